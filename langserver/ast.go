@@ -5,6 +5,7 @@ import (
 	"go/ast"
 	"go/token"
 	"go/types"
+	"unicode/utf8"
 
 	"github.com/sourcegraph/go-langserver/pkg/lsp"
 	"golang.org/x/tools/go/loader"
@@ -12,40 +13,49 @@ import (
 	"github.com/sourcegraph/go-langserver/langserver/util"
 )
 
-func offsetForPosition(contents []byte, p lsp.Position) (offset int, valid bool, whyInvalid string) {
+// offsetForPosition returns the byte offset of the position p in
+// contents, whose character counts the units of enc on its line. A
+// character in the middle of a rune, as the second UTF-16 code unit of an
+// emoji is, is invalid.
+func offsetForPosition(contents []byte, p lsp.Position, enc lsp.PositionEncodingKind) (offset int, valid bool, whyInvalid string) {
 	line := 0
 	col := 0
-	// TODO(sqs): count chars, not bytes, per LSP. does that mean we
-	// need to maintain 2 separate counters since we still need to
-	// return the offset as bytes?
-	for _, b := range contents {
+	for offset < len(contents) {
 		if line == p.Line && col == p.Character {
 			return offset, true, ""
 		}
-		if (line == p.Line && col > p.Character) || line > p.Line {
+		if line == p.Line && col > p.Character {
+			return 0, false, fmt.Sprintf("character %d is in the middle of a character on line %d", p.Character, p.Line)
+		}
+		r, size := utf8.DecodeRune(contents[offset:])
+		if r == '\n' && line == p.Line {
 			return 0, false, fmt.Sprintf("character %d is beyond line %d boundary", p.Character, p.Line)
 		}
-		offset++
-		if b == '\n' {
+		offset += size
+		if r == '\n' {
 			line++
 			col = 0
 		} else {
-			col++
+			col += characterWidth(r, size, enc)
 		}
 	}
+	if line == p.Line && col == p.Character {
+		// The position at the very end of the file.
+		return offset, true, ""
+	}
+	if line == p.Line && col > p.Character {
+		return 0, false, fmt.Sprintf("character %d is in the middle of a character on line %d", p.Character, p.Line)
+	}
 	if line == 0 {
 		return 0, false, fmt.Sprintf("character %d is beyond first line boundary", p.Character)
 	}
 	return 0, false, fmt.Sprintf("file only has %d lines", line+1)
 }
 
-func rangeForNode(fset *token.FileSet, node ast.Node) lsp.Range {
-	start := fset.Position(node.Pos())
-	end := fset.Position(node.End()) // node.End is exclusive, and so is the LSP spec
-	return lsp.Range{
-		Start: lsp.Position{Line: start.Line - 1, Character: start.Column - 1},
-		End:   lsp.Position{Line: end.Line - 1, Character: end.Column - 1},
-	}
+// rangeForNode returns the range of node, counted by conv.
+func rangeForNode(conv *positionConverter, fset *token.FileSet, node ast.Node) lsp.Range {
+	// node.End is exclusive, and so is the LSP spec.
+	return lsp.Range{Start: conv.position(fset.Position(node.Pos())), End: conv.position(fset.Position(node.End()))}
 }
 
 type fakeNode struct{ p, e token.Pos }
@@ -53,20 +63,20 @@ type fakeNode struct{ p, e token.Pos }
 func (n fakeNode) Pos() token.Pos { return n.p }
 func (n fakeNode) End() token.Pos { return n.e }
 
-func goRangesToLSPLocations(fset *token.FileSet, nodes []*ast.Ident) []lsp.Location {
+func goRangesToLSPLocations(conv *positionConverter, fset *token.FileSet, nodes []*ast.Ident) []lsp.Location {
 	locs := make([]lsp.Location, len(nodes))
 	for i, node := range nodes {
-		locs[i] = goRangeToLSPLocation(fset, node.Pos(), node.End())
+		locs[i] = goRangeToLSPLocation(conv, fset, node.Pos(), node.End())
 	}
 	return locs
 }
 
-// goRangeToLSPLocation converts a token.Pos range into a lsp.Location. end is
-// exclusive.
-func goRangeToLSPLocation(fset *token.FileSet, pos token.Pos, end token.Pos) lsp.Location {
+// goRangeToLSPLocation converts a token.Pos range into a lsp.Location,
+// counted by conv. end is exclusive.
+func goRangeToLSPLocation(conv *positionConverter, fset *token.FileSet, pos token.Pos, end token.Pos) lsp.Location {
 	return lsp.Location{
 		URI:   util.PathToURI(fset.Position(pos).Filename),
-		Range: rangeForNode(fset, fakeNode{p: pos, e: end}),
+		Range: rangeForNode(conv, fset, fakeNode{p: pos, e: end}),
 	}
 
 }
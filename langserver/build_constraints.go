@@ -0,0 +1,149 @@
+package langserver
+
+import (
+	"bytes"
+	"go/build"
+	"go/build/constraint"
+	"io"
+	"io/ioutil"
+	"path"
+	"strings"
+)
+
+// maxConstraintTags bounds the tags of a file's build constraints which
+// excludedFileContext tries to satisfy, as it tries all their subsets.
+const maxConstraintTags = 6
+
+// knownOS and knownArch are the values of GOOS and GOARCH which go/build
+// knows of, as in the go tool's syslist.
+var (
+	knownOS   = strings.Fields("aix android darwin dragonfly freebsd hurd illumos ios js linux nacl netbsd openbsd plan9 solaris wasip1 windows zos")
+	knownArch = strings.Fields("386 amd64 amd64p32 arm armbe arm64 arm64be loong64 mips mipsle mips64 mips64le mips64p32 mips64p32le ppc ppc64 ppc64le riscv riscv64 s390 s390x sparc sparc64 wasm")
+)
+
+// excludedFileContext returns a copy of bctx under which the file
+// filename is built, if the build tags, GOOS or GOARCH of bctx exclude
+// it, so that a platform specific file, such as a _windows.go one on
+// Linux, can be typechecked with the rest of its package. The contexts
+// tried set GOOS and GOARCH to the ones the file name or its constraints
+// mention, and add the tags of its constraints, changing as little of
+// bctx as they can. ok is false if bctx doesn't exclude the file, or if
+// no context tried includes it.
+func excludedFileContext(bctx *build.Context, filename string) (alt *build.Context, ok bool) {
+	dir, name := path.Dir(filename), path.Base(filename)
+	contents, err := readFile(bctx, filename)
+	if err != nil {
+		return nil, false
+	}
+	matches := func(c build.Context) bool {
+		// MatchFile only opens the file it matches.
+		c.OpenFile = func(string) (io.ReadCloser, error) {
+			return ioutil.NopCloser(bytes.NewReader(contents)), nil
+		}
+		match, err := c.MatchFile(dir, name)
+		return err == nil && match
+	}
+	if matches(*bctx) {
+		return nil, false
+	}
+
+	mentioned := constraintTags(contents)
+	nameTags := fileNameTags(name)
+	gooses := candidateValues(knownOS, bctx.GOOS, nameTags, mentioned, []string{"linux", "darwin", "windows"})
+	goarches := candidateValues(knownArch, bctx.GOARCH, nameTags, mentioned, []string{"amd64", "arm64", "386"})
+	// GOOS and GOARCH values are satisfied by setting them rather than
+	// as tags, so that imported packages are built for them too.
+	var tags []string
+	for _, tag := range mentioned {
+		if !contains(knownOS, tag) && !contains(knownArch, tag) && len(tags) < maxConstraintTags {
+			tags = append(tags, tag)
+		}
+	}
+	for _, goos := range gooses {
+		for _, goarch := range goarches {
+			for subset := 0; subset < 1<<uint(len(tags)); subset++ {
+				c := *bctx
+				c.GOOS, c.GOARCH = goos, goarch
+				c.BuildTags = append([]string{}, bctx.BuildTags...)
+				for i, tag := range tags {
+					if subset&(1<<uint(i)) != 0 {
+						c.BuildTags = append(c.BuildTags, tag)
+					}
+				}
+				if matches(c) {
+					return &c, true
+				}
+			}
+		}
+	}
+	return nil, false
+}
+
+// constraintTags returns the tags the //go:build and // +build lines of
+// the Go file contents mention, in the order they are first mentioned.
+func constraintTags(contents []byte) []string {
+	var tags []string
+	seen := make(map[string]bool)
+	for _, line := range strings.Split(string(contents), "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "package ") {
+			break
+		}
+		if !constraint.IsGoBuild(line) && !constraint.IsPlusBuild(line) {
+			continue
+		}
+		expr, err := constraint.Parse(line)
+		if err != nil {
+			continue
+		}
+		// Eval calls the func for every tag of the expression.
+		expr.Eval(func(tag string) bool {
+			if !seen[tag] {
+				seen[tag] = true
+				tags = append(tags, tag)
+			}
+			return false
+		})
+	}
+	return tags
+}
+
+// fileNameTags returns the elements of the Go file name which may be the
+// GOOS and GOARCH it is constrained to, as in name_$GOOS_$GOARCH.go.
+func fileNameTags(name string) []string {
+	name = strings.TrimSuffix(strings.TrimSuffix(name, ".go"), "_test")
+	l := strings.Split(name, "_")[1:]
+	if len(l) > 2 {
+		l = l[len(l)-2:]
+	}
+	return l
+}
+
+// candidateValues returns current, followed by the strings of lists
+// which are among known, without duplicates.
+func candidateValues(known []string, current string, lists ...[]string) []string {
+	values := []string{current}
+	seen := map[string]bool{current: true}
+	for _, list := range lists {
+		for _, s := range list {
+			if seen[s] {
+				continue
+			}
+			seen[s] = true
+			if contains(known, s) {
+				values = append(values, s)
+			}
+		}
+	}
+	return values
+}
+
+// contains reports whether list contains s.
+func contains(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
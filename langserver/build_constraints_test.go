@@ -0,0 +1,56 @@
+package langserver
+
+import (
+	"reflect"
+	"testing"
+
+	"golang.org/x/tools/go/buildutil"
+)
+
+func TestExcludedFileContext(t *testing.T) {
+	bctx := buildutil.FakeContext(map[string]map[string]string{
+		"p": {
+			"a.go":         "package p",
+			"a_windows.go": "package p",
+			"a_arm64.go":   "package p",
+			"b.go":         "//go:build ignore\n\npackage main",
+			"c.go":         "//go:build !linux && !darwin\n\npackage p",
+			"d.go":         "// +build foo,bar\n\npackage p",
+			"e.go":         "//go:build linux\n\npackage p",
+			"f.go":         "//go:build windows && cgo\n\npackage p",
+		},
+	})
+	bctx.GOOS, bctx.GOARCH, bctx.BuildTags, bctx.CgoEnabled = "linux", "amd64", []string{"x"}, false
+
+	tests := []struct {
+		name         string
+		ok           bool
+		goos, goarch string
+		buildTags    []string
+	}{
+		{"a.go", false, "", "", nil},
+		{"e.go", false, "", "", nil},
+		{"a_windows.go", true, "windows", "amd64", []string{"x"}},
+		{"a_arm64.go", true, "linux", "arm64", []string{"x"}},
+		{"b.go", true, "linux", "amd64", []string{"x", "ignore"}},
+		{"c.go", true, "windows", "amd64", []string{"x"}},
+		{"d.go", true, "linux", "amd64", []string{"x", "foo", "bar"}},
+		{"f.go", true, "windows", "amd64", []string{"x", "cgo"}},
+	}
+	for _, test := range tests {
+		alt, ok := excludedFileContext(bctx, "/go/src/p/"+test.name)
+		if ok != test.ok {
+			t.Errorf("%s: got ok %v, want %v", test.name, ok, test.ok)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if alt.GOOS != test.goos || alt.GOARCH != test.goarch || !reflect.DeepEqual(alt.BuildTags, test.buildTags) {
+			t.Errorf("%s: got GOOS=%s GOARCH=%s tags %v, want GOOS=%s GOARCH=%s tags %v", test.name, alt.GOOS, alt.GOARCH, alt.BuildTags, test.goos, test.goarch, test.buildTags)
+		}
+	}
+	if !reflect.DeepEqual(bctx.BuildTags, []string{"x"}) {
+		t.Errorf("the build context's tags changed to %v", bctx.BuildTags)
+	}
+}
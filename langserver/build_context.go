@@ -3,6 +3,7 @@ package langserver
 import (
 	"fmt"
 	"go/build"
+	"os"
 	"path"
 	"path/filepath"
 	"strings"
@@ -37,6 +38,8 @@ func (h *LangHandler) BuildContext(ctx context.Context) *build.Context {
 		copy := build.Default
 		bctx = &copy
 	}
+	bctx.BuildTags = h.buildTags(bctx.BuildTags)
+	h.applyGoEnv(bctx)
 
 	h.Mu.Lock()
 	fs := h.FS
@@ -46,6 +49,63 @@ func (h *LangHandler) BuildContext(ctx context.Context) *build.Context {
 	return bctx
 }
 
+// godefBuildContext returns the build.Context used by godef. godef reads
+// the OS file system directly, so this is build.Default with our build tags
+// and Config.GOROOT and Config.GOPATH.
+func (h *LangHandler) godefBuildContext() *build.Context {
+	bctx := build.Default
+	bctx.BuildTags = h.buildTags(bctx.BuildTags)
+	h.applyGoEnv(&bctx)
+	return &bctx
+}
+
+// applyGoEnv sets the GOROOT and GOPATH of bctx to Config.GOROOT and
+// Config.GOPATH, which take precedence over the client's build context
+// and the environment, if they are set.
+func (h *LangHandler) applyGoEnv(bctx *build.Context) {
+	cfg := h.config()
+	if cfg.GOROOT != "" {
+		bctx.GOROOT = cfg.GOROOT
+	}
+	if cfg.GOPATH != "" {
+		bctx.GOPATH = cfg.GOPATH
+	}
+}
+
+// validateGoEnv returns an error if Config.GOROOT or Config.GOPATH is set
+// but doesn't name a usable directory. GOROOT must contain the standard
+// library's sources, and each GOPATH entry must be an absolute path of
+// an existing directory.
+func validateGoEnv(cfg Config) error {
+	if cfg.GOROOT != "" {
+		if !filepath.IsAbs(cfg.GOROOT) {
+			return fmt.Errorf("configured GOROOT must be an absolute path (GOROOT=%q)", cfg.GOROOT)
+		}
+		if fi, err := os.Stat(filepath.Join(cfg.GOROOT, "src")); err != nil || !fi.IsDir() {
+			return fmt.Errorf("configured GOROOT is not a Go installation: %s has no src directory", cfg.GOROOT)
+		}
+	}
+	for _, dir := range filepath.SplitList(cfg.GOPATH) {
+		if !filepath.IsAbs(dir) {
+			return fmt.Errorf("configured GOPATH entries must be absolute paths (GOPATH=%q)", cfg.GOPATH)
+		}
+		if fi, err := os.Stat(dir); err != nil || !fi.IsDir() {
+			return fmt.Errorf("configured GOPATH entry %s is not a directory", dir)
+		}
+	}
+	return nil
+}
+
+// buildTags returns tags with Config.BuildTags appended. tags is not
+// modified.
+func (h *LangHandler) buildTags(tags []string) []string {
+	extra := h.config().BuildTags
+	if len(extra) == 0 {
+		return tags
+	}
+	return append(append([]string{}, tags...), extra...)
+}
+
 // ContainingPackage returns the package that contains the given
 // filename. It is like buildutil.ContainingPackage, except that:
 //
@@ -56,6 +116,12 @@ func (h *LangHandler) BuildContext(ctx context.Context) *build.Context {
 // * if the file is in the xtest package (package p_test not package p),
 //   it returns build.Package only representing that xtest package
 func ContainingPackage(bctx *build.Context, filename string) (*build.Package, error) {
+	return containingPackage(bctx, filename, nil)
+}
+
+// containingPackage is ContainingPackage, except that files in mod are
+// given import paths in mod instead of GOPATH.
+func containingPackage(bctx *build.Context, filename string, mod *goModule) (*build.Package, error) {
 	gopaths := buildutil.SplitPathList(bctx, bctx.GOPATH) // list will be empty with no GOPATH
 	for _, gopath := range gopaths {
 		if !buildutil.IsAbsPath(bctx, gopath) {
@@ -67,22 +133,33 @@ func ContainingPackage(bctx *build.Context, filename string) (*build.Package, er
 	if !bctx.IsDir(filename) {
 		pkgDir = path.Dir(filename)
 	}
-	var srcDir string
-	if util.PathHasPrefix(filename, bctx.GOROOT) {
-		srcDir = bctx.GOROOT // if workspace is Go stdlib
+	var (
+		pkg *build.Package
+		err error
+	)
+	if importPath := mod.importPathForDir(pkgDir); importPath != "" {
+		pkg, err = bctx.ImportDir(pkgDir, 0)
+		if pkg != nil {
+			pkg.ImportPath = importPath
+		}
 	} else {
-		srcDir = "" // with no GOPATH, only stdlib will work
-		for _, gopath := range gopaths {
-			if util.PathHasPrefix(pkgDir, gopath) {
-				srcDir = gopath
-				break
+		var srcDir string
+		if util.PathHasPrefix(filename, bctx.GOROOT) {
+			srcDir = bctx.GOROOT // if workspace is Go stdlib
+		} else {
+			srcDir = "" // with no GOPATH, only stdlib will work
+			for _, gopath := range gopaths {
+				if util.PathHasPrefix(pkgDir, gopath) {
+					srcDir = gopath
+					break
+				}
 			}
 		}
+		srcDir = path.Join(filepath.ToSlash(srcDir), "src")
+		importPath := util.PathTrimPrefix(pkgDir, srcDir)
+		pkg, err = bctx.Import(importPath, pkgDir, 0)
 	}
-	srcDir = path.Join(filepath.ToSlash(srcDir), "src")
-	importPath := util.PathTrimPrefix(pkgDir, srcDir)
 	var xtest bool
-	pkg, err := bctx.Import(importPath, pkgDir, 0)
 	if pkg != nil {
 		base := path.Base(filename)
 		for _, f := range pkg.XTestGoFiles {
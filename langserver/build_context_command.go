@@ -0,0 +1,23 @@
+package langserver
+
+import "context"
+
+// commandBuildContext is the workspace/executeCommand command whose
+// result is the BuildContextInfo, for finding out why an import doesn't
+// resolve.
+const commandBuildContext = "langserver.buildContext"
+
+// buildContextInfo returns the fields of the build context requests use,
+// with the client's overrides, Config.BuildTags, Config.GOROOT and
+// Config.GOPATH applied.
+func (h *LangHandler) buildContextInfo(ctx context.Context) BuildContextInfo {
+	bctx := h.BuildContext(ctx)
+	return BuildContextInfo{
+		GOROOT:     bctx.GOROOT,
+		GOPATH:     bctx.GOPATH,
+		GOOS:       bctx.GOOS,
+		GOARCH:     bctx.GOARCH,
+		BuildTags:  append([]string{}, bctx.BuildTags...),
+		CgoEnabled: bctx.CgoEnabled,
+	}
+}
@@ -1,6 +1,12 @@
 package langserver
 
 import (
+	"context"
+	"go/build"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"golang.org/x/tools/go/buildutil"
@@ -29,3 +35,59 @@ func TestContainingPackage(t *testing.T) {
 		}
 	}
 }
+
+func TestGoEnvOverride(t *testing.T) {
+	h := &LangHandler{Config: NewDefaultConfig(), HandlerShared: &HandlerShared{}}
+	h.init = &InitializeParams{BuildContext: &InitializeBuildContextParams{GOROOT: "/client/goroot", GOPATH: "/client/gopath"}}
+	check := func(name string, bctx *build.Context, wantGOROOT, wantGOPATH string) {
+		t.Helper()
+		if bctx.GOROOT != wantGOROOT || bctx.GOPATH != wantGOPATH {
+			t.Errorf("%s: got GOROOT=%q GOPATH=%q, want GOROOT=%q GOPATH=%q", name, bctx.GOROOT, bctx.GOPATH, wantGOROOT, wantGOPATH)
+		}
+	}
+	check("client", h.BuildContext(context.Background()), "/client/goroot", "/client/gopath")
+
+	h.Config.GOROOT = "/config/goroot"
+	h.Config.GOPATH = "/config/gopath"
+	check("configured", h.BuildContext(context.Background()), "/config/goroot", "/config/gopath")
+	check("configured godef", h.godefBuildContext(), "/config/goroot", "/config/gopath")
+
+	h.init.BuildContext = nil
+	check("configured without client", h.BuildContext(context.Background()), "/config/goroot", "/config/gopath")
+}
+
+func TestValidateGoEnv(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "validate-go-env")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	goroot := filepath.Join(tmp, "goroot")
+	gopath := filepath.Join(tmp, "gopath")
+	for _, dir := range []string{filepath.Join(goroot, "src"), gopath} {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		goroot, gopath string
+		wantErr        string // empty if the configuration is valid
+	}{
+		{},
+		{goroot: goroot, gopath: gopath + string(filepath.ListSeparator) + goroot},
+		{goroot: "goroot", wantErr: "must be an absolute path"},
+		{goroot: gopath, wantErr: "is not a Go installation"},
+		{gopath: "gopath", wantErr: "must be absolute paths"},
+		{gopath: gopath + string(filepath.ListSeparator) + filepath.Join(tmp, "missing"), wantErr: "is not a directory"},
+	}
+	for _, test := range tests {
+		err := validateGoEnv(Config{GOROOT: test.goroot, GOPATH: test.gopath})
+		switch {
+		case test.wantErr == "" && err != nil:
+			t.Errorf("GOROOT=%q GOPATH=%q: got error %q, want none", test.goroot, test.gopath, err)
+		case test.wantErr != "" && (err == nil || !strings.Contains(err.Error(), test.wantErr)):
+			t.Errorf("GOROOT=%q GOPATH=%q: got error %v, want it to contain %q", test.goroot, test.gopath, err, test.wantErr)
+		}
+	}
+}
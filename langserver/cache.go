@@ -1,10 +1,12 @@
 package langserver
 
 import (
+	"context"
 	"os"
 	"strconv"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	lru "github.com/hashicorp/golang-lru"
 	"github.com/prometheus/client_golang/prometheus"
@@ -19,6 +21,10 @@ var (
 	// not directly use this, instead use newSymbolCache()
 	symbolCache = newLRU("SRC_SYMBOL_CACHE_SIZE", 500)
 
+	// godefCache is a process level cache for storing the files parsed
+	// by godef. Do not directly use this, instead use newGodefCache()
+	godefCache = newLRU("SRC_GODEF_CACHE_SIZE", 20)
+
 	// cacheID is used to prevent key conflicts between different
 	// LangHandlers in the same process.
 	cacheID int64
@@ -47,6 +53,18 @@ var (
 		Name:      "cache_request_total",
 		Help:      "Count of requests to cache.",
 	}, []string{"type"})
+	godefCacheSize = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "golangserver",
+		Subsystem: "godef",
+		Name:      "cache_size",
+		Help:      "Number of items in the godef cache",
+	})
+	godefCacheTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "golangserver",
+		Subsystem: "godef",
+		Name:      "cache_request_total",
+		Help:      "Count of requests to cache.",
+	}, []string{"type"})
 )
 
 func init() {
@@ -54,17 +72,44 @@ func init() {
 	prometheus.MustRegister(typecheckCacheTotal)
 	prometheus.MustRegister(symbolCacheSize)
 	prometheus.MustRegister(symbolCacheTotal)
+	prometheus.MustRegister(godefCacheSize)
+	prometheus.MustRegister(godefCacheTotal)
 }
 
 type cache interface {
 	Get(key interface{}, fill func() interface{}) interface{}
 	Purge()
+	// RemoveIf removes the values for which remove returns true. Values
+	// which are still being filled are always removed.
+	RemoveIf(remove func(value interface{}) bool)
+	// Remove removes the value for key, even if it is still being
+	// filled. Those waiting for it are still given it once it's ready.
+	Remove(key interface{})
+	// RemoveIdle removes the values which were last gotten before t.
+	// Values which are still being filled are kept.
+	RemoveIdle(t time.Time)
+	// Len returns the number of values in the cache, including those
+	// still being filled.
+	Len() int
+	// Keys returns the keys of the values in the cache, including those
+	// still being filled.
+	Keys() []interface{}
 }
 
-func newTypecheckCache() *boundedCache {
+// newTypecheckCache returns a cache backed by the process level typecheck
+// cache, or by its own LRU holding at most size packages if size > 0.
+func newTypecheckCache(size int) *boundedCache {
+	c := typecheckCache
+	if size > 0 {
+		var err error
+		if c, err = lru.New(size); err != nil {
+			// This should never happen since size > 0
+			panic(err)
+		}
+	}
 	return &boundedCache{
 		id:      nextCacheID(),
-		c:       typecheckCache,
+		c:       c,
 		size:    typecheckCacheSize,
 		counter: typecheckCacheTotal,
 	}
@@ -79,14 +124,24 @@ func newSymbolCache() *boundedCache {
 	}
 }
 
+func newGodefCache() *boundedCache {
+	return &boundedCache{
+		id:      nextCacheID(),
+		c:       godefCache,
+		size:    godefCacheSize,
+		counter: godefCacheTotal,
+	}
+}
+
 type cacheKey struct {
 	id int64
 	k  interface{}
 }
 
 type cacheValue struct {
-	ready chan struct{} // closed to broadcast readiness
-	value interface{}
+	ready    chan struct{} // closed to broadcast readiness
+	value    interface{}
+	lastUsed int64 // UnixNano of the last Get, accessed atomically
 }
 
 type boundedCache struct {
@@ -108,6 +163,7 @@ func (c *boundedCache) Get(k interface{}, fill func() interface{}) interface{} {
 		c.mu.Unlock()
 		c.counter.WithLabelValues("hit").Inc()
 		v = vi.(*cacheValue)
+		atomic.StoreInt64(&v.lastUsed, time.Now().UnixNano())
 		<-v.ready
 	} else {
 		// cache miss. Add unready result to cache and fill
@@ -119,6 +175,9 @@ func (c *boundedCache) Get(k interface{}, fill func() interface{}) interface{} {
 
 		defer close(v.ready)
 		v.value = fill()
+		// Filling may take a while, so the value is idle from once
+		// it is ready.
+		atomic.StoreInt64(&v.lastUsed, time.Now().UnixNano())
 	}
 
 	return v.value
@@ -138,6 +197,85 @@ func (c *boundedCache) Purge() {
 	c.mu.Unlock()
 }
 
+func (c *boundedCache) RemoveIf(remove func(value interface{}) bool) {
+	c.mu.Lock()
+	for _, key := range c.c.Keys() {
+		if k := key.(cacheKey); k.id != c.id {
+			continue
+		}
+		vi, ok := c.c.Peek(key)
+		if !ok {
+			continue
+		}
+		v := vi.(*cacheValue)
+		select {
+		case <-v.ready:
+			if !remove(v.value) {
+				continue
+			}
+		default:
+			// Still being filled, possibly from contents which
+			// are now out of date.
+		}
+		c.c.Remove(key)
+	}
+	c.mu.Unlock()
+}
+
+func (c *boundedCache) RemoveIdle(t time.Time) {
+	c.mu.Lock()
+	for _, key := range c.c.Keys() {
+		if k := key.(cacheKey); k.id != c.id {
+			continue
+		}
+		vi, ok := c.c.Peek(key)
+		if !ok {
+			continue
+		}
+		v := vi.(*cacheValue)
+		select {
+		case <-v.ready:
+			if atomic.LoadInt64(&v.lastUsed) < t.UnixNano() {
+				c.c.Remove(key)
+			}
+		default:
+		}
+	}
+	c.mu.Unlock()
+	c.size.Set(float64(c.c.Len()))
+}
+
+func (c *boundedCache) Remove(k interface{}) {
+	c.mu.Lock()
+	c.c.Remove(cacheKey{c.id, k})
+	c.mu.Unlock()
+	c.size.Set(float64(c.c.Len()))
+}
+
+func (c *boundedCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := 0
+	for _, key := range c.c.Keys() {
+		if k := key.(cacheKey); k.id == c.id {
+			n++
+		}
+	}
+	return n
+}
+
+func (c *boundedCache) Keys() []interface{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var keys []interface{}
+	for _, key := range c.c.Keys() {
+		if k := key.(cacheKey); k.id == c.id {
+			keys = append(keys, k.k)
+		}
+	}
+	return keys
+}
+
 // newLRU returns an LRU based cache.
 func newLRU(env string, defaultSize int) *lru.Cache {
 	size := defaultSize
@@ -155,3 +293,41 @@ func newLRU(env string, defaultSize int) *lru.Cache {
 func nextCacheID() int64 {
 	return atomic.AddInt64(&cacheID, 1)
 }
+
+// cacheSweepInterval is how often startCacheSweeper evicts the idle
+// packages.
+const cacheSweepInterval = time.Minute
+
+// startCacheSweeper evicts the typechecked packages which have been idle
+// for longer than Config.PackageCacheTTL in the background, every
+// cacheSweepInterval. It is stopped by stopBackground.
+func (h *LangHandler) startCacheSweeper() {
+	if h.config().PackageCacheTTL <= 0 {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	h.mu.Lock()
+	h.backgroundCancels = append(h.backgroundCancels, cancel)
+	h.mu.Unlock()
+	go func() {
+		tick := time.NewTicker(cacheSweepInterval)
+		defer tick.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-tick.C:
+				h.sweepCaches(now)
+			}
+		}
+	}()
+}
+
+// sweepCaches evicts the typechecked packages which were last used longer
+// than Config.PackageCacheTTL before now.
+func (h *LangHandler) sweepCaches(now time.Time) {
+	h.mu.Lock()
+	typecheckCache := h.typecheckCache
+	h.mu.Unlock()
+	typecheckCache.RemoveIdle(now.Add(-h.config().PackageCacheTTL))
+}
@@ -0,0 +1,115 @@
+package langserver
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBoundedCacheRemoveIf(t *testing.T) {
+	c := newTypecheckCache(10)
+	fills := 0
+	get := func(k int) interface{} {
+		return c.Get(k, func() interface{} {
+			fills++
+			return k
+		})
+	}
+	for k := 1; k <= 3; k++ {
+		get(k)
+	}
+	c.RemoveIf(func(v interface{}) bool { return v == 2 })
+	for k := 1; k <= 3; k++ {
+		if got := get(k); got != k {
+			t.Errorf("got %v for key %d", got, k)
+		}
+	}
+	if fills != 4 {
+		t.Errorf("got %d fills, want 4 (only the removed key refilled)", fills)
+	}
+}
+
+func TestBoundedCacheRemoveIdle(t *testing.T) {
+	c := newTypecheckCache(10)
+	fills := 0
+	get := func(k int) interface{} {
+		return c.Get(k, func() interface{} {
+			fills++
+			return k
+		})
+	}
+	get(1)
+	get(2)
+	time.Sleep(time.Millisecond)
+	idleSince := time.Now()
+	time.Sleep(time.Millisecond)
+	get(1) // refreshes 1
+	c.RemoveIdle(idleSince)
+	if n := c.Len(); n != 1 {
+		t.Errorf("got %d values, want 1 (2 evicted)", n)
+	}
+	get(1)
+	get(2)
+	if fills != 3 {
+		t.Errorf("got %d fills, want 3 (only the idle key refilled)", fills)
+	}
+}
+
+func TestBoundedCacheRemoveWhileFilling(t *testing.T) {
+	c := newTypecheckCache(10)
+	fills := 0
+	for i := 0; i < 2; i++ {
+		got := c.Get("k", func() interface{} {
+			fills++
+			c.Remove("k")
+			return "v"
+		})
+		if got != "v" {
+			t.Errorf("got %v, want v", got)
+		}
+	}
+	if fills != 2 {
+		t.Errorf("got %d fills, want 2 (the value was removed while filling)", fills)
+	}
+}
+
+func TestBoundedCacheSize(t *testing.T) {
+	c := newTypecheckCache(2)
+	var fills int
+	for _, k := range []int{1, 2, 3, 1} {
+		c.Get(k, func() interface{} {
+			fills++
+			return k
+		})
+	}
+	if fills != 4 {
+		t.Errorf("got %d fills, want 4 (key 1 evicted)", fills)
+	}
+}
+
+func TestBoundedCacheConcurrentFill(t *testing.T) {
+	c := newTypecheckCache(10)
+	var fills int32
+	release := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v := c.Get("k", func() interface{} {
+				atomic.AddInt32(&fills, 1)
+				<-release
+				return "v"
+			})
+			if v != "v" {
+				t.Errorf("got %v, want v", v)
+			}
+		}()
+	}
+	close(release)
+	wg.Wait()
+	if fills != 1 {
+		t.Errorf("got %d fills, want 1", fills)
+	}
+}
@@ -0,0 +1,343 @@
+package langserver
+
+import (
+	"context"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/token"
+	"go/types"
+	"path"
+	"sort"
+	"strings"
+
+	"golang.org/x/tools/go/ast/astutil"
+	"golang.org/x/tools/go/buildutil"
+	"golang.org/x/tools/go/loader"
+
+	"github.com/sourcegraph/go-langserver/langserver/util"
+	"github.com/sourcegraph/go-langserver/pkg/lsp"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+func (h *LangHandler) handleTextDocumentPrepareCallHierarchy(ctx context.Context, conn jsonrpc2.JSONRPC2, req *jsonrpc2.Request, params lsp.CallHierarchyPrepareParams) ([]lsp.CallHierarchyItem, error) {
+	if !util.IsURI(params.TextDocument.URI) {
+		return nil, &jsonrpc2.Error{
+			Code:    jsonrpc2.CodeInvalidParams,
+			Message: fmt.Sprintf("%s not yet supported for out-of-workspace URI (%q)", req.Method, params.TextDocument.URI),
+		}
+	}
+
+	fset, _, fn, err := h.callHierarchyTarget(ctx, conn, params.TextDocument.URI, params.Position)
+	if err != nil {
+		return nil, err
+	}
+	if fn == nil {
+		return []lsp.CallHierarchyItem{}, nil
+	}
+	item, ok := newDeclFiles(h.BuildContext(ctx), h.positionConverter(ctx)).item(fset.Position(fn.Pos()))
+	if !ok {
+		return []lsp.CallHierarchyItem{}, nil
+	}
+	return []lsp.CallHierarchyItem{item}, nil
+}
+
+func (h *LangHandler) handleCallHierarchyIncomingCalls(ctx context.Context, conn jsonrpc2.JSONRPC2, req *jsonrpc2.Request, params lsp.CallHierarchyIncomingCallsParams) ([]lsp.CallHierarchyIncomingCall, error) {
+	if !util.IsURI(params.Item.URI) {
+		return nil, &jsonrpc2.Error{
+			Code:    jsonrpc2.CodeInvalidParams,
+			Message: fmt.Sprintf("%s not yet supported for out-of-workspace URI (%q)", req.Method, params.Item.URI),
+		}
+	}
+
+	// Begin computing the reverse import graph immediately, as this
+	// occurs in the background and is IO-bound.
+	reverseImportGraphC := h.reverseImportGraph(ctx, conn)
+
+	calls := []lsp.CallHierarchyIncomingCall{}
+	fset, _, fn, err := h.callHierarchyTarget(ctx, conn, params.Item.URI, params.Item.SelectionRange.Start)
+	if err != nil {
+		return nil, err
+	}
+	if fn == nil {
+		return calls, nil
+	}
+
+	refs := make(chan *ast.Ident)
+	errC := make(chan error, 1)
+	go func() {
+		errC <- h.findWorkspaceReferences(ctx, fset, fn, reverseImportGraphC, false, refs)
+		close(refs)
+	}()
+
+	// The references are found in the type checked workspace packages.
+	// Whether each one is a call, and which function it is made in, is
+	// read from the syntax of its file.
+	decls := newDeclFiles(h.BuildContext(ctx), h.positionConverter(ctx))
+	seen := make(map[token.Position]bool)
+	callers := make(map[token.Position]int) // index in calls, by the position of the caller's name
+	for id := range refs {
+		pos := fset.Position(id.Pos())
+		if seen[pos] {
+			continue
+		}
+		seen[pos] = true
+		path := decls.pathAt(pos)
+		if !isCall(path) {
+			continue
+		}
+		decl := enclosingFuncDecl(path)
+		if decl == nil {
+			// Calls made while initializing package-level variables
+			// have no caller to report.
+			continue
+		}
+		namePos := decls.fset.Position(decl.Name.Pos())
+		i, ok := callers[namePos]
+		if !ok {
+			item, ok := decls.item(namePos)
+			if !ok {
+				continue
+			}
+			i = len(calls)
+			callers[namePos] = i
+			calls = append(calls, lsp.CallHierarchyIncomingCall{From: item})
+		}
+		calls[i].FromRanges = append(calls[i].FromRanges, rangeForNode(decls.conv, decls.fset, path[0]))
+	}
+	if err := <-errC; err != nil {
+		return nil, err
+	}
+
+	// References are found concurrently, so sort them to give the same
+	// result for each request.
+	sort.Slice(calls, func(i, j int) bool {
+		return locationLess(lsp.Location{URI: calls[i].From.URI, Range: calls[i].From.Range}, lsp.Location{URI: calls[j].From.URI, Range: calls[j].From.Range})
+	})
+	for _, c := range calls {
+		sortRanges(c.FromRanges)
+	}
+	return calls, nil
+}
+
+func (h *LangHandler) handleCallHierarchyOutgoingCalls(ctx context.Context, conn jsonrpc2.JSONRPC2, req *jsonrpc2.Request, params lsp.CallHierarchyOutgoingCallsParams) ([]lsp.CallHierarchyOutgoingCall, error) {
+	if !util.IsURI(params.Item.URI) {
+		return nil, &jsonrpc2.Error{
+			Code:    jsonrpc2.CodeInvalidParams,
+			Message: fmt.Sprintf("%s not yet supported for out-of-workspace URI (%q)", req.Method, params.Item.URI),
+		}
+	}
+
+	calls := []lsp.CallHierarchyOutgoingCall{}
+	fset, pkg, fn, err := h.callHierarchyTarget(ctx, conn, params.Item.URI, params.Item.SelectionRange.Start)
+	if err != nil {
+		return nil, err
+	}
+	if fn == nil {
+		return calls, nil
+	}
+	var decl *ast.FuncDecl
+	for _, f := range pkg.Files {
+		for _, d := range f.Decls {
+			if d, ok := d.(*ast.FuncDecl); ok && d.Name.Pos() == fn.Pos() {
+				decl = d
+			}
+		}
+	}
+	if decl == nil || decl.Body == nil {
+		return calls, nil
+	}
+
+	decls := newDeclFiles(h.BuildContext(ctx), h.positionConverter(ctx))
+	callees := make(map[*types.Func]int) // index in calls
+	ast.Inspect(decl.Body, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		id := calleeIdent(call.Fun)
+		if id == nil {
+			return true
+		}
+		// Builtins, conversions and calls of function values are left
+		// out, as they have no declaration to show.
+		callee, ok := pkg.Uses[id].(*types.Func)
+		if !ok || !callee.Pos().IsValid() {
+			return true
+		}
+		i, ok := callees[callee]
+		if !ok {
+			item, ok := decls.item(fset.Position(callee.Pos()))
+			if !ok {
+				return true
+			}
+			i = len(calls)
+			callees[callee] = i
+			calls = append(calls, lsp.CallHierarchyOutgoingCall{To: item})
+		}
+		calls[i].FromRanges = append(calls[i].FromRanges, rangeForNode(decls.conv, fset, id))
+		return true
+	})
+	return calls, nil
+}
+
+// callHierarchyTarget returns the function or method named at position in
+// uri, along with the package it is used in. fn is nil if there is none.
+func (h *LangHandler) callHierarchyTarget(ctx context.Context, conn jsonrpc2.JSONRPC2, uri lsp.DocumentURI, position lsp.Position) (fset *token.FileSet, pkg *loader.PackageInfo, fn *types.Func, err error) {
+	fset, node, _, _, pkg, _, err := h.typecheck(ctx, conn, uri, position)
+	if err != nil {
+		// Invalid nodes means we tried to click on something which is
+		// not an ident (eg comment/string/etc). Return no information.
+		if _, ok := err.(*invalidNodeError); ok {
+			return nil, nil, nil, nil
+		}
+		return nil, nil, nil, err
+	}
+	fn, ok := pkg.ObjectOf(node).(*types.Func)
+	if !ok || !fn.Pos().IsValid() {
+		return nil, nil, nil, nil
+	}
+	return fset, pkg, fn, nil
+}
+
+// calleeIdent returns the identifier naming the function called by a call
+// expression whose Fun is fun, such as F in "F()" or "x.F()". It returns
+// nil if fun isn't an identifier or a selector.
+func calleeIdent(fun ast.Expr) *ast.Ident {
+	switch fun := astutil.Unparen(fun).(type) {
+	case *ast.Ident:
+		return fun
+	case *ast.SelectorExpr:
+		return fun.Sel
+	}
+	return nil
+}
+
+// isCall reports whether the identifier path[0] names the function called
+// by a call expression. path is as returned by PathEnclosingInterval.
+func isCall(path []ast.Node) bool {
+	if len(path) == 0 {
+		return false
+	}
+	for _, n := range path[1:] {
+		switch n := n.(type) {
+		case *ast.SelectorExpr, *ast.ParenExpr:
+			continue
+		case *ast.CallExpr:
+			return calleeIdent(n.Fun) == path[0]
+		}
+		return false
+	}
+	return false
+}
+
+// enclosingFuncDecl returns the innermost function declaration in path, or
+// nil if there is none. Calls made in function literals are attributed to
+// the function declaring them.
+func enclosingFuncDecl(path []ast.Node) *ast.FuncDecl {
+	for _, n := range path {
+		if decl, ok := n.(*ast.FuncDecl); ok {
+			return decl
+		}
+	}
+	return nil
+}
+
+// sortRanges sorts ranges by their start.
+func sortRanges(ranges []lsp.Range) {
+	sort.Slice(ranges, func(i, j int) bool {
+		a, b := ranges[i].Start, ranges[j].Start
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Character < b.Character
+	})
+}
+
+// declFiles parses the files containing the calls and declarations of a
+// call hierarchy request. Each file is parsed once.
+type declFiles struct {
+	bctx  *build.Context
+	conv  *positionConverter // of the ranges of the calls and items
+	fset  *token.FileSet
+	files map[string]*ast.File // nil if the file can't be read
+}
+
+func newDeclFiles(bctx *build.Context, conv *positionConverter) *declFiles {
+	return &declFiles{bctx: bctx, conv: conv, fset: token.NewFileSet(), files: make(map[string]*ast.File)}
+}
+
+// pathAt returns the path from the node at pos to the root of its file, as
+// PathEnclosingInterval does. It returns nil if the file can't be read.
+func (d *declFiles) pathAt(pos token.Position) []ast.Node {
+	f, ok := d.files[pos.Filename]
+	if !ok {
+		// Files with syntax errors are still used, as partial ASTs.
+		f, _ = buildutil.ParseFile(d.fset, d.bctx, nil, path.Dir(pos.Filename), path.Base(pos.Filename), 0)
+		d.files[pos.Filename] = f
+	}
+	if f == nil {
+		return nil
+	}
+	tf := d.fset.File(f.Pos())
+	if pos.Offset > tf.Size() {
+		return nil
+	}
+	p := tf.Pos(pos.Offset)
+	path, _ := astutil.PathEnclosingInterval(f, p, p)
+	return path
+}
+
+// item returns the call hierarchy item of the function, method or
+// interface method whose name is at pos. ok is false if no function is
+// declared there.
+func (d *declFiles) item(pos token.Position) (item lsp.CallHierarchyItem, ok bool) {
+	path := d.pathAt(pos)
+	if len(path) < 2 {
+		return lsp.CallHierarchyItem{}, false
+	}
+	id, ok := path[0].(*ast.Ident)
+	if !ok {
+		return lsp.CallHierarchyItem{}, false
+	}
+	loc := goRangeToLSPLocation(d.conv, d.fset, id.Pos(), id.End())
+	item = lsp.CallHierarchyItem{
+		Name:           id.Name,
+		Kind:           lsp.SKFunction,
+		Detail:         path[len(path)-1].(*ast.File).Name.Name,
+		URI:            loc.URI,
+		SelectionRange: loc.Range,
+	}
+	switch decl := path[1].(type) {
+	case *ast.FuncDecl:
+		if decl.Name != id {
+			return lsp.CallHierarchyItem{}, false
+		}
+		item.Range = rangeForNode(d.conv, d.fset, decl)
+		if decl.Recv != nil && len(decl.Recv.List) == 1 {
+			item.Kind = lsp.SKMethod
+			recv := types.ExprString(decl.Recv.List[0].Type)
+			if strings.HasPrefix(recv, "*") {
+				recv = "(" + recv + ")"
+			}
+			item.Detail += "." + recv
+		}
+	case *ast.Field:
+		// The path of an interface method is its name, field, field
+		// list, interface type and type spec.
+		if len(path) < 5 {
+			return lsp.CallHierarchyItem{}, false
+		}
+		_, isInterface := path[3].(*ast.InterfaceType)
+		spec, isSpec := path[4].(*ast.TypeSpec)
+		if !isInterface || !isSpec {
+			return lsp.CallHierarchyItem{}, false
+		}
+		item.Kind = lsp.SKMethod
+		item.Detail += "." + spec.Name.Name
+		item.Range = rangeForNode(d.conv, d.fset, decl)
+	default:
+		return lsp.CallHierarchyItem{}, false
+	}
+	return item, true
+}
@@ -0,0 +1,360 @@
+package langserver
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/tools/go/ast/astutil"
+	"golang.org/x/tools/go/buildutil"
+
+	"github.com/sourcegraph/go-langserver/langserver/util"
+	"github.com/sourcegraph/go-langserver/pkg/lsp"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+func (h *LangHandler) handleTextDocumentCodeAction(ctx context.Context, conn jsonrpc2.JSONRPC2, req *jsonrpc2.Request, params lsp.CodeActionParams) ([]lsp.CodeAction, error) {
+	if !util.IsURI(params.TextDocument.URI) {
+		return nil, &jsonrpc2.Error{
+			Code:    jsonrpc2.CodeInvalidParams,
+			Message: fmt.Sprintf("%s not yet supported for out-of-workspace URI (%q)", req.Method, params.TextDocument.URI),
+		}
+	}
+
+	actions := []lsp.CodeAction{}
+	if codeActionKindRequested(params.Context.Only, lsp.CAKQuickFix) {
+		fixes, err := h.addImportFixes(ctx, params.TextDocument.URI, params.Context.Diagnostics)
+		if err != nil {
+			return nil, err
+		}
+		actions = append(actions, fixes...)
+		removals, err := h.removeImportFixes(ctx, params.TextDocument.URI, params.Context.Diagnostics)
+		if err != nil {
+			return nil, err
+		}
+		actions = append(actions, removals...)
+		stubs, err := h.implementInterfaceActions(ctx, conn, params.TextDocument.URI, params.Range, params.Context.Diagnostics)
+		if err != nil {
+			return nil, err
+		}
+		actions = append(actions, stubs...)
+	}
+	if codeActionKindRequested(params.Context.Only, lsp.CAKSourceOrganizeImports) {
+		edit, err := h.organizeImports(ctx, params.TextDocument.URI)
+		if err != nil {
+			return nil, err
+		}
+		if edit != nil {
+			actions = append(actions, lsp.CodeAction{
+				Title: "Organize imports",
+				Kind:  lsp.CAKSourceOrganizeImports,
+				Edit:  edit,
+			})
+		}
+	}
+	return actions, nil
+}
+
+// codeActionKindRequested reports whether actions of kind were asked for
+// by only, the kinds in a textDocument/codeAction request. Kinds are
+// hierarchical, so "source" includes "source.organizeImports". If only is
+// empty all kinds are wanted.
+func codeActionKindRequested(only []lsp.CodeActionKind, kind lsp.CodeActionKind) bool {
+	if len(only) == 0 {
+		return true
+	}
+	for _, k := range only {
+		if k == kind || strings.HasPrefix(string(kind), string(k)+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// undeclaredNameRegexp matches the type checker's error for the use of a
+// name which isn't declared, such as a package which isn't imported.
+var undeclaredNameRegexp = regexp.MustCompile(`^(?:undeclared name|undefined): (\w+)$`)
+
+// addImportFixes returns a quick fix for each package which could provide
+// a name that one of diags reports as undeclared in the file uri. The fix
+// imports the package.
+func (h *LangHandler) addImportFixes(ctx context.Context, uri lsp.DocumentURI, diags []lsp.Diagnostic) ([]lsp.CodeAction, error) {
+	var (
+		fixes    []lsp.CodeAction
+		contents []byte
+		from     *build.Package
+		pkgs     []string
+	)
+	filename := h.FilePath(uri)
+	bctx := h.BuildContext(ctx)
+	for _, d := range diags {
+		m := undeclaredNameRegexp.FindStringSubmatch(d.Message)
+		if m == nil {
+			continue
+		}
+		name := m[1]
+		if contents == nil {
+			var err error
+			contents, err = h.readFile(ctx, uri)
+			if err != nil {
+				return nil, err
+			}
+			from, err = containingPackage(bctx, filename, h.mainModule(bctx, filename))
+			if err != nil {
+				return nil, nil
+			}
+			pkgs = h.allPackages(bctx)
+		}
+
+		// Only offer packages which declare the member being selected,
+		// as in "fmt.Println".
+		var member string
+		if offset, valid, _ := offsetForPosition(contents, d.Range.Start, h.positionEncoding()); valid && bytes.HasPrefix(contents[offset:], []byte(name+".")) {
+			member = leadingIdent(contents[offset+len(name)+1:])
+		}
+		for _, ipath := range importCandidates(bctx, from, pkgs, name, member) {
+			edit, ok := addImportEdit(filename, contents, ipath, h.positionEncoding())
+			if !ok {
+				return fixes, nil
+			}
+			fixes = append(fixes, lsp.CodeAction{
+				Title:       fmt.Sprintf("Add import for %s: %q", name, ipath),
+				Kind:        lsp.CAKQuickFix,
+				Diagnostics: []lsp.Diagnostic{d},
+				Edit:        h.documentEdit(uri, edit),
+			})
+		}
+	}
+	return fixes, nil
+}
+
+// leadingIdent returns the identifier at the start of b, if any.
+func leadingIdent(b []byte) string {
+	end := 0
+	for end < len(b) && (b[end] == '_' || 'a' <= b[end] && b[end] <= 'z' || 'A' <= b[end] && b[end] <= 'Z' || end > 0 && '0' <= b[end] && b[end] <= '9') {
+		end++
+	}
+	return string(b[:end])
+}
+
+// importCandidates returns the import paths of the packages among pkgs
+// named name which the package from may import. If member isn't empty,
+// only packages which declare it are returned.
+func importCandidates(bctx *build.Context, from *build.Package, pkgs []string, name, member string) []string {
+	var candidates []string
+	seen := make(map[string]bool)
+	for _, ipath := range pkgs {
+		if path.Base(ipath) != name || !importableFrom(ipath, from.ImportPath) {
+			continue
+		}
+		ipath = util.VendorlessImportPath(ipath)
+		if seen[ipath] || ipath == from.ImportPath {
+			continue
+		}
+		seen[ipath] = true
+		bpkg, err := bctx.Import(ipath, from.Dir, 0)
+		if err != nil || bpkg.Name != name {
+			continue
+		}
+		if member != "" && !declares(bctx, bpkg, member) {
+			continue
+		}
+		candidates = append(candidates, ipath)
+	}
+	return candidates
+}
+
+// allPackages returns the import paths of the packages of bctx, as
+// buildutil.AllPackages does. Walking GOPATH is slow, so they are kept in
+// the symbol cache until it is purged as the files change.
+func (h *LangHandler) allPackages(bctx *build.Context) []string {
+	key := struct{ allPackages, goroot, gopath, buildTags string }{"allPackages", bctx.GOROOT, bctx.GOPATH, strings.Join(bctx.BuildTags, ",")}
+	return h.symbolCache.Get(key, func() interface{} {
+		return buildutil.AllPackages(bctx)
+	}).([]string)
+}
+
+// importableFrom reports whether the package ipath may be imported by the
+// package importPath, given the rules for vendor and internal
+// directories.
+func importableFrom(ipath, importPath string) bool {
+	elems := strings.Split(ipath, "/")
+	for i, elem := range elems {
+		if elem != "vendor" && elem != "internal" {
+			continue
+		}
+		// The standard library's and GOPATH's top level internal and
+		// vendor directories are left out.
+		if i == 0 || !util.PathHasPrefix(importPath, strings.Join(elems[:i], "/")) {
+			return false
+		}
+	}
+	return true
+}
+
+// declares reports whether bpkg declares the exported package-level name.
+func declares(bctx *build.Context, bpkg *build.Package, name string) bool {
+	if !ast.IsExported(name) {
+		return false
+	}
+	fset := token.NewFileSet()
+	for _, file := range bpkg.GoFiles {
+		f, err := buildutil.ParseFile(fset, bctx, nil, bpkg.Dir, file, 0)
+		if err != nil {
+			continue
+		}
+		if f.Scope.Lookup(name) != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// addImportEdit returns the edit which imports ipath in the file
+// filename, whose source is contents, with its range in the units of
+// enc. ok is false if the file doesn't parse.
+func addImportEdit(filename string, contents []byte, ipath string, enc lsp.PositionEncodingKind) (edit lsp.TextEdit, ok bool) {
+	fset := token.NewFileSet()
+	orig, err := parser.ParseFile(fset, filename, contents, parser.ImportsOnly|parser.ParseComments)
+	if err != nil {
+		return lsp.TextEdit{}, false
+	}
+	f, err := parser.ParseFile(fset, filename, contents, parser.ParseComments)
+	if err != nil {
+		return lsp.TextEdit{}, false
+	}
+	astutil.AddImport(fset, f, ipath)
+	var buf bytes.Buffer
+	if err := format.Node(&buf, fset, f); err != nil {
+		return lsp.TextEdit{}, false
+	}
+	fixed, err := parser.ParseFile(fset, filename, buf.Bytes(), parser.ImportsOnly|parser.ParseComments)
+	if err != nil {
+		return lsp.TextEdit{}, false
+	}
+	return importsEdit(fset, orig, fixed, contents, buf.Bytes(), enc), true
+}
+
+// organizeImports returns the edit which adds the missing imports of the
+// file uri and removes its unused ones, as goimports does. Only the
+// imports are changed, the rest of the file is not reformatted. It
+// returns nil if no import is missing or unused, or if goimports can't
+// be run.
+func (h *LangHandler) organizeImports(ctx context.Context, uri lsp.DocumentURI) (*lsp.WorkspaceEdit, error) {
+	if !h.canGoimports() {
+		return nil, nil
+	}
+	filename := h.FilePath(uri)
+	orig, err := h.readFile(ctx, uri)
+	if err != nil {
+		return nil, err
+	}
+	fixed, err := goimports(filename, orig, h.config().GoimportsLocalPrefix)
+	if err != nil {
+		// Most likely the file doesn't parse, in which case there is
+		// nothing to offer.
+		warnf("organizing imports of %s: %s", filename, err)
+		return nil, nil
+	}
+
+	fset := token.NewFileSet()
+	origFile, err := parser.ParseFile(fset, filename, orig, parser.ImportsOnly|parser.ParseComments)
+	if err != nil {
+		return nil, nil
+	}
+	fixedFile, err := parser.ParseFile(fset, filename, fixed, parser.ImportsOnly|parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	if sameImports(origFile, fixedFile) {
+		return nil, nil
+	}
+	return h.documentEdit(uri, importsEdit(fset, origFile, fixedFile, orig, fixed, h.positionEncoding())), nil
+}
+
+// importsEdit returns the edit which replaces the imports of orig, whose
+// source is origSrc, with those of fixed, whose source is fixedSrc.
+// Everything from the package name to the end of the last import
+// declaration is replaced. Its range counts the units of enc.
+func importsEdit(fset *token.FileSet, orig, fixed *ast.File, origSrc, fixedSrc []byte, enc lsp.PositionEncodingKind) lsp.TextEdit {
+	origStart, origEnd := importsSpan(fset, orig)
+	fixedStart, fixedEnd := importsSpan(fset, fixed)
+	tf := fset.File(orig.Pos())
+	position := func(offset int) lsp.Position {
+		return lspPosition(tf.Position(tf.Pos(offset)), origSrc, enc)
+	}
+	return lsp.TextEdit{
+		Range:   lsp.Range{Start: position(origStart), End: position(origEnd)},
+		NewText: string(fixedSrc[fixedStart:fixedEnd]),
+	}
+}
+
+// documentEdit returns a WorkspaceEdit making edit to uri. It is
+// attributed to the version of the document the client has open, if any,
+// so that it isn't applied to a different one.
+func (h *LangHandler) documentEdit(uri lsp.DocumentURI, edit lsp.TextEdit) *lsp.WorkspaceEdit {
+	h.Mu.Lock()
+	overlay := h.overlay
+	h.Mu.Unlock()
+	version, open := overlay.version(uri)
+	if wc := h.init.Capabilities.Workspace.WorkspaceEdit; open && wc != nil && wc.DocumentChanges {
+		return &lsp.WorkspaceEdit{DocumentChanges: []lsp.TextDocumentEdit{{
+			TextDocument: lsp.VersionedTextDocumentIdentifier{
+				TextDocumentIdentifier: lsp.TextDocumentIdentifier{URI: uri},
+				Version:                version,
+			},
+			Edits: []lsp.TextEdit{edit},
+		}}}
+	}
+	return &lsp.WorkspaceEdit{Changes: map[string][]lsp.TextEdit{string(uri): {edit}}}
+}
+
+// sameImports reports whether a and b import the same packages under the
+// same names, in any order.
+func sameImports(a, b *ast.File) bool {
+	imports := func(f *ast.File) map[string]int {
+		m := make(map[string]int)
+		for _, imp := range f.Imports {
+			path, _ := strconv.Unquote(imp.Path.Value)
+			if imp.Name != nil {
+				path = imp.Name.Name + " " + path
+			}
+			m[path]++
+		}
+		return m
+	}
+	am, bm := imports(a), imports(b)
+	if len(am) != len(bm) {
+		return false
+	}
+	for path, n := range am {
+		if bm[path] != n {
+			return false
+		}
+	}
+	return true
+}
+
+// importsSpan returns the offsets in f of the end of the package name and
+// of the end of the last import declaration. The two are equal if f has
+// no imports.
+func importsSpan(fset *token.FileSet, f *ast.File) (start, end int) {
+	tf := fset.File(f.Pos())
+	start = tf.Offset(f.Name.End())
+	end = start
+	for _, decl := range f.Decls {
+		if d, ok := decl.(*ast.GenDecl); ok && d.Tok == token.IMPORT {
+			end = tf.Offset(d.End())
+		}
+	}
+	return start, end
+}
@@ -0,0 +1,243 @@
+package langserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/token"
+	"path"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/tools/go/buildutil"
+
+	"github.com/sourcegraph/go-langserver/langserver/util"
+	"github.com/sourcegraph/go-langserver/pkg/lsp"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+// The commands of the code lenses. The server doesn't execute them,
+// clients map them to their task runner or references view. The arguments
+// of the commands running tests and benchmarks are the import path of the
+// package and the name of the function. Those of the command showing
+// references are the document URI and position of the declaration.
+const (
+	commandRunTest        = "go.test.run"
+	commandRunBenchmark   = "go.benchmark.run"
+	commandShowReferences = "go.references.show"
+)
+
+// referencesLensData is the data of a reference count lens, which is the
+// location of the name of the declaration whose references it counts.
+type referencesLensData struct {
+	URI      lsp.DocumentURI `json:"uri"`
+	Position lsp.Position    `json:"position"`
+}
+
+// codeLensResolveParams are the params of codeLens/resolve, a lens this
+// server returned.
+type codeLensResolveParams struct {
+	lsp.CodeLens
+	Data *referencesLensData `json:"data,omitempty"`
+}
+
+func (h *LangHandler) handleTextDocumentCodeLens(ctx context.Context, conn jsonrpc2.JSONRPC2, req *jsonrpc2.Request, params lsp.CodeLensParams) ([]lsp.CodeLens, error) {
+	if !util.IsURI(params.TextDocument.URI) {
+		return nil, &jsonrpc2.Error{
+			Code:    jsonrpc2.CodeInvalidParams,
+			Message: fmt.Sprintf("%s not yet supported for out-of-workspace URI (%q)", req.Method, params.TextDocument.URI),
+		}
+	}
+
+	filename := h.FilePath(params.TextDocument.URI)
+	bctx := h.BuildContext(ctx)
+	fset := token.NewFileSet()
+	file, err := buildutil.ParseFile(fset, bctx, nil, path.Dir(filename), path.Base(filename), 0)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(filename, "_test.go") {
+		if !h.config().ReferenceCodeLensesEnabled {
+			return []lsp.CodeLens{}, nil
+		}
+		return referencesCodeLenses(h.positionConverter(ctx), fset, file, params.TextDocument.URI), nil
+	}
+	bpkg, err := containingPackage(bctx, filename, h.mainModule(bctx, filename))
+	if mpErr, ok := err.(*build.MultiplePackageError); ok {
+		bpkg, err = buildPackageForNamedFileInMultiPackageDir(bpkg, mpErr, path.Base(filename))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return testCodeLenses(h.positionConverter(ctx), fset, file, bpkg.ImportPath), nil
+}
+
+// handleCodeLensResolve counts the references to the declaration of a
+// reference count lens. They are only counted when a lens is resolved,
+// which clients do as it is shown, since it typechecks the packages
+// importing the declaration. Other lenses are returned unchanged.
+func (h *LangHandler) handleCodeLensResolve(ctx context.Context, conn jsonrpc2.JSONRPC2, req *jsonrpc2.Request, params codeLensResolveParams) (lsp.CodeLens, error) {
+	lens := params.CodeLens
+	if params.Data == nil {
+		return lens, nil
+	}
+	lens.Data = params.Data
+	uri, position := params.Data.URI, params.Data.Position
+	if !util.IsURI(uri) {
+		return lsp.CodeLens{}, &jsonrpc2.Error{
+			Code:    jsonrpc2.CodeInvalidParams,
+			Message: fmt.Sprintf("%s not yet supported for out-of-workspace URI (%q)", req.Method, uri),
+		}
+	}
+
+	// Begin computing the reverse import graph immediately, as this
+	// occurs in the background and is IO-bound.
+	reverseImportGraphC := h.reverseImportGraph(ctx, conn)
+
+	fset, node, _, _, pkg, _, err := h.typecheck(ctx, conn, uri, position)
+	if err != nil {
+		return lsp.CodeLens{}, err
+	}
+	obj := pkg.ObjectOf(node)
+	if obj == nil || obj.Pkg() == nil {
+		return lsp.CodeLens{}, errors.New("references object not found")
+	}
+
+	refs := make(chan *ast.Ident)
+	errC := make(chan error, 1)
+	go func() {
+		errC <- h.findWorkspaceReferences(ctx, fset, obj, reverseImportGraphC, false, refs)
+		close(refs)
+	}()
+	seen := make(map[token.Position]bool)
+	for id := range refs {
+		seen[fset.Position(id.Pos())] = true
+	}
+	// As for textDocument/references, an error finding references is only
+	// reported if none were found.
+	if err := <-errC; err != nil && len(seen) == 0 {
+		return lsp.CodeLens{}, err
+	}
+
+	title := fmt.Sprintf("%d references", len(seen))
+	if len(seen) == 1 {
+		title = "1 reference"
+	}
+	lens.Command = &lsp.Command{
+		Title:     title,
+		Command:   commandShowReferences,
+		Arguments: []interface{}{uri, position},
+	}
+	return lens, nil
+}
+
+// referencesCodeLenses returns an unresolved lens counting the references
+// to each exported top-level function, method and type of f, which is the
+// document uri.
+func referencesCodeLenses(conv *positionConverter, fset *token.FileSet, f *ast.File, uri lsp.DocumentURI) []lsp.CodeLens {
+	lenses := []lsp.CodeLens{}
+	add := func(name *ast.Ident) {
+		if !name.IsExported() {
+			return
+		}
+		r := rangeForNode(conv, fset, name)
+		lenses = append(lenses, lsp.CodeLens{
+			Range: r,
+			Data:  &referencesLensData{URI: uri, Position: r.Start},
+		})
+	}
+	for _, decl := range f.Decls {
+		switch decl := decl.(type) {
+		case *ast.FuncDecl:
+			add(decl.Name)
+		case *ast.GenDecl:
+			for _, spec := range decl.Specs {
+				if spec, ok := spec.(*ast.TypeSpec); ok {
+					add(spec.Name)
+				}
+			}
+		}
+	}
+	return lenses
+}
+
+// testCodeLenses returns a lens running each test and benchmark function
+// of f, which is a test file of the package importPath.
+func testCodeLenses(conv *positionConverter, fset *token.FileSet, f *ast.File, importPath string) []lsp.CodeLens {
+	lenses := []lsp.CodeLens{}
+	testing := testingImportName(f)
+	if testing == "" {
+		return lenses
+	}
+	for _, decl := range f.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Recv != nil {
+			continue
+		}
+		var command *lsp.Command
+		switch {
+		case isTestFunc(fn, testing, "Test", "T"):
+			command = &lsp.Command{Title: "run test", Command: commandRunTest}
+		case isTestFunc(fn, testing, "Benchmark", "B"):
+			command = &lsp.Command{Title: "run benchmark", Command: commandRunBenchmark}
+		default:
+			continue
+		}
+		command.Arguments = []interface{}{importPath, fn.Name.Name}
+		lenses = append(lenses, lsp.CodeLens{Range: rangeForNode(conv, fset, fn), Command: command})
+	}
+	return lenses
+}
+
+// testingImportName returns the name the testing package is imported
+// under in f, which is "." if it is dot-imported. It returns "" if f
+// doesn't import it.
+func testingImportName(f *ast.File) string {
+	for _, imp := range f.Imports {
+		if ipath, _ := strconv.Unquote(imp.Path.Value); ipath != "testing" {
+			continue
+		}
+		if imp.Name == nil {
+			return "testing"
+		}
+		if imp.Name.Name != "_" {
+			return imp.Name.Name
+		}
+	}
+	return ""
+}
+
+// isTestFunc reports whether fn is run by "go test" as a function of the
+// kind prefix, such as "Test", which is one whose name starts with prefix
+// and isn't followed by a lower case letter, and whose only parameter is
+// a *testing.typ. testing is the name the testing package is imported
+// under.
+func isTestFunc(fn *ast.FuncDecl, testing, prefix, typ string) bool {
+	name := fn.Name.Name
+	if !strings.HasPrefix(name, prefix) {
+		return false
+	}
+	if r, _ := utf8.DecodeRuneInString(name[len(prefix):]); unicode.IsLower(r) {
+		return false
+	}
+	ftype := fn.Type
+	if ftype.Results != nil && len(ftype.Results.List) > 0 || len(ftype.Params.List) != 1 || len(ftype.Params.List[0].Names) > 1 {
+		return false
+	}
+	star, ok := ftype.Params.List[0].Type.(*ast.StarExpr)
+	if !ok {
+		return false
+	}
+	switch x := star.X.(type) {
+	case *ast.Ident:
+		return testing == "." && x.Name == typ
+	case *ast.SelectorExpr:
+		pkg, ok := x.X.(*ast.Ident)
+		return ok && pkg.Name == testing && x.Sel.Name == typ
+	}
+	return false
+}
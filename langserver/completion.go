@@ -3,8 +3,17 @@ package langserver
 import (
 	"context"
 	"fmt"
-	"regexp"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"sort"
 	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/tools/go/ast/astutil"
+	"golang.org/x/tools/go/types/typeutil"
 
 	"github.com/sourcegraph/go-langserver/langserver/internal/gocode"
 	"github.com/sourcegraph/go-langserver/langserver/util"
@@ -14,7 +23,10 @@ import (
 
 var (
 	CIKConstantSupported = lsp.CIKVariable // or lsp.CIKConstant if client supported
-	funcArgsRegexp       = regexp.MustCompile(`func\(([^)]+)\)`)
+
+	// snippetEscaper escapes the characters which are special in snippet
+	// placeholders.
+	snippetEscaper = strings.NewReplacer(`\`, `\\`, `$`, `\$`, `}`, `\}`)
 )
 
 func (h *LangHandler) handleTextDocumentCompletion(ctx context.Context, conn jsonrpc2.JSONRPC2, req *jsonrpc2.Request, params lsp.CompletionParams) (*lsp.CompletionList, error) {
@@ -41,7 +53,7 @@ func (h *LangHandler) handleTextDocumentCompletion(ctx context.Context, conn jso
 	// convert the path into a real path because 3rd party tools
 	// might load additional code based on the file's package
 	filename := util.UriToRealPath(params.TextDocument.URI)
-	offset, valid, why := offsetForPosition(contents, params.Position)
+	offset, valid, why := offsetForPosition(contents, params.Position, h.positionEncoding())
 	if !valid {
 		return nil, fmt.Errorf("invalid position: %s:%d:%d (%s)", filename, params.Position.Line, params.Position.Character, why)
 	}
@@ -89,31 +101,504 @@ func (h *LangHandler) handleTextDocumentCompletion(ctx context.Context, conn jso
 }
 
 func (h *LangHandler) getNewText(kind lsp.CompletionItemKind, name, detail string) (lsp.InsertTextFormat, string) {
-	if h.Config.FuncSnippetEnabled &&
-		kind == lsp.CIKFunction &&
+	if h.config().FuncSnippetEnabled &&
+		(kind == lsp.CIKFunction || kind == lsp.CIKMethod) &&
 		h.init.Capabilities.TextDocument.Completion.CompletionItem.SnippetSupport {
 		args := genSnippetArgs(parseFuncArgs(detail))
-		text := fmt.Sprintf("%s(%s)$0", name, strings.Join(args, ", "))
+		text := fmt.Sprintf("%s(%s)", name, strings.Join(args, ", "))
 		return lsp.ITFSnippet, text
 	}
 	return lsp.ITFPlainText, name
 }
 
+// completionItemTagSupported reports whether the client shows completion
+// items tagged with tag.
+func (h *LangHandler) completionItemTagSupported(tag lsp.CompletionItemTag) bool {
+	ts := h.init.Capabilities.TextDocument.Completion.CompletionItem.TagSupport
+	if ts == nil {
+		return false
+	}
+	for _, t := range ts.ValueSet {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// parseFuncArgs returns the parameters in the func type def, such as
+// "a int" or "f func(int) error". Commas inside parameter types don't
+// split them.
 func parseFuncArgs(def string) []string {
-	m := funcArgsRegexp.FindStringSubmatch(def)
+	if !strings.HasPrefix(def, "func(") {
+		return nil
+	}
 	var args []string
-	if len(m) > 1 {
-		args = strings.Split(m[1], ", ")
+	depth, start := 0, len("func(")
+	for i := start; i < len(def); i++ {
+		switch def[i] {
+		case '(', '[', '{':
+			depth++
+		case ']', '}':
+			depth--
+		case ')':
+			if depth == 0 {
+				if arg := strings.TrimSpace(def[start:i]); arg != "" {
+					args = append(args, arg)
+				}
+				return args
+			}
+			depth--
+		case ',':
+			if depth == 0 {
+				args = append(args, strings.TrimSpace(def[start:i]))
+				start = i + 1
+			}
+		}
 	}
-	return args
+	return nil
 }
 
+// genSnippetArgs returns a tabstop for each of the parameters args. Its
+// placeholder is the parameter name, followed by "..." if it is variadic,
+// or the parameter type if it is unnamed.
 func genSnippetArgs(args []string) []string {
 	newArgs := make([]string, len(args))
 	for i, a := range args {
-		// Closing curly braces must be escaped
-		a = strings.Replace(a, "}", "\\}", -1)
-		newArgs[i] = fmt.Sprintf("${%d:%s}", i+1, a)
+		placeholder := a
+		if j := strings.IndexByte(a, ' '); j > 0 && isParamName(a[:j]) {
+			placeholder = a[:j]
+			if strings.HasPrefix(a[j+1:], "...") || strings.HasSuffix(a, "...") {
+				placeholder += "..."
+			}
+		}
+		newArgs[i] = fmt.Sprintf("${%d:%s}", i+1, snippetEscaper.Replace(placeholder))
 	}
 	return newArgs
 }
+
+// isParamName reports whether s, the first word of a parameter, is its
+// name rather than the start of an unnamed parameter's type such as
+// "chan int".
+func isParamName(s string) bool {
+	switch s {
+	case "chan", "func", "interface", "map", "struct":
+		return false
+	}
+	for _, r := range s {
+		if r != '_' && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// handleTypecheckCompletion completes the selector being typed at the
+// cursor ("x." or "x.Fo") using the typechecker instead of gocode. Values
+// complete to their accessible fields and methods, and imported packages
+// to their exported members, only their types where a type is expected.
+// If the expression before the "." can't be resolved, the list is empty.
+// Outside of selectors the names of types are completed where a type is
+// expected, as by typeNameCompletion, and elsewhere the field names of
+// struct literals, as by compositeLitCompletion.
+func (h *LangHandler) handleTypecheckCompletion(ctx context.Context, conn jsonrpc2.JSONRPC2, req *jsonrpc2.Request, params lsp.CompletionParams) (*lsp.CompletionList, error) {
+	if !util.IsURI(params.TextDocument.URI) {
+		return nil, &jsonrpc2.Error{
+			Code:    jsonrpc2.CodeInvalidParams,
+			Message: fmt.Sprintf("textDocument/completion not yet supported for out-of-workspace URI (%q)", params.TextDocument.URI),
+		}
+	}
+
+	contents, err := h.readFile(ctx, params.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+	offset, valid, why := offsetForPosition(contents, params.Position, h.positionEncoding())
+	if !valid {
+		return nil, fmt.Errorf("invalid position: %s:%d:%d (%s)", params.TextDocument.URI, params.Position.Line, params.Position.Character, why)
+	}
+
+	// Find the partial member name before the cursor and the "." before
+	// it.
+	empty := &lsp.CompletionList{Items: []lsp.CompletionItem{}}
+	prefixStart, prefixLen := offset, 0 // prefixLen is in the units of the position encoding
+	for prefixStart > 0 {
+		r, size := utf8.DecodeLastRune(contents[:prefixStart])
+		if r != '_' && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			break
+		}
+		prefixStart -= size
+		prefixLen += characterWidth(r, size, h.positionEncoding())
+	}
+	wantType := typeExpected(contents, prefixStart)
+	if prefixStart == 0 || contents[prefixStart-1] != '.' {
+		if wantType {
+			return h.typeNameCompletion(ctx, conn, params, prefixLen)
+		}
+		return h.compositeLitCompletion(ctx, conn, params, prefixLen)
+	}
+	dot := params.Position
+	dot.Character -= prefixLen + 1
+
+	_, _, nodes, prog, pkg, start, err := h.typecheck(ctx, conn, params.TextDocument.URI, dot)
+	if err != nil {
+		if _, ok := err.(*invalidNodeError); !ok {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			return empty, nil
+		}
+	}
+	var sel *ast.SelectorExpr
+	for _, n := range nodes {
+		if s, ok := n.(*ast.SelectorExpr); ok && s.X.End() <= *start && *start < s.Sel.Pos() {
+			sel = s
+			break
+		}
+	}
+	if sel == nil {
+		return empty, nil
+	}
+
+	var objs []types.Object
+	if id, ok := sel.X.(*ast.Ident); ok {
+		if pkgName, ok := pkg.Uses[id].(*types.PkgName); ok {
+			scope := pkgName.Imported().Scope()
+			for _, name := range scope.Names() {
+				if obj := scope.Lookup(name); obj.Exported() {
+					objs = append(objs, obj)
+				}
+			}
+		}
+	}
+	if tv, ok := pkg.Types[sel.X]; ok && objs == nil && tv.Type != nil {
+		objs = selectableMembers(tv.Type, tv.IsType(), pkg.Pkg)
+	}
+	if wantType {
+		// Of the members only the types of a package can be used.
+		typeNames := objs[:0]
+		for _, obj := range objs {
+			if _, ok := obj.(*types.TypeName); ok {
+				typeNames = append(typeNames, obj)
+			}
+		}
+		objs = typeNames
+	}
+
+	rng := lsp.Range{
+		Start: lsp.Position{Line: params.Position.Line, Character: params.Position.Character - prefixLen},
+		End:   params.Position,
+	}
+	tagDeprecated := h.completionItemTagSupported(lsp.CITDeprecated)
+	citems := make([]lsp.CompletionItem, 0, len(objs))
+	for _, obj := range objs {
+		var kind lsp.CompletionItemKind
+		detail := shortType(obj.Type())
+		switch obj := obj.(type) {
+		case *types.Var:
+			kind = lsp.CIKVariable
+			if obj.IsField() {
+				kind = lsp.CIKField
+			}
+		case *types.Func:
+			kind = lsp.CIKFunction
+			if obj.Type().(*types.Signature).Recv() != nil {
+				kind = lsp.CIKMethod
+			}
+		case *types.Const:
+			kind = CIKConstantSupported
+		case *types.TypeName:
+			kind, detail = lsp.CIKClass, typeNameDetail(obj)
+			if wantType {
+				kind = typeNameKind(obj)
+			}
+		}
+		itf, newText := h.getNewText(kind, obj.Name(), detail)
+		item := lsp.CompletionItem{
+			Label:            obj.Name(),
+			Kind:             kind,
+			Detail:           detail,
+			InsertTextFormat: itf,
+			InsertText:       newText,
+			TextEdit:         &lsp.TextEdit{Range: rng, NewText: newText},
+		}
+		if tagDeprecated && isDeprecated(declDoc(prog, obj).Text()) {
+			item.Tags = []lsp.CompletionItemTag{lsp.CITDeprecated}
+		}
+		citems = append(citems, item)
+	}
+	sort.Slice(citems, func(i, j int) bool { return citems[i].Label < citems[j].Label })
+	return &lsp.CompletionList{Items: citems}, nil
+}
+
+// typeNameCompletion completes the name of the type being typed where a
+// type is expected ("var x " or "func() Fo"), which is prefixLen
+// characters long. The types in scope at the cursor are completed, from
+// the package, the enclosing functions and the predeclared ones, and so
+// are the imported packages, whose types follow a ".".
+func (h *LangHandler) typeNameCompletion(ctx context.Context, conn jsonrpc2.JSONRPC2, params lsp.CompletionParams, prefixLen int) (*lsp.CompletionList, error) {
+	empty := &lsp.CompletionList{Items: []lsp.CompletionItem{}}
+	pos := params.Position
+	pos.Character -= prefixLen
+	_, _, _, prog, pkg, start, err := h.typecheck(ctx, conn, params.TextDocument.URI, pos)
+	if err != nil {
+		if _, ok := err.(*invalidNodeError); !ok {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			return empty, nil
+		}
+	}
+	scope := pkg.Pkg.Scope().Innermost(*start)
+	if scope == nil {
+		scope = pkg.Pkg.Scope()
+	}
+
+	rng := lsp.Range{Start: pos, End: params.Position}
+	tagDeprecated := h.completionItemTagSupported(lsp.CITDeprecated)
+	seen := make(map[string]bool)
+	citems := []lsp.CompletionItem{}
+	for s := scope; s != nil; s = s.Parent() {
+		for _, name := range s.Names() {
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+			// LookupParent skips the local declarations after the
+			// cursor, and those shadowed by inner ones.
+			_, obj := scope.LookupParent(name, *start)
+			var kind lsp.CompletionItemKind
+			var detail string
+			switch obj := obj.(type) {
+			case *types.TypeName:
+				if obj.Parent() == types.Universe && name == "comparable" {
+					// It is only a constraint.
+					continue
+				}
+				kind, detail = typeNameKind(obj), typeNameDetail(obj)
+			case *types.PkgName:
+				kind, detail = lsp.CIKModule, obj.Imported().Path()
+			default:
+				continue
+			}
+			item := lsp.CompletionItem{
+				Label:            name,
+				Kind:             kind,
+				Detail:           detail,
+				InsertTextFormat: lsp.ITFPlainText,
+				InsertText:       name,
+				TextEdit:         &lsp.TextEdit{Range: rng, NewText: name},
+			}
+			if tagDeprecated && obj.Pkg() != nil && isDeprecated(declDoc(prog, obj).Text()) {
+				item.Tags = []lsp.CompletionItemTag{lsp.CITDeprecated}
+			}
+			citems = append(citems, item)
+		}
+	}
+	sort.Slice(citems, func(i, j int) bool { return citems[i].Label < citems[j].Label })
+	return &lsp.CompletionList{Items: citems}, nil
+}
+
+// typeExpected reports whether a type is expected at offset start of the
+// Go file contents, as in the type of a var declaration, a field, a
+// parameter or a result, or the element type of a composite type. If no
+// name starts there yet a placeholder is parsed in its place, so that the
+// declaration being typed parses.
+func typeExpected(contents []byte, start int) bool {
+	src := contents
+	if r, _ := utf8.DecodeRune(contents[start:]); r != '_' && !unicode.IsLetter(r) {
+		src = make([]byte, 0, len(contents)+1)
+		src = append(append(append(src, contents[:start]...), '_'), contents[start:]...)
+	}
+	fset := token.NewFileSet()
+	f, _ := parser.ParseFile(fset, "", src, 0)
+	if f == nil {
+		return false
+	}
+	p := fset.File(f.Pos()).Pos(start)
+	path, _ := astutil.PathEnclosingInterval(f, p, p+1)
+	if len(path) < 2 {
+		return false
+	}
+	if id, ok := path[0].(*ast.Ident); !ok || id.Pos() != p {
+		return false
+	}
+	child := path[0]
+	for _, n := range path[1:] {
+		switch n := n.(type) {
+		case *ast.SelectorExpr:
+			// The selected name of a qualified type, not its package.
+			if n.Sel != child {
+				return false
+			}
+		case *ast.StarExpr, *ast.ParenExpr:
+		case *ast.ArrayType:
+			return n.Elt == child
+		case *ast.MapType, *ast.ChanType, *ast.Ellipsis:
+			return true
+		case *ast.Field:
+			return n.Type == child
+		case *ast.ValueSpec:
+			return n.Type == child
+		case *ast.TypeSpec:
+			return n.Type == child
+		case *ast.TypeAssertExpr:
+			return n.Type == child
+		default:
+			return false
+		}
+		child = n
+	}
+	return false
+}
+
+// typeNameKind returns the completion item kind of the type obj.
+func typeNameKind(obj *types.TypeName) lsp.CompletionItemKind {
+	if _, ok := obj.Type().(*types.TypeParam); ok {
+		return lsp.CIKTypeParameter
+	}
+	switch obj.Type().Underlying().(type) {
+	case *types.Struct:
+		return lsp.CIKStruct
+	case *types.Interface:
+		return lsp.CIKInterface
+	}
+	return lsp.CIKClass
+}
+
+// typeNameDetail returns the detail of the completion item of the type
+// obj, the kind of type it denotes.
+func typeNameDetail(obj *types.TypeName) string {
+	switch obj.Type().Underlying().(type) {
+	case *types.Struct:
+		return "struct"
+	case *types.Interface:
+		return "interface"
+	}
+	return shortType(obj.Type().Underlying())
+}
+
+// compositeLitCompletion completes the field name being typed as an
+// element of the struct literal at the cursor ("T{" or "T{A: 1, Fo"),
+// which is prefixLen characters long. The fields code in the package can
+// set are completed, except those the literal already has, and they
+// insert "name: ". Anywhere else the list is empty.
+func (h *LangHandler) compositeLitCompletion(ctx context.Context, conn jsonrpc2.JSONRPC2, params lsp.CompletionParams, prefixLen int) (*lsp.CompletionList, error) {
+	empty := &lsp.CompletionList{Items: []lsp.CompletionItem{}}
+	pos := params.Position
+	pos.Character -= prefixLen
+	_, _, nodes, prog, pkg, start, err := h.typecheck(ctx, conn, params.TextDocument.URI, pos)
+	if err != nil {
+		if _, ok := err.(*invalidNodeError); !ok {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			return empty, nil
+		}
+	}
+
+	// The name must be an element of its own, rather than a key's
+	// value or part of some other expression.
+	var lit *ast.CompositeLit
+	for i, n := range nodes {
+		if l, ok := n.(*ast.CompositeLit); ok {
+			if _, isIdent := nodes[0].(*ast.Ident); i == 0 || (i == 1 && isIdent) {
+				lit = l
+			}
+			break
+		}
+	}
+	if lit == nil || *start <= lit.Lbrace || *start > lit.Rbrace {
+		return empty, nil
+	}
+	tv, ok := pkg.Types[lit]
+	if !ok || tv.Type == nil {
+		return empty, nil
+	}
+	s, ok := tv.Type.Underlying().(*types.Struct)
+	if !ok {
+		return empty, nil
+	}
+	present := make(map[string]bool)
+	for _, elt := range lit.Elts {
+		if kv, ok := elt.(*ast.KeyValueExpr); ok {
+			if id, ok := kv.Key.(*ast.Ident); ok {
+				present[id.Name] = true
+			}
+		}
+	}
+
+	rng := lsp.Range{Start: pos, End: params.Position}
+	tagDeprecated := h.completionItemTagSupported(lsp.CITDeprecated)
+	citems := []lsp.CompletionItem{}
+	for i := 0; i < s.NumFields(); i++ {
+		f := s.Field(i)
+		if present[f.Name()] || (!f.Exported() && f.Pkg() != pkg.Pkg) {
+			continue
+		}
+		newText := f.Name() + ": "
+		item := lsp.CompletionItem{
+			Label:            f.Name(),
+			Kind:             lsp.CIKField,
+			Detail:           shortType(f.Type()),
+			InsertTextFormat: lsp.ITFPlainText,
+			InsertText:       newText,
+			TextEdit:         &lsp.TextEdit{Range: rng, NewText: newText},
+		}
+		if tagDeprecated && isDeprecated(declDoc(prog, f).Text()) {
+			item.Tags = []lsp.CompletionItemTag{lsp.CITDeprecated}
+		}
+		citems = append(citems, item)
+	}
+	sort.Slice(citems, func(i, j int) bool { return citems[i].Label < citems[j].Label })
+	return &lsp.CompletionList{Items: citems}, nil
+}
+
+// selectableMembers returns the fields and methods which code in pkg can
+// select from an addressable value of type T, including those promoted
+// from embedded fields. If isType, T is used in a method expression and
+// only its methods are returned.
+func selectableMembers(T types.Type, isType bool, pkg *types.Package) []types.Object {
+	var names []string
+	for _, sel := range typeutil.IntuitiveMethodSet(T, nil) {
+		names = append(names, sel.Obj().Name())
+	}
+	if !isType {
+		seen := make(map[types.Type]bool)
+		var addFields func(t types.Type)
+		addFields = func(t types.Type) {
+			if p, ok := t.(*types.Pointer); ok {
+				t = p.Elem()
+			}
+			s, ok := t.Underlying().(*types.Struct)
+			if !ok || seen[t] {
+				return
+			}
+			seen[t] = true
+			for i := 0; i < s.NumFields(); i++ {
+				names = append(names, s.Field(i).Name())
+				if s.Field(i).Anonymous() {
+					addFields(s.Field(i).Type())
+				}
+			}
+		}
+		addFields(T)
+	}
+
+	// LookupFieldOrMethod decides which of the names are accessible from
+	// pkg and refer to a unique, unshadowed member.
+	var objs []types.Object
+	found := make(map[types.Object]bool)
+	for _, name := range names {
+		obj, _, _ := types.LookupFieldOrMethod(T, true, pkg, name)
+		if obj == nil || found[obj] || (!obj.Exported() && obj.Pkg() != pkg) {
+			continue
+		}
+		if _, ok := obj.(*types.Func); !ok && isType {
+			continue
+		}
+		found[obj] = true
+		objs = append(objs, obj)
+	}
+	return objs
+}
@@ -3,6 +3,8 @@ package langserver
 import (
     "reflect"
     "testing"
+
+    "github.com/sourcegraph/go-langserver/pkg/lsp"
 )
 
 func TestParseFuncArgs(t *testing.T) {
@@ -11,12 +13,53 @@ func TestParseFuncArgs(t *testing.T) {
     if !reflect.DeepEqual(got, want) {
         t.Fatalf("Wrong function args parsed. got: %s want: %s", got, want)
     }
+
+    got = parseFuncArgs("func(f func(int, string) error, m map[string]struct{ a, b int })")
+    want = []string{"f func(int, string) error", "m map[string]struct{ a, b int }"}
+    if !reflect.DeepEqual(got, want) {
+        t.Fatalf("Wrong function args parsed. got: %s want: %s", got, want)
+    }
+
+    if got := parseFuncArgs("func()"); len(got) != 0 {
+        t.Fatalf("Wrong function args parsed. got: %s want none", got)
+    }
 }
 
 func TestGenSnippetArgs(t *testing.T) {
-    got := genSnippetArgs([]string{"a int", "b bool", "c interface{}", "d string..."})
-    want := []string{"${1:a int}", "${2:b bool}", "${3:c interface{\\}}", "${4:d string...}"}
+    got := genSnippetArgs([]string{"a int", "b bool", "c interface{}", "d ...string"})
+    want := []string{"${1:a}", "${2:b}", "${3:c}", "${4:d...}"}
     if !reflect.DeepEqual(got, want) {
         t.Fatalf("Wrong snippet args. got: %s want: %s", got, want)
     }
+
+    got = genSnippetArgs([]string{"interface{}", "chan int", "$x"})
+    want = []string{"${1:interface{\\}}", "${2:chan int}", "${3:\\$x}"}
+    if !reflect.DeepEqual(got, want) {
+        t.Fatalf("Wrong snippet args. got: %s want: %s", got, want)
+    }
+}
+
+func TestGetNewText(t *testing.T) {
+    h := &LangHandler{Config: Config{FuncSnippetEnabled: true}, init: &InitializeParams{}}
+    tests := []struct {
+        kind     lsp.CompletionItemKind
+        name     string
+        detail   string
+        snippets bool
+        wantITF  lsp.InsertTextFormat
+        want     string
+    }{
+        {lsp.CIKFunction, "Foo", "func(a int, b string) error", true, lsp.ITFSnippet, "Foo(${1:a}, ${2:b})"},
+        {lsp.CIKMethod, "Printf", "func(format string, a ...interface{})", true, lsp.ITFSnippet, "Printf(${1:format}, ${2:a...})"},
+        {lsp.CIKFunction, "F", "func()", true, lsp.ITFSnippet, "F()"},
+        {lsp.CIKFunction, "Foo", "func(a int, b string) error", false, lsp.ITFPlainText, "Foo"},
+        {lsp.CIKVariable, "V", "func(a int)", true, lsp.ITFPlainText, "V"},
+    }
+    for _, test := range tests {
+        h.init.Capabilities.TextDocument.Completion.CompletionItem.SnippetSupport = test.snippets
+        itf, got := h.getNewText(test.kind, test.name, test.detail)
+        if itf != test.wantITF || got != test.want {
+            t.Errorf("getNewText(%v, %q, %q) with snippets %v = %v, %q, want %v, %q", test.kind, test.name, test.detail, test.snippets, itf, got, test.wantITF, test.want)
+        }
+    }
 }
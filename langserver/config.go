@@ -1,10 +1,14 @@
 package langserver
 
-import "os"
+import (
+	"os"
+	"strings"
+	"time"
+)
 
 var (
 	// GOLSP_WARMUP_ON_INITIALIZE toggles if we typecheck the whole
-	// workspace in the background on initialize. This trades off initial
+	// workspace in the background once initialized. This trades off initial
 	// CPU and memory to hide perceived latency of the first few
 	// requests. If the LSP server is long lived the tradeoff is usually
 	// worth it.
@@ -13,23 +17,263 @@ var (
 
 type Config struct {
 	// FuncSnippetEnabled enables the returning of enable argument snippets
-	// on `func` completions, eg. func(foo string, arg2 bar).
-	// Requires code completion to be enabled.
+	// on `func` and method completions, eg. Foo(${1:a}, ${2:b}), to
+	// clients which support snippets.
 	FuncSnippetEnabled bool
-	// GocodeCompletionEnabled enables code completion feature (using gocode)
+	// GocodeCompletionEnabled enables code completion feature (using gocode).
+	// When disabled, the typechecker completes selectors ("x."), the names
+	// of types where a type is expected and the field names of struct
+	// literals. Import paths are completed either way.
 	GocodeCompletionEnabled bool
 	// MaxParallelism controls the maximum number of goroutines that should be used
 	// to fulfill requests. This is useful in editor environments where users do
 	// not want results ASAP, but rather just semi quickly without eating all of
-	// their CPU.
+	// their CPU. It also bounds the number of packages loaded and typechecked
+	// at once, across all requests. If it is 0, GOMAXPROCS is used.
 	MaxParallelism int
 	// UseBinaryPkgCache controls whether or not $GOPATH/pkg binary .a files should
-	// be used.
+	// be used. Hovers in packages which can't be typechecked fall back to
+	// them even in module workspaces.
 	UseBinaryPkgCache bool
+	// HoverBackend decides how hovers are answered. Supported:
+	// "typecheck", which typechecks the package of the document, and
+	// "godef", which is faster as it only parses the files leading to
+	// the declaration and reads the binary package cache. If it is
+	// empty hovers are answered like definitions, with godef if
+	// UseBinaryPkgCache is set and no workspace folder is a module.
+	HoverBackend string
+	// FormatTool decides which tool is used to format documents. Supported:
+	// "gofmt" and "goimports". Gofmt is used instead of goimports if the
+	// server was initialized with NoOSFileSystemAccess.
+	FormatTool string
+	// GoimportsLocalPrefix makes goimports group imports beginning with
+	// this prefix after third-party packages. It may be a comma-separated
+	// list of prefixes, each of which gets its own group.
+	GoimportsLocalPrefix string
+	// FormatGoVersion is the Go version, such as "1.18", whose gofmt
+	// rules formatting follows where they differ from the current ones.
+	// Before Go 1.19 doc comments aren't reformatted. If it is empty the
+	// current rules are followed.
+	FormatGoVersion string
+	// DocLinkBaseURL is the URL of the documentation server which import
+	// paths link to, such as "https://pkg.go.dev". The link for an import
+	// path is the URL followed by "/" and the path. If it is empty import
+	// paths aren't linked.
+	DocLinkBaseURL string
+	// MaxWorkspaceSymbols is the number of workspace/symbol results
+	// returned if the client doesn't specify a limit. If it is 0 all
+	// results are returned.
+	MaxWorkspaceSymbols int
+	// SymbolScope decides which packages workspace/symbol searches.
+	// Supported: "workspace", the packages under the root of the
+	// workspace, and "gopath", all the packages in GOPATH.
+	SymbolScope string
+	// DefinitionTarget decides where definitions outside of the workspace
+	// folders lead. Supported: "source", the declaration in the Go file,
+	// and "doc", the documentation of the symbol on the server of
+	// DocLinkBaseURL. Definitions in the workspace always lead to the
+	// source.
+	DefinitionTarget string
+	// IncludeUnexportedSymbols controls whether workspace/symbol returns
+	// unexported symbols. If false only the exported API is returned:
+	// exported top-level declarations and the exported methods and fields
+	// of exported types.
+	IncludeUnexportedSymbols bool
+	// TypecheckCacheSize is the maximum number of typechecked packages
+	// kept in memory. If it is 0 a process level cache is used, whose
+	// size is set by the environment variable SRC_TYPECHECK_CACHE_SIZE.
+	TypecheckCacheSize int
+	// PackageCacheTTL is how long a typechecked package is kept in
+	// memory once it was last used. The packages which have been idle
+	// longer are evicted every minute. If it is 0 they are only evicted
+	// when the cache is full.
+	PackageCacheTTL time.Duration
+	// DiagnosticsEnabled enables publishing the type errors of the
+	// packages of documents as they are opened, changed and saved.
+	DiagnosticsEnabled bool
+	// UnusedImportDiagnosticsEnabled enables publishing warnings for the
+	// unused imports of documents as they are opened and changed. They
+	// are found from the syntax of the document alone, so they are
+	// published at once even if DiagnosticsEnabled is false.
+	UnusedImportDiagnosticsEnabled bool
+	// DiagnosticsDebounceMs is how many milliseconds after a document
+	// last changed the diagnostics of its package are recomputed.
+	DiagnosticsDebounceMs int
+	// BuildTags are additional build tags considered satisfied when
+	// deciding which files are part of a package.
+	BuildTags []string
+	// FollowTypeAliases makes definitions of type aliases lead to the
+	// declaration of the type they denote, and type definitions lead
+	// through aliases to the named type. If false the alias itself is
+	// shown.
+	FollowTypeAliases bool
+	// ReferenceCodeLensesEnabled enables code lenses counting the
+	// references to exported declarations. Each is counted across the
+	// workspace when the client resolves it, which is costly in large
+	// workspaces.
+	ReferenceCodeLensesEnabled bool
+	// MaxReferenceResults is the maximum number of locations returned
+	// for textDocument/references. All the references are still found
+	// and sorted, so the same first ones are returned for each request,
+	// and the client is sent a log message if some are left out. No more
+	// than that are streamed as partial results while they are found,
+	// though they needn't be the first ones. If it is 0 all the
+	// references are returned.
+	MaxReferenceResults int
+	// LogLevel is the least severe level of the messages logged:
+	// "debug", "info", "warn" or "error". Debug messages include the
+	// errors finding the symbol descriptors of definitions.
+	LogLevel string
+	// PrewarmPackages are the packages typechecked in the background
+	// once the server is initialized, so that requests in them are fast
+	// from the start. Each is an import path, or a path relative to a
+	// workspace folder such as "./cmd/...", which may contain the
+	// wildcards of path.Match. A trailing "/..." also matches the
+	// packages below.
+	PrewarmPackages []string
+	// ExcludeDirs are the directories left out of the scans of the
+	// workspace, such as the ones finding its symbols, references and
+	// packages to prewarm, and whose files get no diagnostics. Each is
+	// a pattern of path.Match, matched against the directory relative
+	// to its workspace folder, or against its name at any depth if the
+	// pattern has no "/", as for "node_modules".
+	ExcludeDirs []string
+	// ReadOnly disables the requests whose results edit documents:
+	// rename, formatting and code actions. They fail with an error
+	// saying the server is read-only, and aren't among the capabilities
+	// returned by initialize, so that an analysis-only deployment can't
+	// be asked for edits.
+	ReadOnly bool
+	// FreeGCCommandEnabled enables the langserver.freeGC command of
+	// workspace/executeCommand, which collects garbage and returns as
+	// much memory as it can to the OS, pausing the server meanwhile. It
+	// is disabled by default.
+	FreeGCCommandEnabled bool
+	// GOROOT and GOPATH override those of the build context, whether
+	// it is the client's or the environment's, if they are not empty.
+	// They are checked when the server is initialized.
+	GOROOT string
+	GOPATH string
 }
 
+const (
+	formatToolGofmt     = "gofmt"
+	formatToolGoimports = "goimports"
+)
+
+const (
+	hoverBackendTypecheck = "typecheck"
+	hoverBackendGodef     = "godef"
+)
+
+const (
+	symbolScopeWorkspace = "workspace"
+	symbolScopeGOPATH    = "gopath"
+)
+
+const (
+	definitionTargetSource = "source"
+	definitionTargetDoc    = "doc"
+)
+
 func NewDefaultConfig() Config {
 	return Config{
-		MaxParallelism: 8,
+		MaxParallelism:                 8,
+		FormatTool:                     formatToolGofmt,
+		DocLinkBaseURL:                 "https://pkg.go.dev",
+		MaxWorkspaceSymbols:            50,
+		SymbolScope:                    symbolScopeWorkspace,
+		DefinitionTarget:               definitionTargetSource,
+		IncludeUnexportedSymbols:       true,
+		DiagnosticsEnabled:             true,
+		UnusedImportDiagnosticsEnabled: true,
+		DiagnosticsDebounceMs:          250,
+		ReferenceCodeLensesEnabled:     true,
+		LogLevel:                       "info",
+	}
+}
+
+// config returns the current configuration. Requests are handled
+// concurrently with workspace/didChangeConfiguration, which changes it.
+func (h *LangHandler) config() Config {
+	h.configMu.Lock()
+	defer h.configMu.Unlock()
+	return h.Config
+}
+
+// handleWorkspaceDidChangeConfiguration applies the settings of params to
+// the configuration. Build tags change which files packages are made of,
+// and excluded directories which packages the workspace has, so changing
+// them resets the caches.
+func (h *LangHandler) handleWorkspaceDidChangeConfiguration(params DidChangeConfigurationParams) {
+	s := params.Settings
+	h.configMu.Lock()
+	cfg := &h.Config
+	oldTags := strings.Join(cfg.BuildTags, ",")
+	oldExcludeDirs := strings.Join(cfg.ExcludeDirs, ",")
+	if s.FuncSnippetEnabled != nil {
+		cfg.FuncSnippetEnabled = *s.FuncSnippetEnabled
+	}
+	if s.HoverBackend != nil {
+		cfg.HoverBackend = *s.HoverBackend
+	}
+	if s.FormatTool != nil {
+		cfg.FormatTool = *s.FormatTool
+	}
+	if s.GoimportsLocalPrefix != nil {
+		cfg.GoimportsLocalPrefix = *s.GoimportsLocalPrefix
+	}
+	if s.FormatGoVersion != nil {
+		cfg.FormatGoVersion = *s.FormatGoVersion
+	}
+	if s.DocLinkBaseURL != nil {
+		cfg.DocLinkBaseURL = *s.DocLinkBaseURL
+	}
+	if s.MaxWorkspaceSymbols != nil {
+		cfg.MaxWorkspaceSymbols = *s.MaxWorkspaceSymbols
+	}
+	if s.SymbolScope != nil {
+		cfg.SymbolScope = *s.SymbolScope
+	}
+	if s.DefinitionTarget != nil {
+		cfg.DefinitionTarget = *s.DefinitionTarget
+	}
+	if s.IncludeUnexportedSymbols != nil {
+		cfg.IncludeUnexportedSymbols = *s.IncludeUnexportedSymbols
+	}
+	if s.DiagnosticsEnabled != nil {
+		cfg.DiagnosticsEnabled = *s.DiagnosticsEnabled
+	}
+	if s.UnusedImportDiagnosticsEnabled != nil {
+		cfg.UnusedImportDiagnosticsEnabled = *s.UnusedImportDiagnosticsEnabled
+	}
+	if s.DiagnosticsDebounceMs != nil {
+		cfg.DiagnosticsDebounceMs = *s.DiagnosticsDebounceMs
+	}
+	if s.BuildTags != nil {
+		cfg.BuildTags = *s.BuildTags
+	}
+	if s.FollowTypeAliases != nil {
+		cfg.FollowTypeAliases = *s.FollowTypeAliases
+	}
+	if s.ReferenceCodeLensesEnabled != nil {
+		cfg.ReferenceCodeLensesEnabled = *s.ReferenceCodeLensesEnabled
+	}
+	if s.MaxReferenceResults != nil {
+		cfg.MaxReferenceResults = *s.MaxReferenceResults
+	}
+	if s.ExcludeDirs != nil {
+		cfg.ExcludeDirs = *s.ExcludeDirs
+	}
+	if s.LogLevel != nil {
+		cfg.LogLevel = *s.LogLevel
+		setLogLevel(cfg.LogLevel)
+	}
+	tagsChanged := strings.Join(cfg.BuildTags, ",") != oldTags
+	excludeDirsChanged := strings.Join(cfg.ExcludeDirs, ",") != oldExcludeDirs
+	h.configMu.Unlock()
+
+	if tagsChanged || excludeDirsChanged {
+		h.resetCaches(true)
 	}
 }
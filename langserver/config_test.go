@@ -0,0 +1,57 @@
+package langserver
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestDidChangeConfiguration(t *testing.T) {
+	h := &LangHandler{Config: NewDefaultConfig(), HandlerShared: &HandlerShared{}}
+	h.resetCaches(false)
+	change := func(settings string) {
+		var params DidChangeConfigurationParams
+		if err := json.Unmarshal([]byte(`{"settings": `+settings+`}`), &params); err != nil {
+			t.Fatal(err)
+		}
+		h.handleWorkspaceDidChangeConfiguration(params)
+	}
+	fills := 0
+	typecheck := func() {
+		h.typecheckCache.Get("k", func() interface{} {
+			fills++
+			return nil
+		})
+	}
+	typecheck()
+
+	change(`{"formatTool": "goimports", "hoverBackend": "godef", "diagnosticsDebounceMs": 10}`)
+	want := NewDefaultConfig()
+	want.FormatTool = formatToolGoimports
+	want.HoverBackend = hoverBackendGodef
+	want.DiagnosticsDebounceMs = 10
+	if got := h.config(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got config %+v, want %+v", got, want)
+	}
+	typecheck()
+	if fills != 1 {
+		t.Errorf("got %d typechecks, want 1 (the cache is kept)", fills)
+	}
+
+	for i := 0; i < 2; i++ {
+		change(`{"buildTags": ["integration"]}`)
+		typecheck()
+	}
+	want.BuildTags = []string{"integration"}
+	if got := h.config(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got config %+v, want %+v", got, want)
+	}
+	if fills != 2 {
+		t.Errorf("got %d typechecks, want 2 (the cache is reset when the build tags change)", fills)
+	}
+
+	change(`null`)
+	if got := h.config(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got config %+v after no settings, want %+v", got, want)
+	}
+}
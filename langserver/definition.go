@@ -2,13 +2,21 @@ package langserver
 
 import (
 	"context"
-	"errors"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"go/ast"
 	"go/build"
+	"go/parser"
 	"go/token"
-	"log"
+	"go/types"
 	"path/filepath"
+	"strings"
+	"sync"
+
+	"golang.org/x/tools/go/ast/astutil"
+	"golang.org/x/tools/go/buildutil"
+	"golang.org/x/tools/go/loader"
 
 	"github.com/sourcegraph/go-langserver/langserver/internal/godef"
 	"github.com/sourcegraph/go-langserver/langserver/internal/refs"
@@ -18,27 +26,198 @@ import (
 )
 
 func (h *LangHandler) handleDefinition(ctx context.Context, conn jsonrpc2.JSONRPC2, req *jsonrpc2.Request, params lsp.TextDocumentPositionParams) ([]lsp.Location, error) {
-	if h.Config.UseBinaryPkgCache {
+	if locs, ok := h.generateDefinition(ctx, params); ok {
+		return locs, nil
+	}
+
+	// godef doesn't tell aliases from the types they denote, so they
+	// can only be followed using the type checker, nor does it describe
+	// the symbols documentation is found by.
+	if cfg := h.config(); h.useGodef(ctx) && !cfg.FollowTypeAliases && cfg.DefinitionTarget != definitionTargetDoc {
 		_, _, locs, err := h.definitionGodef(ctx, params)
 		if err == godef.ErrNoIdentifierFound {
 			// This is expected to happen when j2d over
 			// comments/strings/whitespace/etc), just return no info.
-			return []lsp.Location{}, nil
+			// Struct tags are the exception: they lead to their field.
+			return h.tagDefinitionGodef(ctx, params)
+		}
+		if e, ok := err.(*godef.NoDeclarationError); ok {
+			return nil, definitionNotFoundError(params, e.Expr)
 		}
 		return locs, err
 	}
 
 	res, err := h.handleXDefinition(ctx, conn, req, params)
 	if err != nil {
+		// Errors from the server, such as there being no definition,
+		// are answers. Others mean the file couldn't be typechecked,
+		// in which case its own declarations can still be found.
+		if _, ok := err.(*jsonrpc2.Error); !ok && ctx.Err() == nil {
+			if loc, ok := h.syntacticDefinition(ctx, params); ok {
+				return []lsp.Location{loc}, nil
+			}
+		}
 		return nil, err
 	}
 	locs := make([]lsp.Location, 0, len(res))
 	for _, li := range res {
+		if loc, ok := h.docLocation(li); ok {
+			locs = append(locs, loc)
+			continue
+		}
 		locs = append(locs, li.Location)
 	}
 	return locs, nil
 }
 
+func (h *LangHandler) handleTypeDefinition(ctx context.Context, conn jsonrpc2.JSONRPC2, req *jsonrpc2.Request, params lsp.TextDocumentPositionParams) ([]lsp.Location, error) {
+	if h.useGodef(ctx) && !h.config().FollowTypeAliases {
+		fset, res, _, err := h.definitionGodef(ctx, params)
+		if err == godef.ErrNoIdentifierFound {
+			return []lsp.Location{}, nil
+		}
+		if e, ok := err.(*godef.NoDeclarationError); ok {
+			return nil, definitionNotFoundError(params, e.Expr)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !res.TypeStart.IsValid() {
+			// Builtins and unnamed types have no declaration to
+			// jump to.
+			return []lsp.Location{}, nil
+		}
+		return []lsp.Location{goRangeToLSPLocation(h.positionConverter(ctx), fset, res.TypeStart, res.TypeEnd)}, nil
+	}
+
+	if !util.IsURI(params.TextDocument.URI) {
+		return nil, &jsonrpc2.Error{
+			Code:    jsonrpc2.CodeInvalidParams,
+			Message: fmt.Sprintf("%s not yet supported for out-of-workspace URI (%q)", req.Method, params.TextDocument.URI),
+		}
+	}
+
+	fset, node, _, _, pkg, _, err := h.typecheck(ctx, conn, params.TextDocument.URI, params.Position)
+	if err != nil {
+		// Invalid nodes means we tried to click on something which is
+		// not an ident (eg comment/string/etc). Return no locations.
+		if _, ok := err.(*invalidNodeError); ok {
+			return []lsp.Location{}, nil
+		}
+		return nil, err
+	}
+	obj := pkg.ObjectOf(node)
+	if obj == nil {
+		return nil, definitionNotFoundError(params, node.Name)
+	}
+	tobj := typeDeclaration(obj.Type(), h.config().FollowTypeAliases)
+	if tobj == nil || !tobj.Pos().IsValid() {
+		// Builtins have an invalid Pos, and unnamed types have no
+		// declaration.
+		return []lsp.Location{}, nil
+	}
+	return []lsp.Location{goRangeToLSPLocation(h.positionConverter(ctx), fset, tobj.Pos(), tobj.Pos()+token.Pos(len(tobj.Name())))}, nil
+}
+
+// syntacticDefinition returns the declaration of the identifier at params
+// in the same file, as resolved by the parser. It is the fallback for when
+// the file can't be typechecked, so it only knows the file's own
+// declarations and not those of other files, packages or fields. ok is
+// false if there is no such declaration.
+func (h *LangHandler) syntacticDefinition(ctx context.Context, params lsp.TextDocumentPositionParams) (loc lsp.Location, ok bool) {
+	contents, err := h.readFile(ctx, params.TextDocument.URI)
+	if err != nil {
+		return lsp.Location{}, false
+	}
+	offset, valid, _ := offsetForPosition(contents, params.Position, h.positionEncoding())
+	if !valid {
+		return lsp.Location{}, false
+	}
+	fset := token.NewFileSet()
+	f, _ := parser.ParseFile(fset, h.FilePath(params.TextDocument.URI), contents, parser.AllErrors)
+	if f == nil {
+		return lsp.Location{}, false
+	}
+	pos := fset.File(f.Pos()).Pos(offset)
+	path, _ := astutil.PathEnclosingInterval(f, pos, pos)
+	if len(path) == 0 {
+		return lsp.Location{}, false
+	}
+	id, isIdent := path[0].(*ast.Ident)
+	if !isIdent || id.Obj == nil {
+		return lsp.Location{}, false
+	}
+	obj := id.Obj
+	declNode, isNode := obj.Decl.(ast.Node)
+	if !isNode {
+		return lsp.Location{}, false
+	}
+
+	// The identifier declaring the object is the one in its declaration
+	// which refers to it by name.
+	var decl *ast.Ident
+	ast.Inspect(declNode, func(n ast.Node) bool {
+		if id, ok := n.(*ast.Ident); ok && decl == nil && id.Obj == obj && id.Name == obj.Name {
+			decl = id
+		}
+		return decl == nil
+	})
+	if decl == nil {
+		return lsp.Location{}, false
+	}
+	return goRangeToLSPLocation(h.positionConverter(ctx), fset, decl.Pos(), decl.End()), true
+}
+
+// definitionNotFoundError returns the CodeDefinitionNotFound error for the
+// identifier name at params, which has no definition.
+func definitionNotFoundError(params lsp.TextDocumentPositionParams, name string) error {
+	err := &jsonrpc2.Error{
+		Code:    CodeDefinitionNotFound,
+		Message: fmt.Sprintf("no definition found for %s at %s:%d:%d", name, params.TextDocument.URI, params.Position.Line+1, params.Position.Character+1),
+	}
+	err.SetError(DefinitionNotFoundData{TextDocumentPositionParams: params, Identifier: name})
+	return err
+}
+
+// typeDeclaration returns the declaration of the named type or alias typ,
+// or of the one it points to. If followAliases is true, aliases lead to
+// the type they denote. It returns nil if there is no such type.
+func typeDeclaration(typ types.Type, followAliases bool) *types.TypeName {
+	unalias := func(typ types.Type) types.Type {
+		if followAliases {
+			return types.Unalias(typ)
+		}
+		return typ
+	}
+	typ = unalias(typ)
+	if ptr, ok := typ.(*types.Pointer); ok {
+		typ = unalias(ptr.Elem())
+	}
+	switch typ := typ.(type) {
+	case *types.Named:
+		return typ.Obj()
+	case *types.Alias:
+		return typ.Obj()
+	}
+	return nil
+}
+
+// aliasTarget returns the declaration of the type which the alias obj
+// denotes, following aliases of aliases. It returns nil if obj isn't an
+// alias, or if the type has no declaration, as for builtin and unnamed
+// types.
+func aliasTarget(obj types.Object) *types.TypeName {
+	tn, ok := obj.(*types.TypeName)
+	if !ok || !tn.IsAlias() {
+		return nil
+	}
+	named, ok := types.Unalias(tn.Type()).(*types.Named)
+	if !ok || !named.Obj().Pos().IsValid() {
+		return nil
+	}
+	return named.Obj()
+}
+
 var testOSToVFSPath func(osPath string) string
 
 func (h *LangHandler) definitionGodef(ctx context.Context, params lsp.TextDocumentPositionParams) (*token.FileSet, *godef.Result, []lsp.Location, error) {
@@ -58,35 +237,301 @@ func (h *LangHandler) definitionGodef(ctx context.Context, params lsp.TextDocume
 	// convert the path into a real path because 3rd party tools
 	// might load additional code based on the file's package
 	filename := util.UriToRealPath(params.TextDocument.URI)
-	offset, valid, why := offsetForPosition(contents, params.Position)
+	offset, valid, why := offsetForPosition(contents, params.Position, h.positionEncoding())
 	if !valid {
 		return nil, nil, nil, fmt.Errorf("invalid position: %s:%d:%d (%s)", filename, params.Position.Line, params.Position.Character, why)
 	}
 
 	// Invoke godef to determine the position of the definition.
-	fset := token.NewFileSet()
-	res, err := godef.Godef(fset, offset, filename, contents)
+	godefCtx := h.godefBuildContext()
+	file, err := h.godefFile(godefCtx, filename, contents)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	fset := file.FileSet()
+	res, err := file.Godef(offset)
 	if err != nil {
 		return nil, nil, nil, err
 	}
 	if res.Package != nil {
-		// TODO: return directory location. This right now at least matches our
-		// other implementation.
-		return fset, res, []lsp.Location{}, nil
+		loc, err := packageLocation(godefCtx, h.positionConverter(ctx), res.Package.Dir)
+		if err != nil {
+			// We at least match our other implementation by
+			// returning no location.
+			return fset, res, []lsp.Location{}, nil
+		}
+		return fset, res, []lsp.Location{loc}, nil
 	}
-	loc := goRangeToLSPLocation(fset, res.Start, res.End)
+	loc := goRangeToLSPLocation(h.positionConverter(ctx), fset, res.Start, res.End)
 
 	if loc.URI == "file://" {
-		// TODO: builtins do not have valid URIs or locations, so we emit a
-		// phony location here instead. This is better than our other
-		// implementation.
-		loc.URI = util.PathToURI(filepath.Join(build.Default.GOROOT, "/src/builtin/builtin.go"))
-		loc.Range = lsp.Range{}
+		// Builtins do not have valid URIs or locations, so we point at
+		// their declaration in the builtin package's documentation
+		// instead. Builtins can't be renamed or qualified, so the
+		// identifier at the offset is the builtin's name.
+		var ok bool
+		loc, ok = builtinLocation(godefCtx.GOROOT, identAt(contents, offset))
+		if !ok {
+			loc = lsp.Location{URI: util.PathToURI(builtinFile(godefCtx.GOROOT))}
+		}
 	}
 
 	return fset, res, []lsp.Location{loc}, nil
 }
 
+type godefKey struct {
+	filename string
+
+	// hash is of the contents of the file, so that a file is never used
+	// after it changes.
+	hash string
+
+	// The build context affects which packages and files are imported.
+	buildTags, goroot, gopath string
+}
+
+type godefFile struct {
+	file *godef.File
+	err  error
+}
+
+// godefFile returns filename, whose contents are src, parsed by godef.
+// The files are cached, along with the packages godef imports for them,
+// so that successive requests in the same file don't parse them again.
+func (h *LangHandler) godefFile(godefCtx *build.Context, filename string, src []byte) (*godef.File, error) {
+	sum := sha256.Sum256(src)
+	key := godefKey{filename, hex.EncodeToString(sum[:]), strings.Join(godefCtx.BuildTags, ","), godefCtx.GOROOT, godefCtx.GOPATH}
+	r := h.godefCache.Get(key, func() interface{} {
+		file, err := godef.ParseFile(godefCtx, token.NewFileSet(), filename, src)
+		return &godefFile{file: file, err: err}
+	})
+	res, ok := r.(*godefFile)
+	if !ok {
+		// This can happen if we panic
+		return nil, fmt.Errorf("parsing %s failed", filename)
+	}
+	return res.file, res.err
+}
+
+// tagDefinitionGodef returns the location of the struct field whose tag
+// is at params.Position, or no locations if there is no tag there. It is
+// used where godef finds no identifier.
+func (h *LangHandler) tagDefinitionGodef(ctx context.Context, params lsp.TextDocumentPositionParams) ([]lsp.Location, error) {
+	vfsURI := params.TextDocument.URI
+	if testOSToVFSPath != nil {
+		vfsURI = util.PathToURI(testOSToVFSPath(util.UriToPath(vfsURI)))
+	}
+	contents, err := h.readFile(ctx, vfsURI)
+	if err != nil {
+		return nil, err
+	}
+	offset, valid, _ := offsetForPosition(contents, params.Position, h.positionEncoding())
+	if !valid {
+		return []lsp.Location{}, nil
+	}
+	fset := token.NewFileSet()
+	f, _ := parser.ParseFile(fset, util.UriToRealPath(params.TextDocument.URI), contents, 0)
+	if f == nil {
+		return []lsp.Location{}, nil
+	}
+	pos := fset.File(f.Pos()).Pos(offset)
+	path, _ := astutil.PathEnclosingInterval(f, pos, pos)
+	name := tagFieldName(path)
+	if name == nil {
+		return []lsp.Location{}, nil
+	}
+	return []lsp.Location{goRangeToLSPLocation(h.positionConverter(ctx), fset, name.Pos(), name.End())}, nil
+}
+
+// tagFieldName returns the first name of the struct field whose tag is
+// path[0], or nil if path[0] isn't the tag of a named field. path is as
+// returned by PathEnclosingInterval.
+func tagFieldName(path []ast.Node) *ast.Ident {
+	if len(path) < 2 {
+		return nil
+	}
+	field, ok := path[1].(*ast.Field)
+	if !ok || field.Tag == nil || field.Tag != path[0] || len(field.Names) == 0 {
+		return nil
+	}
+	return field.Names[0]
+}
+
+// builtinFile returns the path of the file documenting the builtins in
+// goroot.
+func builtinFile(goroot string) string {
+	return filepath.Join(goroot, "src", "builtin", "builtin.go")
+}
+
+// builtins maps the name of each builtin to the location of its
+// declaration in builtinFile, by GOROOT. Each GOROOT's file is read on
+// first use.
+var builtins struct {
+	mu   sync.Mutex
+	locs map[string]map[string]lsp.Location
+}
+
+// builtinLocation returns the location of the declaration of the builtin
+// name in the builtinFile of goroot. ok is false if there is no such
+// declaration.
+func builtinLocation(goroot, name string) (loc lsp.Location, ok bool) {
+	builtins.mu.Lock()
+	defer builtins.mu.Unlock()
+	locs, read := builtins.locs[goroot]
+	if !read {
+		if builtins.locs == nil {
+			builtins.locs = make(map[string]map[string]lsp.Location)
+		}
+		locs = readBuiltins(goroot)
+		builtins.locs[goroot] = locs
+	}
+	loc, ok = locs[name]
+	return loc, ok
+}
+
+// readBuiltins returns the locations of the declarations in the
+// builtinFile of goroot, by name. It returns nil if the file can't be
+// read.
+func readBuiltins(goroot string) map[string]lsp.Location {
+	filename := builtinFile(goroot)
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, filename, nil, 0)
+	if err != nil {
+		warnf("reading builtin declarations: %s", err)
+		return nil
+	}
+	locs := make(map[string]lsp.Location)
+	add := func(id *ast.Ident) {
+		// The locations are shared by the clients, whatever their
+		// position encoding. Only keywords precede the names, so
+		// bytes count them in every encoding.
+		locs[id.Name] = goRangeToLSPLocation(nil, fset, id.Pos(), id.End())
+	}
+	for _, decl := range f.Decls {
+		switch decl := decl.(type) {
+		case *ast.FuncDecl:
+			add(decl.Name)
+		case *ast.GenDecl:
+			for _, spec := range decl.Specs {
+				switch spec := spec.(type) {
+				case *ast.TypeSpec:
+					add(spec.Name)
+				case *ast.ValueSpec:
+					for _, id := range spec.Names {
+						add(id)
+					}
+				}
+			}
+		}
+	}
+	return locs
+}
+
+// identAt returns the identifier in src which contains offset, if any.
+func identAt(src []byte, offset int) string {
+	start, end := identRangeAt(src, offset)
+	return string(src[start:end])
+}
+
+// identRangeAt returns the offsets of the identifier in src which
+// contains offset. They are equal if there is none.
+func identRangeAt(src []byte, offset int) (start, end int) {
+	if offset > len(src) {
+		return 0, 0
+	}
+	start = offset
+	for start > 0 && isIdentByte(src[start-1]) {
+		start--
+	}
+	end = offset
+	for end < len(src) && isIdentByte(src[end]) {
+		end++
+	}
+	return start, end
+}
+
+// identRange returns the range of the identifier at params, or nil if
+// there is none.
+func (h *LangHandler) identRange(ctx context.Context, params lsp.TextDocumentPositionParams) *lsp.Range {
+	// Godef is given OS paths by the tests, as in definitionGodef.
+	vfsURI := params.TextDocument.URI
+	if testOSToVFSPath != nil {
+		vfsURI = util.PathToURI(testOSToVFSPath(util.UriToPath(vfsURI)))
+	}
+	contents, err := h.readFile(ctx, vfsURI)
+	if err != nil {
+		return nil
+	}
+	offset, valid, _ := offsetForPosition(contents, params.Position, h.positionEncoding())
+	if !valid {
+		return nil
+	}
+	lineStart, _, _ := offsetForPosition(contents, lsp.Position{Line: params.Position.Line}, h.positionEncoding())
+	start, end := identRangeAt(contents, offset)
+	if start == end {
+		return nil
+	}
+	position := func(offset int) lsp.Position {
+		p := token.Position{Line: params.Position.Line + 1, Column: offset - lineStart + 1, Offset: offset}
+		return lspPosition(p, contents, h.positionEncoding())
+	}
+	return &lsp.Range{Start: position(start), End: position(end)}
+}
+
+// supportsDefinitionLinks reports whether the client takes definitions as
+// LocationLinks.
+func (h *LangHandler) supportsDefinitionLinks() bool {
+	dc := h.init.Capabilities.TextDocument.Definition
+	return dc != nil && dc.LinkSupport
+}
+
+// definitionLinks returns the definitions locs of the identifier at
+// params as links from it. The declarations of the definitions aren't
+// known, so their whole range is their name, as is the range selected.
+func (h *LangHandler) definitionLinks(ctx context.Context, params lsp.TextDocumentPositionParams, locs []lsp.Location) []lsp.LocationLink {
+	origin := h.identRange(ctx, params)
+	links := make([]lsp.LocationLink, len(locs))
+	for i, loc := range locs {
+		links[i] = lsp.LocationLink{
+			OriginSelectionRange: origin,
+			TargetURI:            loc.URI,
+			TargetRange:          loc.Range,
+			TargetSelectionRange: loc.Range,
+		}
+	}
+	return links
+}
+
+func isIdentByte(b byte) bool {
+	return b == '_' || 'a' <= b && b <= 'z' || 'A' <= b && b <= 'Z' || '0' <= b && b <= '9'
+}
+
+// packageLocation returns the location of the package clause in the main
+// file of the package in dir, as read from bctx. That is the file named
+// after the directory if there is one, otherwise the first file.
+func packageLocation(bctx *build.Context, conv *positionConverter, dir string) (lsp.Location, error) {
+	bpkg, err := bctx.ImportDir(dir, 0)
+	if err != nil {
+		return lsp.Location{}, err
+	}
+	if len(bpkg.GoFiles) == 0 {
+		return lsp.Location{}, fmt.Errorf("no Go files in %s", dir)
+	}
+	name := bpkg.GoFiles[0]
+	for _, f := range bpkg.GoFiles {
+		if f == filepath.Base(dir)+".go" {
+			name = f
+			break
+		}
+	}
+	fset := token.NewFileSet()
+	f, err := buildutil.ParseFile(fset, bctx, nil, dir, name, parser.PackageClauseOnly)
+	if err != nil {
+		return lsp.Location{}, err
+	}
+	return goRangeToLSPLocation(conv, fset, f.Name.Pos(), f.Name.End()), nil
+}
+
 func (h *LangHandler) handleXDefinition(ctx context.Context, conn jsonrpc2.JSONRPC2, req *jsonrpc2.Request, params lsp.TextDocumentPositionParams) ([]symbolLocationInformation, error) {
 	if !util.IsURI(params.TextDocument.URI) {
 		return nil, &jsonrpc2.Error{
@@ -95,25 +540,61 @@ func (h *LangHandler) handleXDefinition(ctx context.Context, conn jsonrpc2.JSONR
 		}
 	}
 
-	rootPath := h.FilePath(h.init.Root())
+	rootPath := h.folderOf(h.FilePath(params.TextDocument.URI))
 	bctx := h.BuildContext(ctx)
+	conv := h.positionConverter(ctx)
 
-	fset, node, pathEnclosingInterval, _, pkg, _, err := h.typecheck(ctx, conn, params.TextDocument.URI, params.Position)
+	fset, node, pathEnclosingInterval, prog, pkg, _, err := h.typecheck(ctx, conn, params.TextDocument.URI, params.Position)
 	if err != nil {
 		// Invalid nodes means we tried to click on something which is
-		// not an ident (eg comment/string/etc). Return no locations.
-		if _, ok := err.(*invalidNodeError); ok {
-			return []symbolLocationInformation{}, nil
+		// not an ident (eg comment/string/etc). Return no locations,
+		// unless it is an import path, which leads to its package, or a
+		// struct tag, which leads to its field.
+		if _, ok := err.(*invalidNodeError); !ok {
+			return nil, err
+		}
+		if spec := importSpecOfPath(pathEnclosingInterval); spec != nil {
+			return importDefinition(ctx, bctx, rootPath, conv, fset, prog, pkg, spec, h.getFindPackageFunc())
+		}
+		if id, path := instantiatedIdent(&pkg.Info, pathEnclosingInterval); id != nil {
+			// The brackets and commas of an instantiation lead to
+			// the generic function or type.
+			node, pathEnclosingInterval = id, path
+		} else {
+			node = tagFieldName(pathEnclosingInterval)
+			if node == nil {
+				return []symbolLocationInformation{}, nil
+			}
+			pathEnclosingInterval = append([]ast.Node{node}, pathEnclosingInterval[1:]...)
 		}
-		return nil, err
 	}
 
-	var nodes []*ast.Ident
-	obj, ok := pkg.Uses[node]
+	span, ctx := startChildSpan(ctx, "langserver-go: build result")
+	defer span.Finish()
+
+	var (
+		nodes     []*ast.Ident
+		ambiguous bool
+	)
+	// The selection of a selector is the field or method it selects,
+	// however long the chain of calls and selectors before it. Uses
+	// records the binding each other use resolves to, so the innermost
+	// of shadowed declarations is found. Declaring identifiers are in
+	// Defs instead.
+	obj := selectedObject(&pkg.Info, pathEnclosingInterval)
+	ok := obj != nil
+	if !ok {
+		obj, ok = pkg.Uses[node]
+	}
 	if !ok {
 		obj, ok = pkg.Defs[node]
 	}
 	if ok && obj != nil {
+		if h.config().FollowTypeAliases {
+			if target := aliasTarget(obj); target != nil {
+				return typeNameDefinition(ctx, bctx, rootPath, conv, fset, target, h.getFindPackageFunc())
+			}
+		}
 		if p := obj.Pos(); p.IsValid() {
 			nodes = append(nodes, &ast.Ident{NamePos: p, Name: obj.Name()})
 		} else {
@@ -124,16 +605,39 @@ func (h *LangHandler) handleXDefinition(ctx context.Context, conn jsonrpc2.JSONR
 			// (pointing to builtin/builtin.go).
 			return []symbolLocationInformation{}, nil
 		}
+	} else if len(pathEnclosingInterval) > 1 {
+		// go/types doesn't resolve an ambiguous selector, such as a
+		// field promoted through two embedded types at the same depth,
+		// so offer each of the candidates instead.
+		if sel, isSel := pathEnclosingInterval[1].(*ast.SelectorExpr); isSel && sel.Sel == node {
+			if T := pkg.TypeOf(sel.X); T != nil {
+				for _, obj := range ambiguousSelection(T, pkg.Pkg, node.Name) {
+					nodes = append(nodes, &ast.Ident{NamePos: obj.Pos(), Name: obj.Name()})
+				}
+				ambiguous = true
+			}
+		}
 	}
 	if len(nodes) == 0 {
-		return nil, errors.New("definition not found")
+		if isCgoReference(&pkg.Info, pathEnclosingInterval) {
+			// C's declarations are in the comments of the files
+			// importing it, which aren't typechecked.
+			return []symbolLocationInformation{}, nil
+		}
+		return nil, definitionNotFoundError(params, node.Name)
 	}
 	findPackage := h.getFindPackageFunc()
 	locs := make([]symbolLocationInformation, 0, len(nodes))
 	for _, node := range nodes {
 		// Determine location information for the node.
 		l := symbolLocationInformation{
-			Location: goRangeToLSPLocation(fset, node.Pos(), node.End()),
+			Location: goRangeToLSPLocation(conv, fset, node.Pos(), node.End()),
+		}
+		if ambiguous {
+			// DefInfo needs the selection, which go/types doesn't
+			// record for an ambiguous selector.
+			locs = append(locs, l)
+			continue
 		}
 
 		// Determine metadata information for the node.
@@ -141,15 +645,258 @@ func (h *LangHandler) handleXDefinition(ctx context.Context, conn jsonrpc2.JSONR
 			symDesc, err := defSymbolDescriptor(ctx, bctx, rootPath, *def, findPackage)
 			if err != nil {
 				// TODO: tracing
-				log.Println("refs.DefInfo:", err)
+				debugf("refs.DefInfo: %s", err)
 			} else {
 				l.Symbol = symDesc
 			}
 		} else {
+			// Some definitions have no symbol, such as the fields of
+			// anonymous struct types, which no named type declares,
+			// but they are still located in the source.
 			// TODO: tracing
-			log.Println("refs.DefInfo:", err)
+			debugf("refs.DefInfo: %s", err)
 		}
 		locs = append(locs, l)
 	}
+	if c := typeParamConstraint(obj); c != nil {
+		// A type parameter also leads to its constraint, which says
+		// what it can be.
+		cl, err := typeNameDefinition(ctx, bctx, rootPath, conv, fset, c, findPackage)
+		if err != nil {
+			return nil, err
+		}
+		locs = append(locs, cl...)
+	}
 	return locs, nil
 }
+
+// selectedObject returns the field or method selected by the selector
+// whose name is path[0], as recorded in the Selections of info, or nil if
+// path[0] isn't the name of a selector of a field or method.
+func selectedObject(info *types.Info, path []ast.Node) types.Object {
+	if len(path) < 2 {
+		return nil
+	}
+	sel, ok := path[1].(*ast.SelectorExpr)
+	if !ok || sel.Sel != path[0] {
+		return nil
+	}
+	if s, ok := info.Selections[sel]; ok {
+		return s.Obj()
+	}
+	return nil
+}
+
+// isCgoReference reports whether path[0] is the selected name of a member
+// of the "C" package of cgo, such as printf in "C.printf". The type
+// checker fakes the package, so such names have no object.
+func isCgoReference(info *types.Info, path []ast.Node) bool {
+	if len(path) < 2 {
+		return false
+	}
+	sel, ok := path[1].(*ast.SelectorExpr)
+	if !ok || sel.Sel != path[0] {
+		return false
+	}
+	x, ok := sel.X.(*ast.Ident)
+	if !ok {
+		return false
+	}
+	pkgName, ok := info.Uses[x].(*types.PkgName)
+	return ok && pkgName.Imported().Path() == "C"
+}
+
+// instantiatedIdent returns the identifier of the generic function or
+// type instantiated by the index expression path[0], such as Map in
+// "Map[int, string]", along with the path to it. It returns nil if
+// path[0] isn't an instantiation, as when it indexes a slice or map.
+func instantiatedIdent(info *types.Info, path []ast.Node) (*ast.Ident, []ast.Node) {
+	var x ast.Expr
+	switch n := path[0].(type) {
+	case *ast.IndexExpr:
+		x = n.X
+	case *ast.IndexListExpr:
+		x = n.X
+	default:
+		return nil, nil
+	}
+	var id *ast.Ident
+	switch x := x.(type) {
+	case *ast.Ident:
+		id = x
+		path = append([]ast.Node{id}, path...)
+	case *ast.SelectorExpr:
+		id = x.Sel
+		path = append([]ast.Node{id, x}, path...)
+	default:
+		return nil, nil
+	}
+	if !isGeneric(info.Uses[id]) {
+		return nil, nil
+	}
+	return id, path
+}
+
+// isGeneric reports whether obj is a generic function or type. The
+// identifier of an instantiation uses the generic object, so this tells
+// instantiations from other index expressions without Info.Instances,
+// which the loader doesn't record.
+func isGeneric(obj types.Object) bool {
+	switch obj := obj.(type) {
+	case *types.Func:
+		sig, ok := obj.Type().(*types.Signature)
+		return ok && sig.TypeParams().Len() > 0
+	case *types.TypeName:
+		named, ok := obj.Type().(*types.Named)
+		return ok && !obj.IsAlias() && named.TypeParams().Len() > 0
+	}
+	return false
+}
+
+// typeParamConstraint returns the declaration of the constraint of the
+// type parameter obj. It returns nil if obj isn't a type parameter, or if
+// its constraint is predeclared, like any, or a literal interface.
+func typeParamConstraint(obj types.Object) *types.TypeName {
+	tn, ok := obj.(*types.TypeName)
+	if !ok {
+		return nil
+	}
+	tparam, ok := tn.Type().(*types.TypeParam)
+	if !ok {
+		return nil
+	}
+	c := typeDeclaration(tparam.Constraint(), false)
+	if c == nil || !c.Pos().IsValid() {
+		return nil
+	}
+	return c
+}
+
+// importDefinition returns the location of the package imported by spec,
+// which is the package clause of its main file as for packageLocation. The
+// package is the one the type checker loaded for spec, so an import of a
+// vendored package leads to the copy in the nearest vendor directory.
+func importDefinition(ctx context.Context, bctx *build.Context, rootPath string, conv *positionConverter, fset *token.FileSet, prog *loader.Program, pkg *loader.PackageInfo, spec *ast.ImportSpec, findPackage FindPackageFunc) ([]symbolLocationInformation, error) {
+	pkgName := importPkgName(pkg, spec)
+	if pkgName == nil {
+		return []symbolLocationInformation{}, nil
+	}
+	imported := prog.AllPackages[pkgName.Imported()]
+	if imported == nil || len(imported.Files) == 0 {
+		return []symbolLocationInformation{}, nil
+	}
+	f := imported.Files[0]
+	for _, file := range imported.Files {
+		name := fset.File(file.Pos()).Name()
+		if filepath.Base(name) == filepath.Base(filepath.Dir(name))+".go" {
+			f = file
+			break
+		}
+	}
+	l := symbolLocationInformation{
+		Location: goRangeToLSPLocation(conv, fset, f.Name.Pos(), f.Name.End()),
+	}
+	def := refs.Def{ImportPath: imported.Pkg.Path(), PackageName: imported.Pkg.Name()}
+	if symDesc, err := defSymbolDescriptor(ctx, bctx, rootPath, def, findPackage); err == nil {
+		l.Symbol = symDesc
+	} else {
+		// TODO: tracing
+		debugf("defSymbolDescriptor: %s", err)
+	}
+	return []symbolLocationInformation{l}, nil
+}
+
+// typeNameDefinition returns the location of the declaration of the named
+// type obj. Only package-level types have a symbol descriptor.
+func typeNameDefinition(ctx context.Context, bctx *build.Context, rootPath string, conv *positionConverter, fset *token.FileSet, obj *types.TypeName, findPackage FindPackageFunc) ([]symbolLocationInformation, error) {
+	l := symbolLocationInformation{
+		Location: goRangeToLSPLocation(conv, fset, obj.Pos(), obj.Pos()+token.Pos(len(obj.Name()))),
+	}
+	if obj.Pkg() != nil && obj.Parent() == obj.Pkg().Scope() {
+		def := refs.Def{ImportPath: obj.Pkg().Path(), PackageName: obj.Pkg().Name(), Path: obj.Name()}
+		if symDesc, err := defSymbolDescriptor(ctx, bctx, rootPath, def, findPackage); err == nil {
+			l.Symbol = symDesc
+		} else {
+			// TODO: tracing
+			debugf("defSymbolDescriptor: %s", err)
+		}
+	}
+	return []symbolLocationInformation{l}, nil
+}
+
+// importSpecOfPath returns the import spec whose path is path[0], or nil
+// if path[0] isn't an import path. path is as returned by
+// PathEnclosingInterval.
+func importSpecOfPath(path []ast.Node) *ast.ImportSpec {
+	if len(path) < 2 {
+		return nil
+	}
+	spec, ok := path[1].(*ast.ImportSpec)
+	if !ok || spec.Path != path[0] {
+		return nil
+	}
+	return spec
+}
+
+// importPkgName returns the package name declared by spec in pkg, which is
+// implicit unless spec names the package. It returns nil if spec wasn't
+// type checked.
+func importPkgName(pkg *loader.PackageInfo, spec *ast.ImportSpec) *types.PkgName {
+	obj := pkg.Implicits[spec]
+	if obj == nil && spec.Name != nil {
+		obj = pkg.Defs[spec.Name]
+	}
+	pkgName, _ := obj.(*types.PkgName)
+	return pkgName
+}
+
+// ambiguousSelection returns the fields and methods named name, as used in
+// pkg, which are at the shallowest embedding depth of T that has any. More
+// than one means a selector of name on a value of type T is ambiguous.
+func ambiguousSelection(T types.Type, pkg *types.Package, name string) []types.Object {
+	id := types.Id(pkg, name)
+	seen := make(map[*types.Named]bool)
+	for level := []types.Type{T}; len(level) > 0; {
+		var (
+			found []types.Object
+			next  []types.Type
+		)
+		for _, typ := range level {
+			typ = deref(typ)
+			if named, ok := typ.(*types.Named); ok {
+				if seen[named] {
+					continue
+				}
+				seen[named] = true
+				for i := 0; i < named.NumMethods(); i++ {
+					if m := named.Method(i); m.Id() == id {
+						found = append(found, m)
+					}
+				}
+			}
+			switch u := typ.Underlying().(type) {
+			case *types.Struct:
+				for i := 0; i < u.NumFields(); i++ {
+					f := u.Field(i)
+					if f.Id() == id {
+						found = append(found, f)
+					}
+					if f.Anonymous() {
+						next = append(next, f.Type())
+					}
+				}
+			case *types.Interface:
+				for i := 0; i < u.NumMethods(); i++ {
+					if m := u.Method(i); m.Id() == id {
+						found = append(found, m)
+					}
+				}
+			}
+		}
+		if len(found) > 0 {
+			return found
+		}
+		level = next
+	}
+	return nil
+}
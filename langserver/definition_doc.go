@@ -0,0 +1,49 @@
+package langserver
+
+import (
+	"strings"
+
+	"github.com/sourcegraph/go-langserver/langserver/util"
+	"github.com/sourcegraph/go-langserver/pkg/lsp"
+)
+
+// docLocation returns the location of the documentation of the symbol
+// defined at li, if Config.DefinitionTarget is "doc" and the definition
+// is outside of the workspace folders. The location is the page of the
+// symbol on the documentation server of Config.DocLinkBaseURL, which the
+// client opens instead of the source. ok is false if the definition is
+// to be shown as source.
+func (h *LangHandler) docLocation(li symbolLocationInformation) (loc lsp.Location, ok bool) {
+	cfg := h.config()
+	if cfg.DefinitionTarget != definitionTargetDoc || cfg.DocLinkBaseURL == "" || li.Symbol == nil {
+		return lsp.Location{}, false
+	}
+	filename := h.FilePath(li.Location.URI)
+	for _, folder := range h.workspaceFolders() {
+		if util.PathHasPrefix(filename, folder) {
+			return lsp.Location{}, false
+		}
+	}
+	return lsp.Location{URI: lsp.DocumentURI(docURL(cfg.DocLinkBaseURL, li.Symbol))}, true
+}
+
+// docURL returns the URL of the documentation of the symbol desc on the
+// documentation server baseURL, whose package pages anchor declarations
+// by name and methods and fields by their receiver and name, as
+// pkg.go.dev and godoc do.
+func docURL(baseURL string, desc *symbolDescriptor) string {
+	importPath := desc.Package
+	// Vendored packages are documented under their own import path.
+	if i := strings.LastIndex(importPath, "/vendor/"); i >= 0 {
+		importPath = importPath[i+len("/vendor/"):]
+	}
+	importPath = strings.TrimPrefix(importPath, "vendor/")
+	u := strings.TrimSuffix(baseURL, "/") + "/" + importPath
+	switch {
+	case desc.Recv != "":
+		u += "#" + desc.Recv + "." + desc.Name
+	case desc.Name != "":
+		u += "#" + desc.Name
+	}
+	return u
+}
@@ -0,0 +1,256 @@
+package langserver
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/sourcegraph/go-langserver/langserver/internal/godef"
+	"github.com/sourcegraph/go-langserver/langserver/util"
+	"github.com/sourcegraph/go-langserver/pkg/lsp"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+func TestBuiltinLocation(t *testing.T) {
+	goroot := build.Default.GOROOT
+	f, err := os.Open(builtinFile(goroot))
+	if err != nil {
+		t.Skip(err)
+	}
+	defer f.Close()
+	var lines []string
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		lines = append(lines, s.Text())
+	}
+	if err := s.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]string{
+		"append": "func append(",
+		"make":   "func make(",
+		"int":    "type int int",
+		"error":  "type error interface",
+		"true":   "true",
+		"nil":    "var nil ",
+	}
+	for name, want := range tests {
+		loc, ok := builtinLocation(goroot, name)
+		if !ok {
+			t.Errorf("%s: no location", name)
+			continue
+		}
+		if got := util.UriToPath(loc.URI); got != builtinFile(goroot) {
+			t.Errorf("%s: got file %q, want %q", name, got, builtinFile(goroot))
+		}
+		line := lines[loc.Range.Start.Line]
+		if got := line[loc.Range.Start.Character:loc.Range.End.Character]; got != name {
+			t.Errorf("%s: got range %+v covering %q", name, loc.Range, got)
+		}
+		if !strings.Contains(line, want) {
+			t.Errorf("%s: got line %q, want it to contain %q", name, line, want)
+		}
+	}
+	if loc, ok := builtinLocation(goroot, "notabuiltin"); ok {
+		t.Errorf("got location %+v for a name which isn't a builtin", loc)
+	}
+}
+
+// TestOnDiskLocation checks that the locations of declarations in files
+// which are only on disk, as in GOROOT, have URIs the client can open.
+func TestOnDiskLocation(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "on-disk-location")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	escaped := filepath.Join(tmp, "a dir#1", "p.go")
+	if err := os.MkdirAll(filepath.Dir(escaped), 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(escaped, []byte("package p\n\nfunc Println() {}\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, filename := range []string{filepath.Join(build.Default.GOROOT, "src", "fmt", "print.go"), escaped} {
+		src, err := ioutil.ReadFile(filename)
+		if err != nil {
+			t.Skip(err)
+		}
+		fset := token.NewFileSet()
+		f, err := parser.ParseFile(fset, filename, src, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		obj := f.Scope.Lookup("Println")
+		if obj == nil {
+			t.Fatalf("%s: Println not declared", filename)
+		}
+		name := obj.Decl.(*ast.FuncDecl).Name
+		loc := goRangeToLSPLocation(nil, fset, name.Pos(), name.End())
+
+		if _, err := url.Parse(string(loc.URI)); err != nil || !util.IsURI(loc.URI) {
+			t.Errorf("%s: got invalid URI %q (%v)", filename, loc.URI, err)
+		}
+		if got := util.UriToRealPath(loc.URI); got != filename {
+			t.Errorf("%s: got URI %q for file %q", filename, loc.URI, got)
+			continue
+		}
+		lines := strings.Split(string(src), "\n")
+		if got := lines[loc.Range.Start.Line]; !strings.HasPrefix(got, "func Println(") {
+			t.Errorf("%s: got line %d %q, want the declaration of Println", filename, loc.Range.Start.Line, got)
+		}
+	}
+}
+
+func TestIdentAt(t *testing.T) {
+	src := []byte("x := append(s, 1)")
+	for offset, want := range map[int]string{0: "x", 1: "x", 2: "", 5: "append", 8: "append", 11: "append", 12: "s", 18: ""} {
+		if got := identAt(src, offset); got != want {
+			t.Errorf("identAt(%q, %d) = %q, want %q", src, offset, got, want)
+		}
+	}
+}
+
+func TestGodefFileCache(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "godef-file-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	a, b := filepath.Join(tmp, "a.go"), filepath.Join(tmp, "b.go")
+	src := []byte("package p\n\nfunc A() { B() }\n")
+	for filename, contents := range map[string][]byte{a: src, b: []byte("package p\n\nfunc B() {}\n")} {
+		if err := ioutil.WriteFile(filename, contents, 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	h := &LangHandler{Config: NewDefaultConfig(), HandlerShared: &HandlerShared{}}
+	h.resetCaches(false)
+	bctx := h.godefBuildContext()
+	file := func(src []byte) *godef.File {
+		f, err := h.godefFile(bctx, a, src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return f
+	}
+
+	f := file(src)
+	res, err := f.Godef(bytes.Index(src, []byte("B()")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := f.FileSet().Position(res.Start); got.Filename != b || got.Line != 3 {
+		t.Errorf("got definition at %s, want %s:3", got, b)
+	}
+	if file(src) != f {
+		t.Error("got a new file for the same contents")
+	}
+	if file(append(src, '\n')) == f {
+		t.Error("got the same file for different contents")
+	}
+	// The file's definitions are in b.go, so they may be out of date once
+	// it changes.
+	h.invalidateFile(util.PathToURI(b))
+	if file(src) == f {
+		t.Error("got the same file after another file of its package changed")
+	}
+}
+
+func TestDefinitionLinks(t *testing.T) {
+	h := &LangHandler{Config: NewDefaultConfig(), HandlerShared: &HandlerShared{}}
+	addr, done := startServer(t, jsonrpc2.HandlerWithError(h.handle))
+	defer done()
+	conn := dialServer(t, addr)
+	defer conn.Close()
+
+	ctx := context.Background()
+	var caps lsp.ClientCapabilities
+	caps.TextDocument.Definition = &struct {
+		LinkSupport bool `json:"linkSupport,omitempty"`
+	}{LinkSupport: true}
+	if err := conn.Call(ctx, "initialize", InitializeParams{
+		InitializeParams:     lsp.InitializeParams{RootURI: "file:///src/test/pkg", Capabilities: caps},
+		NoOSFileSystemAccess: true,
+		BuildContext: &InitializeBuildContextParams{
+			GOOS:     "linux",
+			GOARCH:   "amd64",
+			GOPATH:   "/",
+			GOROOT:   "/goroot",
+			Compiler: runtime.Compiler,
+		},
+	}, nil); err != nil {
+		t.Fatal("initialize:", err)
+	}
+	uri := lsp.DocumentURI("file:///src/test/pkg/a.go")
+	if err := conn.Call(ctx, "textDocument/didOpen", lsp.DidOpenTextDocumentParams{
+		TextDocument: lsp.TextDocumentItem{URI: uri, Version: 1, Text: "package p\n\nfunc Foo() { Foo() }\n"},
+	}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	var links []lsp.LocationLink
+	if err := conn.Call(ctx, "textDocument/definition", lsp.TextDocumentPositionParams{
+		TextDocument: lsp.TextDocumentIdentifier{URI: uri},
+		Position:     lsp.Position{Line: 2, Character: 15},
+	}, &links); err != nil {
+		t.Fatal(err)
+	}
+	name := lsp.Range{Start: lsp.Position{Line: 2, Character: 5}, End: lsp.Position{Line: 2, Character: 8}}
+	want := []lsp.LocationLink{{
+		OriginSelectionRange: &lsp.Range{Start: lsp.Position{Line: 2, Character: 13}, End: lsp.Position{Line: 2, Character: 16}},
+		TargetURI:            uri,
+		TargetRange:          name,
+		TargetSelectionRange: name,
+	}}
+	if !reflect.DeepEqual(links, want) {
+		t.Errorf("got links %+v, want %+v", links, want)
+	}
+}
+
+func TestDocLocation(t *testing.T) {
+	h := &LangHandler{Config: NewDefaultConfig(), HandlerShared: &HandlerShared{}}
+	h.folders = []string{"/src/test/pkg"}
+	h.Config.DefinitionTarget = definitionTargetDoc
+	h.Config.DocLinkBaseURL = "https://pkg.go.dev/"
+
+	tests := []struct {
+		uri  lsp.DocumentURI
+		desc symbolDescriptor
+		want string // "" if the definition is shown as source
+	}{
+		{"file:///goroot/src/fmt/print.go", symbolDescriptor{Package: "fmt", Name: "Println"}, "https://pkg.go.dev/fmt#Println"},
+		{"file:///goroot/src/strings/builder.go", symbolDescriptor{Package: "strings", Recv: "Builder", Name: "Len"}, "https://pkg.go.dev/strings#Builder.Len"},
+		{"file:///goroot/src/fmt/doc.go", symbolDescriptor{Package: "fmt"}, "https://pkg.go.dev/fmt"},
+		{"file:///src/test/pkg/vendor/github.com/a/b/b.go", symbolDescriptor{Package: "test/pkg/vendor/github.com/a/b", Name: "B"}, ""},
+		{"file:///gopath/src/x/vendor/github.com/a/b/b.go", symbolDescriptor{Package: "x/vendor/github.com/a/b", Name: "B"}, "https://pkg.go.dev/github.com/a/b#B"},
+		{"file:///src/test/pkg/a.go", symbolDescriptor{Package: "test/pkg", Name: "A"}, ""},
+	}
+	for _, test := range tests {
+		desc := test.desc
+		loc, ok := h.docLocation(symbolLocationInformation{Location: lsp.Location{URI: test.uri}, Symbol: &desc})
+		if got := string(loc.URI); ok != (test.want != "") || got != test.want {
+			t.Errorf("%s: got %q, %v, want %q", test.uri, got, ok, test.want)
+		}
+	}
+
+	h.Config.DefinitionTarget = definitionTargetSource
+	if _, ok := h.docLocation(symbolLocationInformation{Location: lsp.Location{URI: "file:///goroot/src/fmt/print.go"}, Symbol: &symbolDescriptor{Package: "fmt", Name: "Println"}}); ok {
+		t.Error("got a documentation location with definitions leading to the source")
+	}
+}
@@ -3,11 +3,17 @@ package langserver
 import (
 	"context"
 	"fmt"
+	"go/build"
+	"go/parser"
 	"go/scanner"
 	"go/token"
 	"go/types"
+	"path"
 	"strings"
+	"sync"
+	"time"
 
+	opentracing "github.com/opentracing/opentracing-go"
 	"golang.org/x/tools/go/loader"
 
 	"github.com/sourcegraph/go-langserver/pkg/lsp"
@@ -18,34 +24,199 @@ import (
 
 type diagnostics map[string][]*lsp.Diagnostic // map of URI to diagnostics (for PublishDiagnosticParams)
 
-// publishDiagnostics sends diagnostic information (such as compile
-// errors) to the client.
-func (h *LangHandler) publishDiagnostics(ctx context.Context, conn jsonrpc2.JSONRPC2, diags diagnostics) error {
-	// Our diagnostics are currently disabled because they behave
-	// incorrectly. We do not keep track of which files have failed /
-	// succeeded, so we do not send empty diagnostics to clear compiler
-	// errors/etc. https://github.com/sourcegraph/go-langserver/issues/23
-	// Leaving the code here for when we do actually fix this.
-	if cake := false; !cake {
-		return nil
+// diagnosticsState tracks the diagnostics published to the client.
+type diagnosticsState struct {
+	mu sync.Mutex
+
+	// pending holds the scheduled typecheck of each changed package,
+	// keyed by its directory.
+	pending map[string]*time.Timer
+
+	// published holds the files whose last published diagnostics were
+	// not empty, and so must be cleared once they have none.
+	published map[string]bool
+
+	// typeErrors and unusedImports hold the last diagnostics of each
+	// file found by typechecking and by unusedImports. They are
+	// published together, as each publication replaces the last.
+	typeErrors    diagnostics
+	unusedImports diagnostics
+}
+
+func newDiagnosticsState() *diagnosticsState {
+	return &diagnosticsState{
+		pending:       make(map[string]*time.Timer),
+		published:     make(map[string]bool),
+		typeErrors:    make(diagnostics),
+		unusedImports: make(diagnostics),
+	}
+}
+
+// scheduleDiagnostics typechecks the package of the document uri and
+// publishes its diagnostics once Config.DiagnosticsDebounceMs have passed.
+// If a document in the same package changes before that, the delay starts
+// over, so that typing doesn't start a typecheck for every keystroke.
+// Other packages' scheduled typechecks are unaffected, and closing the
+// document doesn't cancel it.
+func (h *LangHandler) scheduleDiagnostics(ctx context.Context, conn jsonrpc2.JSONRPC2, uri lsp.DocumentURI) {
+	h.mu.Lock()
+	s := h.diagnostics
+	h.mu.Unlock()
+
+	dir := path.Dir(h.FilePath(uri))
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if t := s.pending[dir]; t != nil {
+		t.Stop()
+	}
+	var t *time.Timer
+	t = time.AfterFunc(time.Duration(h.config().DiagnosticsDebounceMs)*time.Millisecond, func() {
+		s.mu.Lock()
+		if s.pending[dir] == t {
+			delete(s.pending, dir)
+		}
+		s.mu.Unlock()
+
+		// The request which scheduled this is long done, so its
+		// context can't be used.
+		span := startSpanFollowsFromContext(ctx, "langserver-go: publish diagnostics", opentracing.Tags{"uri": uri})
+		defer span.Finish()
+		ctx := opentracing.ContextWithSpan(context.Background(), span)
+		if err := h.diagnose(ctx, conn, uri); err != nil {
+			warnf("failed to publish diagnostics for %s: %s.", uri, err)
+		}
+	})
+	s.pending[dir] = t
+}
+
+// diagnose typechecks the package containing the document uri and
+// publishes the diagnostics of its files.
+func (h *LangHandler) diagnose(ctx context.Context, conn jsonrpc2.JSONRPC2, uri lsp.DocumentURI) error {
+	filename := h.FilePath(uri)
+	bctx := h.BuildContext(ctx)
+	bpkg, err := containingPackage(bctx, filename, h.mainModule(bctx, filename))
+	if mpErr, ok := err.(*build.MultiplePackageError); ok {
+		bpkg, err = buildPackageForNamedFileInMultiPackageDir(bpkg, mpErr, path.Base(filename))
+	}
+	if err != nil {
+		return err
 	}
+	_, _, diags, err := h.cachedTypecheck(ctx, bctx, bpkg)
+	if err != nil {
+		return err
+	}
+	return h.publishDiagnostics(ctx, conn, diags, packageFiles(bctx, bpkg))
+}
+
+// publishDiagnostics sends diagnostic information (such as compile
+// errors) to the client. clear lists files whose diagnostics, if any were
+// published, are now out of date: those without diags are sent an empty
+// list so that the client removes them.
+func (h *LangHandler) publishDiagnostics(ctx context.Context, conn jsonrpc2.JSONRPC2, diags diagnostics, clear []string) error {
+	h.mu.Lock()
+	s := h.diagnostics
+	h.mu.Unlock()
 
-	for filename, diags := range diags {
-		params := lsp.PublishDiagnosticsParams{
-			URI:         util.PathToURI(filename),
-			Diagnostics: make([]lsp.Diagnostic, len(diags)),
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	files := make(map[string]bool, len(diags)+len(clear))
+	for filename := range diags {
+		files[filename] = true
+	}
+	for _, filename := range clear {
+		if s.published[filename] {
+			files[filename] = true
 		}
-		for i, d := range diags {
-			params.Diagnostics[i] = *d
+	}
+	for filename := range files {
+		if len(diags[filename]) > 0 {
+			s.typeErrors[filename] = diags[filename]
+		} else {
+			delete(s.typeErrors, filename)
 		}
-		if err := conn.Notify(ctx, "textDocument/publishDiagnostics", params); err != nil {
+		if err := s.publish(ctx, conn, filename); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
-func errsToDiagnostics(typeErrs []error, prog *loader.Program) (diagnostics, error) {
+// publishUnusedImports publishes the unused imports of the document uri,
+// along with its last type errors.
+func (h *LangHandler) publishUnusedImports(ctx context.Context, conn jsonrpc2.JSONRPC2, uri lsp.DocumentURI) error {
+	filename := h.FilePath(uri)
+	contents, err := h.readFile(ctx, uri)
+	if err != nil {
+		return err
+	}
+	var unused []*lsp.Diagnostic
+	// A document which doesn't parse, as while it is being typed, may
+	// be missing uses, so nothing is reported until it parses again.
+	fset := token.NewFileSet()
+	if f, err := parser.ParseFile(fset, filename, contents, 0); err == nil {
+		unused = unusedImports(fset, f, contents, h.positionEncoding())
+	}
+
+	h.mu.Lock()
+	s := h.diagnostics
+	h.mu.Unlock()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(unused) == 0 && len(s.unusedImports[filename]) == 0 {
+		return nil
+	}
+	if len(unused) > 0 {
+		s.unusedImports[filename] = unused
+	} else {
+		delete(s.unusedImports, filename)
+	}
+	return s.publish(ctx, conn, filename)
+}
+
+// publish sends the type errors and unused imports of filename to the
+// client, unless it has none and none were published before. An unused
+// import which is also a type error is sent once. s.mu must be held.
+func (s *diagnosticsState) publish(ctx context.Context, conn jsonrpc2.JSONRPC2, filename string) error {
+	all := append([]*lsp.Diagnostic(nil), s.typeErrors[filename]...)
+	for _, d := range s.unusedImports[filename] {
+		if !containsDiagnostic(s.typeErrors[filename], d) {
+			all = append(all, d)
+		}
+	}
+	if len(all) == 0 && !s.published[filename] {
+		return nil
+	}
+	params := lsp.PublishDiagnosticsParams{
+		URI:         util.PathToURI(filename),
+		Diagnostics: make([]lsp.Diagnostic, len(all)),
+	}
+	for i, d := range all {
+		params.Diagnostics[i] = *d
+	}
+	if err := conn.Notify(ctx, "textDocument/publishDiagnostics", params); err != nil {
+		return err
+	}
+	if len(params.Diagnostics) > 0 {
+		s.published[filename] = true
+	} else {
+		delete(s.published, filename)
+	}
+	return nil
+}
+
+// containsDiagnostic reports whether diags has a diagnostic with the
+// message of d, starting where d does.
+func containsDiagnostic(diags []*lsp.Diagnostic, d *lsp.Diagnostic) bool {
+	for _, d2 := range diags {
+		if d2.Message == d.Message && d2.Range.Start == d.Range.Start {
+			return true
+		}
+	}
+	return false
+}
+
+func errsToDiagnostics(conv *positionConverter, typeErrs []error, prog *loader.Program) diagnostics {
 	var diags diagnostics
 	for _, typeErr := range typeErrs {
 		var (
@@ -74,11 +245,14 @@ func errsToDiagnostics(typeErrs []error, prog *loader.Program) (diagnostics, err
 				msg = fmt.Sprintf("%s (and %d more errors)", msg, len(e)-1)
 			}
 		default:
-			return nil, fmt.Errorf("unexpected type error: %#+v", typeErr)
+			// Errors without a position, such as cgo failing
+			// to process a dependency's files, can't be shown
+			// with a file. They don't stop the rest of the
+			// program from being typechecked.
+			warnf("typechecking: %s", typeErr)
+			continue
 		}
-		// LSP is 0-indexed, so subtract one from the numbers Go reports.
-		start := lsp.Position{Line: p.Line - 1, Character: p.Column - 1}
-		end := lsp.Position{Line: pEnd.Line - 1, Character: pEnd.Column - 1}
+		start, end := conv.position(p), conv.position(pEnd)
 		if !pEnd.IsValid() {
 			end = start
 		}
@@ -96,5 +270,5 @@ func errsToDiagnostics(typeErrs []error, prog *loader.Program) (diagnostics, err
 		}
 		diags[p.Filename] = append(diags[p.Filename], diag)
 	}
-	return diags, nil
+	return diags
 }
@@ -0,0 +1,229 @@
+package langserver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"reflect"
+	"runtime"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/sourcegraph/go-langserver/pkg/lsp"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+func TestDiagnostics(t *testing.T) {
+	cfg := NewDefaultConfig()
+	cfg.DiagnosticsDebounceMs = 50
+	delay := 50 * time.Millisecond
+	conn, published, done := startDiagnosticsServer(t, cfg)
+	defer done()
+
+	ctx := context.Background()
+	const (
+		a = "file:///src/test/pkg/a.go"
+		b = "file:///src/test/pkg/b.go"
+		q = "file:///src/test/pkg/q/q.go"
+	)
+	notify := func(method string, params interface{}) {
+		if err := conn.Call(ctx, method, params, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	open := func(uri lsp.DocumentURI, text string) {
+		notify("textDocument/didOpen", lsp.DidOpenTextDocumentParams{
+			TextDocument: lsp.TextDocumentItem{URI: uri, Version: 1, Text: text},
+		})
+	}
+	change := func(uri lsp.DocumentURI, version int, text string) {
+		notify("textDocument/didChange", lsp.DidChangeTextDocumentParams{
+			TextDocument:   lsp.VersionedTextDocumentIdentifier{TextDocumentIdentifier: lsp.TextDocumentIdentifier{URI: uri}, Version: version},
+			ContentChanges: []lsp.TextDocumentContentChangeEvent{{Text: text}},
+		})
+	}
+	// collect returns the diagnostics published until none have been
+	// for a while, as "uri:count" in the order they were published.
+	collect := func() []string {
+		var got []string
+		for {
+			select {
+			case params := <-published:
+				got = append(got, fmt.Sprintf("%s:%d", params.URI, len(params.Diagnostics)))
+				for _, d := range params.Diagnostics {
+					if d.Severity != lsp.Error {
+						t.Errorf("got diagnostic %+v, want an error", d)
+					}
+				}
+			case <-time.After(6 * delay):
+				return got
+			}
+		}
+	}
+	check := func(got []string, want ...string) {
+		t.Helper()
+		sort.Strings(got)
+		sort.Strings(want)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got diagnostics %q, want %q", got, want)
+		}
+	}
+
+	// Changing one package doesn't delay another's diagnostics.
+	open(a, "package p\n\nvar x int = \"s\"\n")
+	open(q, "package q\n\nvar y int = \"s\"\n")
+	check(collect(), a+":1", q+":1")
+
+	// Changes to a package in quick succession are typechecked once,
+	// and fixing the error clears the diagnostics.
+	change(a, 2, "package p\n\nvar x int = \"t\"\n")
+	open(b, "package p\n\nvar y int = z\n")
+	change(a, 3, "package p\n\nvar x int = 1\n")
+	check(collect(), a+":0", b+":1")
+
+	// Saving typechecks again, but nothing is published for files
+	// which had no diagnostics and still have none.
+	change(b, 2, "package p\n\nvar y int = x\n")
+	check(collect(), b+":0")
+	notify("textDocument/didSave", lsp.DidSaveTextDocumentParams{TextDocument: lsp.TextDocumentIdentifier{URI: b}})
+	check(collect())
+
+	// Closing a document doesn't cancel its package's pending
+	// typecheck, which must report that b.go now refers to x, which
+	// was declared in the closed a.go.
+	change(a, 4, "package p\n\nvar x string\n")
+	notify("textDocument/didClose", lsp.DidCloseTextDocumentParams{TextDocument: lsp.TextDocumentIdentifier{URI: a}})
+	check(collect(), b+":1")
+}
+
+func TestUnusedImportDiagnostics(t *testing.T) {
+	cfg := NewDefaultConfig()
+	cfg.DiagnosticsEnabled = true
+	cfg.UnusedImportDiagnosticsEnabled = true
+	cfg.DiagnosticsDebounceMs = 50
+	conn, published, done := startDiagnosticsServer(t, cfg)
+	defer done()
+
+	ctx := context.Background()
+	for _, doc := range []lsp.TextDocumentItem{
+		{URI: "file:///src/test/pkg/q/q.go", Text: "package q\n\nvar Q = 1\n"},
+		{URI: "file:///src/test/pkg/a.go", Text: "package p\n\nimport (\n\t\"test/pkg/q\"\n\tr \"test/pkg/q\"\n)\n"},
+	} {
+		doc.Version = 1
+		if err := conn.Call(ctx, "textDocument/didOpen", lsp.DidOpenTextDocumentParams{TextDocument: doc}, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The unused imports are published at once, and again with the
+	// type errors once the package is typechecked.
+	var got [][]string
+	for {
+		select {
+		case params := <-published:
+			if params.URI != "file:///src/test/pkg/a.go" {
+				continue
+			}
+			var msgs []string
+			for _, d := range params.Diagnostics {
+				msgs = append(msgs, d.Message)
+			}
+			got = append(got, msgs)
+			continue
+		case <-time.After(300 * time.Millisecond):
+		}
+		break
+	}
+	want := []string{`"test/pkg/q" imported and not used`, `"test/pkg/q" imported as r and not used`}
+	if len(got) == 0 {
+		t.Fatal("got no diagnostics")
+	}
+	for _, msgs := range got {
+		if !reflect.DeepEqual(msgs, want) {
+			t.Errorf("got diagnostics %q, want %q", msgs, want)
+		}
+	}
+}
+
+// notifyRecorder records the notifications sent through it.
+type notifyRecorder struct {
+	jsonrpc2.JSONRPC2
+	params []interface{}
+}
+
+func (r *notifyRecorder) Notify(ctx context.Context, method string, params interface{}, opt ...jsonrpc2.CallOption) error {
+	r.params = append(r.params, params)
+	return nil
+}
+
+func TestPublishDuplicateUnusedImport(t *testing.T) {
+	s := newDiagnosticsState()
+	start := lsp.Position{Line: 2, Character: 7}
+	s.typeErrors["/a.go"] = []*lsp.Diagnostic{{
+		Range:    lsp.Range{Start: start, End: lsp.Position{Line: 2, Character: 11}},
+		Severity: lsp.Error,
+		Message:  `"os" imported and not used`,
+	}}
+	s.unusedImports["/a.go"] = []*lsp.Diagnostic{
+		{Range: lsp.Range{Start: start, End: lsp.Position{Line: 2, Character: 11}}, Severity: lsp.Warning, Message: `"os" imported and not used`},
+		{Range: lsp.Range{Start: lsp.Position{Line: 3, Character: 7}}, Severity: lsp.Warning, Message: `"io" imported and not used`},
+	}
+	var r notifyRecorder
+	if err := s.publish(context.Background(), &r, "/a.go"); err != nil {
+		t.Fatal(err)
+	}
+	if len(r.params) != 1 {
+		t.Fatalf("got %d notifications, want 1", len(r.params))
+	}
+	var got []string
+	for _, d := range r.params[0].(lsp.PublishDiagnosticsParams).Diagnostics {
+		got = append(got, d.Message)
+	}
+	if want := []string{`"os" imported and not used`, `"io" imported and not used`}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got diagnostics %q, want %q", got, want)
+	}
+}
+
+// startDiagnosticsServer starts a server with cfg, initialized for the
+// package /src/test/pkg, and returns a connection to it and the
+// diagnostics it publishes.
+func startDiagnosticsServer(t *testing.T, cfg Config) (conn *jsonrpc2.Conn, published <-chan lsp.PublishDiagnosticsParams, done func()) {
+	h := &LangHandler{Config: cfg, HandlerShared: &HandlerShared{}}
+	addr, serverDone := startServer(t, jsonrpc2.HandlerWithError(h.handle))
+
+	ch := make(chan lsp.PublishDiagnosticsParams, 10)
+	nc, err := (&net.Dialer{}).Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn = jsonrpc2.NewConn(context.Background(), jsonrpc2.NewBufferedStream(nc, jsonrpc2.VSCodeObjectCodec{}), jsonrpc2.HandlerWithError(func(_ context.Context, _ *jsonrpc2.Conn, req *jsonrpc2.Request) (interface{}, error) {
+		if req.Method == "textDocument/publishDiagnostics" {
+			var params lsp.PublishDiagnosticsParams
+			if err := json.Unmarshal(*req.Params, &params); err != nil {
+				t.Error(err)
+			}
+			ch <- params
+		}
+		return nil, nil
+	}))
+
+	if err := conn.Call(context.Background(), "initialize", InitializeParams{
+		InitializeParams:     lsp.InitializeParams{RootURI: "file:///src/test/pkg"},
+		NoOSFileSystemAccess: true,
+		BuildContext: &InitializeBuildContextParams{
+			GOOS:     "linux",
+			GOARCH:   "amd64",
+			GOPATH:   "/",
+			GOROOT:   "/goroot",
+			Compiler: runtime.Compiler,
+		},
+	}, nil); err != nil {
+		t.Fatal("initialize:", err)
+	}
+	return conn, ch, func() {
+		conn.Close()
+		serverDone()
+	}
+}
@@ -0,0 +1,56 @@
+package langserver
+
+import (
+	"context"
+	"fmt"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"path"
+	"strconv"
+	"strings"
+
+	"golang.org/x/tools/go/buildutil"
+
+	"github.com/sourcegraph/go-langserver/langserver/util"
+	"github.com/sourcegraph/go-langserver/pkg/lsp"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+func (h *LangHandler) handleTextDocumentDocumentLink(ctx context.Context, conn jsonrpc2.JSONRPC2, req *jsonrpc2.Request, params lsp.DocumentLinkParams) ([]lsp.DocumentLink, error) {
+	if !util.IsURI(params.TextDocument.URI) {
+		return nil, &jsonrpc2.Error{
+			Code:    jsonrpc2.CodeInvalidParams,
+			Message: fmt.Sprintf("%s not yet supported for out-of-workspace URI (%q)", req.Method, params.TextDocument.URI),
+		}
+	}
+
+	links := []lsp.DocumentLink{}
+	baseURL := h.config().DocLinkBaseURL
+	if baseURL == "" {
+		return links, nil
+	}
+	baseURL = strings.TrimSuffix(baseURL, "/")
+
+	filename := h.FilePath(params.TextDocument.URI)
+	bctx := h.BuildContext(ctx)
+	fset := token.NewFileSet()
+	file, err := buildutil.ParseFile(fset, bctx, nil, path.Dir(filename), path.Base(filename), parser.ImportsOnly)
+	if err != nil {
+		return nil, err
+	}
+	conv := h.positionConverter(ctx)
+	for _, imp := range file.Imports {
+		ipath, err := strconv.Unquote(imp.Path.Value)
+		if err != nil || build.IsLocalImport(ipath) {
+			// Relative imports have no documentation page.
+			continue
+		}
+		// The link covers the import path, without its quotes.
+		links = append(links, lsp.DocumentLink{
+			Range:  rangeForNode(conv, fset, fakeNode{p: imp.Path.Pos() + 1, e: imp.Path.End() - 1}),
+			Target: baseURL + "/" + ipath,
+		})
+	}
+	return links, nil
+}
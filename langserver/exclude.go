@@ -0,0 +1,63 @@
+package langserver
+
+import (
+	"path"
+	"strings"
+
+	"github.com/sourcegraph/go-langserver/langserver/util"
+)
+
+// skipExcludedDir returns the function reporting whether a directory under
+// the workspace folder rootPath is excluded by Config.ExcludeDirs, which
+// the scans of the workspace don't descend into. It is nil if no
+// directories are excluded.
+func (h *LangHandler) skipExcludedDir(rootPath string) func(dir string) bool {
+	patterns := h.config().ExcludeDirs
+	if len(patterns) == 0 {
+		return nil
+	}
+	return func(dir string) bool {
+		return util.PathHasPrefix(dir, rootPath) && matchExcludeDirs(patterns, util.PathTrimPrefix(dir, rootPath))
+	}
+}
+
+// isExcluded reports whether the file filename is in a directory excluded
+// by Config.ExcludeDirs from the workspace folder it is in.
+func (h *LangHandler) isExcluded(filename string) bool {
+	patterns := h.config().ExcludeDirs
+	rootPath := h.folderOf(filename)
+	if len(patterns) == 0 || !util.PathHasPrefix(filename, rootPath) {
+		return false
+	}
+	for rel := path.Dir(util.PathTrimPrefix(filename, rootPath)); rel != "." && rel != "/"; rel = path.Dir(rel) {
+		if matchExcludeDirs(patterns, rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchExcludeDirs reports whether the directory rel, relative to its
+// workspace folder, matches one of patterns. A pattern is matched against
+// the whole of rel with path.Match, or against its last element only if
+// the pattern has a single element, so that "node_modules" is excluded at
+// any depth while "./node_modules" is only the one of the folder.
+func matchExcludeDirs(patterns []string, rel string) bool {
+	if rel == "" {
+		return false
+	}
+	for _, p := range patterns {
+		p = strings.TrimSuffix(p, "/")
+		anywhere := !strings.Contains(p, "/")
+		p = strings.TrimPrefix(p, "./")
+		if ok, _ := path.Match(p, rel); ok {
+			return true
+		}
+		if anywhere {
+			if ok, _ := path.Match(p, path.Base(rel)); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,86 @@
+package langserver
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sourcegraph/go-langserver/pkg/lsp"
+	"github.com/sourcegraph/go-langserver/pkg/lspext"
+)
+
+func TestMatchExcludeDirs(t *testing.T) {
+	tests := []struct {
+		pattern string
+		rel     string
+		want    bool
+	}{
+		{"node_modules", "node_modules", true},
+		{"node_modules", "web/node_modules", true},
+		{"node_modules", "node_modules_x", false},
+		{"node_modules/", "web/node_modules", true},
+		{"./third_party", "third_party", true},
+		{"./third_party", "a/third_party", false},
+		{"third_party/*", "third_party/x", true},
+		{"third_party/*", "third_party/x/y", false},
+		{"third_party/*", "a/third_party/x", false},
+		{"*_gen", "api/types_gen", true},
+		{"a/b", "a/b", true},
+		{"a/b", "c/a/b", false},
+		{"node_modules", "", false},
+	}
+	for _, test := range tests {
+		if got := matchExcludeDirs([]string{test.pattern}, test.rel); got != test.want {
+			t.Errorf("pattern %q matching %q: got %v, want %v", test.pattern, test.rel, got, test.want)
+		}
+	}
+}
+
+func TestExcludeDirs(t *testing.T) {
+	cfg := NewDefaultConfig()
+	cfg.DiagnosticsDebounceMs = 50
+	cfg.ExcludeDirs = []string{"gen"}
+	conn, published, done := startDiagnosticsServer(t, cfg)
+	defer done()
+
+	ctx := context.Background()
+	for _, doc := range []lsp.TextDocumentItem{
+		{URI: "file:///src/test/pkg/a.go", Text: "package p\n\nvar A int = \"s\"\n"},
+		{URI: "file:///src/test/pkg/gen/g.go", Text: "package gen\n\nimport \"os\"\n\nvar G int = \"s\"\n"},
+	} {
+		doc.Version = 1
+		if err := conn.Call(ctx, "textDocument/didOpen", lsp.DidOpenTextDocumentParams{TextDocument: doc}, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Only a.go is typechecked, and gen/g.go's unused import isn't
+	// reported either.
+	var got []lsp.DocumentURI
+	timeout := time.After(300 * time.Millisecond)
+collect:
+	for {
+		select {
+		case params := <-published:
+			got = append(got, params.URI)
+		case <-timeout:
+			break collect
+		}
+	}
+	if want := []lsp.DocumentURI{"file:///src/test/pkg/a.go"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got diagnostics for %q, want %q", got, want)
+	}
+
+	var symbols []lsp.SymbolInformation
+	if err := conn.Call(ctx, "workspace/symbol", lspext.WorkspaceSymbolParams{Limit: 100}, &symbols); err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, s := range symbols {
+		names = append(names, s.Name)
+	}
+	if want := []string{"A"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("got symbols %q, want %q", names, want)
+	}
+}
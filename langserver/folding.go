@@ -0,0 +1,92 @@
+package langserver
+
+import (
+	"context"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path"
+	"sort"
+
+	"golang.org/x/tools/go/buildutil"
+
+	"github.com/sourcegraph/go-langserver/langserver/util"
+	"github.com/sourcegraph/go-langserver/pkg/lsp"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+func (h *LangHandler) handleTextDocumentFoldingRange(ctx context.Context, conn jsonrpc2.JSONRPC2, req *jsonrpc2.Request, params lsp.FoldingRangeParams) ([]lsp.FoldingRange, error) {
+	if !util.IsURI(params.TextDocument.URI) {
+		return nil, &jsonrpc2.Error{
+			Code:    jsonrpc2.CodeInvalidParams,
+			Message: fmt.Sprintf("%s not yet supported for out-of-workspace URI (%q)", req.Method, params.TextDocument.URI),
+		}
+	}
+
+	filename := h.FilePath(params.TextDocument.URI)
+	bctx := h.BuildContext(ctx)
+	fset := token.NewFileSet()
+	file, err := buildutil.ParseFile(fset, bctx, nil, path.Dir(filename), path.Base(filename), parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	return foldingRanges(fset, file), nil
+}
+
+// foldingRanges returns the foldable regions of f, sorted by start line.
+func foldingRanges(fset *token.FileSet, f *ast.File) []lsp.FoldingRange {
+	ranges := []lsp.FoldingRange{}
+	// add folds the lines between open and close. Line numbers are zero
+	// based, and a fold stops on the line before close so that the
+	// closing brace or paren stays visible.
+	add := func(open, close token.Pos, kind lsp.FoldingRangeKind) {
+		if !open.IsValid() || !close.IsValid() {
+			return
+		}
+		start := fset.Position(open).Line - 1
+		end := fset.Position(close).Line - 2
+		if end <= start {
+			return
+		}
+		ranges = append(ranges, lsp.FoldingRange{StartLine: start, EndLine: end, Kind: kind})
+	}
+
+	ast.Inspect(f, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.BlockStmt:
+			add(n.Lbrace, n.Rbrace, "")
+		case *ast.CompositeLit:
+			add(n.Lbrace, n.Rbrace, "")
+		case *ast.StructType:
+			add(n.Fields.Opening, n.Fields.Closing, "")
+		case *ast.InterfaceType:
+			add(n.Methods.Opening, n.Methods.Closing, "")
+		case *ast.CallExpr:
+			add(n.Lparen, n.Rparen, "")
+		case *ast.GenDecl:
+			if n.Tok == token.IMPORT {
+				add(n.Lparen, n.Rparen, lsp.FRKImports)
+			}
+		}
+		return true
+	})
+
+	// Adjacent comments are already grouped by the parser. There is no
+	// closing delimiter to keep visible, so fold through the last line.
+	for _, c := range f.Comments {
+		start := fset.Position(c.Pos()).Line - 1
+		end := fset.Position(c.End()).Line - 1
+		if end > start {
+			ranges = append(ranges, lsp.FoldingRange{StartLine: start, EndLine: end, Kind: lsp.FRKComment})
+		}
+	}
+
+	sort.Slice(ranges, func(i, j int) bool {
+		if ranges[i].StartLine != ranges[j].StartLine {
+			return ranges[i].StartLine < ranges[j].StartLine
+		}
+		return ranges[i].EndLine > ranges[j].EndLine
+	})
+	return ranges
+}
@@ -5,12 +5,19 @@ import (
 	"context"
 	"fmt"
 	"go/ast"
+	"go/build"
+	"go/format"
 	"go/parser"
 	"go/printer"
+	"go/scanner"
 	"go/token"
 	"path"
+	"strings"
+	"sync"
+	"unicode/utf8"
 
 	"golang.org/x/tools/go/buildutil"
+	"golang.org/x/tools/imports"
 
 	"github.com/sourcegraph/go-langserver/langserver/util"
 	"github.com/sourcegraph/go-langserver/pkg/lsp"
@@ -26,27 +33,24 @@ func (h *LangHandler) handleTextDocumentFormatting(ctx context.Context, conn jso
 	}
 
 	filename := h.FilePath(params.TextDocument.URI)
-	bctx := h.BuildContext(ctx)
-	fset := token.NewFileSet()
-	file, err := buildutil.ParseFile(fset, bctx, nil, path.Dir(filename), path.Base(filename), parser.ParseComments)
+	orig, err := h.readFile(ctx, params.TextDocument.URI)
 	if err != nil {
 		return nil, err
 	}
 
-	ast.SortImports(fset, file)
-
-	var buf bytes.Buffer
-	cfg := printer.Config{Mode: printer.UseSpaces | printer.TabIndent, Tabwidth: 8}
-	err = cfg.Fprint(&buf, fset, file)
-	if err != nil {
-		return nil, err
+	var b []byte
+	switch cfg := h.config(); {
+	case cfg.FormatTool == formatToolGoimports && h.canGoimports():
+		b, err = goimports(filename, orig, cfg.GoimportsLocalPrefix)
+	default:
+		b, err = gofmt(h.BuildContext(ctx), filename)
 	}
-
-	b := buf.Bytes()
-	orig, err := h.readFile(ctx, params.TextDocument.URI)
 	if err != nil {
 		return nil, err
 	}
+	if !reformatsDocComments(h.config().FormatGoVersion) {
+		b = restoreDocComments(orig, b)
+	}
 	if bytes.Equal(b, orig) {
 		return nil, nil
 	}
@@ -69,3 +73,388 @@ func (h *LangHandler) handleTextDocumentFormatting(ctx context.Context, conn jso
 		},
 	}, nil
 }
+
+// gofmt formats filename as read from bctx.
+func gofmt(bctx *build.Context, filename string) ([]byte, error) {
+	fset := token.NewFileSet()
+	file, err := buildutil.ParseFile(fset, bctx, nil, path.Dir(filename), path.Base(filename), parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+
+	ast.SortImports(fset, file)
+
+	var buf bytes.Buffer
+	cfg := printer.Config{Mode: printer.UseSpaces | printer.TabIndent, Tabwidth: 8}
+	err = cfg.Fprint(&buf, fset, file)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// canGoimports reports whether goimports can be run. It looks for the
+// packages to import on the OS file system, which the server mustn't
+// access if it was initialized with NoOSFileSystemAccess.
+func (h *LangHandler) canGoimports() bool {
+	return h.init != nil && !h.init.NoOSFileSystemAccess
+}
+
+// goimportsMu guards imports.LocalPrefix, which the imports package reads
+// from a global.
+var goimportsMu sync.Mutex
+
+// goimports formats src like gofmt, additionally adding missing imports,
+// removing unused ones and grouping imports beginning with localPrefix
+// separately. localPrefix may be a comma-separated list, in which case
+// each prefix has its own group, in the order given.
+func goimports(filename string, src []byte, localPrefix string) ([]byte, error) {
+	goimportsMu.Lock()
+	defer goimportsMu.Unlock()
+	// The imports package knows a single prefix, whose imports it moves
+	// to a group after the others of their block, and it keeps the
+	// existing groups. So moving each prefix's imports in turn, from the
+	// last to the first, leaves the groups in order.
+	prefixes := strings.Split(localPrefix, ",")
+	for i := len(prefixes) - 1; i >= 0; i-- {
+		imports.LocalPrefix = strings.TrimSpace(prefixes[i])
+		b, err := imports.Process(filename, src, nil)
+		if err != nil {
+			return nil, err
+		}
+		src = b
+	}
+	return src, nil
+}
+
+func (h *LangHandler) handleTextDocumentRangeFormatting(ctx context.Context, conn jsonrpc2.JSONRPC2, req *jsonrpc2.Request, params lsp.DocumentRangeFormattingParams) ([]lsp.TextEdit, error) {
+	if !util.IsURI(params.TextDocument.URI) {
+		return nil, &jsonrpc2.Error{
+			Code:    jsonrpc2.CodeInvalidParams,
+			Message: fmt.Sprintf("%s not yet supported for out-of-workspace URI (%q)", req.Method, params.TextDocument.URI),
+		}
+	}
+
+	contents, err := h.readFile(ctx, params.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+	start, valid, why := offsetForPosition(contents, params.Range.Start, h.positionEncoding())
+	if !valid {
+		return nil, fmt.Errorf("invalid range start %v: %s", params.Range.Start, why)
+	}
+	end, valid, why := offsetForPosition(contents, params.Range.End, h.positionEncoding())
+	if !valid {
+		return nil, fmt.Errorf("invalid range end %v: %s", params.Range.End, why)
+	}
+	if end < start {
+		start, end = end, start
+	}
+
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, h.FilePath(params.TextDocument.URI), contents, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	tf := fset.File(file.Pos())
+
+	// Only a run of whole declarations or statements can be formatted on
+	// its own, so expand the range to the enclosing ones.
+	first, last := enclosingNodes(file, tf.Pos(start), tf.Pos(end))
+	if first == nil {
+		return nil, nil
+	}
+	start, end = expandToLines(contents, tf.Offset(first.Pos()), tf.Offset(last.End()))
+
+	// go/format keeps the leading indentation of a partial source, so the
+	// fragment stays where it was.
+	formatted, err := format.Source(contents[start:end])
+	if err != nil {
+		return nil, err
+	}
+	if !reformatsDocComments(h.config().FormatGoVersion) {
+		formatted = restoreDocComments(contents[start:end], formatted)
+	}
+	if bytes.Equal(formatted, contents[start:end]) {
+		return nil, nil
+	}
+
+	position := func(offset int) lsp.Position {
+		return lspPosition(tf.Position(tf.Pos(offset)), contents, h.positionEncoding())
+	}
+	return []lsp.TextEdit{
+		{
+			Range:   lsp.Range{Start: position(start), End: position(end)},
+			NewText: string(formatted),
+		},
+	}, nil
+}
+
+// enclosingNodes returns the first and last of the shortest run of sibling
+// declarations or statements which covers [start, end). It returns nils if
+// there is no such run.
+func enclosingNodes(file *ast.File, start, end token.Pos) (first, last ast.Node) {
+	visit := func(lbound, rbound token.Pos, list []ast.Node) {
+		if start < lbound || end > rbound {
+			return
+		}
+		var f, l ast.Node
+		for _, n := range list {
+			if n.End() <= start || n.Pos() >= end {
+				continue
+			}
+			if f == nil {
+				f = n
+			}
+			l = n
+		}
+		if f != nil && (first == nil || l.End()-f.Pos() < last.End()-first.Pos()) {
+			first, last = f, l
+		}
+	}
+	stmts := func(list []ast.Stmt) []ast.Node {
+		nodes := make([]ast.Node, len(list))
+		for i, s := range list {
+			nodes[i] = s
+		}
+		return nodes
+	}
+
+	decls := make([]ast.Node, len(file.Decls))
+	for i, d := range file.Decls {
+		decls[i] = d
+	}
+	visit(start, end, decls)
+	ast.Inspect(file, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.BlockStmt:
+			visit(n.Lbrace+1, n.Rbrace, stmts(n.List))
+		case *ast.CaseClause:
+			visit(n.Colon+1, n.End(), stmts(n.Body))
+		case *ast.CommClause:
+			visit(n.Colon+1, n.End(), stmts(n.Body))
+		}
+		return true
+	})
+	return first, last
+}
+
+// expandToLines widens contents[start:end] to whole lines, including the
+// leading indentation and a trailing line comment, as long as that doesn't
+// take in any other code.
+func expandToLines(contents []byte, start, end int) (int, int) {
+	s := start
+	for s > 0 && (contents[s-1] == ' ' || contents[s-1] == '\t') {
+		s--
+	}
+	if s == 0 || contents[s-1] == '\n' {
+		start = s
+	}
+
+	e := end
+	for e < len(contents) && (contents[e] == ' ' || contents[e] == '\t' || contents[e] == '\r') {
+		e++
+	}
+	if bytes.HasPrefix(contents[e:], []byte("//")) {
+		if i := bytes.IndexByte(contents[e:], '\n'); i >= 0 {
+			e += i
+		} else {
+			e = len(contents)
+		}
+	}
+	if e == len(contents) {
+		end = e
+	} else if contents[e] == '\n' {
+		end = e + 1
+	}
+	return start, end
+}
+
+// The characters after which the client asks for
+// textDocument/onTypeFormatting. A newline indents the new line and formats
+// the one it ends, and a closing brace indents its line.
+const (
+	onTypeFormattingNewline = "\n"
+	onTypeFormattingBrace   = "}"
+)
+
+func (h *LangHandler) handleTextDocumentOnTypeFormatting(ctx context.Context, conn jsonrpc2.JSONRPC2, req *jsonrpc2.Request, params lsp.DocumentOnTypeFormattingParams) ([]lsp.TextEdit, error) {
+	if !util.IsURI(params.TextDocument.URI) {
+		return nil, &jsonrpc2.Error{
+			Code:    jsonrpc2.CodeInvalidParams,
+			Message: fmt.Sprintf("%s not yet supported for out-of-workspace URI (%q)", req.Method, params.TextDocument.URI),
+		}
+	}
+	if params.Ch != onTypeFormattingNewline && params.Ch != onTypeFormattingBrace {
+		return nil, nil
+	}
+
+	contents, err := h.readFile(ctx, params.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+	line := params.Position.Line
+	lineStart, valid, why := offsetForPosition(contents, lsp.Position{Line: line}, h.positionEncoding())
+	if !valid {
+		return nil, fmt.Errorf("invalid position %v: %s", params.Position, why)
+	}
+
+	// The edits are on different lines, so they don't overlap. Only
+	// what changes is replaced, so that the cursor stays where it is in
+	// the text.
+	var edits []lsp.TextEdit
+	if params.Ch == onTypeFormattingNewline && line > 0 {
+		prevStart, _, _ := offsetForPosition(contents, lsp.Position{Line: line - 1}, h.positionEncoding())
+		if edit, ok := formatLine(h.FilePath(params.TextDocument.URI), contents, line-1, prevStart, lineStart, h.positionEncoding()); ok {
+			edits = append(edits, edit)
+		}
+	}
+	if edit, ok := indentLine(contents, line, lineStart, h.positionEncoding()); ok {
+		edits = append(edits, edit)
+	}
+	return edits, nil
+}
+
+// formatLine returns the edit formatting the statements or declarations on
+// line, which is contents[start:end], if they are entirely on it. ok is
+// false if there are none, they are already formatted or the file doesn't
+// parse. The characters of the edit are counted in the units of enc.
+func formatLine(filename string, contents []byte, line, start, end int, enc lsp.PositionEncodingKind) (edit lsp.TextEdit, ok bool) {
+	s, e := start, end
+	for s < e && (contents[s] == ' ' || contents[s] == '\t') {
+		s++
+	}
+	for e > s && (contents[e-1] == ' ' || contents[e-1] == '\t' || contents[e-1] == '\r' || contents[e-1] == '\n') {
+		e--
+	}
+	if s == e {
+		return lsp.TextEdit{}, false
+	}
+
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, filename, contents, parser.ParseComments)
+	if err != nil {
+		return lsp.TextEdit{}, false
+	}
+	tf := fset.File(file.Pos())
+	first, last := enclosingNodes(file, tf.Pos(s), tf.Pos(e))
+	if first == nil || tf.Offset(first.Pos()) < start || tf.Offset(last.End()) > end {
+		return lsp.TextEdit{}, false
+	}
+	s, e = expandToLines(contents, tf.Offset(first.Pos()), tf.Offset(last.End()))
+	formatted, err := format.Source(contents[s:e])
+	if err != nil || bytes.Equal(formatted, contents[s:e]) {
+		return lsp.TextEdit{}, false
+	}
+	return lineEdit(contents, line, start, s, e, formatted, enc), true
+}
+
+// indentLine returns the edit setting the indentation of line, which
+// starts at lineStart in contents, to gofmt's. ok is false if it is
+// already indented so, or is inside a multi-line comment or string. The
+// characters of the edit are counted in the units of enc.
+func indentLine(contents []byte, line, lineStart int, enc lsp.PositionEncodingKind) (edit lsp.TextEdit, ok bool) {
+	depth, ok := indentDepth(contents, lineStart)
+	if !ok {
+		return lsp.TextEdit{}, false
+	}
+	end := lineStart
+	for end < len(contents) && (contents[end] == ' ' || contents[end] == '\t') {
+		end++
+	}
+	want := bytes.Repeat([]byte("\t"), depth)
+	if bytes.Equal(contents[lineStart:end], want) {
+		return lsp.TextEdit{}, false
+	}
+	return lineEdit(contents, line, lineStart, lineStart, end, want, enc), true
+}
+
+// indentDepth returns the number of tabs gofmt indents the line starting
+// at lineStart in src by. Each line opening brackets which are still open
+// indents the lines after it once, except for the line closing them, and
+// case clauses are outdented. ok is false if lineStart is inside a comment
+// or a raw string.
+func indentDepth(src []byte, lineStart int) (depth int, ok bool) {
+	fset := token.NewFileSet()
+	file := fset.AddFile("", -1, len(src))
+	var s scanner.Scanner
+	s.Init(file, src, nil, scanner.ScanComments)
+
+	var open []int // the lines of the brackets which are still open
+	for {
+		pos, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		offset := file.Offset(pos)
+		if offset >= lineStart {
+			if bytes.IndexByte(src[lineStart:offset], '\n') >= 0 {
+				// The line has no tokens.
+				break
+			}
+			switch tok {
+			case token.RPAREN, token.RBRACK, token.RBRACE:
+				if len(open) > 0 {
+					open = open[:len(open)-1]
+				}
+			case token.CASE, token.DEFAULT:
+				depth--
+			}
+			break
+		}
+		if (tok == token.COMMENT || tok == token.STRING) && offset+len(lit) > lineStart {
+			return 0, false
+		}
+		switch tok {
+		case token.LPAREN, token.LBRACK, token.LBRACE:
+			open = append(open, file.Line(pos))
+		case token.RPAREN, token.RBRACK, token.RBRACE:
+			if len(open) > 0 {
+				open = open[:len(open)-1]
+			}
+		}
+	}
+	for i, line := range open {
+		if i == 0 || line != open[i-1] {
+			depth++
+		}
+	}
+	if depth < 0 {
+		depth = 0
+	}
+	return depth, true
+}
+
+// lineEdit returns the edit replacing contents[offset:end], which is in
+// line and doesn't extend past its newline, with new. The line starts at
+// lineStart, and the characters of the edit are counted in the units of
+// enc. Only the part which differs is replaced.
+func lineEdit(contents []byte, line, lineStart, offset, end int, new []byte, enc lsp.PositionEncodingKind) lsp.TextEdit {
+	old := contents[offset:end]
+	prefix := 0
+	for prefix < len(old) && prefix < len(new) && old[prefix] == new[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(old)-prefix && suffix < len(new)-prefix && old[len(old)-1-suffix] == new[len(new)-1-suffix] {
+		suffix++
+	}
+	// Don't split the characters the edit starts or ends in.
+	for prefix > 0 && prefix < len(old) && !utf8.RuneStart(old[prefix]) {
+		prefix--
+	}
+	for suffix > 0 && !utf8.RuneStart(old[len(old)-suffix]) {
+		suffix--
+	}
+	character := func(i int) int {
+		p := token.Position{Line: line + 1, Column: offset - lineStart + i + 1, Offset: offset + i}
+		return lspPosition(p, contents, enc).Character
+	}
+	return lsp.TextEdit{
+		Range: lsp.Range{
+			Start: lsp.Position{Line: line, Character: character(prefix)},
+			End:   lsp.Position{Line: line, Character: character(len(old) - suffix)},
+		},
+		NewText: string(new[prefix : len(new)-suffix]),
+	}
+}
@@ -0,0 +1,106 @@
+package langserver
+
+import (
+	"go/format"
+	"testing"
+)
+
+func TestGoimportsLocalPrefix(t *testing.T) {
+	const uses = `
+var _ = fmt.Println
+var _ = b.B
+var _ = x.X
+var _ = y.Y
+`
+	const src = `package p
+
+import (
+	"corp.com/x"
+	"example.org/y"
+	"fmt"
+	"github.com/a/b"
+)
+` + uses
+	tests := map[string]string{
+		"": `package p
+
+import (
+	"fmt"
+
+	"corp.com/x"
+	"example.org/y"
+	"github.com/a/b"
+)
+`,
+		"corp.com/": `package p
+
+import (
+	"fmt"
+
+	"example.org/y"
+	"github.com/a/b"
+
+	"corp.com/x"
+)
+`,
+		"example.org/, corp.com/": `package p
+
+import (
+	"fmt"
+
+	"github.com/a/b"
+
+	"example.org/y"
+
+	"corp.com/x"
+)
+`,
+	}
+	for localPrefix, want := range tests {
+		got, err := goimports("/src/p/p.go", []byte(src), localPrefix)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want += uses; string(got) != want {
+			t.Errorf("local prefix %q: got\n%s\nwant\n%s", localPrefix, got, want)
+		}
+	}
+}
+
+func TestRestoreDocComments(t *testing.T) {
+	tests := map[string]string{
+		// A file, whose doc comment lists are reformatted since Go
+		// 1.19, and whose other comments keep being indented.
+		"package p\n\n// F does:\n//  * a\n//  * b\nfunc F() {}\n\nfunc g() {\n// c\n\tx :=  1\n\t_ = x\n}\n": "package p\n\n// F does:\n//  * a\n//  * b\nfunc F() {}\n\nfunc g() {\n\t// c\n\tx := 1\n\t_ = x\n}\n",
+		// A list of declarations, as range formatting formats.
+		"// G does:\n//  * a\nfunc G() {}\n\nvar  x = 1\n":   "// G does:\n//  * a\nfunc G() {}\n\nvar x = 1\n",
+		"package p\n\n/*\nH does:\n  * a\n*/\nfunc H() {}\n": "package p\n\n/*\nH does:\n  * a\n*/\nfunc H() {}\n",
+	}
+	for src, want := range tests {
+		formatted, err := format.Source([]byte(src))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := string(restoreDocComments([]byte(src), formatted)); got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	}
+}
+
+func TestReformatsDocComments(t *testing.T) {
+	tests := map[string]bool{
+		"":        true,
+		"1.19":    true,
+		"go1.21":  true,
+		"1.18":    false,
+		"go1.17":  false,
+		"1.16.15": false,
+		"2":       true,
+		"latest":  true,
+	}
+	for goVersion, want := range tests {
+		if got := reformatsDocComments(goVersion); got != want {
+			t.Errorf("%q: got %v, want %v", goVersion, got, want)
+		}
+	}
+}
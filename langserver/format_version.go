@@ -0,0 +1,103 @@
+package langserver
+
+import (
+	"bytes"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strconv"
+	"strings"
+)
+
+// docCommentsMinorVersion is the minor version of the Go 1 release from
+// which gofmt reformats doc comments.
+const docCommentsMinorVersion = 19
+
+// reformatsDocComments reports whether gofmt of the Go version goVersion,
+// such as "1.18" or "go1.21.3", reformats doc comments, as gofmt has since
+// Go 1.19. The current gofmt does, which an empty or unknown goVersion
+// means.
+func reformatsDocComments(goVersion string) bool {
+	minor, ok := goMinorVersion(goVersion)
+	return !ok || minor >= docCommentsMinorVersion
+}
+
+// goMinorVersion returns the minor version of the Go 1 release v, such as
+// 18 for "1.18", "go1.18" or "1.18.3". ok is false if v isn't one.
+func goMinorVersion(v string) (minor int, ok bool) {
+	parts := strings.Split(strings.TrimPrefix(v, "go"), ".")
+	if len(parts) < 2 || parts[0] != "1" {
+		return 0, false
+	}
+	minor, err := strconv.Atoi(parts[1])
+	if err != nil || minor < 0 {
+		return 0, false
+	}
+	return minor, true
+}
+
+// restoreDocComments returns formatted, which gofmt made of the Go source
+// orig, with the doc comments as they are in orig, as gofmt before Go 1.19
+// leaves them. Those are the comments gofmt reformats: the unindented ones
+// directly before a declaration, which are otherwise left alone. Their
+// lines only lose trailing white space, as they do with any gofmt. Like
+// go/format.Source, orig may be a file or a list of declarations. If orig
+// or formatted doesn't parse, or gofmt removed a comment, formatted is
+// returned as is.
+func restoreDocComments(orig, formatted []byte) []byte {
+	fset := token.NewFileSet()
+	of, ooff, err := parseComments(fset, orig)
+	if err != nil {
+		return formatted
+	}
+	ff, foff, err := parseComments(fset, formatted)
+	if err != nil || len(of.Comments) != len(ff.Comments) {
+		return formatted
+	}
+	ftf := fset.File(ff.Pos())
+
+	var buf bytes.Buffer
+	last := 0
+	for i, fc := range ff.Comments {
+		oc := of.Comments[i]
+		p := fset.Position(oc.Pos())
+		if p.Line == 1 {
+			p.Column -= ooff
+		}
+		if p.Column != 1 {
+			continue
+		}
+		var lines []string
+		for _, c := range oc.List {
+			for _, l := range strings.Split(c.Text, "\n") {
+				lines = append(lines, strings.TrimRight(l, " \t\r"))
+			}
+		}
+		want := strings.Join(lines, "\n")
+		start, end := ftf.Offset(fc.Pos())-foff, ftf.Offset(fc.End())-foff
+		if start < last || string(formatted[start:end]) == want {
+			continue
+		}
+		buf.Write(formatted[last:start])
+		buf.WriteString(want)
+		last = end
+	}
+	if last == 0 {
+		return formatted
+	}
+	buf.Write(formatted[last:])
+	return buf.Bytes()
+}
+
+// parseComments parses the Go source src with its comments. If src isn't
+// a file it is parsed as a list of declarations, after a package clause
+// which starts the source parsed. offset is where src starts in it.
+func parseComments(fset *token.FileSet, src []byte) (f *ast.File, offset int, err error) {
+	f, err = parser.ParseFile(fset, "", src, parser.ParseComments)
+	if err == nil {
+		return f, 0, nil
+	}
+	const pkg = "package p;"
+	f, err = parser.ParseFile(fset, "", append([]byte(pkg), src...), parser.ParseComments)
+	return f, len(pkg), err
+}
@@ -0,0 +1,33 @@
+package langserver
+
+import (
+	"runtime"
+	"runtime/debug"
+)
+
+// commandFreeGC is the workspace/executeCommand command which makes the
+// server return the memory it no longer uses to the OS, as after a scan
+// of a large workspace, if Config.FreeGCCommandEnabled is set.
+const commandFreeGC = "langserver.freeGC"
+
+// freeGC collects garbage and returns as much memory to the OS as
+// possible, and returns the memory use before and after.
+func freeGC() FreeGCResult {
+	var res FreeGCResult
+	res.Before = readMemoryStats()
+	runtime.GC()
+	debug.FreeOSMemory()
+	res.After = readMemoryStats()
+	return res
+}
+
+// readMemoryStats returns the current memory use.
+func readMemoryStats() MemoryStats {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	return MemoryStats{
+		HeapAllocBytes:    mem.HeapAlloc,
+		HeapReleasedBytes: mem.HeapReleased,
+		SysBytes:          mem.Sys,
+	}
+}
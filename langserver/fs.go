@@ -90,8 +90,12 @@ func (h *HandlerShared) handleFileSystemRequest(ctx context.Context, req *jsonrp
 		})
 
 	case "textDocument/didSave":
-		// no-op
-		return "", false, nil
+		// The contents come from didChange, so saving changes nothing.
+		var params lsp.DidSaveTextDocumentParams
+		if err := json.Unmarshal(*req.Params, &params); err != nil {
+			return "", false, err
+		}
+		return params.TextDocument.URI, false, nil
 
 	default:
 		panic("unexpected file system request method: " + req.Method)
@@ -103,10 +107,17 @@ func (h *HandlerShared) handleFileSystemRequest(ctx context.Context, req *jsonrp
 type overlay struct {
 	mu sync.Mutex
 	m  map[string][]byte
+
+	// versions holds the version the client last sent for each open
+	// document, keyed like m.
+	versions map[string]int
+
+	// encoding is the position encoding of the ranges of changes.
+	encoding lsp.PositionEncodingKind
 }
 
 func newOverlay() *overlay {
-	return &overlay{m: make(map[string][]byte)}
+	return &overlay{m: make(map[string][]byte), versions: make(map[string]int)}
 }
 
 // FS returns a vfs for the overlay.
@@ -114,8 +125,24 @@ func (h *overlay) FS() ctxvfs.FileSystem {
 	return ctxvfs.Sync(&h.mu, ctxvfs.Map(h.m))
 }
 
+// setPositionEncoding sets the encoding the ranges of changes are in to
+// the one negotiated with the client.
+func (h *overlay) setPositionEncoding(enc lsp.PositionEncodingKind) {
+	h.mu.Lock()
+	h.encoding = enc
+	h.mu.Unlock()
+}
+
+// positionEncoding returns the encoding the ranges of changes are in.
+func (h *overlay) positionEncoding() lsp.PositionEncodingKind {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.encoding
+}
+
 func (h *overlay) didOpen(params *lsp.DidOpenTextDocumentParams) {
 	h.set(params.TextDocument.URI, []byte(params.TextDocument.Text))
+	h.setVersion(params.TextDocument.URI, params.TextDocument.Version)
 }
 
 func (h *overlay) didChange(params *lsp.DidChangeTextDocumentParams) error {
@@ -125,26 +152,23 @@ func (h *overlay) didChange(params *lsp.DidChangeTextDocumentParams) error {
 	}
 
 	for _, change := range params.ContentChanges {
-		if change.Range == nil && change.RangeLength == 0 {
+		if change.Range == nil {
 			contents = []byte(change.Text) // new full content
 			continue
 		}
-		start, ok, why := offsetForPosition(contents, change.Range.Start)
+		// Each change applies to the result of the previous one, so
+		// ranges are always resolved against the current contents.
+		// RangeLength is deprecated in favour of the range end.
+		start, ok, why := offsetForPosition(contents, change.Range.Start, h.positionEncoding())
 		if !ok {
-			return fmt.Errorf("received textDocument/didChange for invalid position %q on %q: %s", change.Range.Start, params.TextDocument.URI, why)
+			return fmt.Errorf("received textDocument/didChange for invalid position %v on %q: %s", change.Range.Start, params.TextDocument.URI, why)
 		}
-		var end int
-		if change.RangeLength != 0 {
-			end = start + int(change.RangeLength)
-		} else {
-			// RangeLength not specified, work it out from Range.End
-			end, ok, why = offsetForPosition(contents, change.Range.End)
-			if !ok {
-				return fmt.Errorf("received textDocument/didChange for invalid position %q on %q: %s", change.Range.Start, params.TextDocument.URI, why)
-			}
+		end, ok, why := offsetForPosition(contents, change.Range.End, h.positionEncoding())
+		if !ok {
+			return fmt.Errorf("received textDocument/didChange for invalid position %v on %q: %s", change.Range.End, params.TextDocument.URI, why)
 		}
-		if start < 0 || end >= len(contents) || end < start {
-			return fmt.Errorf("received textDocument/didChange for out of range position %q on %q", change.Range, params.TextDocument.URI)
+		if end < start {
+			return fmt.Errorf("received textDocument/didChange for range %v on %q which ends before it starts", *change.Range, params.TextDocument.URI)
 		}
 		// Try avoid doing too many allocations, so use bytes.Buffer
 		b := &bytes.Buffer{}
@@ -155,11 +179,44 @@ func (h *overlay) didChange(params *lsp.DidChangeTextDocumentParams) error {
 		contents = b.Bytes()
 	}
 	h.set(params.TextDocument.URI, contents)
+	h.setVersion(params.TextDocument.URI, params.TextDocument.Version)
 	return nil
 }
 
 func (h *overlay) didClose(params *lsp.DidCloseTextDocumentParams) {
 	h.del(params.TextDocument.URI)
+	h.mu.Lock()
+	delete(h.versions, uriToOverlayPath(params.TextDocument.URI))
+	h.mu.Unlock()
+}
+
+// dropUnopened removes the files which aren't open documents, so that
+// they are read from the file system instead.
+func (h *overlay) dropUnopened() {
+	h.mu.Lock()
+	for path := range h.m {
+		if _, open := h.versions[path]; !open {
+			delete(h.m, path)
+		}
+	}
+	h.mu.Unlock()
+}
+
+func (h *overlay) setVersion(uri lsp.DocumentURI, version int) {
+	path := uriToOverlayPath(uri)
+	h.mu.Lock()
+	h.versions[path] = version
+	h.mu.Unlock()
+}
+
+// version returns the version of the open document uri. found is false if
+// it isn't open.
+func (h *overlay) version(uri lsp.DocumentURI) (version int, found bool) {
+	path := uriToOverlayPath(uri)
+	h.mu.Lock()
+	version, found = h.versions[path]
+	h.mu.Unlock()
+	return
 }
 
 func uriToOverlayPath(uri lsp.DocumentURI) string {
@@ -0,0 +1,145 @@
+package langserver
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/sourcegraph/go-langserver/pkg/lsp"
+)
+
+func TestOverlayDidChange(t *testing.T) {
+	rng := func(startLine, startChar, endLine, endChar int) *lsp.Range {
+		return &lsp.Range{
+			Start: lsp.Position{Line: startLine, Character: startChar},
+			End:   lsp.Position{Line: endLine, Character: endChar},
+		}
+	}
+
+	tests := map[string]struct {
+		changes []lsp.TextDocumentContentChangeEvent
+		want    string
+		wantErr bool
+	}{
+		"full": {
+			changes: []lsp.TextDocumentContentChangeEvent{{Text: "package q\n"}},
+			want:    "package q\n",
+		},
+		"insert": {
+			changes: []lsp.TextDocumentContentChangeEvent{{Range: rng(1, 6, 1, 6), Text: "B"}},
+			want:    "package p\nfunc AB() {}\n",
+		},
+		"replace across lines": {
+			changes: []lsp.TextDocumentContentChangeEvent{{Range: rng(0, 8, 1, 6), Text: "q\nfunc C"}},
+			want:    "package q\nfunc C() {}\n",
+		},
+		"append at end of file": {
+			changes: []lsp.TextDocumentContentChangeEvent{{Range: rng(2, 0, 2, 0), Text: "var x int\n"}},
+			want:    "package p\nfunc A() {}\nvar x int\n",
+		},
+		"sequential": {
+			changes: []lsp.TextDocumentContentChangeEvent{
+				{Range: rng(1, 5, 1, 6), Text: "Foo"},
+				{Range: rng(1, 9, 1, 9), Text: "x int"},
+			},
+			want: "package p\nfunc Foo(x int) {}\n",
+		},
+		"range length is ignored": {
+			changes: []lsp.TextDocumentContentChangeEvent{{Range: rng(1, 5, 1, 6), RangeLength: 100, Text: "B"}},
+			want:    "package p\nfunc B() {}\n",
+		},
+		"beyond line": {
+			changes: []lsp.TextDocumentContentChangeEvent{{Range: rng(0, 20, 0, 21), Text: "x"}},
+			wantErr: true,
+		},
+		"beyond file": {
+			changes: []lsp.TextDocumentContentChangeEvent{{Range: rng(5, 0, 5, 0), Text: "x"}},
+			wantErr: true,
+		},
+		"end before start": {
+			changes: []lsp.TextDocumentContentChangeEvent{{Range: rng(1, 6, 1, 2), Text: "x"}},
+			wantErr: true,
+		},
+	}
+	for label, test := range tests {
+		t.Run(label, func(t *testing.T) {
+			uri := lsp.DocumentURI("file:///src/test/pkg/a.go")
+			orig := "package p\nfunc A() {}\n"
+			o := newOverlay()
+			o.didOpen(&lsp.DidOpenTextDocumentParams{TextDocument: lsp.TextDocumentItem{URI: uri, Text: orig}})
+			err := o.didChange(&lsp.DidChangeTextDocumentParams{
+				TextDocument:   lsp.VersionedTextDocumentIdentifier{TextDocumentIdentifier: lsp.TextDocumentIdentifier{URI: uri}},
+				ContentChanges: test.changes,
+			})
+			got, _ := o.get(uri)
+			if test.wantErr {
+				if err == nil {
+					t.Fatal("got no error, want one")
+				}
+				if string(got) != orig {
+					t.Errorf("contents changed on error to %q", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestInitializationOverlay(t *testing.T) {
+	const uri = "file:///src/test/pkg/a.go"
+	var params InitializeParams
+	if err := json.Unmarshal([]byte(`{
+		"rootUri": "file:///src/test/pkg",
+		"initializationOptions": {"overlay": {"`+uri+`": "package p\n"}}
+	}`), &params); err != nil {
+		t.Fatal(err)
+	}
+	params.NoOSFileSystemAccess = true
+	h := &LangHandler{Config: NewDefaultConfig(), HandlerShared: &HandlerShared{}}
+	if err := h.reset(&params); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	check := func(want string) {
+		t.Helper()
+		got, err := h.readFile(ctx, uri)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	}
+	check("package p\n")
+
+	if err := h.overlay.didChange(&lsp.DidChangeTextDocumentParams{
+		TextDocument:   lsp.VersionedTextDocumentIdentifier{TextDocumentIdentifier: lsp.TextDocumentIdentifier{URI: uri}, Version: 2},
+		ContentChanges: []lsp.TextDocumentContentChangeEvent{{Text: "package q\n"}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	check("package q\n")
+}
+
+func TestInitializationOptionsIgnored(t *testing.T) {
+	// Options which aren't the server's don't fail initialize.
+	for _, opts := range []string{`"x"`, `[1]`, `{"overlay": 1}`, `null`} {
+		var params InitializeParams
+		if err := json.Unmarshal([]byte(`{"rootUri": "file:///src/test/pkg", "initializationOptions": `+opts+`}`), &params); err != nil {
+			t.Errorf("%s: %s", opts, err)
+			continue
+		}
+		params.NoOSFileSystemAccess = true
+		h := &LangHandler{Config: NewDefaultConfig(), HandlerShared: &HandlerShared{}}
+		if err := h.reset(&params); err != nil {
+			t.Errorf("%s: %s", opts, err)
+		}
+	}
+}
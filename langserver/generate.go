@@ -0,0 +1,151 @@
+package langserver
+
+import (
+	"bytes"
+	"context"
+	"go/ast"
+	"go/build"
+	"go/token"
+	"path"
+	"strings"
+
+	"golang.org/x/tools/go/buildutil"
+
+	"github.com/sourcegraph/go-langserver/pkg/lsp"
+	"github.com/sourcegraph/go-langserver/pkg/tools"
+)
+
+// generatePrefix starts the //go:generate directives.
+const generatePrefix = "//go:generate "
+
+// generateDefinition returns the definition of the program run by the
+// //go:generate directive at params, if the position is on its name. That
+// is the package "go run" is given, or else the command, which leads to
+// the main package named after it in the workspace. The program is
+// located at its main function. ok is false if the position isn't on a
+// directive.
+func (h *LangHandler) generateDefinition(ctx context.Context, params lsp.TextDocumentPositionParams) (locs []lsp.Location, ok bool) {
+	contents, err := h.readFile(ctx, params.TextDocument.URI)
+	if err != nil {
+		return nil, false
+	}
+	lines := bytes.Split(contents, []byte("\n"))
+	if params.Position.Line >= len(lines) {
+		return nil, false
+	}
+	line := string(lines[params.Position.Line])
+	if !strings.HasPrefix(line, generatePrefix) {
+		return nil, false
+	}
+	program := generateProgram(line, params.Position.Character)
+	if program == "" {
+		return []lsp.Location{}, true
+	}
+
+	bctx := h.BuildContext(ctx)
+	findPackage := h.getFindPackageFunc()
+	dir := path.Dir(h.FilePath(params.TextDocument.URI))
+	var dirs []string
+	switch {
+	case strings.HasSuffix(program, ".go"):
+		// "go run" of the files of a program.
+		filename := path.Join(dir, program)
+		if buildutil.FileExists(bctx, filename) {
+			if loc, ok := mainLocation(bctx, h.positionConverter(ctx), path.Dir(filename), []string{path.Base(filename)}); ok {
+				return []lsp.Location{loc}, true
+			}
+		}
+		return []lsp.Location{}, true
+	case build.IsLocalImport(program):
+		dirs = append(dirs, path.Join(dir, program))
+	case strings.Contains(program, "/"):
+		if bpkg, err := findPackage(ctx, bctx, program, dir, build.FindOnly); err == nil {
+			dirs = append(dirs, bpkg.Dir)
+		}
+	default:
+		// A command installed from the workspace is named after the
+		// directory of its package.
+		for _, rootPath := range h.workspaceFolders() {
+			for _, pkg := range tools.ListPkgsUnderDir(bctx, rootPath, h.skipExcludedDir(rootPath)) {
+				if path.Base(pkg) != program {
+					continue
+				}
+				if bpkg, err := findPackage(ctx, bctx, pkg, rootPath, build.FindOnly); err == nil {
+					dirs = append(dirs, bpkg.Dir)
+				}
+			}
+		}
+	}
+	locs = []lsp.Location{}
+	for _, d := range dirs {
+		bpkg, err := bctx.ImportDir(d, 0)
+		if err != nil || bpkg.Name != "main" {
+			continue
+		}
+		if loc, ok := mainLocation(bctx, h.positionConverter(ctx), d, bpkg.GoFiles); ok {
+			locs = append(locs, loc)
+		}
+	}
+	return locs, true
+}
+
+// generateProgram returns the program run by the //go:generate directive
+// line if character is within it, otherwise "". The program of "go run"
+// is its first argument which isn't a flag, and otherwise it is the
+// command.
+func generateProgram(line string, character int) string {
+	type word struct {
+		text       string
+		start, end int
+	}
+	var words []word
+	start := -1
+	for i := len(generatePrefix); i <= len(line); i++ {
+		space := i == len(line) || line[i] == ' ' || line[i] == '\t' || line[i] == '\r'
+		switch {
+		case space && start >= 0:
+			words = append(words, word{line[start:i], start, i})
+			start = -1
+		case !space && start < 0:
+			start = i
+		}
+	}
+	if len(words) == 0 {
+		return ""
+	}
+	program := words[0]
+	if program.text == "go" && len(words) > 1 && words[1].text == "run" {
+		program = word{}
+		for _, w := range words[2:] {
+			if !strings.HasPrefix(w.text, "-") {
+				program = w
+				break
+			}
+		}
+	}
+	if program.text == "" || character < program.start || character > program.end {
+		return ""
+	}
+	return program.text
+}
+
+// mainLocation returns the location of the main function declared in one
+// of the files of dir, or else of the package clause of the first file.
+func mainLocation(bctx *build.Context, conv *positionConverter, dir string, files []string) (loc lsp.Location, ok bool) {
+	fset := token.NewFileSet()
+	for _, name := range files {
+		f, err := buildutil.ParseFile(fset, bctx, nil, dir, name, 0)
+		if err != nil {
+			continue
+		}
+		if !ok {
+			loc, ok = goRangeToLSPLocation(conv, fset, f.Name.Pos(), f.Name.End()), true
+		}
+		for _, decl := range f.Decls {
+			if fn, isFunc := decl.(*ast.FuncDecl); isFunc && fn.Recv == nil && fn.Name.Name == "main" {
+				return goRangeToLSPLocation(conv, fset, fn.Name.Pos(), fn.Name.End()), true
+			}
+		}
+	}
+	return loc, ok
+}
@@ -0,0 +1,25 @@
+package langserver
+
+import "testing"
+
+func TestGenerateProgram(t *testing.T) {
+	tests := []struct {
+		line      string
+		character int
+		want      string
+	}{
+		{"//go:generate stringer -type=Kind", 14, "stringer"},
+		{"//go:generate stringer -type=Kind", 22, "stringer"},
+		{"//go:generate stringer -type=Kind", 24, ""},
+		{"//go:generate go run ./cmd/gen -out x.go", 22, "./cmd/gen"},
+		{"//go:generate go run ./cmd/gen -out x.go", 15, ""},
+		{"//go:generate go run -tags=gen gen.go", 33, "gen.go"},
+		{"//go:generate  go run example.com/tools/gen\r", 43, "example.com/tools/gen"},
+		{"//go:generate go run", 18, ""},
+	}
+	for _, test := range tests {
+		if got := generateProgram(test.line, test.character); got != test.want {
+			t.Errorf("generateProgram(%q, %d) = %q, want %q", test.line, test.character, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,284 @@
+package langserver
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"go/build"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+
+	"golang.org/x/tools/go/buildutil"
+
+	"github.com/sourcegraph/go-langserver/langserver/util"
+)
+
+// goModule is the main module of a workspace which has a go.mod file at
+// its root. go/build only knows GOPATH, so the packages of the module and
+// of the modules it requires are found using goModule instead.
+type goModule struct {
+	path string // module path, such as "github.com/foo/bar"
+	dir  string // directory containing go.mod
+
+	// deps maps the path of each required module to its directory:
+	// the target of its replace directive if it has one, otherwise
+	// its directory in the module cache.
+	deps map[string]string
+}
+
+// dirForImport returns the directory of the package importPath if it is
+// in m or one of its requirements, or "" if it isn't.
+func (m *goModule) dirForImport(importPath string) string {
+	if util.PathHasPrefix(importPath, m.path) {
+		return path.Join(m.dir, util.PathTrimPrefix(importPath, m.path))
+	}
+	var best string
+	for modPath := range m.deps {
+		if len(modPath) > len(best) && util.PathHasPrefix(importPath, modPath) {
+			best = modPath
+		}
+	}
+	if best == "" {
+		return ""
+	}
+	return path.Join(m.deps[best], util.PathTrimPrefix(importPath, best))
+}
+
+// importPathForDir returns the import path of the package in dir, or "" if
+// dir isn't in m or m is nil.
+func (m *goModule) importPathForDir(dir string) string {
+	if m == nil || !util.PathHasPrefix(dir, m.dir) {
+		return ""
+	}
+	return path.Join(m.path, util.PathTrimPrefix(dir, m.dir))
+}
+
+// lazyModule reads the go.mod of a workspace folder on first use.
+type lazyModule struct {
+	once sync.Once
+	mod  *goModule
+}
+
+// mainModule returns the module whose go.mod is at the root of the
+// workspace folder containing filename, or nil if there is none. go.mod
+// is read again after the caches are reset.
+func (h *LangHandler) mainModule(bctx *build.Context, filename string) *goModule {
+	folder := h.folderOf(filename)
+	h.mu.Lock()
+	lm := h.modules[folder]
+	if lm == nil {
+		lm = &lazyModule{}
+		h.modules[folder] = lm
+	}
+	h.mu.Unlock()
+	lm.once.Do(func() {
+		filename := path.Join(folder, "go.mod")
+		f, err := buildutil.OpenFile(bctx, filename)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				warnf("reading %s: %s", filename, err)
+			}
+			return
+		}
+		defer f.Close()
+		data, err := ioutil.ReadAll(f)
+		if err != nil {
+			warnf("reading %s: %s", filename, err)
+			return
+		}
+		lm.mod, err = parseGoMod(data, folder, moduleCacheDir(bctx))
+		if err != nil {
+			warnf("ignoring %s: %s", filename, err)
+		}
+	})
+	return lm.mod
+}
+
+// workspaceModules returns the modules of the workspace folders which
+// have one. The module of the folder containing dir comes first.
+func (h *LangHandler) workspaceModules(bctx *build.Context, dir string) []*goModule {
+	var mods []*goModule
+	if mod := h.mainModule(bctx, dir); mod != nil {
+		mods = append(mods, mod)
+	}
+	for _, folder := range h.workspaceFolders() {
+		if mod := h.mainModule(bctx, folder); mod != nil && (len(mods) == 0 || mod != mods[0]) {
+			mods = append(mods, mod)
+		}
+	}
+	return mods
+}
+
+// getFindPackageFunc is like HandlerShared.getFindPackageFunc, but if
+// workspace folders are modules the packages of the modules and their
+// requirements are found in their module directories first. The module
+// of the folder containing fromDir takes precedence, as the others may
+// require different versions of the same module.
+func (h *LangHandler) getFindPackageFunc() FindPackageFunc {
+	findPackage := h.HandlerShared.getFindPackageFunc()
+	return func(ctx context.Context, bctx *build.Context, importPath, fromDir string, mode build.ImportMode) (*build.Package, error) {
+		for _, mod := range h.workspaceModules(bctx, fromDir) {
+			dir := mod.dirForImport(importPath)
+			if dir == "" {
+				continue
+			}
+			bpkg, err := bctx.ImportDir(dir, mode)
+			if bpkg != nil {
+				bpkg.ImportPath = importPath
+			}
+			return bpkg, err
+		}
+		return findPackage(ctx, bctx, importPath, fromDir, mode)
+	}
+}
+
+// useGodef reports whether definition requests, and hover requests unless
+// Config.HoverBackend is set, are answered with godef. Godef reads the
+// binary package cache and imports packages using GOPATH, so if a
+// workspace folder is a module the typechecker is used instead.
+func (h *LangHandler) useGodef(ctx context.Context) bool {
+	return h.config().UseBinaryPkgCache && len(h.workspaceModules(h.BuildContext(ctx), "")) == 0
+}
+
+// moduleCacheDir returns the root of the module download cache.
+func moduleCacheDir(bctx *build.Context) string {
+	if dir := os.Getenv("GOMODCACHE"); dir != "" {
+		return dir
+	}
+	gopaths := buildutil.SplitPathList(bctx, bctx.GOPATH)
+	if len(gopaths) == 0 {
+		return ""
+	}
+	return path.Join(gopaths[0], "pkg", "mod")
+}
+
+// parseGoMod parses the go.mod file data in dir. Only the module,
+// require and replace directives are used; modCache is the root of the
+// module download cache.
+func parseGoMod(data []byte, dir, modCache string) (*goModule, error) {
+	m := &goModule{dir: dir, deps: make(map[string]string)}
+	replace := make(map[string]string)
+	var block string // directive of the enclosing "( ... )" block
+	for i, line := range bytes.Split(data, []byte("\n")) {
+		if j := bytes.Index(line, []byte("//")); j >= 0 {
+			line = line[:j]
+		}
+		fields, err := goModFields(string(line))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", i+1, err)
+		}
+		if len(fields) == 0 {
+			continue
+		}
+		if block != "" {
+			if fields[0] == ")" {
+				block = ""
+				continue
+			}
+			fields = append([]string{block}, fields...)
+		} else if len(fields) == 2 && fields[1] == "(" {
+			block = fields[0]
+			continue
+		}
+
+		switch fields[0] {
+		case "module":
+			if len(fields) != 2 {
+				return nil, fmt.Errorf("line %d: usage: module module/path", i+1)
+			}
+			m.path = fields[1]
+		case "require":
+			if len(fields) != 3 {
+				return nil, fmt.Errorf("line %d: usage: require module/path v1.2.3", i+1)
+			}
+			m.deps[fields[1]] = moduleVersionDir(modCache, fields[1], fields[2])
+		case "replace":
+			arrow := 0
+			for j, f := range fields {
+				if f == "=>" {
+					arrow = j
+				}
+			}
+			if (arrow != 2 && arrow != 3) || (len(fields)-arrow != 2 && len(fields)-arrow != 3) {
+				return nil, fmt.Errorf("line %d: usage: replace module/path [v1.2.3] => other/module v1.4 or local/dir", i+1)
+			}
+			target := fields[arrow+1]
+			if len(fields)-arrow == 3 {
+				target = moduleVersionDir(modCache, target, fields[arrow+2])
+			} else if !path.IsAbs(target) {
+				target = path.Join(dir, target)
+			}
+			replace[fields[1]] = target
+		}
+	}
+	if m.path == "" {
+		return nil, fmt.Errorf("no module directive")
+	}
+	for modPath, target := range replace {
+		if _, ok := m.deps[modPath]; ok {
+			m.deps[modPath] = target
+		}
+	}
+	return m, nil
+}
+
+// goModFields splits a go.mod line into its fields, unquoting any quoted
+// ones.
+func goModFields(line string) ([]string, error) {
+	var fields []string
+	for {
+		line = strings.TrimLeftFunc(line, unicode.IsSpace)
+		if line == "" {
+			return fields, nil
+		}
+		if line[0] != '"' && line[0] != '`' {
+			end := strings.IndexFunc(line, unicode.IsSpace)
+			if end < 0 {
+				end = len(line)
+			}
+			fields = append(fields, line[:end])
+			line = line[end:]
+			continue
+		}
+		quote := line[0]
+		end := 1
+		for end < len(line) && line[end] != quote {
+			if quote == '"' && line[end] == '\\' {
+				end++
+			}
+			end++
+		}
+		if end >= len(line) {
+			return nil, fmt.Errorf("unterminated quoted string")
+		}
+		s, err := strconv.Unquote(line[:end+1])
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, s)
+		line = line[end+1:]
+	}
+}
+
+// moduleVersionDir returns the directory of a module version in the
+// module cache, where upper case letters are escaped as "!" followed by
+// the lower case letter.
+func moduleVersionDir(modCache, modPath, version string) string {
+	escape := func(s string) string {
+		var b strings.Builder
+		for _, r := range s {
+			if unicode.IsUpper(r) {
+				b.WriteByte('!')
+				r = unicode.ToLower(r)
+			}
+			b.WriteRune(r)
+		}
+		return b.String()
+	}
+	return path.Join(modCache, escape(modPath)+"@"+escape(version))
+}
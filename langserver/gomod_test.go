@@ -0,0 +1,79 @@
+package langserver
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseGoMod(t *testing.T) {
+	data := []byte(`module "example.com/m" // comment
+
+go 1.11
+
+require (
+	example.com/a v1.2.3
+	github.com/Upper/b v0.1.0 // indirect
+	example.com/c v1.0.0
+)
+
+require example.com/d v2.0.0
+
+replace example.com/c => ../c
+replace example.com/d v2.0.0 => example.com/e v2.1.0
+replace example.com/unused => /unused
+`)
+	m, err := parseGoMod(data, "/src/m", "/gopath/pkg/mod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &goModule{
+		path: "example.com/m",
+		dir:  "/src/m",
+		deps: map[string]string{
+			"example.com/a":      "/gopath/pkg/mod/example.com/a@v1.2.3",
+			"github.com/Upper/b": "/gopath/pkg/mod/github.com/!upper/b@v0.1.0",
+			"example.com/c":      "/src/c",
+			"example.com/d":      "/gopath/pkg/mod/example.com/e@v2.1.0",
+		},
+	}
+	if !reflect.DeepEqual(m, want) {
+		t.Fatalf("got %+v, want %+v", m, want)
+	}
+
+	for importPath, want := range map[string]string{
+		"example.com/m":      "/src/m",
+		"example.com/m/sub":  "/src/m/sub",
+		"example.com/a/x/y":  "/gopath/pkg/mod/example.com/a@v1.2.3/x/y",
+		"github.com/Upper/b": "/gopath/pkg/mod/github.com/!upper/b@v0.1.0",
+		"example.com/ab":     "",
+		"fmt":                "",
+	} {
+		if got := m.dirForImport(importPath); got != want {
+			t.Errorf("dirForImport(%q): got %q, want %q", importPath, got, want)
+		}
+	}
+	for dir, want := range map[string]string{
+		"/src/m":     "example.com/m",
+		"/src/m/sub": "example.com/m/sub",
+		"/src/mm":    "",
+	} {
+		if got := m.importPathForDir(dir); got != want {
+			t.Errorf("importPathForDir(%q): got %q, want %q", dir, got, want)
+		}
+	}
+}
+
+func TestParseGoModErrors(t *testing.T) {
+	for _, data := range []string{
+		"",
+		"go 1.11\n",
+		"module\n",
+		"module example.com/m\nrequire example.com/a\n",
+		"module \"example.com/m\n",
+		"module example.com/m\nreplace example.com/a\n",
+	} {
+		if _, err := parseGoMod([]byte(data), "/src/m", ""); err == nil {
+			t.Errorf("%q: got no error", data)
+		}
+	}
+}
@@ -5,7 +5,8 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
+	"go/token"
+	"path"
 	"strconv"
 	"sync"
 	"time"
@@ -40,15 +41,16 @@ func NewHandler(cfg Config) jsonrpc2.Handler {
 // result. We actually can return responses out of order, since vscode does
 // not seem to have issues with that. We also do everything concurrently,
 // except methods which could mutate the state used by our typecheckers (ie
-// textDocument/didOpen, etc). Those are done serially since applying them out
-// of order could result in a different textDocument.
+// textDocument/didOpen, etc), the configuration or the workspace folders.
+// Those are done serially since applying them out of order could result in
+// a different textDocument.
 type lspHandler struct {
 	jsonrpc2.Handler
 }
 
 // Handle implements jsonrpc2.Handler
 func (h lspHandler) Handle(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) {
-	if isFileSystemRequest(req.Method) {
+	if isFileSystemRequest(req.Method) || req.Method == "workspace/didChangeConfiguration" || req.Method == "workspace/didChangeWorkspaceFolders" {
 		h.Handler.Handle(ctx, conn, req)
 		return
 	}
@@ -62,8 +64,14 @@ type LangHandler struct {
 	*HandlerShared
 	init *InitializeParams // set by "initialize" request
 
+	// folders are the paths of the workspace folders, which is just the
+	// root unless the client sent workspaceFolders. They change with
+	// workspace/didChangeWorkspaceFolders.
+	folders []string
+
 	typecheckCache cache
 	symbolCache    cache
+	godefCache     cache
 
 	// cache the reverse import graph. The sync.Once is a pointer since it
 	// is reset when we reset caches. If it was a value we would racily
@@ -71,9 +79,28 @@ type LangHandler struct {
 	importGraphOnce *sync.Once
 	importGraph     importgraph.Graph
 
+	// modules are the go.mod files of the workspace folders, keyed by
+	// folder. Like the import graph they are replaced when we reset
+	// caches.
+	modules map[string]*lazyModule
+
+	diagnostics *diagnosticsState
+
+	// loads is a counting semaphore limiting the number of packages
+	// loaded at once by all requests. It is created on first use.
+	loads chan bool
+
 	cancel *cancel
 
-	Config Config // language handler configuration; must not change after handling has begun
+	// backgroundCancels cancel the work the server does in the
+	// background, such as prewarming packages, when it shuts down.
+	backgroundCancels []context.CancelFunc
+
+	// Config is the language handler configuration. Once handling has
+	// begun it is only changed by workspace/didChangeConfiguration, so
+	// it must be read with config.
+	Config   Config
+	configMu sync.Mutex // guards Config once handling has begun
 }
 
 // reset clears all internal state in h.
@@ -85,10 +112,6 @@ func (h *LangHandler) reset(init *InitializeParams) error {
 		}
 	}
 
-	if util.IsURI(lsp.DocumentURI(init.InitializeParams.RootPath)) {
-		log.Printf("Passing an initialize rootPath URI (%q) is deprecated. Use rootUri instead.", init.InitializeParams.RootPath)
-	}
-
 	h.mu.Lock()
 	defer h.mu.Unlock()
 	if err := h.HandlerCommon.Reset(init.Root()); err != nil {
@@ -101,12 +124,50 @@ func (h *LangHandler) reset(init *InitializeParams) error {
 			return err
 		}
 	}
+	h.HandlerShared.Mu.Lock()
+	overlay := h.overlay
+	h.HandlerShared.Mu.Unlock()
+	overlay.setPositionEncoding(negotiatePositionEncoding(init.Capabilities))
+	if opts := init.initializationOptions(); opts != nil {
+		for uri, text := range opts.Overlay {
+			overlay.set(uri, []byte(text))
+		}
+	}
+	setLogLevel(h.config().LogLevel)
 	h.init = init
+	h.folders = initialFolders(init)
 	h.cancel = &cancel{}
+	h.diagnostics = newDiagnosticsState()
 	h.resetCaches(false)
 	return nil
 }
 
+// normalizeRoot converts the deprecated rootPath of params to a file URI,
+// as historically it could be either. The root is rootUri if the client
+// sent one, as rootUri takes precedence, otherwise it is rootPath. A
+// client which sent neither but has workspace folders is given the first
+// of them as its root. It returns an error if the client sent none of
+// them.
+func normalizeRoot(params *lsp.InitializeParams) error {
+	if params.RootURI == "" && params.RootPath == "" && len(params.WorkspaceFolders) > 0 {
+		params.RootURI = params.WorkspaceFolders[0].URI
+	}
+	// HACK: RootPath is not a URI, but historically we treated it
+	// as such.
+	if util.IsURI(lsp.DocumentURI(params.RootPath)) {
+		warnf("Passing an initialize rootPath URI (%q) is deprecated. Use rootUri instead.", params.RootPath)
+	} else if params.RootPath != "" {
+		params.RootPath = string(util.PathToURI(params.RootPath))
+	}
+	switch {
+	case params.RootURI == "" && params.RootPath == "":
+		return &jsonrpc2.Error{Code: jsonrpc2.CodeInvalidParams, Message: "initialize requires a rootUri or workspaceFolders"}
+	case params.RootURI != "" && params.RootPath != "" && !util.PathEqual(util.UriToPath(params.RootURI), util.UriToPath(lsp.DocumentURI(params.RootPath))):
+		warnf("Initialize rootUri %q and rootPath %q differ, using rootUri.", params.RootURI, params.RootPath)
+	}
+	return nil
+}
+
 func (h *LangHandler) resetCaches(lock bool) {
 	if lock {
 		h.mu.Lock()
@@ -114,9 +175,10 @@ func (h *LangHandler) resetCaches(lock bool) {
 
 	h.importGraphOnce = &sync.Once{}
 	h.importGraph = nil
+	h.modules = make(map[string]*lazyModule)
 
 	if h.typecheckCache == nil {
-		h.typecheckCache = newTypecheckCache()
+		h.typecheckCache = newTypecheckCache(h.config().TypecheckCacheSize)
 	} else {
 		h.typecheckCache.Purge()
 	}
@@ -127,11 +189,71 @@ func (h *LangHandler) resetCaches(lock bool) {
 		h.symbolCache.Purge()
 	}
 
+	if h.godefCache == nil {
+		h.godefCache = newGodefCache()
+	} else {
+		h.godefCache.Purge()
+	}
+
 	if lock {
 		h.mu.Unlock()
 	}
 }
 
+// invalidateFile is like resetCaches, but only removes the typecheck
+// results and godef files which could depend on the file at uri. They are
+// keyed by the contents of their own files, but they also include the
+// packages they import, and the file could be new to its package.
+func (h *LangHandler) invalidateFile(uri lsp.DocumentURI) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.importGraphOnce = &sync.Once{}
+	h.importGraph = nil
+	h.symbolCache.Purge()
+
+	filename := h.FilePath(uri)
+	dir := path.Dir(filename)
+	if path.Base(filename) == "go.mod" {
+		for _, folder := range h.folders {
+			if !util.PathEqual(folder, dir) {
+				continue
+			}
+			// The module path and requirements affect how
+			// everything is imported.
+			delete(h.modules, folder)
+			h.typecheckCache.Purge()
+			h.godefCache.Purge()
+			return
+		}
+	}
+
+	h.typecheckCache.RemoveIf(func(v interface{}) bool {
+		res, ok := v.(*typecheckResult)
+		if !ok || res.prog == nil {
+			return true
+		}
+		return hasFileInDir(res.fset, dir)
+	})
+	h.godefCache.RemoveIf(func(v interface{}) bool {
+		res, ok := v.(*godefFile)
+		if !ok || res.file == nil {
+			return true
+		}
+		return hasFileInDir(res.file.FileSet(), dir)
+	})
+}
+
+// hasFileInDir reports whether one of the files of fset is in dir.
+func hasFileInDir(fset *token.FileSet, dir string) bool {
+	found := false
+	fset.Iterate(func(f *token.File) bool {
+		found = util.PathEqual(path.Dir(f.Name()), dir)
+		return !found
+	})
+	return found
+}
+
 // handle implements jsonrpc2.Handler.
 func (h *LangHandler) handle(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) (result interface{}, err error) {
 	return h.Handle(ctx, conn, req)
@@ -186,6 +308,10 @@ func (h *LangHandler) Handle(ctx context.Context, conn jsonrpc2.JSONRPC2, req *j
 		defer cancel()
 	}
 
+	if editingMethods[req.Method] && h.config().ReadOnly {
+		return nil, readOnlyError(req.Method)
+	}
+
 	switch req.Method {
 	case "initialize":
 		if h.init != nil {
@@ -199,20 +325,93 @@ func (h *LangHandler) Handle(ctx context.Context, conn jsonrpc2.JSONRPC2, req *j
 			return nil, err
 		}
 
-		// HACK: RootPath is not a URI, but historically we treated it
-		// as such. Convert it to a file URI
-		if !util.IsURI(lsp.DocumentURI(params.RootPath)) {
-			params.RootPath = string(util.PathToURI(params.RootPath))
+		if err := normalizeRoot(&params.InitializeParams); err != nil {
+			return nil, err
+		}
+		if err := validateGoEnv(h.config()); err != nil {
+			return nil, err
 		}
-
 		if err := h.reset(&params); err != nil {
 			return nil, err
 		}
-		if h.Config.GocodeCompletionEnabled {
+		if h.config().GocodeCompletionEnabled {
 			gocode.InitDaemon(h.BuildContext(ctx))
 		}
 
-		// PERF: Kick off a workspace/symbol in the background to warm up the server
+		kind := lsp.TDSKIncremental
+		completionOp := &lsp.CompletionOptions{TriggerCharacters: []string{"."}}
+		// Code actions are only returned as CodeAction literals, not
+		// commands.
+		ca := params.Capabilities.TextDocument.CodeAction
+		codeActionOp := ca != nil && ca.CodeActionLiteralSupport != nil
+		renameOp := &lsp.RenameOptionsOrBool{Bool: true}
+		if r := params.Capabilities.TextDocument.Rename; r != nil && r.PrepareSupport {
+			renameOp = &lsp.RenameOptionsOrBool{Options: &lsp.RenameOptions{PrepareProvider: true}}
+		}
+		semanticTokensOp := &lsp.SemanticTokensOptions{
+			Legend: lsp.SemanticTokensLegend{
+				TokenTypes:     semanticTokenTypes,
+				TokenModifiers: semanticTokenModifiers,
+			},
+			Full: true,
+		}
+		onTypeFormattingOp := &lsp.DocumentOnTypeFormattingOptions{
+			FirstTriggerCharacter: onTypeFormattingNewline,
+			MoreTriggerCharacter:  []string{onTypeFormattingBrace},
+		}
+		commands := []string{commandStatus, commandReload, commandBuildContext}
+		if h.config().FreeGCCommandEnabled {
+			commands = append(commands, commandFreeGC)
+		}
+		workspaceOp := &lsp.WorkspaceOptions{
+			WorkspaceFolders: &lsp.WorkspaceFoldersServerCapabilities{Supported: true, ChangeNotifications: true},
+		}
+		result := lsp.InitializeResult{
+			Capabilities: lsp.ServerCapabilities{
+				PositionEncoding: negotiatePositionEncoding(params.Capabilities),
+				TextDocumentSync: &lsp.TextDocumentSyncOptionsOrKind{
+					Kind: &kind,
+				},
+				CompletionProvider:               completionOp,
+				DefinitionProvider:               true,
+				TypeDefinitionProvider:           true,
+				DocumentFormattingProvider:       true,
+				DocumentRangeFormattingProvider:  true,
+				DocumentOnTypeFormattingProvider: onTypeFormattingOp,
+				CodeActionProvider:               codeActionOp,
+				DocumentHighlightProvider:        true,
+				DocumentLinkProvider:             &lsp.DocumentLinkOptions{},
+				CodeLensProvider:                 &lsp.CodeLensOptions{ResolveProvider: true},
+				FoldingRangeProvider:             true,
+				CallHierarchyProvider:            true,
+				SemanticTokensProvider:           semanticTokensOp,
+				ExecuteCommandProvider:           &lsp.ExecuteCommandOptions{Commands: commands},
+				Workspace:                        workspaceOp,
+				RenameProvider:                   renameOp,
+				DocumentSymbolProvider:           true,
+				HoverProvider:                    true,
+				ReferencesProvider:               true,
+				WorkspaceSymbolProvider:          true,
+				ImplementationProvider:           true,
+				XWorkspaceReferencesProvider:     true,
+				XDefinitionProvider:              true,
+				XWorkspaceSymbolByProperties:     true,
+				SignatureHelpProvider:            &lsp.SignatureHelpOptions{TriggerCharacters: []string{"(", ","}},
+			},
+		}
+		if h.config().ReadOnly {
+			result.Capabilities = withoutEditingCapabilities(result.Capabilities)
+		}
+		return result, nil
+
+	case "initialized":
+		// A notification that the client is ready to receive requests.
+		h.startPrewarm(conn)
+		h.startCacheSweeper()
+
+		// PERF: Kick off a workspace/symbol in the background to warm
+		// up the server. It reports progress, so it waits until the
+		// client is initialized, as prewarming does.
 		if yes, _ := strconv.ParseBool(envWarmupOnInitialize); yes {
 			go func() {
 				ctx, cancel := context.WithDeadline(ctx, time.Now().Add(30*time.Second))
@@ -223,38 +422,11 @@ func (h *LangHandler) Handle(ctx context.Context, conn jsonrpc2.JSONRPC2, req *j
 				})
 			}()
 		}
-
-		kind := lsp.TDSKIncremental
-		var completionOp *lsp.CompletionOptions
-		if h.Config.GocodeCompletionEnabled {
-			completionOp = &lsp.CompletionOptions{TriggerCharacters: []string{"."}}
-		}
-		return lsp.InitializeResult{
-			Capabilities: lsp.ServerCapabilities{
-				TextDocumentSync: &lsp.TextDocumentSyncOptionsOrKind{
-					Kind: &kind,
-				},
-				CompletionProvider:           completionOp,
-				DefinitionProvider:           true,
-				DocumentFormattingProvider:   true,
-				DocumentSymbolProvider:       true,
-				HoverProvider:                true,
-				ReferencesProvider:           true,
-				WorkspaceSymbolProvider:      true,
-				ImplementationProvider:       true,
-				XWorkspaceReferencesProvider: true,
-				XDefinitionProvider:          true,
-				XWorkspaceSymbolByProperties: true,
-				SignatureHelpProvider:        &lsp.SignatureHelpOptions{TriggerCharacters: []string{"(", ","}},
-			},
-		}, nil
-
-	case "initialized":
-		// A notification that the client is ready to receive requests. Ignore
 		return nil, nil
 
 	case "shutdown":
 		h.ShutDown()
+		h.stopBackground()
 		return nil, nil
 
 	case "exit":
@@ -290,7 +462,11 @@ func (h *LangHandler) Handle(ctx context.Context, conn jsonrpc2.JSONRPC2, req *j
 		if err := json.Unmarshal(*req.Params, &params); err != nil {
 			return nil, err
 		}
-		return h.handleHover(ctx, conn, req, params)
+		hover, err := h.handleHover(ctx, conn, req, params)
+		if hover != nil && h.supportsMarkdownHover() {
+			hover.Markup = markdownHover(hover.Contents)
+		}
+		return hover, err
 
 	case "textDocument/definition":
 		if req.Params == nil {
@@ -300,7 +476,22 @@ func (h *LangHandler) Handle(ctx context.Context, conn jsonrpc2.JSONRPC2, req *j
 		if err := json.Unmarshal(*req.Params, &params); err != nil {
 			return nil, err
 		}
-		return h.handleDefinition(ctx, conn, req, params)
+		locs, err := h.handleDefinition(ctx, conn, req, params)
+		if err != nil || !h.supportsDefinitionLinks() {
+			return h.clientLocations(locs), err
+		}
+		return h.definitionLinks(ctx, params, h.clientLocations(locs)), nil
+
+	case "textDocument/typeDefinition":
+		if req.Params == nil {
+			return nil, &jsonrpc2.Error{Code: jsonrpc2.CodeInvalidParams}
+		}
+		var params lsp.TextDocumentPositionParams
+		if err := json.Unmarshal(*req.Params, &params); err != nil {
+			return nil, err
+		}
+		locs, err := h.handleTypeDefinition(ctx, conn, req, params)
+		return h.clientLocations(locs), err
 
 	case "textDocument/xdefinition":
 		if req.Params == nil {
@@ -310,13 +501,14 @@ func (h *LangHandler) Handle(ctx context.Context, conn jsonrpc2.JSONRPC2, req *j
 		if err := json.Unmarshal(*req.Params, &params); err != nil {
 			return nil, err
 		}
-		return h.handleXDefinition(ctx, conn, req, params)
+		res, err := h.handleXDefinition(ctx, conn, req, params)
+		clientURI := h.clientURIs()
+		for i := range res {
+			res[i].Location.URI = clientURI(res[i].Location.URI)
+		}
+		return res, err
 
 	case "textDocument/completion":
-		if !h.Config.GocodeCompletionEnabled {
-			return nil, &jsonrpc2.Error{Code: jsonrpc2.CodeMethodNotFound,
-				Message: fmt.Sprintf("completion is disabled. Enable with flag `-gocodecompletion`")}
-		}
 		if req.Params == nil {
 			return nil, &jsonrpc2.Error{Code: jsonrpc2.CodeInvalidParams}
 		}
@@ -324,6 +516,12 @@ func (h *LangHandler) Handle(ctx context.Context, conn jsonrpc2.JSONRPC2, req *j
 		if err := json.Unmarshal(*req.Params, &params); err != nil {
 			return nil, err
 		}
+		if list, ok := h.handleImportPathCompletion(ctx, params); ok {
+			return list, nil
+		}
+		if !h.config().GocodeCompletionEnabled {
+			return h.handleTypecheckCompletion(ctx, conn, req, params)
+		}
 		return h.handleTextDocumentCompletion(ctx, conn, req, params)
 
 	case "textDocument/references":
@@ -346,6 +544,36 @@ func (h *LangHandler) Handle(ctx context.Context, conn jsonrpc2.JSONRPC2, req *j
 		}
 		return h.handleTextDocumentImplementation(ctx, conn, req, params)
 
+	case "textDocument/rename":
+		if req.Params == nil {
+			return nil, &jsonrpc2.Error{Code: jsonrpc2.CodeInvalidParams}
+		}
+		var params lsp.RenameParams
+		if err := json.Unmarshal(*req.Params, &params); err != nil {
+			return nil, err
+		}
+		return h.handleTextDocumentRename(ctx, conn, req, params)
+
+	case "textDocument/prepareRename":
+		if req.Params == nil {
+			return nil, &jsonrpc2.Error{Code: jsonrpc2.CodeInvalidParams}
+		}
+		var params lsp.TextDocumentPositionParams
+		if err := json.Unmarshal(*req.Params, &params); err != nil {
+			return nil, err
+		}
+		return h.handleTextDocumentPrepareRename(ctx, conn, req, params)
+
+	case "textDocument/documentHighlight":
+		if req.Params == nil {
+			return nil, &jsonrpc2.Error{Code: jsonrpc2.CodeInvalidParams}
+		}
+		var params lsp.TextDocumentPositionParams
+		if err := json.Unmarshal(*req.Params, &params); err != nil {
+			return nil, err
+		}
+		return h.handleTextDocumentHighlight(ctx, conn, req, params)
+
 	case "textDocument/documentSymbol":
 		if req.Params == nil {
 			return nil, &jsonrpc2.Error{Code: jsonrpc2.CodeInvalidParams}
@@ -354,6 +582,9 @@ func (h *LangHandler) Handle(ctx context.Context, conn jsonrpc2.JSONRPC2, req *j
 		if err := json.Unmarshal(*req.Params, &params); err != nil {
 			return nil, err
 		}
+		if ds := h.init.Capabilities.TextDocument.DocumentSymbol; ds != nil && ds.HierarchicalDocumentSymbolSupport {
+			return h.handleTextDocumentHierarchicalSymbol(ctx, conn, req, params)
+		}
 		return h.handleTextDocumentSymbol(ctx, conn, req, params)
 
 	case "textDocument/signatureHelp":
@@ -376,6 +607,116 @@ func (h *LangHandler) Handle(ctx context.Context, conn jsonrpc2.JSONRPC2, req *j
 		}
 		return h.handleTextDocumentFormatting(ctx, conn, req, params)
 
+	case "textDocument/rangeFormatting":
+		if req.Params == nil {
+			return nil, &jsonrpc2.Error{Code: jsonrpc2.CodeInvalidParams}
+		}
+		var params lsp.DocumentRangeFormattingParams
+		if err := json.Unmarshal(*req.Params, &params); err != nil {
+			return nil, err
+		}
+		return h.handleTextDocumentRangeFormatting(ctx, conn, req, params)
+
+	case "textDocument/onTypeFormatting":
+		if req.Params == nil {
+			return nil, &jsonrpc2.Error{Code: jsonrpc2.CodeInvalidParams}
+		}
+		var params lsp.DocumentOnTypeFormattingParams
+		if err := json.Unmarshal(*req.Params, &params); err != nil {
+			return nil, err
+		}
+		return h.handleTextDocumentOnTypeFormatting(ctx, conn, req, params)
+
+	case "textDocument/codeAction":
+		if req.Params == nil {
+			return nil, &jsonrpc2.Error{Code: jsonrpc2.CodeInvalidParams}
+		}
+		var params lsp.CodeActionParams
+		if err := json.Unmarshal(*req.Params, &params); err != nil {
+			return nil, err
+		}
+		return h.handleTextDocumentCodeAction(ctx, conn, req, params)
+
+	case "textDocument/documentLink":
+		if req.Params == nil {
+			return nil, &jsonrpc2.Error{Code: jsonrpc2.CodeInvalidParams}
+		}
+		var params lsp.DocumentLinkParams
+		if err := json.Unmarshal(*req.Params, &params); err != nil {
+			return nil, err
+		}
+		return h.handleTextDocumentDocumentLink(ctx, conn, req, params)
+
+	case "textDocument/codeLens":
+		if req.Params == nil {
+			return nil, &jsonrpc2.Error{Code: jsonrpc2.CodeInvalidParams}
+		}
+		var params lsp.CodeLensParams
+		if err := json.Unmarshal(*req.Params, &params); err != nil {
+			return nil, err
+		}
+		return h.handleTextDocumentCodeLens(ctx, conn, req, params)
+
+	case "codeLens/resolve":
+		if req.Params == nil {
+			return nil, &jsonrpc2.Error{Code: jsonrpc2.CodeInvalidParams}
+		}
+		var params codeLensResolveParams
+		if err := json.Unmarshal(*req.Params, &params); err != nil {
+			return nil, err
+		}
+		return h.handleCodeLensResolve(ctx, conn, req, params)
+
+	case "textDocument/foldingRange":
+		if req.Params == nil {
+			return nil, &jsonrpc2.Error{Code: jsonrpc2.CodeInvalidParams}
+		}
+		var params lsp.FoldingRangeParams
+		if err := json.Unmarshal(*req.Params, &params); err != nil {
+			return nil, err
+		}
+		return h.handleTextDocumentFoldingRange(ctx, conn, req, params)
+
+	case "textDocument/semanticTokens/full":
+		if req.Params == nil {
+			return nil, &jsonrpc2.Error{Code: jsonrpc2.CodeInvalidParams}
+		}
+		var params lsp.SemanticTokensParams
+		if err := json.Unmarshal(*req.Params, &params); err != nil {
+			return nil, err
+		}
+		return h.handleTextDocumentSemanticTokensFull(ctx, conn, req, params)
+
+	case "textDocument/prepareCallHierarchy":
+		if req.Params == nil {
+			return nil, &jsonrpc2.Error{Code: jsonrpc2.CodeInvalidParams}
+		}
+		var params lsp.CallHierarchyPrepareParams
+		if err := json.Unmarshal(*req.Params, &params); err != nil {
+			return nil, err
+		}
+		return h.handleTextDocumentPrepareCallHierarchy(ctx, conn, req, params)
+
+	case "callHierarchy/incomingCalls":
+		if req.Params == nil {
+			return nil, &jsonrpc2.Error{Code: jsonrpc2.CodeInvalidParams}
+		}
+		var params lsp.CallHierarchyIncomingCallsParams
+		if err := json.Unmarshal(*req.Params, &params); err != nil {
+			return nil, err
+		}
+		return h.handleCallHierarchyIncomingCalls(ctx, conn, req, params)
+
+	case "callHierarchy/outgoingCalls":
+		if req.Params == nil {
+			return nil, &jsonrpc2.Error{Code: jsonrpc2.CodeInvalidParams}
+		}
+		var params lsp.CallHierarchyOutgoingCallsParams
+		if err := json.Unmarshal(*req.Params, &params); err != nil {
+			return nil, err
+		}
+		return h.handleCallHierarchyOutgoingCalls(ctx, conn, req, params)
+
 	case "workspace/symbol":
 		if req.Params == nil {
 			return nil, &jsonrpc2.Error{Code: jsonrpc2.CodeInvalidParams}
@@ -396,20 +737,69 @@ func (h *LangHandler) Handle(ctx context.Context, conn jsonrpc2.JSONRPC2, req *j
 		}
 		return h.handleWorkspaceReferences(ctx, conn, req, params)
 
+	case "workspace/executeCommand":
+		if req.Params == nil {
+			return nil, &jsonrpc2.Error{Code: jsonrpc2.CodeInvalidParams}
+		}
+		var params lsp.ExecuteCommandParams
+		if err := json.Unmarshal(*req.Params, &params); err != nil {
+			return nil, err
+		}
+		return h.handleWorkspaceExecuteCommand(ctx, conn, req, params)
+
+	case "workspace/didChangeConfiguration":
+		if req.Params == nil {
+			return nil, &jsonrpc2.Error{Code: jsonrpc2.CodeInvalidParams}
+		}
+		var params DidChangeConfigurationParams
+		if err := json.Unmarshal(*req.Params, &params); err != nil {
+			return nil, err
+		}
+		h.handleWorkspaceDidChangeConfiguration(params)
+		return nil, nil
+
+	case "workspace/didChangeWorkspaceFolders":
+		if req.Params == nil {
+			return nil, &jsonrpc2.Error{Code: jsonrpc2.CodeInvalidParams}
+		}
+		var params lsp.DidChangeWorkspaceFoldersParams
+		if err := json.Unmarshal(*req.Params, &params); err != nil {
+			return nil, err
+		}
+		h.handleWorkspaceDidChangeWorkspaceFolders(params)
+		return nil, nil
+
 	default:
 		if isFileSystemRequest(req.Method) {
 			uri, fileChanged, err := h.handleFileSystemRequest(ctx, req)
 			if fileChanged {
 				// a file changed, so we must re-typecheck and re-enumerate symbols
-				h.resetCaches(true)
+				if uri != "" {
+					h.invalidateFile(uri)
+				} else {
+					h.resetCaches(true)
+				}
 			}
 			if uri != "" {
 				// a user is viewing this path, hint to add it to the cache
 				// (unless we're primarily using binary package cache .a
 				// files).
-				if !h.Config.UseBinaryPkgCache {
+				if !h.useGodef(ctx) {
 					go h.typecheck(ctx, conn, uri, lsp.Position{})
 				}
+				// Documents in directories excluded by
+				// Config.ExcludeDirs get no diagnostics.
+				diagnose := path.Ext(string(uri)) == ".go" && req.Method != "textDocument/didClose" && !h.isExcluded(h.FilePath(uri))
+				if h.config().DiagnosticsEnabled && diagnose {
+					h.scheduleDiagnostics(ctx, conn, uri)
+				}
+				// Finding the unused imports only parses the
+				// document, so it is done at once.
+				if h.config().UnusedImportDiagnosticsEnabled && diagnose {
+					if err := h.publishUnusedImports(ctx, conn, uri); err != nil {
+						warnf("failed to publish unused imports for %s: %s.", uri, err)
+					}
+				}
 			}
 			return nil, err
 		}
@@ -3,7 +3,6 @@ package langserver
 import (
 	"errors"
 	"fmt"
-	"log"
 	"sync"
 
 	opentracing "github.com/opentracing/opentracing-go"
@@ -40,7 +39,7 @@ func (h *HandlerCommon) Reset(rootURI lsp.DocumentURI) error {
 func (h *HandlerCommon) ShutDown() {
 	h.mu.Lock()
 	if h.shutdown {
-		log.Printf("Warning: server received a shutdown request after it was already shut down.")
+		warnf("server received a shutdown request after it was already shut down.")
 	}
 	h.shutdown = true
 	h.mu.Unlock()
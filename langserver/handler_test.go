@@ -0,0 +1,77 @@
+package langserver
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/sourcegraph/go-langserver/pkg/lsp"
+)
+
+func TestNormalizeRoot(t *testing.T) {
+	tests := []struct {
+		rootURI, rootPath string
+		folders           []lsp.WorkspaceFolder
+		want              lsp.DocumentURI
+		wantErr           bool
+	}{
+		{rootURI: "file:///src/p", want: "file:///src/p"},
+		{rootPath: "/src/p", want: "file:///src/p"},
+		{rootPath: "file:///src/p", want: "file:///src/p"},
+		{rootURI: "file:///src/p", rootPath: "/src/p", want: "file:///src/p"},
+		{rootURI: "file:///src/p", rootPath: "/src/q", want: "file:///src/p"},
+		{folders: []lsp.WorkspaceFolder{{URI: "file:///src/q"}, {URI: "file:///src/r"}}, want: "file:///src/q"},
+		{rootURI: "file:///src/p", folders: []lsp.WorkspaceFolder{{URI: "file:///src/q"}}, want: "file:///src/p"},
+		{wantErr: true},
+	}
+	for _, test := range tests {
+		params := lsp.InitializeParams{RootURI: lsp.DocumentURI(test.rootURI), RootPath: test.rootPath, WorkspaceFolders: test.folders}
+		err := normalizeRoot(&params)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("rootUri %q, rootPath %q: got no error, want one", test.rootURI, test.rootPath)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("rootUri %q, rootPath %q: %s", test.rootURI, test.rootPath, err)
+		} else if got := params.Root(); got != test.want {
+			t.Errorf("rootUri %q, rootPath %q: got root %q, want %q", test.rootURI, test.rootPath, got, test.want)
+		}
+	}
+}
+
+func TestWorkspaceFolders(t *testing.T) {
+	h := &LangHandler{Config: NewDefaultConfig(), HandlerShared: &HandlerShared{}}
+	init := &InitializeParams{InitializeParams: lsp.InitializeParams{
+		RootURI:          "file:///src/a",
+		WorkspaceFolders: []lsp.WorkspaceFolder{{URI: "file:///src/a"}, {URI: "file:///src/b"}, {URI: "file:///src/a"}},
+	}}
+	if err := h.reset(init); err != nil {
+		t.Fatal(err)
+	}
+	check := func(want ...string) {
+		t.Helper()
+		if got := h.workspaceFolders(); !reflect.DeepEqual(got, want) {
+			t.Errorf("got folders %q, want %q", got, want)
+		}
+	}
+	check("/src/a", "/src/b")
+
+	h.handleWorkspaceDidChangeWorkspaceFolders(lsp.DidChangeWorkspaceFoldersParams{Event: lsp.WorkspaceFoldersChangeEvent{
+		Added:   []lsp.WorkspaceFolder{{URI: "file:///src/b/c"}, {URI: "file:///src/d"}},
+		Removed: []lsp.WorkspaceFolder{{URI: "file:///src/a"}},
+	}})
+	check("/src/b", "/src/b/c", "/src/d")
+
+	for filename, want := range map[string]string{
+		"/src/b/b.go":     "/src/b",
+		"/src/b/c/c.go":   "/src/b/c",
+		"/src/b/cc/cc.go": "/src/b",
+		"/src/d/d.go":     "/src/d",
+		"/goroot/x.go":    "/src/b",
+	} {
+		if got := h.folderOf(filename); got != want {
+			t.Errorf("got folder %q for %s, want %q", got, filename, want)
+		}
+	}
+}
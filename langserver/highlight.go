@@ -0,0 +1,103 @@
+package langserver
+
+import (
+	"context"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"sort"
+
+	"github.com/sourcegraph/go-langserver/langserver/util"
+	"github.com/sourcegraph/go-langserver/pkg/lsp"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+func (h *LangHandler) handleTextDocumentHighlight(ctx context.Context, conn jsonrpc2.JSONRPC2, req *jsonrpc2.Request, params lsp.TextDocumentPositionParams) ([]lsp.DocumentHighlight, error) {
+	if !util.IsURI(params.TextDocument.URI) {
+		return nil, &jsonrpc2.Error{
+			Code:    jsonrpc2.CodeInvalidParams,
+			Message: fmt.Sprintf("%s not yet supported for out-of-workspace URI (%q)", req.Method, params.TextDocument.URI),
+		}
+	}
+
+	fset, node, _, _, pkg, _, err := h.typecheck(ctx, conn, params.TextDocument.URI, params.Position)
+	if err != nil {
+		// Invalid nodes means we tried to click on something which is
+		// not an ident (eg comment/string/etc). Return no information.
+		if _, ok := err.(*invalidNodeError); ok {
+			return []lsp.DocumentHighlight{}, nil
+		}
+		return nil, err
+	}
+
+	obj := pkg.ObjectOf(node)
+	if obj == nil {
+		return []lsp.DocumentHighlight{}, nil
+	}
+
+	// Only consider the file the request is for, so that we don't have
+	// to walk every file in large packages.
+	filename := h.FilePath(params.TextDocument.URI)
+	var file *ast.File
+	for _, f := range pkg.Files {
+		if util.PathEqual(fset.Position(f.Pos()).Filename, filename) {
+			file = f
+			break
+		}
+	}
+	if file == nil {
+		return []lsp.DocumentHighlight{}, nil
+	}
+	writes := writtenIdents(file)
+
+	var ids []*ast.Ident
+	ast.Inspect(file, func(n ast.Node) bool {
+		if id, ok := n.(*ast.Ident); ok && sameObj(obj, pkg.ObjectOf(id)) {
+			ids = append(ids, id)
+		}
+		return true
+	})
+	sort.Slice(ids, func(i, j int) bool { return ids[i].Pos() < ids[j].Pos() })
+
+	conv := h.positionConverter(ctx)
+	highlights := make([]lsp.DocumentHighlight, 0, len(ids))
+	for _, id := range ids {
+		kind := lsp.Read
+		if _, isDef := pkg.Defs[id]; isDef || writes[id] {
+			kind = lsp.Write
+		}
+		highlights = append(highlights, lsp.DocumentHighlight{
+			Range: rangeForNode(conv, fset, id),
+			Kind:  kind,
+		})
+	}
+	return highlights, nil
+}
+
+// writtenIdents returns the set of identifiers in f which are assigned to
+// (the left hand side of assignments, increments/decrements and range
+// clauses).
+func writtenIdents(f *ast.File) map[*ast.Ident]bool {
+	writes := make(map[*ast.Ident]bool)
+	add := func(exprs ...ast.Expr) {
+		for _, e := range exprs {
+			if id, ok := e.(*ast.Ident); ok {
+				writes[id] = true
+			}
+		}
+	}
+	ast.Inspect(f, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.AssignStmt:
+			add(n.Lhs...)
+		case *ast.IncDecStmt:
+			add(n.X)
+		case *ast.RangeStmt:
+			if n.Tok != token.ILLEGAL {
+				add(n.Key, n.Value)
+			}
+		}
+		return true
+	})
+	return writes
+}
@@ -14,6 +14,8 @@ import (
 	"sort"
 	"strings"
 
+	"golang.org/x/tools/go/loader"
+
 	doc "github.com/slimsag/godocmd"
 	"github.com/sourcegraph/go-langserver/langserver/internal/godef"
 	"github.com/sourcegraph/go-langserver/langserver/util"
@@ -22,10 +24,16 @@ import (
 )
 
 func (h *LangHandler) handleHover(ctx context.Context, conn jsonrpc2.JSONRPC2, req *jsonrpc2.Request, params lsp.TextDocumentPositionParams) (*lsp.Hover, error) {
-	if h.Config.UseBinaryPkgCache {
+	if h.hoverWithGodef(ctx) {
 		return h.handleHoverGodef(ctx, conn, req, params)
 	}
+	return h.handleHoverTypecheck(ctx, conn, req, params, true)
+}
 
+// handleHoverTypecheck answers a hover request with the typechecker. If
+// the package can't be typechecked it falls back to godef if
+// godefFallback is set and Config.UseBinaryPkgCache is.
+func (h *LangHandler) handleHoverTypecheck(ctx context.Context, conn jsonrpc2.JSONRPC2, req *jsonrpc2.Request, params lsp.TextDocumentPositionParams, godefFallback bool) (*lsp.Hover, error) {
 	if !util.IsURI(params.TextDocument.URI) {
 		return nil, &jsonrpc2.Error{
 			Code:    jsonrpc2.CodeInvalidParams,
@@ -33,11 +41,15 @@ func (h *LangHandler) handleHover(ctx context.Context, conn jsonrpc2.JSONRPC2, r
 		}
 	}
 
-	fset, node, _, prog, pkg, _, err := h.typecheck(ctx, conn, params.TextDocument.URI, params.Position)
+	fset, node, path, prog, pkg, _, err := h.typecheck(ctx, conn, params.TextDocument.URI, params.Position)
 	if err != nil {
 		// Invalid nodes means we tried to click on something which is
-		// not an ident (eg comment/string/etc). Return no information.
+		// not an ident (eg comment/string/etc). Return no information,
+		// unless it is an import path, which shows its package.
 		if _, ok := err.(*invalidNodeError); ok {
+			if spec := importSpecOfPath(path); spec != nil {
+				return importHover(h.positionConverter(ctx), fset, prog, pkg, spec), nil
+			}
 			return nil, nil
 		}
 		// This is a common error we get in production when a user is
@@ -47,16 +59,54 @@ func (h *LangHandler) handleHover(ctx context.Context, conn jsonrpc2.JSONRPC2, r
 		if _, ok := err.(*build.NoGoError); ok {
 			return nil, nil
 		}
+		// godef doesn't need the whole package to typecheck, so it
+		// can still describe the identifier from the binary package
+		// cache.
+		if _, ok := err.(*jsonrpc2.Error); !ok && ctx.Err() == nil && godefFallback && h.config().UseBinaryPkgCache {
+			if hover, godefErr := h.handleHoverGodef(ctx, conn, req, params); godefErr == nil {
+				return hover, nil
+			}
+		}
 		return nil, err
 	}
 
+	span, ctx := startChildSpan(ctx, "langserver-go: build result")
+	defer span.Finish()
+
 	o := pkg.ObjectOf(node)
 	t := pkg.TypeOf(node)
+	if tn := conversionTypeName(pkg, path); tn != nil {
+		// The type of a conversion is described by its declaration,
+		// not as the callee of a call.
+		o, t = tn, tn.Type()
+	}
+	if o == nil {
+		if f := compositeLitKeyField(pkg, path); f != nil {
+			o, t = f, f.Type()
+		}
+	}
+	if o == nil && isCgoReference(&pkg.Info, path) {
+		// Nothing is known about the members of C.
+		return nil, nil
+	}
+	if o == nil && t == nil && node.Name == "_" {
+		// A blank identifier assigned to declares nothing, but what it
+		// discards is worth knowing.
+		dt := discardedType(pkg, path)
+		if dt == nil {
+			return nil, nil
+		}
+		r := rangeForNode(h.positionConverter(ctx), fset, node)
+		return &lsp.Hover{
+			Contents: []lsp.MarkedString{{Language: "go", Value: "_ (discarded) " + shortType(dt)}},
+			Range:    &r,
+		}, nil
+	}
 	if o == nil && t == nil {
 		comments := packageDoc(pkg.Files, node.Name)
 
 		// Package statement idents don't have an object, so try that separately.
-		r := rangeForNode(fset, node)
+		r := rangeForNode(h.positionConverter(ctx), fset, node)
 		if pkgName := packageStatementName(fset, pkg.Files, node); pkgName != "" {
 			return &lsp.Hover{
 				Contents: maybeAddComments(comments, []lsp.MarkedString{{Language: "go", Value: "package " + pkgName}}),
@@ -65,8 +115,9 @@ func (h *LangHandler) handleHover(ctx context.Context, conn jsonrpc2.JSONRPC2, r
 		}
 		return nil, fmt.Errorf("type/object not found at %+v", params.Position)
 	}
-	if o != nil && !o.Pos().IsValid() {
-		// Only builtins have invalid position, and don't have useful info.
+	if o != nil && !o.Pos().IsValid() && o.Pkg() != nil {
+		// Besides builtins, only the objects of package unsafe have
+		// invalid positions, and they don't have useful info.
 		return nil, nil
 	}
 	// Don't package-qualify the string output.
@@ -81,17 +132,22 @@ func (h *LangHandler) handleHover(ctx context.Context, conn jsonrpc2.JSONRPC2, r
 		if obj, ok := o.(*types.TypeName); ok {
 			typ := obj.Type().Underlying()
 			if _, ok := typ.(*types.Struct); ok {
-				s = "type " + obj.Name() + " struct"
+				s = "type " + obj.Name() + typeParamsString(obj.Type(), qf) + " struct"
 				extra = prettyPrintTypesString(types.TypeString(typ, qf))
 			}
-			if _, ok := typ.(*types.Interface); ok {
-				s = "type " + obj.Name() + " interface"
-				extra = prettyPrintTypesString(types.TypeString(typ, qf))
+			if iface, ok := typ.(*types.Interface); ok {
+				s = "type " + obj.Name() + typeParamsString(obj.Type(), qf) + " interface"
+				extra = interfaceMethodSetString(iface, qf)
 			}
 		}
 		if s == "" {
 			s = types.ObjectString(o, qf)
 		}
+		if c, ok := o.(*types.Const); ok {
+			// Show the value the type checker computed, which for
+			// iota and constant expressions isn't in the source.
+			s += " = " + c.Val().String()
+		}
 
 	} else if t != nil {
 		s = types.TypeString(t, qf)
@@ -105,36 +161,20 @@ func (h *LangHandler) handleHover(ctx context.Context, conn jsonrpc2.JSONRPC2, r
 		// Package names must be resolved specially, so do this now to avoid
 		// additional overhead.
 		if v, ok := o.(*types.PkgName); ok {
-			return packageDoc(prog.Package(v.Imported().Path()).Files, node.Name)
+			return importedPackageDoc(prog, v.Imported())
 		}
 
-		// Resolve the object o into its respective ast.Node
-		_, path, _ := prog.PathEnclosingInterval(o.Pos(), o.Pos())
-		if path == nil {
-			return ""
-		}
+		return declDoc(prog, o).Text()
+	}
 
-		// Pull the comment out of the comment map for the file. Do
-		// not search too far away from the current path.
-		var doc *ast.CommentGroup
-		for i := 0; i < 3 && i < len(path) && doc == nil; i++ {
-			switch v := path[i].(type) {
-			case *ast.Field:
-				doc = v.Doc
-			case *ast.ValueSpec:
-				doc = v.Doc
-			case *ast.TypeSpec:
-				doc = v.Doc
-			case *ast.GenDecl:
-				doc = v.Doc
-			case *ast.FuncDecl:
-				doc = v.Doc
-			}
+	if _, ok := o.(*types.Builtin); o != nil && !ok {
+		// Builtin functions already read as "builtin len".
+		switch {
+		case o.Pkg() == nil:
+			s = importLine("builtin") + s
+		case o.Pkg() != pkg.Pkg:
+			s = importLine(o.Pkg().Path()) + s
 		}
-		if doc == nil {
-			return ""
-		}
-		return doc.Text()
 	}
 
 	contents := maybeAddComments(findComments(o), []lsp.MarkedString{{Language: "go", Value: s}})
@@ -144,13 +184,284 @@ func (h *LangHandler) handleHover(ctx context.Context, conn jsonrpc2.JSONRPC2, r
 		contents = append(contents, lsp.MarkedString{Language: "go", Value: extra})
 	}
 
-	r := rangeForNode(fset, node)
+	r := rangeForNode(h.positionConverter(ctx), fset, node)
 	return &lsp.Hover{
 		Contents: contents,
 		Range:    &r,
 	}, nil
 }
 
+// conversionTypeName returns the type named by the identifier at the
+// start of path if it is the type of a conversion, such as T in T(x),
+// (*p.T)(x) or T[int](x), or nil if it isn't one. The type checker records
+// the callee of a conversion as a type, and of a call as a value.
+func conversionTypeName(pkg *loader.PackageInfo, path []ast.Node) *types.TypeName {
+	id, ok := path[0].(*ast.Ident)
+	if !ok {
+		return nil
+	}
+	tn, ok := pkg.ObjectOf(id).(*types.TypeName)
+	if !ok {
+		return nil
+	}
+	child := ast.Node(id)
+	for _, n := range path[1:] {
+		switch n := n.(type) {
+		case *ast.ParenExpr, *ast.StarExpr:
+		case *ast.IndexExpr:
+			// The type arguments are types of their own.
+			if n.X != child {
+				return nil
+			}
+		case *ast.IndexListExpr:
+			if n.X != child {
+				return nil
+			}
+		case *ast.SelectorExpr:
+			if n.Sel != child {
+				return nil
+			}
+		case *ast.CallExpr:
+			if n.Fun != child || !pkg.Types[n.Fun].IsType() {
+				return nil
+			}
+			return tn
+		default:
+			return nil
+		}
+		child = n
+	}
+	return nil
+}
+
+// discardedType returns the type of the value the blank identifier at the
+// start of path discards, as the left-hand side of an assignment or the
+// key or value of a range statement, or nil if it is unknown. The type
+// checker records no object for those blank identifiers, unlike for the
+// ones declared with ":=".
+func discardedType(pkg *loader.PackageInfo, path []ast.Node) types.Type {
+	if len(path) < 2 {
+		return nil
+	}
+	switch n := path[1].(type) {
+	case *ast.AssignStmt:
+		for i, lhs := range n.Lhs {
+			if lhs != path[0] {
+				continue
+			}
+			if len(n.Lhs) == len(n.Rhs) {
+				return pkg.TypeOf(n.Rhs[i])
+			}
+			// The values of a call, or of a comma-ok expression, whose
+			// types are recorded as a tuple.
+			if len(n.Rhs) == 1 {
+				if tuple, ok := pkg.TypeOf(n.Rhs[0]).(*types.Tuple); ok && i < tuple.Len() {
+					return tuple.At(i).Type()
+				}
+			}
+		}
+	case *ast.RangeStmt:
+		key, value := rangeTypes(pkg.TypeOf(n.X))
+		switch path[0] {
+		case n.Key:
+			return key
+		case n.Value:
+			return value
+		}
+	}
+	return nil
+}
+
+// rangeTypes returns the types of the keys and values a range statement
+// iterates over for the range expression of type T, which are nil if
+// there are none or T can't be ranged over.
+func rangeTypes(T types.Type) (key, value types.Type) {
+	if T == nil {
+		return nil, nil
+	}
+	u := T.Underlying()
+	if p, ok := u.(*types.Pointer); ok {
+		// A pointer to an array is ranged over like the array.
+		if a, ok := p.Elem().Underlying().(*types.Array); ok {
+			u = a
+		}
+	}
+	switch u := u.(type) {
+	case *types.Basic:
+		switch {
+		case u.Info()&types.IsString != 0:
+			return types.Typ[types.Int], types.Universe.Lookup("rune").Type()
+		case u.Info()&types.IsInteger != 0:
+			return T, nil
+		}
+	case *types.Array:
+		return types.Typ[types.Int], u.Elem()
+	case *types.Slice:
+		return types.Typ[types.Int], u.Elem()
+	case *types.Map:
+		return u.Key(), u.Elem()
+	case *types.Chan:
+		return u.Elem(), nil
+	case *types.Signature:
+		// An iterator function yields its keys and values.
+		if u.Params().Len() != 1 {
+			break
+		}
+		yield, ok := u.Params().At(0).Type().Underlying().(*types.Signature)
+		if !ok {
+			break
+		}
+		if yield.Params().Len() > 0 {
+			key = yield.Params().At(0).Type()
+		}
+		if yield.Params().Len() > 1 {
+			value = yield.Params().At(1).Type()
+		}
+		return key, value
+	}
+	return nil, nil
+}
+
+// compositeLitKeyField returns the field named by the key at the start of
+// path in a struct literal, or nil if it isn't one. The type checker
+// records the keys as uses of their fields, except in literals it
+// rejects, such as those mixing keyed and positional elements.
+func compositeLitKeyField(pkg *loader.PackageInfo, path []ast.Node) *types.Var {
+	if len(path) < 3 {
+		return nil
+	}
+	id, ok := path[0].(*ast.Ident)
+	if !ok {
+		return nil
+	}
+	kv, ok := path[1].(*ast.KeyValueExpr)
+	if !ok || kv.Key != id {
+		return nil
+	}
+	lit, ok := path[2].(*ast.CompositeLit)
+	if !ok {
+		return nil
+	}
+	t := pkg.TypeOf(lit)
+	if ptr, ok := t.(*types.Pointer); ok {
+		// The type of a literal whose &T is elided, as in []*T{{}}.
+		t = ptr.Elem()
+	}
+	if t == nil {
+		return nil
+	}
+	st, ok := t.Underlying().(*types.Struct)
+	if !ok {
+		return nil
+	}
+	for i := 0; i < st.NumFields(); i++ {
+		if f := st.Field(i); f.Name() == id.Name && (f.Exported() || f.Pkg() == pkg.Pkg) {
+			return f
+		}
+	}
+	return nil
+}
+
+// hoverWithGodef reports whether to answer hover requests with godef, as
+// decided by Config.HoverBackend.
+func (h *LangHandler) hoverWithGodef(ctx context.Context) bool {
+	switch h.config().HoverBackend {
+	case hoverBackendGodef:
+		return true
+	case hoverBackendTypecheck:
+		return false
+	}
+	return h.useGodef(ctx)
+}
+
+// declDoc returns the doc comment of the declaration of o, or nil if it
+// has none or its declaration isn't in prog.
+func declDoc(prog *loader.Program, o types.Object) *ast.CommentGroup {
+	// Resolve the object o into its respective ast.Node
+	_, path, _ := prog.PathEnclosingInterval(o.Pos(), o.Pos())
+
+	// Pull the comment out of the comment map for the file. Do not search
+	// too far away from the current path.
+	var doc *ast.CommentGroup
+	for i := 0; i < 3 && i < len(path) && doc == nil; i++ {
+		switch v := path[i].(type) {
+		case *ast.Field:
+			doc = v.Doc
+		case *ast.ValueSpec:
+			doc = v.Doc
+		case *ast.TypeSpec:
+			doc = v.Doc
+		case *ast.GenDecl:
+			doc = v.Doc
+		case *ast.FuncDecl:
+			doc = v.Doc
+		}
+	}
+	return doc
+}
+
+// importHover returns the hover for the import path of spec, which shows
+// the imported package and its documentation. It returns nil if spec
+// wasn't type checked.
+func importHover(conv *positionConverter, fset *token.FileSet, prog *loader.Program, pkg *loader.PackageInfo, spec *ast.ImportSpec) *lsp.Hover {
+	pkgName := importPkgName(pkg, spec)
+	if pkgName == nil {
+		return nil
+	}
+	imported := pkgName.Imported()
+	r := rangeForNode(conv, fset, spec.Path)
+	return &lsp.Hover{
+		Contents: maybeAddComments(importedPackageDoc(prog, imported), []lsp.MarkedString{{Language: "go", Value: fmt.Sprintf("package %s (%q)", imported.Name(), imported.Path())}}),
+		Range:    &r,
+	}
+}
+
+// importedPackageDoc returns the documentation of the package imported by
+// prog, or "" if it wasn't loaded from source.
+func importedPackageDoc(prog *loader.Program, imported *types.Package) string {
+	info := prog.AllPackages[imported]
+	if info == nil {
+		return ""
+	}
+	return packageDoc(info.Files, imported.Name())
+}
+
+// importLine returns the line shown above the signature of an object
+// declared in the package with the given import path, which may be
+// vendored.
+func importLine(pkgPath string) string {
+	if pkgPath == "builtin" {
+		return "builtin\n"
+	}
+	return fmt.Sprintf("import %q\n", util.VendorlessImportPath(pkgPath))
+}
+
+// typeParamsString returns the type parameters of the generic type t
+// with their constraints, as in "[K comparable, V any]", or "" if t isn't
+// generic. Consecutive parameters with the same constraint share it, as
+// in the signatures of generic functions.
+func typeParamsString(t types.Type, qf types.Qualifier) string {
+	named, ok := t.(*types.Named)
+	if !ok || named.TypeParams().Len() == 0 {
+		return ""
+	}
+	tparams := named.TypeParams()
+	var b strings.Builder
+	b.WriteByte('[')
+	for i := 0; i < tparams.Len(); i++ {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(tparams.At(i).Obj().Name())
+		c := types.TypeString(tparams.At(i).Constraint(), qf)
+		if i+1 == tparams.Len() || types.TypeString(tparams.At(i+1).Constraint(), qf) != c {
+			b.WriteString(" " + c)
+		}
+	}
+	b.WriteByte(']')
+	return b.String()
+}
+
 // packageStatementName returns the package name ((*ast.Ident).Name)
 // of node iff node is the package statement of a file ("package p").
 func packageStatementName(fset *token.FileSet, files []*ast.File, node *ast.Ident) string {
@@ -173,6 +484,39 @@ func maybeAddComments(comments string, contents []lsp.MarkedString) []lsp.Marked
 	return append(contents, lsp.RawMarkedString(b.String()))
 }
 
+// supportsMarkdownHover reports whether the client accepts markdown
+// MarkupContent in hover results.
+func (h *LangHandler) supportsMarkdownHover() bool {
+	hc := h.init.Capabilities.TextDocument.Hover
+	if hc == nil {
+		return false
+	}
+	for _, kind := range hc.ContentFormat {
+		if kind == lsp.MKMarkdown {
+			return true
+		}
+	}
+	return false
+}
+
+// markdownHover renders hover contents as a single markdown document,
+// fencing code such as the signature so that clients highlight it. Raw
+// strings are the doc comments from maybeAddComments, which are already
+// markdown with their indented blocks fenced.
+func markdownHover(contents []lsp.MarkedString) *lsp.MarkupContent {
+	var parts []string
+	for _, ms := range contents {
+		if ms.Language != "" {
+			parts = append(parts, "```"+ms.Language+"\n"+strings.TrimSuffix(ms.Value, "\n")+"\n```")
+			continue
+		}
+		if v := strings.TrimSpace(ms.Value); v != "" {
+			parts = append(parts, v)
+		}
+	}
+	return &lsp.MarkupContent{Kind: lsp.MKMarkdown, Value: strings.Join(parts, "\n\n")}
+}
+
 // packageDoc finds the documentation for the named package from its files or
 // additional files.
 func packageDoc(files []*ast.File, pkgName string) string {
@@ -256,7 +600,46 @@ func prettyPrintTypesString(s string) string {
 	return b.String()
 }
 
+// interfaceMethodSetString formats the method set of iface, one method
+// per line, with the methods of embedded interfaces flattened into it so
+// that all of what the interface requires is listed. Embedded types which
+// add no methods, such as the unions of constraints and comparable, are
+// kept as they are written. It is "" for the empty interface.
+func interfaceMethodSetString(iface *types.Interface, qf types.Qualifier) string {
+	var lines []string
+	for i := 0; i < iface.NumEmbeddeds(); i++ {
+		t := iface.EmbeddedType(i)
+		if embedded, ok := t.Underlying().(*types.Interface); ok && embedded.NumMethods() > 0 {
+			continue
+		}
+		lines = append(lines, types.TypeString(t, qf))
+	}
+	for i := 0; i < iface.NumMethods(); i++ {
+		m := iface.Method(i)
+		lines = append(lines, m.Name()+strings.TrimPrefix(types.TypeString(m.Type(), qf), "func"))
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+	return "interface {\n    " + strings.Join(lines, "\n    ") + "\n}"
+}
+
 func (h *LangHandler) handleHoverGodef(ctx context.Context, conn jsonrpc2.JSONRPC2, req *jsonrpc2.Request, params lsp.TextDocumentPositionParams) (*lsp.Hover, error) {
+	// Godef is given OS paths by the tests, as in definitionGodef.
+	vfsParams := params
+	if testOSToVFSPath != nil {
+		vfsParams.TextDocument.URI = util.PathToURI(testOSToVFSPath(util.UriToPath(params.TextDocument.URI)))
+	}
+	if contents, err := h.readFile(ctx, vfsParams.TextDocument.URI); err == nil {
+		offset, valid, _ := offsetForPosition(contents, params.Position, h.positionEncoding())
+		if valid && identAt(contents, offset) == "_" {
+			// godef knows the declarations, not the types of the
+			// values a blank identifier discards, which the
+			// typechecker is asked for instead.
+			return h.handleHoverTypecheck(ctx, conn, req, vfsParams, false)
+		}
+	}
+
 	// First perform the equivalent of a textDocument/definition request in
 	// order to resolve the definition position.
 	fset, res, _, err := h.definitionGodef(ctx, params)
@@ -274,7 +657,7 @@ func (h *LangHandler) handleHoverGodef(ctx context.Context, conn jsonrpc2.JSONRP
 	if res.Package != nil {
 		// res.Package.Name is invalid since it was imported with FindOnly, so
 		// import normally now.
-		bpkg, err := build.Default.ImportDir(res.Package.Dir, 0)
+		bpkg, err := h.godefBuildContext().ImportDir(res.Package.Dir, 0)
 		if err != nil {
 			return nil, err
 		}
@@ -293,17 +676,18 @@ func (h *LangHandler) handleHoverGodef(ctx context.Context, conn jsonrpc2.JSONRP
 		}
 		comments := packageDoc(pkgFiles, bpkg.Name)
 
-		return &lsp.Hover{
+		hover := &lsp.Hover{
 			Contents: maybeAddComments(comments, []lsp.MarkedString{{Language: "go", Value: fmt.Sprintf("package %s (%q)", bpkg.Name, bpkg.ImportPath)}}),
-
-			// TODO(slimsag): I think we can add Range here, but not exactly
-			// sure. res.Start and res.End are only present if it's a package
-			// selector, not an import statement. Since Range is optional,
-			// we're omitting it here.
-		}, nil
+		}
+		// res.Start is only valid for a package selector, whose name is
+		// the identifier hovered, not for an import path.
+		if res.Start.IsValid() {
+			hover.Range = h.identRange(ctx, params)
+		}
+		return hover, nil
 	}
 
-	loc := goRangeToLSPLocation(fset, res.Start, res.End)
+	loc := goRangeToLSPLocation(h.positionConverter(ctx), fset, res.Start, res.End)
 
 	if loc.URI == "file://" {
 		// TODO: builtins do not have valid URIs or locations.
@@ -337,8 +721,14 @@ func (h *LangHandler) handleHoverGodef(ctx context.Context, conn jsonrpc2.JSONRP
 	}
 
 	contents, _ := fmtDocObject(fset, docObject, target)
+	if dir := filepath.Dir(filename); len(contents) > 0 && dir != filepath.Dir(util.UriToRealPath(params.TextDocument.URI)) {
+		if bpkg, err := h.godefBuildContext().ImportDir(dir, build.FindOnly); err == nil && bpkg.ImportPath != "." {
+			contents[0].Value = importLine(bpkg.ImportPath) + contents[0].Value
+		}
+	}
 	return &lsp.Hover{
 		Contents: contents,
+		Range:    h.identRange(ctx, params),
 	}, nil
 }
 
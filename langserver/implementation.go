@@ -49,7 +49,12 @@ func (h *LangHandler) handleTextDocumentImplementation(ctx context.Context, conn
 		lconf.ImportWithTests(path)
 	}
 	// Type-check the program.
+	release, err := h.acquireLoad(ctx)
+	if err != nil {
+		return nil, err
+	}
 	lprog, err := lconf.Load()
+	release()
 	if err != nil {
 		return nil, err
 	}
@@ -57,12 +62,12 @@ func (h *LangHandler) handleTextDocumentImplementation(ctx context.Context, conn
 	pkg, path, _ := lprog.PathEnclosingInterval(pos, pos)
 	path, action := findInterestingNode(pkg, path)
 
-	return implements(lconf.Fset, lprog, pkg, path, action)
+	return implements(h.positionConverter(ctx), lconf.Fset, lprog, pkg, path, action)
 }
 
 // Adapted from golang.org/x/tools/cmd/guru (Copyright (c) 2013 The Go Authors). All rights
 // reserved. See NOTICE for full license.
-func implements(fset *token.FileSet, lprog *loader.Program, pkgInfo *loader.PackageInfo, path []ast.Node, action action) ([]*lspext.ImplementationLocation, error) {
+func implements(conv *positionConverter, fset *token.FileSet, lprog *loader.Program, pkgInfo *loader.PackageInfo, path []ast.Node, action action) ([]*lspext.ImplementationLocation, error) {
 	var method *types.Func
 	var T types.Type // selected type (receiver if method != nil)
 
@@ -159,6 +164,11 @@ func implements(fset *token.FileSet, lprog *loader.Program, pkgInfo *loader.Pack
 	sort.Sort(typesByString(fromPtr))
 
 	seen := map[types.Object]struct{}{}
+	if method != nil {
+		// An interface embedding the queried one promotes the queried
+		// method itself; don't report it as its own implementation.
+		seen[method] = struct{}{}
+	}
 	toLocation := func(t types.Type, method *types.Func) *lspext.ImplementationLocation {
 		var obj types.Object
 		if method == nil {
@@ -184,7 +194,7 @@ func implements(fset *token.FileSet, lprog *loader.Program, pkgInfo *loader.Pack
 		pos := obj.Pos()
 		end := obj.Pos() + token.Pos(len(obj.Name()))
 		return &lspext.ImplementationLocation{
-			Location: goRangeToLSPLocation(fset, pos, end),
+			Location: goRangeToLSPLocation(conv, fset, pos, end),
 			Method:   method != nil,
 		}
 	}
@@ -0,0 +1,182 @@
+package langserver
+
+import (
+	"context"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"path"
+	"sort"
+	"strings"
+
+	"golang.org/x/tools/go/buildutil"
+
+	"github.com/sourcegraph/go-langserver/pkg/lsp"
+)
+
+// importRoot is a directory whose subdirectories are imported by their
+// path relative to it, prefixed by importPath if it isn't empty.
+type importRoot struct {
+	importPath, dir string
+}
+
+// handleImportPathCompletion completes the import path being typed in
+// the import declaration at the cursor. Each completion is the path of a
+// directory in GOROOT, GOPATH, the vendor directories the file can
+// import from or the modules of the workspace, one path element further
+// than what was typed, so the list is incomplete until the path is.
+// Packages are completed as modules detailed with their synopsis, and
+// directories without Go files as folders. ok is false if the cursor
+// isn't in an import path.
+func (h *LangHandler) handleImportPathCompletion(ctx context.Context, params lsp.CompletionParams) (list *lsp.CompletionList, ok bool) {
+	contents, err := h.readFile(ctx, params.TextDocument.URI)
+	if err != nil {
+		return nil, false
+	}
+	offset, valid, _ := offsetForPosition(contents, params.Position, h.positionEncoding())
+	if !valid {
+		return nil, false
+	}
+	prefix, ok := importPathPrefix(contents, offset)
+	if !ok {
+		return nil, false
+	}
+
+	bctx := h.BuildContext(ctx)
+	filename := h.FilePath(params.TextDocument.URI)
+	var roots []importRoot
+	for _, dir := range vendorDirs(bctx, path.Dir(filename)) {
+		roots = append(roots, importRoot{dir: dir})
+	}
+	for _, mod := range h.workspaceModules(bctx, filename) {
+		roots = append(roots, importRoot{importPath: mod.path, dir: mod.dir})
+		for p, dir := range mod.deps {
+			roots = append(roots, importRoot{importPath: p, dir: dir})
+		}
+	}
+	for _, dir := range bctx.SrcDirs() {
+		roots = append(roots, importRoot{dir: dir})
+	}
+
+	rng := lsp.Range{
+		Start: lsp.Position{Line: params.Position.Line, Character: params.Position.Character - len(prefix)},
+		End:   params.Position,
+	}
+	seen := make(map[string]bool)
+	items := []lsp.CompletionItem{}
+	for _, c := range importPathCandidates(bctx, roots, prefix) {
+		if seen[c.importPath] {
+			// Vendored packages shadow the others.
+			continue
+		}
+		seen[c.importPath] = true
+		item := lsp.CompletionItem{
+			Label:            c.importPath,
+			Kind:             lsp.CIKFolder,
+			InsertTextFormat: lsp.ITFPlainText,
+			InsertText:       c.importPath,
+			TextEdit:         &lsp.TextEdit{Range: rng, NewText: c.importPath},
+		}
+		bpkg, err := bctx.ImportDir(c.dir, 0)
+		if err == nil || (bpkg != nil && len(bpkg.GoFiles)+len(bpkg.CgoFiles) > 0) {
+			item.Kind = lsp.CIKModule
+			item.Detail = bpkg.Doc
+		}
+		items = append(items, item)
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].Label < items[j].Label })
+	return &lsp.CompletionList{IsIncomplete: true, Items: items}, true
+}
+
+// importPathPrefix returns the part before offset of the import path
+// contents has at offset. ok is false if offset isn't in the path of an
+// import spec. The path may be unterminated, as it is while it is typed.
+func importPathPrefix(contents []byte, offset int) (prefix string, ok bool) {
+	fset := token.NewFileSet()
+	f, _ := parser.ParseFile(fset, "", contents, parser.ImportsOnly)
+	if f == nil {
+		return "", false
+	}
+	tf := fset.File(f.Pos())
+	for _, imp := range f.Imports {
+		if imp.Path == nil || !strings.HasPrefix(imp.Path.Value, `"`) {
+			continue
+		}
+		start, end := tf.Offset(imp.Path.Pos())+1, tf.Offset(imp.Path.End())
+		if len(imp.Path.Value) > 1 && strings.HasSuffix(imp.Path.Value, `"`) {
+			end-- // the closing quote
+		}
+		if start <= offset && offset <= end {
+			return string(contents[start:offset]), true
+		}
+	}
+	return "", false
+}
+
+// vendorDirs returns the vendor directories code in dir can import
+// from, innermost first.
+func vendorDirs(bctx *build.Context, dir string) []string {
+	var dirs []string
+	for _, src := range bctx.SrcDirs() {
+		rel, ok := buildutil.HasSubdir(bctx, src, dir)
+		if !ok {
+			continue
+		}
+		for {
+			if vendor := path.Join(src, rel, "vendor"); buildutil.IsDir(bctx, vendor) {
+				dirs = append(dirs, vendor)
+			}
+			if rel == "." || rel == "" {
+				break
+			}
+			rel = path.Dir(rel)
+		}
+		break
+	}
+	return dirs
+}
+
+// importPathCandidate is a directory whose import path completes a
+// prefix.
+type importPathCandidate struct {
+	importPath, dir string
+}
+
+// importPathCandidates returns the directories of roots whose import
+// paths complete prefix with one path element. The element being typed,
+// after the last "/" of prefix, is matched as a prefix of the names of
+// the directories.
+func importPathCandidates(bctx *build.Context, roots []importRoot, prefix string) []importPathCandidate {
+	parent, name := "", prefix
+	if i := strings.LastIndex(prefix, "/"); i >= 0 {
+		parent, name = prefix[:i], prefix[i+1:]
+	}
+	var cands []importPathCandidate
+	for _, root := range roots {
+		var dir string
+		switch {
+		case root.importPath == "":
+			dir = path.Join(root.dir, parent)
+		case parent == root.importPath || strings.HasPrefix(parent, root.importPath+"/"):
+			dir = path.Join(root.dir, strings.TrimPrefix(parent, root.importPath))
+		default:
+			// The root itself completes prefixes of its path.
+			if strings.HasPrefix(root.importPath, prefix) {
+				cands = append(cands, importPathCandidate{importPath: root.importPath, dir: root.dir})
+			}
+			continue
+		}
+		fis, err := buildutil.ReadDir(bctx, dir)
+		if err != nil {
+			continue
+		}
+		for _, fi := range fis {
+			n := fi.Name()
+			if !fi.IsDir() || !strings.HasPrefix(n, name) || strings.HasPrefix(n, ".") || strings.HasPrefix(n, "_") || n == "testdata" || n == "vendor" {
+				continue
+			}
+			cands = append(cands, importPathCandidate{importPath: path.Join(parent, n), dir: path.Join(dir, n)})
+		}
+	}
+	return cands
+}
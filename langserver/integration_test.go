@@ -77,7 +77,7 @@ func TestIntegration_FileSystem(t *testing.T) {
 		wantHover: map[string]string{
 			"a.go:1:17":    "func A()",
 			"b.go:1:20":    "func A()",
-			"p2/c.go:1:40": "func A()",
+			"p2/c.go:1:40": "import \"test/p\"\nfunc A()",
 		},
 	}
 	lspTests(t, ctx, nil, conn, rootURI, cases)
@@ -96,7 +96,7 @@ func TestIntegration_FileSystem(t *testing.T) {
 		wantHover: map[string]string{
 			"a.go:1:17":    "func A() int",
 			"b.go:1:20":    "func A() int",
-			"p2/c.go:1:40": "func A() int",
+			"p2/c.go:1:40": "import \"test/p\"\nfunc A() int",
 		},
 	}
 	lspTests(t, ctx, nil, conn, rootURI, cases)
@@ -138,7 +138,7 @@ func TestIntegration_FileSystem(t *testing.T) {
 		wantHover: map[string]string{
 			"a.go:1:28":    "func A(i int)",
 			"b.go:1:20":    "func A(i int)",
-			"p2/c.go:1:40": "func A(i int)",
+			"p2/c.go:1:40": "import \"test/p\"\nfunc A(i int)",
 		},
 	}
 	lspTests(t, ctx, nil, conn, rootURI, cases)
@@ -41,6 +41,10 @@ func declPos(name string, decl ast.Node) token.Pos {
 			return d.Label.Pos()
 		}
 	case *ast.GenDecl:
+		// Constants implicitly repeating the expression above them
+		// are declared with the whole GenDecl, so find the name in
+		// their ValueSpec rather than returning the GenDecl's
+		// position.
 		for _, spec := range d.Specs {
 			if pos := declPos(name, spec); pos.IsValid() {
 				return pos
@@ -79,8 +79,14 @@ type Importer func(path string, srcDir string) *ast.Package
 // DefaultImporter looks for the package; if it finds it,
 // it parses and returns it. If no package was found, it returns nil.
 func DefaultImporter(fset *token.FileSet) func(path string, srcDir string) *ast.Package {
+	return ContextImporter(&build.Default, fset)
+}
+
+// ContextImporter is like DefaultImporter, but looks for the
+// package using ctxt rather than build.Default.
+func ContextImporter(ctxt *build.Context, fset *token.FileSet) func(path string, srcDir string) *ast.Package {
 	return func(path string, srcDir string) *ast.Package {
-		bpkg, err := build.Default.Import(path, srcDir, 0)
+		bpkg, err := ctxt.Import(path, srcDir, 0)
 		if err != nil {
 			return nil
 		}
@@ -91,10 +97,17 @@ func DefaultImporter(fset *token.FileSet) func(path string, srcDir string) *ast.
 		for _, f := range bpkg.CgoFiles {
 			goFiles[f] = true
 		}
+		// Only an external test package imports the package in its
+		// own directory, and it sees the in-package test files too.
+		if filepath.Clean(bpkg.Dir) == filepath.Clean(srcDir) {
+			for _, f := range bpkg.TestGoFiles {
+				goFiles[f] = true
+			}
+		}
 		shouldInclude := func(d os.FileInfo) bool {
 			return goFiles[d.Name()]
 		}
-		pkgs, err := parser.ParseDir(fset, bpkg.Dir, shouldInclude, 0, DefaultImportPathToName)
+		pkgs, err := parser.ParseDir(fset, bpkg.Dir, shouldInclude, 0, ContextImportPathToName(ctxt))
 		if err != nil {
 			if Debug {
 				switch err := err.(type) {
@@ -121,11 +134,19 @@ func DefaultImporter(fset *token.FileSet) func(path string, srcDir string) *ast.
 // DefaultImportPathToName returns the package identifier
 // for the given import path.
 func DefaultImportPathToName(path, srcDir string) (string, error) {
-	if path == "C" {
-		return "C", nil
+	return ContextImportPathToName(&build.Default)(path, srcDir)
+}
+
+// ContextImportPathToName is like DefaultImportPathToName, but
+// looks for the package using ctxt rather than build.Default.
+func ContextImportPathToName(ctxt *build.Context) parser.ImportPathToName {
+	return func(path, srcDir string) (string, error) {
+		if path == "C" {
+			return "C", nil
+		}
+		pkg, err := ctxt.Import(path, srcDir, 0)
+		return pkg.Name, err
 	}
-	pkg, err := build.Default.Import(path, srcDir, 0)
-	return pkg.Name, err
 }
 
 // isGoFile returns true if we will consider the file as a
@@ -11,6 +11,7 @@ import (
 	"runtime"
 	"strconv"
 	"strings"
+	"sync"
 
 	"go/token"
 
@@ -26,6 +27,10 @@ type Result struct {
 	// Start and end positions of the definition (only if not an import statement).
 	Start, End token.Pos
 
+	// Start and end positions of the declaration of the definition's
+	// type, if it is a named type with a known position.
+	TypeStart, TypeEnd token.Pos
+
 	// Package in question, only present if an import statement OR package selector
 	// ('http' in 'http.Router').
 	Package *build.Package
@@ -33,12 +38,90 @@ type Result struct {
 
 var ErrNoIdentifierFound = errors.New("no identifier found")
 
-func Godef(fset *token.FileSet, offset int, filename string, src []byte) (*Result, error) {
+// NoDeclarationError is the error returned when the identifier at the
+// offset has no declaration, such as an undeclared name.
+type NoDeclarationError struct {
+	Expr string // the expression at the offset, such as "x" or "x.y"
+}
+
+func (e *NoDeclarationError) Error() string {
+	return "no declaration found for " + e.Expr
+}
+
+// Godef finds the definition of the identifier at offset in filename, whose
+// contents are src. Packages are found using ctxt.
+func Godef(ctxt *build.Context, fset *token.FileSet, offset int, filename string, src []byte) (*Result, error) {
+	f, err := ParseFile(ctxt, fset, filename, src)
+	if err != nil {
+		return nil, err
+	}
+	return f.Godef(offset)
+}
+
+// File is a parsed source file in which definitions are found. The
+// packages it imports and the other files of its package are parsed the
+// first time they are needed and kept, so that finding several
+// definitions in the same file only parses them once. A File is safe for
+// concurrent use.
+type File struct {
+	ctxt       *build.Context
+	fset       *token.FileSet
+	filename   string
+	f          *ast.File
+	pkgScope   *ast.Scope
+	pathToName parser.ImportPathToName
+
+	mu          sync.Mutex
+	imported    map[importKey]*ast.Package
+	localParsed bool // whether the other files of the package are in pkgScope
+}
+
+type importKey struct {
+	path, srcDir string
+}
+
+// ParseFile parses filename, whose contents are src, for finding the
+// definitions in it with Godef. Packages are found using ctxt, and the
+// positions of the results are in fset.
+func ParseFile(ctxt *build.Context, fset *token.FileSet, filename string, src []byte) (*File, error) {
+	pathToName := types.ContextImportPathToName(ctxt)
 	pkgScope := ast.NewScope(parser.Universe)
-	f, err := parser.ParseFile(fset, filename, src, 0, pkgScope, types.DefaultImportPathToName)
+	f, err := parser.ParseFile(fset, filename, src, 0, pkgScope, pathToName)
 	if f == nil {
 		return nil, fmt.Errorf("cannot parse %s: %v", filename, err)
 	}
+	return &File{
+		ctxt:       ctxt,
+		fset:       fset,
+		filename:   filename,
+		f:          f,
+		pkgScope:   pkgScope,
+		pathToName: pathToName,
+		imported:   make(map[importKey]*ast.Package),
+	}, nil
+}
+
+// FileSet returns the file set the positions of the results are in.
+func (file *File) FileSet() *token.FileSet {
+	return file.fset
+}
+
+// importer is a types.Importer which parses each package only once.
+func (file *File) importer(path, srcDir string) *ast.Package {
+	key := importKey{path, srcDir}
+	if pkg, ok := file.imported[key]; ok {
+		return pkg
+	}
+	pkg := types.ContextImporter(file.ctxt, file.fset)(path, srcDir)
+	file.imported[key] = pkg
+	return pkg
+}
+
+// Godef finds the definition of the identifier at offset in the file.
+func (file *File) Godef(offset int) (*Result, error) {
+	file.mu.Lock()
+	defer file.mu.Unlock()
+	ctxt, fset, filename, f := file.ctxt, file.fset, file.filename, file.f
 
 	o := findIdentifier(fset, f, offset)
 	if o == nil {
@@ -50,21 +133,26 @@ func Godef(fset *token.FileSet, offset int, filename string, src []byte) (*Resul
 		if err != nil {
 			return nil, err
 		}
-		pkg, err := build.Default.Import(path, filepath.Dir(filename), build.FindOnly)
+		pkg, err := ctxt.Import(path, filepath.Dir(filename), build.FindOnly)
 		if err != nil {
 			return nil, fmt.Errorf("error finding import path for %s: %s", path, err)
 		}
 		return &Result{Package: pkg}, nil
 	case ast.Expr:
-		result := func(obj *ast.Object) (*Result, error) {
+		result := func(obj *ast.Object, typ types.Type) (*Result, error) {
 			p := types.DeclPos(obj)
 			r := &Result{Start: p, End: p + token.Pos(len(obj.Name))}
+			if tobj := typeObject(typ); tobj != nil {
+				if p := types.DeclPos(tobj); p.IsValid() {
+					r.TypeStart, r.TypeEnd = p, p+token.Pos(len(tobj.Name))
+				}
+			}
 			if imp, ok := obj.Decl.(*ast.ImportSpec); ok {
 				path, err := importPath(imp)
 				if err != nil {
 					return nil, err
 				}
-				pkg, err := build.Default.Import(path, filepath.Dir(fset.Position(p).Filename), build.FindOnly)
+				pkg, err := ctxt.Import(path, filepath.Dir(fset.Position(p).Filename), build.FindOnly)
 				if err != nil {
 					return nil, fmt.Errorf("error finding import path for %s: %s", path, err)
 				}
@@ -72,25 +160,45 @@ func Godef(fset *token.FileSet, offset int, filename string, src []byte) (*Resul
 			}
 			return r, nil
 		}
-		importer := types.DefaultImporter(fset)
-		// try local declarations only
-		if obj, _ := types.ExprType(e, importer, fset); obj != nil {
-			return result(obj)
+		// try local declarations only. If the type can't be worked out
+		// it may depend on other files, so look there too.
+		if obj, typ := types.ExprType(e, file.importer, fset); obj != nil && typ.Node != nil {
+			return result(obj, typ)
 		}
 
 		// add declarations from other files in the local package and try again
-		pkg, err := parseLocalPackage(fset, filename, f, pkgScope, types.DefaultImportPathToName)
-		if pkg == nil {
-			log.Printf("parseLocalPackage error: %v\n", err)
+		if !file.localParsed {
+			file.localParsed = true
+			pkg, err := parseLocalPackage(ctxt, fset, filename, f, file.pkgScope, file.pathToName)
+			if pkg == nil {
+				log.Printf("parseLocalPackage error: %v\n", err)
+			}
 		}
-		if obj, _ := types.ExprType(e, importer, fset); obj != nil {
-			return result(obj)
+		if obj, typ := types.ExprType(e, file.importer, fset); obj != nil {
+			return result(obj, typ)
 		}
-		return nil, fmt.Errorf("no declaration found for %v", pretty{fset, e})
+		return nil, &NoDeclarationError{Expr: pretty{fset, e}.String()}
 	}
 	return nil, fmt.Errorf("unreached")
 }
 
+// typeObject returns the object declaring the named type typ, looking
+// through pointers. It returns nil if typ isn't a named type.
+func typeObject(typ types.Type) *ast.Object {
+	n := typ.Node
+	for {
+		star, ok := n.(*ast.StarExpr)
+		if !ok {
+			break
+		}
+		n = star.X
+	}
+	if id, ok := n.(*ast.Ident); ok && id.Obj != nil && id.Obj.Kind == ast.Typ {
+		return id.Obj
+	}
+	return nil
+}
+
 func importPath(n *ast.ImportSpec) (string, error) {
 	p, err := strconv.Unquote(n.Path.Value)
 	if err != nil {
@@ -192,9 +300,10 @@ var errNoPkgFiles = errors.New("no more package files found")
 // parseLocalPackage reads and parses all go files from the
 // current directory that implement the same package name
 // the principal source file, except the original source file
-// itself, which will already have been parsed.
+// itself, which will already have been parsed. Files excluded
+// by ctxt's build constraints are skipped.
 //
-func parseLocalPackage(fset *token.FileSet, filename string, src *ast.File, pkgScope *ast.Scope, pathToName parser.ImportPathToName) (*ast.Package, error) {
+func parseLocalPackage(ctxt *build.Context, fset *token.FileSet, filename string, src *ast.File, pkgScope *ast.Scope, pathToName parser.ImportPathToName) (*ast.Package, error) {
 	pkg := &ast.Package{src.Name.Name, pkgScope, nil, map[string]*ast.File{filename: src}}
 	d, f := filepath.Split(filename)
 	if d == "" {
@@ -218,7 +327,10 @@ func parseLocalPackage(fset *token.FileSet, filename string, src *ast.File, pkgS
 			pkgName(fset, file) != pkg.Name {
 			continue
 		}
-		src, err := parser.ParseFile(fset, file, nil, 0, pkg.Scope, types.DefaultImportPathToName)
+		if match, _ := ctxt.MatchFile(d, pf); !match {
+			continue
+		}
+		src, err := parser.ParseFile(fset, file, nil, 0, pkg.Scope, pathToName)
 		if err == nil {
 			pkg.Files[file] = src
 		}
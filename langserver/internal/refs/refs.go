@@ -116,7 +116,10 @@ func (c *Config) Refs(emit func(*Ref)) error {
 	return nil
 }
 
-var errReceiverNotTopLevelNamedType = errors.New("receiver is not a top-level named type")
+var (
+	errReceiverNotTopLevelNamedType = errors.New("receiver is not a top-level named type")
+	errLabel                        = errors.New("labels are local to their function")
+)
 
 type notPackageLevelDef struct {
 	ident *ast.Ident
@@ -170,6 +173,12 @@ func DefInfo(pkg *types.Package, info *types.Info, nodes []ast.Node, pos token.P
 		}
 	}
 
+	if _, ok := info.ObjectOf(identX).(*types.Label); ok {
+		// Labels have no type, which would otherwise be taken for
+		// the builtin invalid type.
+		return nil, errLabel
+	}
+
 	if obj := info.Defs[identX]; obj != nil {
 		switch t := obj.Type().(type) {
 		case *types.Signature:
@@ -234,7 +243,9 @@ func DefInfo(pkg *types.Package, info *types.Info, nodes []ast.Node, pos token.P
 	if pkgName, ok := obj.(*types.PkgName); ok {
 		return &Def{ImportPath: pkgName.Imported().Path(), PackageName: pkgName.Imported().Name()}, nil
 	} else if selX == nil {
-		if pkg.Scope().Lookup(identX.Name) == obj {
+		// An unqualified identifier may also name another package's
+		// top-level definition, when that package is dot-imported.
+		if p := obj.Pkg(); p != nil && p.Scope().Lookup(identX.Name) == obj {
 			return objectString(obj), nil
 		} else if types.Universe.Lookup(identX.Name) == obj {
 			return &Def{ImportPath: "builtin", PackageName: "builtin", Path: obj.Name()}, nil
@@ -249,7 +260,15 @@ func DefInfo(pkg *types.Package, info *types.Info, nodes []ast.Node, pos token.P
 			t:     t,
 		}
 	} else if sel, ok := info.Selections[selX]; ok {
-		recv, ok := dereferenceType(deepRecvType(sel)).(*types.Named)
+		recvType := deepRecvType(sel)
+		if iface := declaringInterface(obj); iface != nil {
+			// The method set of an interface flattens the methods
+			// of those it embeds, so the selection doesn't record
+			// which interface declares the method, but the method
+			// does.
+			recvType = iface
+		}
+		recv, ok := dereferenceType(recvType).(*types.Named)
 		if !ok || recv == nil || recv.Obj() == nil || recv.Obj().Pkg() == nil || recv.Obj().Pkg().Scope().Lookup(recv.Obj().Name()) != recv.Obj() {
 			return nil, errReceiverNotTopLevelNamedType
 		}
@@ -300,6 +319,24 @@ func deepRecvType(sel *types.Selection) types.Type {
 	return typ
 }
 
+// declaringInterface returns the named interface which declares the
+// interface method obj, or nil if obj isn't one.
+func declaringInterface(obj types.Object) *types.Named {
+	fn, ok := obj.(*types.Func)
+	if !ok {
+		return nil
+	}
+	recv := fn.Type().(*types.Signature).Recv()
+	if recv == nil {
+		return nil
+	}
+	named, ok := recv.Type().(*types.Named)
+	if !ok || !types.IsInterface(named) {
+		return nil
+	}
+	return named
+}
+
 func dereferenceType(typ types.Type) types.Type {
 	if typ, ok := typ.(*types.Pointer); ok {
 		return typ.Elem()
@@ -29,11 +29,20 @@ import (
 )
 
 type serverTestCase struct {
-	skip    bool
-	rootURI lsp.DocumentURI
-	fs      map[string]string
-	mountFS map[string]map[string]string // mount dir -> map VFS
-	cases   lspTestCases
+	skip             bool
+	rootURI          lsp.DocumentURI
+	workspaceFolders []lsp.DocumentURI // sent by the client, if not empty
+	fs               map[string]string
+	mountFS          map[string]map[string]string // mount dir -> map VFS
+	cases            lspTestCases
+
+	buildTags         []string // Config.BuildTags
+	followTypeAliases bool     // Config.FollowTypeAliases
+	symbolScope       string   // Config.SymbolScope, if not empty
+	maxReferences     int      // Config.MaxReferenceResults
+	hoverBackend      string   // Config.HoverBackend
+
+	osFileSystemAccess bool // NoOSFileSystemAccess is unset at initialize
 }
 
 var serverTestCases = map[string]serverTestCase{
@@ -92,6 +101,13 @@ var serverTestCases = map[string]serverTestCase{
 					"/src/test/pkg/b.go:1:23",
 				},
 			},
+			wantReferencesWithoutDecl: map[string][]string{
+				"a.go:1:17": []string{
+					"/src/test/pkg/a.go:1:23",
+					"/src/test/pkg/b.go:1:23",
+				},
+				"b.go:1:17": []string{},
+			},
 			wantSymbols: map[string][]string{
 				"a.go": []string{"/src/test/pkg/a.go:function:A:1:17"},
 				"b.go": []string{"/src/test/pkg/b.go:function:B:1:17"},
@@ -166,6 +182,56 @@ var serverTestCases = map[string]serverTestCase{
 			},
 		},
 	},
+	"workspace symbols in the workspace": {
+		rootURI: "file:///src/test/pkg",
+		fs: map[string]string{
+			"a.go": "package p; func A() {}",
+		},
+		mountFS: map[string]map[string]string{
+			"/src/other": {
+				"o.go": "package other; func O() {}",
+			},
+		},
+		cases: lspTestCases{
+			wantWorkspaceSymbols: map[*lspext.WorkspaceSymbolParams][]string{
+				{Query: ""}: []string{"/src/test/pkg/a.go:function:A:1:17"},
+			},
+		},
+	},
+	"workspace symbols in GOPATH": {
+		rootURI: "file:///src/test/pkg",
+		fs: map[string]string{
+			"a.go": "package p; func A() {}",
+		},
+		mountFS: map[string]map[string]string{
+			"/src/other": {
+				"o.go": "package other; func O() {}",
+			},
+		},
+		symbolScope: symbolScopeGOPATH,
+		cases: lspTestCases{
+			wantWorkspaceSymbols: map[*lspext.WorkspaceSymbolParams][]string{
+				{Query: ""}: []string{"/src/test/pkg/a.go:function:A:1:17", "/src/other/o.go:function:O:1:21"},
+			},
+		},
+	},
+	"max reference results": {
+		rootURI: "file:///src/test/pkg",
+		fs: map[string]string{
+			"a.go": "package p; func A() { A() }",
+			"b.go": "package p; func B() { A(); A() }",
+		},
+		maxReferences: 3,
+		cases: lspTestCases{
+			wantReferences: map[string][]string{
+				"b.go:1:23": []string{
+					"/src/test/pkg/a.go:1:17",
+					"/src/test/pkg/a.go:1:23",
+					"/src/test/pkg/b.go:1:23",
+				},
+			},
+		},
+	},
 	"exported defs unexported type": {
 		rootURI: "file:///src/test/pkg",
 		fs: map[string]string{
@@ -180,6 +246,70 @@ var serverTestCases = map[string]serverTestCase{
 			},
 		},
 	},
+	"go definitions despite errors in other packages": {
+		rootURI: "file:///src/test/pkg",
+		fs: map[string]string{
+			"a.go":   "package p; import \"test/pkg/b\"; var _, _ = b.F, b.X",
+			"a2.go":  "package p; import (",
+			"b/b.go": "package b; func F() {}; var X int = \"s\"",
+			"b/c.go": "package b; import (",
+			"b/d.go": "package b\n\nimport \"C\"\n\nfunc G() {}\n",
+			"c/c.go": "package c; import (",
+		},
+		cases: lspTestCases{
+			wantXDefinition: map[string]string{
+				"a.go:1:46": "/src/test/pkg/b/b.go:1:17 id:test/pkg/b/-/F name:F package:test/pkg/b packageName:b recv: vendor:false",
+				"a.go:1:51": "/src/test/pkg/b/b.go:1:29 id:test/pkg/b/-/X name:X package:test/pkg/b packageName:b recv: vendor:false",
+			},
+		},
+	},
+	"go syntactic definitions in a file which isn't typechecked": {
+		rootURI: "file:///src/test/pkg",
+		fs: map[string]string{
+			"a.go":   "package p",
+			"gen.go": "// +build ignore\n\npackage main\n\nimport \"fmt\"\n\nfunc main() {\n\tx := 1\n\tfmt.Println(x)\n\thelper(T{})\n}\n\ntype T struct{}\n\nfunc helper(t T) {}\n",
+		},
+		cases: lspTestCases{
+			wantDefinition: map[string]string{
+				"gen.go:9:14":  "/src/test/pkg/gen.go:8:2-8:3",
+				"gen.go:10:2":  "/src/test/pkg/gen.go:15:6-15:12",
+				"gen.go:10:9":  "/src/test/pkg/gen.go:13:6-13:7",
+				"gen.go:15:13": "/src/test/pkg/gen.go:15:13-15:14",
+				"gen.go:15:15": "/src/test/pkg/gen.go:13:6-13:7",
+			},
+		},
+	},
+	"go xtest using in-package test declarations": {
+		rootURI: "file:///src/test/pkg",
+		fs: map[string]string{
+			"a.go":           "package p; var a int",
+			"export_test.go": "package p; var A = a",
+			"x_test.go":      `package p_test; import "test/pkg"; var X = p.A`,
+		},
+		cases: lspTestCases{
+			overrideGodefHover: map[string]string{
+				"x_test.go:1:40": "var X = p.A",
+				"x_test.go:1:46": "var A = a",
+			},
+			wantDefinition: map[string]string{
+				"x_test.go:1:46":      "/src/test/pkg/export_test.go:1:16-1:17",
+				"export_test.go:1:20": "/src/test/pkg/a.go:1:16-1:17",
+			},
+			wantXDefinition: map[string]string{
+				"x_test.go:1:46": "/src/test/pkg/export_test.go:1:16 id:test/pkg/-/A name:A package:test/pkg packageName:p recv: vendor:false",
+			},
+			wantHover: map[string]string{
+				"x_test.go:1:46": "import \"test/pkg\"\nvar A int",
+				"x_test.go:1:40": "var X int",
+			},
+			wantReferences: map[string][]string{
+				"export_test.go:1:16": []string{
+					"/src/test/pkg/export_test.go:1:16",
+					"/src/test/pkg/x_test.go:1:46",
+				},
+			},
+		},
+	},
 	"go xtest": {
 		rootURI: "file:///src/test/pkg",
 		fs: map[string]string{
@@ -203,7 +333,7 @@ var serverTestCases = map[string]serverTestCase{
 			wantHover: map[string]string{
 				"a.go:1:16":      "var A int",
 				"x_test.go:1:40": "var X int",
-				"x_test.go:1:46": "var A int",
+				"x_test.go:1:46": "import \"test/pkg\"\nvar A int",
 				"a_test.go:1:16": "var X int",
 				"a_test.go:1:20": "var A int",
 			},
@@ -262,11 +392,11 @@ var serverTestCases = map[string]serverTestCase{
 		cases: lspTestCases{
 			overrideGodefHover: map[string]string{
 				"a_test.go:1:37": "var X = b.B",
-				"a_test.go:1:43": "var B int",
+				"a_test.go:1:43": "import \"test/pkg/b\"\nvar B int",
 			},
 			wantHover: map[string]string{
 				"a_test.go:1:37": "var X int",
-				"a_test.go:1:43": "var B int",
+				"a_test.go:1:43": "import \"test/pkg/b\"\nvar B int",
 			},
 			wantReferences: map[string][]string{
 				"a_test.go:1:43": []string{
@@ -285,6 +415,21 @@ var serverTestCases = map[string]serverTestCase{
 			},
 		},
 	},
+	"go dot import": {
+		rootURI: "file:///src/test/pkg",
+		fs: map[string]string{
+			"a.go":   `package a; import . "test/pkg/b"; func A() T { return B() }`,
+			"b/b.go": "package b; type T int; func B() T { return 0 }",
+		},
+		cases: lspTestCases{
+			// godef doesn't resolve dot imports, so only the type
+			// checked definitions are tested.
+			wantXDefinition: map[string]string{
+				"a.go:1:44": "/src/test/pkg/b/b.go:1:17 id:test/pkg/b/-/T name:T package:test/pkg/b packageName:b recv: vendor:false",
+				"a.go:1:55": "/src/test/pkg/b/b.go:1:29 id:test/pkg/b/-/B name:B package:test/pkg/b packageName:b recv: vendor:false",
+			},
+		},
+	},
 	"go subdirectory in repo": {
 		rootURI: "file:///src/test/pkg/d",
 		fs: map[string]string{
@@ -296,7 +441,7 @@ var serverTestCases = map[string]serverTestCase{
 				"a.go:1:17":    "func A()",
 				"a.go:1:23":    "func A()",
 				"d2/b.go:1:39": "func B()",
-				"d2/b.go:1:47": "func A()",
+				"d2/b.go:1:47": "import \"test/pkg/d\"\nfunc A()",
 				"d2/b.go:1:52": "func B()",
 			},
 			wantDefinition: map[string]string{
@@ -386,6 +531,33 @@ var serverTestCases = map[string]serverTestCase{
 			},
 		},
 	},
+	"workspace references by descriptor": {
+		rootURI: "file:///src/test/pkg",
+		fs: map[string]string{
+			"q/q.go": "package q; type T struct{ F int }; func (T) M() {}; func G() {}",
+			"p/p.go": `package p; import "test/pkg/q"; var t q.T; var _ = t.M; var _ = t.F; var _ = q.G`,
+		},
+		cases: lspTestCases{
+			wantWorkspaceReferences: map[*lspext.WorkspaceReferencesParams][]string{
+				// Everything in a package.
+				{Query: lspext.SymbolDescriptor{"package": "test/pkg/q"}}: []string{
+					"/src/test/pkg/p/p.go:1:19-1:31 -> id:test/pkg/q name: package:test/pkg/q packageName:q recv: vendor:false",
+					"/src/test/pkg/p/p.go:1:41-1:42 -> id:test/pkg/q/-/T name:T package:test/pkg/q packageName:q recv: vendor:false",
+					"/src/test/pkg/p/p.go:1:54-1:55 -> id:test/pkg/q/-/T/M name:M package:test/pkg/q packageName:q recv:T vendor:false",
+					"/src/test/pkg/p/p.go:1:67-1:68 -> id:test/pkg/q/-/T/F name:F package:test/pkg/q packageName:q recv:T vendor:false",
+					"/src/test/pkg/p/p.go:1:80-1:81 -> id:test/pkg/q/-/G name:G package:test/pkg/q packageName:q recv: vendor:false",
+				},
+
+				// Fields and methods of a type.
+				{Query: lspext.SymbolDescriptor{"package": "test/pkg/q", "recv": "T"}}: []string{
+					"/src/test/pkg/p/p.go:1:54-1:55 -> id:test/pkg/q/-/T/M name:M package:test/pkg/q packageName:q recv:T vendor:false",
+					"/src/test/pkg/p/p.go:1:67-1:68 -> id:test/pkg/q/-/T/F name:F package:test/pkg/q packageName:q recv:T vendor:false",
+				},
+
+				{Query: lspext.SymbolDescriptor{"name": "M"}}: []string{"/src/test/pkg/p/p.go:1:54-1:55 -> id:test/pkg/q/-/T/M name:M package:test/pkg/q packageName:q recv:T vendor:false"},
+			},
+		},
+	},
 	"go multiple packages in dir": {
 		rootURI: "file:///src/test/pkg",
 		fs: map[string]string{
@@ -441,16 +613,18 @@ package main; import "test/pkg"; func B() { p.A(); B() }`,
 		},
 		cases: lspTestCases{
 			overrideGodefHover: map[string]string{
-				"a.go:1:40": "func Println(a ...interface{}) (n int, err error); Println formats using the default formats for its operands and writes to standard output. Spaces are always added between operands and a newline is appended. It returns the number of bytes written and any write error encountered. \n\n",
-				// "a.go:1:53": "type int int",
+				"a.go:1:40": "import \"fmt\"\nfunc Println(a ...interface{}) (n int, err error); Println formats using the default formats for its operands and writes to standard output. Spaces are always added between operands and a newline is appended. It returns the number of bytes written and any write error encountered. \n\n",
+				// "a.go:1:53": "builtin\ntype int int",
 			},
 			wantHover: map[string]string{
-				"a.go:1:40": "func Println(a ...interface{}) (n int, err error)",
-				// "a.go:1:53": "type int int",
+				"a.go:1:40": "import \"fmt\"\nfunc Println(a ...interface{}) (n int, err error)",
+				"a.go:1:53": "builtin\ntype int",
 			},
 			overrideGodefDefinition: map[string]string{
-				"a.go:1:40": "/goroot/src/fmt/print.go",               // hitting the real GOROOT
-				"a.go:1:53": "/goroot/src/builtin/builtin.go:1:1-1:1", // TODO: accurate builtin positions
+				"a.go:1:40": "/goroot/src/fmt/print.go",       // hitting the real GOROOT
+				"a.go:1:53": "/goroot/src/builtin/builtin.go", // positions are checked by TestBuiltinLocation
+				"a.go:1:20": "/goroot/src/fmt/doc.go",         // import spec
+				"a.go:1:36": "/goroot/src/fmt/doc.go",         // package selector
 			},
 			wantDefinition: map[string]string{
 				"a.go:1:40": "/goroot/src/fmt/print.go:1:19-1:26",
@@ -496,7 +670,7 @@ package main; import "test/pkg"; func B() { p.A(); B() }`,
 			wantHover: map[string]string{
 				"a/a.go:1:17": "func A()",
 				// "b/b.go:1:20": "package", // TODO(sqs): make import paths hoverable
-				"b/b.go:1:43": "func A()",
+				"b/b.go:1:43": "import \"test/pkg/a\"\nfunc A()",
 			},
 			wantDefinition: map[string]string{
 				"a/a.go:1:17": "/src/test/pkg/a/a.go:1:17-1:18",
@@ -549,11 +723,15 @@ package main; import "test/pkg"; func B() { p.A(); B() }`,
 		},
 		cases: lspTestCases{
 			wantHover: map[string]string{
-				"a.go:1:61": "func V()",
+				"a.go:1:61": "import \"github.com/v/vendored\"\nfunc V()",
 			},
 			wantDefinition: map[string]string{
 				"a.go:1:61": "/src/test/pkg/vendor/github.com/v/vendored/v.go:1:24-1:25",
-				//"a.go:1:40": "/src/test/pkg/vendor/github.com/v/vendored/v.go:1:24-1:25",
+				"a.go:1:40": "/src/test/pkg/vendor/github.com/v/vendored/v.go:1:9-1:17",
+			},
+			overrideGodefDefinition: map[string]string{
+				"a.go:1:61": "/src/test/pkg/vendor/github.com/v/vendored/v.go:1:24-1:25",
+				"a.go:1:52": "/src/test/pkg/vendor/github.com/v/vendored/v.go:1:9-1:17",
 			},
 			wantXDefinition: map[string]string{
 				"a.go:1:61": "/src/test/pkg/vendor/github.com/v/vendored/v.go:1:24 id:test/pkg/vendor/github.com/v/vendored/-/V name:V package:test/pkg/vendor/github.com/v/vendored packageName:vendored recv: vendor:true",
@@ -625,158 +803,706 @@ package main; import "test/pkg"; func B() { p.A(); B() }`,
 			},
 		},
 	},
-	"go external dep": {
+	"exported workspace symbols": {
 		rootURI: "file:///src/test/pkg",
 		fs: map[string]string{
-			"a.go": `package a; import "github.com/d/dep"; var _ = dep.D; var _ = dep.D`,
-		},
-		mountFS: map[string]map[string]string{
-			"/src/github.com/d/dep": {
-				"d.go": "package dep; func D() {}; var _ = D",
-			},
+			"a.go": `package p; type T struct{}; func (T) M() {}; func (T) m() {}; type t struct{}; func (t) N() {}; func F() {}; func f() {}; var V, v int`,
 		},
 		cases: lspTestCases{
-			wantHover: map[string]string{
-				"a.go:1:51": "func D()",
-			},
-			wantDefinition: map[string]string{
-				"a.go:1:51": "/src/github.com/d/dep/d.go:1:19-1:20",
-			},
-			wantXDefinition: map[string]string{
-				"a.go:1:51": "/src/github.com/d/dep/d.go:1:19 id:github.com/d/dep/-/D name:D package:github.com/d/dep packageName:dep recv: vendor:false",
-			},
-			wantCompletion: map[string]string{
-				"a.go:1:34": "1:20-1:34 github.com/d/dep module ",
-				"a.go:1:51": "1:51-1:51 D function func()",
+			wantWorkspaceSymbols: map[*lspext.WorkspaceSymbolParams][]string{
+				{Query: "n"}: []string{"/src/test/pkg/a.go:method:t.N:1:89"},
 			},
-			wantReferences: map[string][]string{
-				"a.go:1:51": []string{
-					"/src/test/pkg/a.go:1:51",
-					"/src/test/pkg/a.go:1:66",
-					// Do not include "refs" from the dependency
-					// package itself; only return results in the
-					// workspace.
+			wantExportedWorkspaceSymbols: map[*lspext.WorkspaceSymbolParams][]string{
+				{Query: ""}: []string{
+					"/src/test/pkg/a.go:function:F:1:102",
+					"/src/test/pkg/a.go:class:T:1:17",
+					"/src/test/pkg/a.go:variable:V:1:127",
+					"/src/test/pkg/a.go:method:T.M:1:38",
 				},
+				{Query: "n"}: []string{},
 			},
-			wantWorkspaceReferences: map[*lspext.WorkspaceReferencesParams][]string{
-				{Query: lspext.SymbolDescriptor{}}: []string{
-					"/src/test/pkg/a.go:1:19-1:37 -> id:github.com/d/dep name: package:github.com/d/dep packageName:dep recv: vendor:false",
-					"/src/test/pkg/a.go:1:51-1:52 -> id:github.com/d/dep/-/D name:D package:github.com/d/dep packageName:dep recv: vendor:false",
-					"/src/test/pkg/a.go:1:66-1:67 -> id:github.com/d/dep/-/D name:D package:github.com/d/dep packageName:dep recv: vendor:false",
+		},
+	},
+	"hierarchical document symbols": {
+		rootURI: "file:///src/test/pkg",
+		fs: map[string]string{
+			"a.go": "package p\n\ntype T struct {\n\tX, Y int\n\tio.Reader\n}\n\nconst (\n\tA T = iota\n\tB\n\tC = 1\n)\n\nvar V = 1\n\nfunc (t *T) M() {}\n\nfunc (u U) N() {}\n\ntype I interface {\n\tM()\n\tfmt.Stringer\n}\n\nfunc F() {}\n",
+		},
+		cases: lspTestCases{
+			wantHierarchicalSymbols: map[string][]string{
+				"a.go": []string{
+					"class:T 3:1-6:2 3:6-3:7",
+					"field:T.X 4:2-4:10 4:2-4:3",
+					"field:T.Y 4:2-4:10 4:5-4:6",
+					"field:T.Reader 5:2-5:11 5:5-5:11",
+					"constant:T.A 9:2-9:12 9:2-9:3",
+					"constant:T.B 10:2-10:3 10:2-10:3",
+					"method:T.M 16:1-16:19 16:13-16:14",
+					"constant:C 11:2-11:7 11:2-11:3",
+					"variable:V 14:1-14:10 14:5-14:6",
+					"method:N 18:1-18:18 18:12-18:13",
+					"interface:I 20:1-23:2 20:6-20:7",
+					"method:I.M 21:2-21:5 21:2-21:3",
+					"interface:I.Stringer 22:2-22:14 22:6-22:14",
+					"function:F 25:1-25:12 25:6-25:7",
 				},
 			},
 		},
 	},
-	"external dep with vendor": {
+	"deprecated tags": {
 		rootURI: "file:///src/test/pkg",
 		fs: map[string]string{
-			"a.go": `package p; import "github.com/d/dep"; var _ = dep.D().F`,
+			"a.go": "package p\n\n// Deprecated: use B.\nfunc A() {}\n\nfunc B() {}\n\n// T is a type.\n//\n// Deprecated: use U.\ntype T struct {\n\t// Deprecated: use G.\n\tF int\n\tG int\n}\n\ntype U struct{}\n\n// Deprecated: don't.\nfunc (U) M() {}\n\nfunc (U) N() {}\n\nconst (\n\t// Deprecated: use D.\n\tC = 1\n\tD = 2\n)\n\n// Deprecated: all of them.\nvar (\n\tV = 1\n\tW = 2\n)\n\nfunc _() {\n\tvar u U\n\tu.N()\n\tvar t T\n\t_ = t.G\n}\n",
 		},
-		mountFS: map[string]map[string]string{
-			"/src/github.com/d/dep": map[string]string{
-				"d.go":               `package dep; import "vendp"; func D() (v vendp.V) { return }`,
-				"vendor/vendp/vp.go": "package vendp; type V struct { F int }",
+		cases: lspTestCases{
+			wantDeprecatedCompletion: map[string][]string{
+				"a.go:38:4": []string{"M"},
+				"a.go:40:8": []string{"F"},
+			},
+			wantDeprecatedSymbols: map[string][]string{
+				"a.go": []string{"A", "T", "T.F", "U.M", "C", "V", "W"},
 			},
+			wantDeprecatedWorkspaceSymbols: map[*lspext.WorkspaceSymbolParams][]string{
+				{Query: ""}: []string{"A", "C", "T", "U.M", "V", "W"},
+			},
+		},
+	},
+	"markdown hover": {
+		rootURI: "file:///src/test/pkg",
+		fs: map[string]string{
+			"a.go": "package p\n\n// F does things.\n//\n// For example:\n//\n//\tF(1)\nfunc F(x int) {}\n\nvar _ = F\n\n// T is a type.\ntype T struct {\n\tX int\n}\n",
 		},
 		cases: lspTestCases{
-			wantDefinition: map[string]string{
-				"a.go:1:55": "/src/github.com/d/dep/vendor/vendp/vp.go:1:32-1:33",
+			wantHover: map[string]string{
+				"a.go:10:9": "func F(x int); F does things. \n\nFor example: \n\n```\nF(1)\n\n```\n",
 			},
-			wantXDefinition: map[string]string{
-				"a.go:1:55": "/src/github.com/d/dep/vendor/vendp/vp.go:1:32 id:github.com/d/dep/vendor/vendp/-/V/F name:F package:github.com/d/dep/vendor/vendp packageName:vendp recv:V vendor:true",
+			wantMarkdownHover: map[string]string{
+				"a.go:10:9": "```go\nfunc F(x int)\n```\n\nF does things. \n\nFor example: \n\n```\nF(1)\n\n```",
+				"a.go:13:6": "```go\ntype T struct\n```\n\nT is a type.\n\n```go\nstruct {\n    X int\n}\n```",
 			},
-			wantCompletion: map[string]string{
-				"a.go:1:55": "1:55-1:55 F variable int",
+		},
+	},
+	"generics hover": {
+		rootURI: "file:///src/test/pkg",
+		fs: map[string]string{
+			"a.go": "package p\n\ntype Number interface{ ~int | ~float64 }\n\nfunc Map[T any, U Number](xs []T, f func(T) U) []U { return nil }\n\ntype List[T Number] struct{ v T }\n\ntype Pair[K comparable, V any] interface{ Get(K) V }\n\ntype Both[A, B Number] struct{}\n\nvar _ = Map[int, int]\n",
+		},
+		cases: lspTestCases{
+			wantMarkdownHover: map[string]string{
+				"a.go:7:6":  "```go\ntype List[T Number] struct\n```\n\n```go\nstruct {\n    v T\n}\n```",
+				"a.go:9:6":  "```go\ntype Pair[K comparable, V any] interface\n```\n\n```go\ninterface {\n    Get(K) V\n}\n```",
+				"a.go:11:6": "```go\ntype Both[A, B Number] struct\n```",
+				"a.go:3:6":  "```go\ntype Number interface\n```\n\n```go\ninterface {\n    ~int | ~float64\n}\n```",
+				"a.go:13:9": "```go\nfunc Map[T any, U Number](xs []T, f func(T) U) []U\n```",
 			},
-			wantWorkspaceReferences: map[*lspext.WorkspaceReferencesParams][]string{
-				{Query: lspext.SymbolDescriptor{}}: []string{
-					"/src/test/pkg/a.go:1:19-1:37 -> id:github.com/d/dep name: package:github.com/d/dep packageName:dep recv: vendor:false",
-					"/src/test/pkg/a.go:1:55-1:56 -> id:github.com/d/dep/vendor/vendp/-/V/F name:F package:github.com/d/dep/vendor/vendp packageName:vendp recv:V vendor:true",
-					"/src/test/pkg/a.go:1:51-1:52 -> id:github.com/d/dep/-/D name:D package:github.com/d/dep packageName:dep recv: vendor:false",
-				},
+		},
+	},
+	"conversion hover": {
+		rootURI: "file:///src/test/pkg",
+		fs: map[string]string{
+			"a.go":   "package p\n\nimport \"test/pkg/b\"\n\n// Celsius is a temperature.\ntype Celsius float64\n\nfunc f(x float64) {\n\t_ = Celsius(x)\n\t_ = (*Celsius)(&x)\n\t_ = b.Meters(x)\n}\n",
+			"b/b.go": "package b\n\n// Meters is a length.\ntype Meters float64\n",
+		},
+		cases: lspTestCases{
+			wantMarkdownHover: map[string]string{
+				"a.go:9:6":   "```go\ntype Celsius float64\n```\n\nCelsius is a temperature.",
+				"a.go:10:8":  "```go\ntype Celsius float64\n```\n\nCelsius is a temperature.",
+				"a.go:11:8":  "```go\nimport \"test/pkg/b\"\ntype Meters float64\n```\n\nMeters is a length.",
+				"a.go:11:15": "```go\nvar x float64\n```",
 			},
 		},
 	},
-	"go external dep at subtree": {
+	"blank identifier hover": {
 		rootURI: "file:///src/test/pkg",
 		fs: map[string]string{
-			"a.go": `package a; import "github.com/d/dep/subp"; var _ = subp.D`,
+			"a.go": "package p\n\nfunc g() (int, error) { return 0, nil }\n\nfunc f(m map[string]bool, s string) {\n\t_, _ = g()\n\t_ = s\n\tfor _, _ = range m {\n\t}\n\tfor _ = range s {\n\t}\n\t_, _ = m[\"k\"]\n\tfor _, v := range s {\n\t\t_ = v\n\t}\n}\n",
 		},
-		mountFS: map[string]map[string]string{
-			"/src/github.com/d/dep": {
-				"subp/d.go": "package subp; func D() {}",
+		cases: lspTestCases{
+			wantMarkdownHover: map[string]string{
+				"a.go:6:2":  "```go\n_ (discarded) int\n```",
+				"a.go:6:5":  "```go\n_ (discarded) error\n```",
+				"a.go:7:2":  "```go\n_ (discarded) string\n```",
+				"a.go:8:6":  "```go\n_ (discarded) string\n```",
+				"a.go:8:9":  "```go\n_ (discarded) bool\n```",
+				"a.go:10:6": "```go\n_ (discarded) int\n```",
+				"a.go:12:5": "```go\n_ (discarded) bool\n```",
+				"a.go:13:6": "```go\nvar _ int\n```",
+				"a.go:14:3": "```go\n_ (discarded) rune\n```",
 			},
 		},
+	},
+	"blank identifier hover with godef": {
+		rootURI:      "file:///src/test/pkg",
+		hoverBackend: hoverBackendGodef,
+		fs: map[string]string{
+			"a.go": "package p\n\nfunc g() (int, error) { return 0, nil }\n\nfunc f() {\n\t_, _ = g()\n}\n",
+		},
 		cases: lspTestCases{
 			wantHover: map[string]string{
-				"a.go:1:57": "func D()",
-			},
-			wantDefinition: map[string]string{
-				"a.go:1:57": "/src/github.com/d/dep/subp/d.go:1:20-1:21",
-			},
-			wantXDefinition: map[string]string{
-				"a.go:1:57": "/src/github.com/d/dep/subp/d.go:1:20 id:github.com/d/dep/subp/-/D name:D package:github.com/d/dep/subp packageName:subp recv: vendor:false",
-			},
-			wantCompletion: map[string]string{
-				"a.go:1:34": "1:20-1:34 github.com/d/dep/subp module ",
-				"a.go:1:57": "1:57-1:57 D function func()",
-			},
-			wantWorkspaceReferences: map[*lspext.WorkspaceReferencesParams][]string{
-				{Query: lspext.SymbolDescriptor{}}: []string{
-					"/src/test/pkg/a.go:1:19-1:42 -> id:github.com/d/dep/subp name: package:github.com/d/dep/subp packageName:subp recv: vendor:false",
-					"/src/test/pkg/a.go:1:57-1:58 -> id:github.com/d/dep/subp/-/D name:D package:github.com/d/dep/subp packageName:subp recv: vendor:false",
-				},
+				"a.go:6:2": "_ (discarded) int",
+				"a.go:6:5": "_ (discarded) error",
 			},
 		},
 	},
-	"go nested external dep": { // a depends on dep1, dep1 depends on dep2
+	"hover ranges": {
 		rootURI: "file:///src/test/pkg",
 		fs: map[string]string{
-			"a.go": `package a; import "github.com/d/dep1"; var _ = dep1.D1().D2`,
+			"a.go": "package p\n\nimport \"strings\"\n\nvar s = strings.ToUpper(\"x\")\n\nfunc Longer() string { return s }\n",
 		},
 		mountFS: map[string]map[string]string{
-			"/src/github.com/d/dep1": {
-				"d1.go": `package dep1; import "github.com/d/dep2"; func D1() dep2.D2 { return dep2.D2{} }`,
-			},
-			"/src/github.com/d/dep2": {
-				"d2.go": "package dep2; type D2 struct { D2 int }",
+			"/goroot": {
+				"src/strings/strings.go": "package strings\n\nfunc ToUpper(s string) string { return s }\n",
 			},
 		},
 		cases: lspTestCases{
-			overrideGodefHover: map[string]string{
-				"a.go:1:53": "func D1() dep2.D2",
-				"a.go:1:59": "struct field D2 int",
+			wantHoverRange: map[string]string{
+				"a.go:5:10": "5:9-5:16",
+				"a.go:5:20": "5:17-5:24",
+				"a.go:7:8":  "7:6-7:12",
+				"a.go:7:31": "7:31-7:32",
 			},
-			wantHover: map[string]string{
-				"a.go:1:53": "func D1() D2",
-				"a.go:1:59": "struct field D2 int",
-			},
-			wantDefinition: map[string]string{
-				"a.go:1:53": "/src/github.com/d/dep1/d1.go:1:48-1:50", // func D1
-				"a.go:1:58": "/src/github.com/d/dep2/d2.go:1:32-1:34", // field D2
+		},
+	},
+	"interface method set hover": {
+		rootURI: "file:///src/test/pkg",
+		fs: map[string]string{
+			"a.go": "package p\n\ntype Reader interface {\n\tRead(p []byte) (n int, err error)\n}\n\ntype ReadCloser interface {\n\tReader\n\tClose() error\n}\n\ntype Empty interface{}\n",
+		},
+		cases: lspTestCases{
+			wantMarkdownHover: map[string]string{
+				"a.go:3:6":  "```go\ntype Reader interface\n```\n\n```go\ninterface {\n    Read(p []byte) (n int, err error)\n}\n```",
+				"a.go:7:6":  "```go\ntype ReadCloser interface\n```\n\n```go\ninterface {\n    Close() error\n    Read(p []byte) (n int, err error)\n}\n```",
+				"a.go:12:6": "```go\ntype Empty interface\n```",
 			},
-			wantXDefinition: map[string]string{
-				"a.go:1:53": "/src/github.com/d/dep1/d1.go:1:48 id:github.com/d/dep1/-/D1 name:D1 package:github.com/d/dep1 packageName:dep1 recv: vendor:false",
-				"a.go:1:58": "/src/github.com/d/dep2/d2.go:1:32 id:github.com/d/dep2/-/D2/D2 name:D2 package:github.com/d/dep2 packageName:dep2 recv:D2 vendor:false",
+		},
+	},
+	"composite literal key hover": {
+		rootURI: "file:///src/test/pkg",
+		fs: map[string]string{
+			"a.go": "package p\n\ntype T struct {\n\t// F is a field.\n\tF string\n\tG int\n}\n\nvar _ = T{F: \"x\"}\n\nvar _ = T{1, G: 2}\n\nvar _ = []*T{{G: 1}}\n",
+		},
+		cases: lspTestCases{
+			wantMarkdownHover: map[string]string{
+				"a.go:9:11":  "```go\nstruct field F string\n```\n\nF is a field.",
+				"a.go:11:14": "```go\nstruct field G int\n```",
+				"a.go:13:15": "```go\nstruct field G int\n```",
 			},
-			wantCompletion: map[string]string{
-				//"a.go:1:53": "1:53-1:53 D1 function func() D2", // gocode does not handle D2 correctly
-				"a.go:1:58": "1:58-1:58 D2 variable int",
+		},
+	},
+	"typecheck completion": {
+		rootURI: "file:///src/test/pkg",
+		fs: map[string]string{
+			"a.go":   "package p\n\nimport \"test/pkg/q\"\n\ntype E struct{ Z int }\n\nfunc (E) Em() {}\n\ntype T struct {\n\tE\n\tX int\n\ty string\n}\n\nfunc (t *T) M() {}\n\nfunc f1(t T) {\n\tt.\n}\n\nfunc f2() {\n\tq.V.\n}\n\nfunc f3() {\n\tq.F\n}\n\nfunc f4() {\n\tnope.\n}\n",
+			"b.go":   "package p\n\nimport \"test/pkg/q\"\n\nvar _ = T{X: 1, }\n\nvar _ = q.Q{}\n\nvar _ = []T{{X}}\n\nvar _ = T{X: y}\n",
+			"q/q.go": "package q\n\ntype Q struct {\n\tA int\n\tb int\n}\n\nfunc (Q) B() {}\n\nfunc (Q) c() {}\n\nconst K = 1\n\nvar V Q\n\nfunc F(s string) error { return nil }\n\nfunc g() {}\n",
+		},
+		cases: lspTestCases{
+			wantTypecheckCompletion: map[string]string{
+				"a.go:18:4":  "18:4-18:4 E field E, Em method func(), M method func(), X field int, Z field int, y field string",
+				"a.go:22:6":  "22:6-22:6 A field int, B method func()",
+				"a.go:26:5":  "26:4-26:5 F function func(s string) error, K constant untyped int, Q class struct, V variable Q",
+				"a.go:30:7":  "",
+				"b.go:5:17":  "5:17-5:17 E field E, y field string",
+				"b.go:7:13":  "7:13-7:13 A field int",
+				"b.go:9:15":  "9:14-9:15 E field E, X field int, y field string",
+				"b.go:11:15": "",
 			},
-			wantWorkspaceReferences: map[*lspext.WorkspaceReferencesParams][]string{
-				{Query: lspext.SymbolDescriptor{}}: []string{
-					"/src/test/pkg/a.go:1:19-1:38 -> id:github.com/d/dep1 name: package:github.com/d/dep1 packageName:dep1 recv: vendor:false",
-					"/src/test/pkg/a.go:1:58-1:60 -> id:github.com/d/dep2/-/D2/D2 name:D2 package:github.com/d/dep2 packageName:dep2 recv:D2 vendor:false",
-					"/src/test/pkg/a.go:1:53-1:55 -> id:github.com/d/dep1/-/D1 name:D1 package:github.com/d/dep1 packageName:dep1 recv: vendor:false",
-				},
+		},
+	},
+	"type name completion": {
+		rootURI: "file:///src/test/pkg",
+		fs: map[string]string{
+			"a.go":   "package p\n\nimport \"test/pkg/q\"\n\ntype T struct{}\n\nfunc f(t T) q.C { return 0 }\n\nfunc g() {\n\ttype L int\n\tvar _ L\n}\n",
+			"b.go":   "package p\n\nvar x \n",
+			"c.go":   "package p\n\nimport \"test/pkg/q\"\n\nvar y q.\n",
+			"q/q.go": "package q\n\ntype A struct{}\n\ntype B interface{}\n\ntype C int\n\nfunc F() {}\n\nvar V int\n",
+		},
+		cases: lspTestCases{
+			wantTypecheckCompletion: map[string]string{
+				"a.go:7:11": "7:10-7:11 T struct struct, any interface interface, bool class bool, byte class byte, complex128 class complex128, complex64 class complex64, error interface interface, float32 class float32, float64 class float64, int class int, int16 class int16, int32 class int32, int64 class int64, int8 class int8, q module test/pkg/q, rune class rune, string class string, uint class uint, uint16 class uint16, uint32 class uint32, uint64 class uint64, uint8 class uint8, uintptr class uintptr",
+				"a.go:7:16": "7:15-7:16 A struct struct, B interface interface, C class int",
+				"a.go:11:9": "11:8-11:9 L class int, T struct struct, any interface interface, bool class bool, byte class byte, complex128 class complex128, complex64 class complex64, error interface interface, float32 class float32, float64 class float64, int class int, int16 class int16, int32 class int32, int64 class int64, int8 class int8, q module test/pkg/q, rune class rune, string class string, uint class uint, uint16 class uint16, uint32 class uint32, uint64 class uint64, uint8 class uint8, uintptr class uintptr",
+				"b.go:3:7":  "3:7-3:7 T struct struct, any interface interface, bool class bool, byte class byte, complex128 class complex128, complex64 class complex64, error interface interface, float32 class float32, float64 class float64, int class int, int16 class int16, int32 class int32, int64 class int64, int8 class int8, rune class rune, string class string, uint class uint, uint16 class uint16, uint32 class uint32, uint64 class uint64, uint8 class uint8, uintptr class uintptr",
+				"c.go:5:9":  "5:9-5:9 A struct struct, B interface interface, C class int",
 			},
 		},
 	},
-	"go symbols": {
+	"import path completion": {
 		rootURI: "file:///src/test/pkg",
 		fs: map[string]string{
-			"abc.go": `package a
-
+			"a.go":           "package p\n\nimport (\n\t\"test/pkg/\n\t\"test/pkg/q\"\n\t\"v\"\n)\n",
+			"q/q.go":         "// Package q is quoted.\npackage q\n",
+			"empty/sub/s.go": "package sub\n",
+			"vendor/v/v.go":  "package v\n",
+		},
+		cases: lspTestCases{
+			wantTypecheckCompletion: map[string]string{
+				"a.go:4:12": "4:3-4:12 test/pkg/empty folder , test/pkg/q module Package q is quoted.",
+				"a.go:5:13": "5:3-5:13 test/pkg/q module Package q is quoted.",
+				"a.go:6:4":  "6:3-6:4 v module ",
+			},
+		},
+	},
+	"go module": {
+		rootURI: "file:///work/m",
+		fs: map[string]string{
+			"go.mod":   "module example.com/m\n\nrequire example.com/dep v1.0.0\n\nreplace example.com/dep => ../dep\n",
+			"a.go":     `package m; import "example.com/m/sub"; var _ = sub.S`,
+			"b.go":     `package m; import "example.com/dep"; var _ = dep.D`,
+			"sub/s.go": "package sub; var S int",
+		},
+		mountFS: map[string]map[string]string{
+			"/work/dep": {
+				"d.go": "package dep; func D() {}",
+			},
+		},
+		cases: lspTestCases{
+			wantXDefinition: map[string]string{
+				"a.go:1:52": "/work/m/sub/s.go:1:18 id:example.com/m/sub/-/S name:S package:example.com/m/sub packageName:sub recv: vendor:false",
+				"b.go:1:50": "/work/dep/d.go:1:19 id:example.com/dep/-/D name:D package:example.com/dep packageName:dep recv: vendor:false",
+			},
+		},
+	},
+	"workspace folders": {
+		rootURI:          "file:///src/test",
+		workspaceFolders: []lsp.DocumentURI{"file:///src/test/a", "file:///src/test/b"},
+		fs: map[string]string{
+			"a/a.go":     "package a\n\nfunc A() {}\n",
+			"b/go.mod":   "module example.com/b\n",
+			"b/b.go":     "package b\n\nimport (\n\t\"example.com/b/sub\"\n\t\"test/a\"\n)\n\nfunc B() { a.A(); _ = sub.S }\n",
+			"b/sub/s.go": "package sub\n\nvar S int\n",
+			"c/c.go":     "package c\n\nfunc C() {}\n",
+		},
+		cases: lspTestCases{
+			wantXDefinition: map[string]string{
+				"b/b.go:8:14": "/src/test/a/a.go:3:6 id:test/a/-/A name:A package:test/a packageName:a recv: vendor:false",
+				"b/b.go:8:27": "/src/test/b/sub/s.go:3:5 id:example.com/b/sub/-/S name:S package:example.com/b/sub packageName:sub recv: vendor:false",
+			},
+			wantWorkspaceSymbols: map[*lspext.WorkspaceSymbolParams][]string{
+				{Query: ""}: {
+					"/src/test/a/a.go:function:A:3:6",
+					"/src/test/b/b.go:function:B:8:6",
+					"/src/test/b/sub/s.go:variable:S:3:5",
+				},
+			},
+		},
+	},
+	"promoted interface methods": {
+		rootURI: "file:///src/test/pkg",
+		fs: map[string]string{
+			"a.go": "package p\n\ntype A interface{ M() }\n\ntype B interface{ A }\n\ntype C interface{ B }\n\ntype S struct{ C }\n\nfunc f(c C, s S) { c.M(); s.M() }\n",
+		},
+		cases: lspTestCases{
+			wantDefinition: map[string]string{
+				"a.go:11:22": "/src/test/pkg/a.go:3:19-3:20",
+				"a.go:11:29": "/src/test/pkg/a.go:3:19-3:20",
+			},
+			wantXDefinition: map[string]string{
+				"a.go:11:22": "/src/test/pkg/a.go:3:19 id:test/pkg/-/A/M name:M package:test/pkg packageName:p recv:A vendor:false",
+				"a.go:11:29": "/src/test/pkg/a.go:3:19 id:test/pkg/-/A/M name:M package:test/pkg packageName:p recv:A vendor:false",
+			},
+		},
+	},
+	"selectors chained through packages": {
+		rootURI: "file:///src/test/pkg",
+		fs: map[string]string{
+			"a.go":   "package p\n\nimport \"test/pkg/b\"\n\nvar _ = b.New().Inner().C\n",
+			"b/b.go": "package b\n\nimport \"test/pkg/c\"\n\ntype T struct{}\n\nfunc New() T { return T{} }\n\nfunc (T) Inner() c.U { return c.U{} }\n",
+			"c/c.go": "package c\n\ntype U struct{ C int }\n",
+		},
+		cases: lspTestCases{
+			wantDefinition: map[string]string{
+				"a.go:5:17": "/src/test/pkg/b/b.go:9:10-9:15",
+				"a.go:5:25": "/src/test/pkg/c/c.go:3:16-3:17",
+			},
+			wantXDefinition: map[string]string{
+				"a.go:5:17": "/src/test/pkg/b/b.go:9:10 id:test/pkg/b/-/T/Inner name:Inner package:test/pkg/b packageName:b recv:T vendor:false",
+				"a.go:5:25": "/src/test/pkg/c/c.go:3:16 id:test/pkg/c/-/U/C name:C package:test/pkg/c packageName:c recv:U vendor:false",
+			},
+		},
+	},
+	"iota constants across packages": {
+		rootURI: "file:///src/test/pkg",
+		fs: map[string]string{
+			"a.go":   "package p\n\nimport \"test/pkg/b\"\n\nvar _ = b.StatusA\nvar _ = b.StatusB\nvar _ = b.StatusC\n",
+			"b/b.go": "package b\n\ntype Status int\n\nconst (\n\tStatusA Status = iota\n\tStatusB\n\tStatusC\n)\n",
+		},
+		cases: lspTestCases{
+			wantDefinition: map[string]string{
+				"a.go:5:11": "/src/test/pkg/b/b.go:6:2-6:9",
+				"a.go:6:11": "/src/test/pkg/b/b.go:7:2-7:9",
+				"a.go:7:11": "/src/test/pkg/b/b.go:8:2-8:9",
+			},
+			wantXDefinition: map[string]string{
+				"a.go:6:11": "/src/test/pkg/b/b.go:7:2 id:test/pkg/b/-/StatusB name:StatusB package:test/pkg/b packageName:b recv: vendor:false",
+				"a.go:7:11": "/src/test/pkg/b/b.go:8:2 id:test/pkg/b/-/StatusC name:StatusC package:test/pkg/b packageName:b recv: vendor:false",
+			},
+		},
+	},
+	"anonymous struct fields": {
+		rootURI: "file:///src/test/pkg",
+		fs: map[string]string{
+			"a.go": "package p\n\nvar x struct{ Foo int }\n\nfunc f() int {\n\ty := struct{ Bar, Baz string }{Bar: \"b\"}\n\treturn x.Foo + len(y.Baz)\n}\n",
+		},
+		cases: lspTestCases{
+			wantDefinition: map[string]string{
+				"a.go:7:11": "/src/test/pkg/a.go:3:15-3:18",
+				"a.go:7:23": "/src/test/pkg/a.go:6:20-6:23",
+			},
+			wantXDefinition: map[string]string{
+				"a.go:7:11": "/src/test/pkg/a.go:3:15 ",
+				"a.go:7:23": "/src/test/pkg/a.go:6:20 ",
+				"a.go:6:33": "/src/test/pkg/a.go:6:15 ",
+			},
+		},
+	},
+	"shadowed definitions": {
+		rootURI: "file:///src/test/pkg",
+		fs: map[string]string{
+			"a.go": "package p\n\nvar x = 1\n\nfunc f() int {\n\tx := x + 1\n\tif x := 2; x > 0 {\n\t\treturn x\n\t}\n\treturn x\n}\n",
+		},
+		cases: lspTestCases{
+			wantDefinition: map[string]string{
+				"a.go:6:2":  "/src/test/pkg/a.go:6:2-6:3",
+				"a.go:6:7":  "/src/test/pkg/a.go:3:5-3:6",
+				"a.go:7:13": "/src/test/pkg/a.go:7:5-7:6",
+				"a.go:8:10": "/src/test/pkg/a.go:7:5-7:6",
+				"a.go:10:9": "/src/test/pkg/a.go:6:2-6:3",
+			},
+		},
+	},
+	"labels": {
+		rootURI: "file:///src/test/pkg",
+		fs: map[string]string{
+			"a.go": "package p\n\nfunc F() {\nouter:\n\tfor {\n\t\tfor {\n\t\t\tbreak outer\n\t\t}\n\t\tcontinue outer\n\t}\n\tgoto end\nend:\n}\n",
+		},
+		cases: lspTestCases{
+			wantDefinition: map[string]string{
+				"a.go:4:1":  "/src/test/pkg/a.go:4:1-4:6",
+				"a.go:7:10": "/src/test/pkg/a.go:4:1-4:6",
+				"a.go:9:12": "/src/test/pkg/a.go:4:1-4:6",
+				"a.go:11:7": "/src/test/pkg/a.go:12:1-12:4",
+			},
+			wantXDefinition: map[string]string{
+				"a.go:7:10": "/src/test/pkg/a.go:4:1 ",
+				"a.go:11:7": "/src/test/pkg/a.go:12:1 ",
+			},
+		},
+	},
+	"definitions not found": {
+		rootURI: "file:///src/test/pkg",
+		fs: map[string]string{
+			// The undeclared name is in a test file, so that the
+			// package still builds for godef.
+			"a.go":      "package p\n\n// Comment\nvar s = \"s\"\n",
+			"a_test.go": "package p\n\nvar x = y\n",
+		},
+		cases: lspTestCases{
+			wantDefinition: map[string]string{
+				"a.go:3:4":      "",
+				"a.go:4:10":     "",
+				"a_test.go:3:9": "not found: y",
+			},
+			wantTypeDefinition: map[string]string{
+				"a_test.go:3:9": "not found: y",
+			},
+			wantXDefinition: map[string]string{
+				"a.go:3:4":      "",
+				"a.go:4:10":     "",
+				"a_test.go:3:9": "not found: y",
+			},
+		},
+	},
+	"constant values": {
+		rootURI: "file:///src/test/pkg",
+		fs: map[string]string{
+			"a.go": "package p\n\ntype K int\n\nconst (\n\tA K = iota\n\tB\n\tC\n)\n\nconst (\n\tMaxInt = 1<<63 - 1\n\tS      = \"a\" + \"b\"\n\tF      = 1.0 / 4\n)\n\nvar _ = C\n",
+		},
+		cases: lspTestCases{
+			overrideGodefHover: map[string]string{
+				"a.go:8:2":  "const C",
+				"a.go:12:2": "const MaxInt = 1<<63 - 1",
+				"a.go:17:9": "const C",
+			},
+			wantHover: map[string]string{
+				"a.go:8:2":  "const C K = 2",
+				"a.go:12:2": "const MaxInt untyped int = 9223372036854775807",
+				"a.go:13:2": "const S untyped string = \"ab\"",
+				"a.go:14:2": "const F untyped float = 0.25",
+				"a.go:17:9": "const C K = 2",
+			},
+		},
+	},
+	"method expressions": {
+		rootURI: "file:///src/test/pkg",
+		fs: map[string]string{
+			"a.go":   "package p\n\ntype T struct{}\n\nfunc (T) V() {}\n\nfunc (*T) P() {}\n\ntype I interface{ M() }\n\nvar (\n\tv = T.V\n\tp = (*T).P\n\tm = I.M\n\tt T\n\tw = t.V\n\tx = t.P\n\ty = U.V\n\tz = (*U).P\n)\n\ntype U struct{ T }\n",
+			"b.go":   `package p; import "test/pkg/q"; var _ = (*q.Q).M`,
+			"q/q.go": "package q\n\ntype Q struct{}\n\nfunc (*Q) M() {}\n",
+		},
+		cases: lspTestCases{
+			wantDefinition: map[string]string{
+				"a.go:12:8":  "/src/test/pkg/a.go:5:10-5:11",
+				"a.go:13:11": "/src/test/pkg/a.go:7:11-7:12",
+				"a.go:14:8":  "/src/test/pkg/a.go:9:19-9:20",
+				"a.go:16:8":  "/src/test/pkg/a.go:5:10-5:11",
+				"a.go:17:8":  "/src/test/pkg/a.go:7:11-7:12",
+				"a.go:18:8":  "/src/test/pkg/a.go:5:10-5:11",
+				"a.go:19:11": "/src/test/pkg/a.go:7:11-7:12",
+				"b.go:1:48":  "/src/test/pkg/q/q.go:5:11-5:12",
+			},
+			wantXDefinition: map[string]string{
+				"a.go:12:8":  "/src/test/pkg/a.go:5:10 id:test/pkg/-/T/V name:V package:test/pkg packageName:p recv:T vendor:false",
+				"a.go:13:11": "/src/test/pkg/a.go:7:11 id:test/pkg/-/T/P name:P package:test/pkg packageName:p recv:T vendor:false",
+				"a.go:14:8":  "/src/test/pkg/a.go:9:19 id:test/pkg/-/I/M name:M package:test/pkg packageName:p recv:I vendor:false",
+				"a.go:16:8":  "/src/test/pkg/a.go:5:10 id:test/pkg/-/T/V name:V package:test/pkg packageName:p recv:T vendor:false",
+				"a.go:17:8":  "/src/test/pkg/a.go:7:11 id:test/pkg/-/T/P name:P package:test/pkg packageName:p recv:T vendor:false",
+				"a.go:18:8":  "/src/test/pkg/a.go:5:10 id:test/pkg/-/T/V name:V package:test/pkg packageName:p recv:T vendor:false",
+				"a.go:19:11": "/src/test/pkg/a.go:7:11 id:test/pkg/-/T/P name:P package:test/pkg packageName:p recv:T vendor:false",
+				"b.go:1:48":  "/src/test/pkg/q/q.go:5:11 id:test/pkg/q/-/Q/M name:M package:test/pkg/q packageName:q recv:Q vendor:false",
+			},
+		},
+	},
+	"type aliases": {
+		rootURI: "file:///src/test/pkg",
+		fs: map[string]string{
+			"a.go": "package p\n\ntype T struct{}\n\ntype A = T\n\ntype B = A\n\nvar v B\n\nvar w *B\n",
+		},
+		cases: lspTestCases{
+			wantDefinition: map[string]string{
+				"a.go:7:10": "/src/test/pkg/a.go:5:6-5:7",
+				"a.go:9:7":  "/src/test/pkg/a.go:7:6-7:7",
+			},
+			wantTypeDefinition: map[string]string{
+				"a.go:9:5":  "/src/test/pkg/a.go:7:6-7:7",
+				"a.go:11:5": "/src/test/pkg/a.go:7:6-7:7",
+			},
+		},
+	},
+	"follow type aliases": {
+		rootURI: "file:///src/test/pkg",
+		fs: map[string]string{
+			"a.go": "package p\n\ntype T struct{}\n\ntype A = T\n\ntype B = A\n\nvar v B\n\nvar w *B\n",
+		},
+		followTypeAliases: true,
+		cases: lspTestCases{
+			wantDefinition: map[string]string{
+				"a.go:7:10": "/src/test/pkg/a.go:3:6-3:7",
+				"a.go:9:7":  "/src/test/pkg/a.go:3:6-3:7",
+			},
+			wantXDefinition: map[string]string{
+				"a.go:9:7": "/src/test/pkg/a.go:3:6 id:test/pkg/-/T name:T package:test/pkg packageName:p recv: vendor:false",
+			},
+			wantTypeDefinition: map[string]string{
+				"a.go:9:5":  "/src/test/pkg/a.go:3:6-3:7",
+				"a.go:11:5": "/src/test/pkg/a.go:3:6-3:7",
+			},
+		},
+	},
+	"build tags": {
+		rootURI: "file:///src/test/pkg",
+		fs: map[string]string{
+			"a.go":     `package p; import "test/pkg/d"; var _ = B; var _ = d.D`,
+			"b.go":     "// +build custom\n\npackage p; var B int",
+			"c.go":     "// +build !custom\n\npackage p; var B string",
+			"d/d.go":   "// +build custom\n\npackage d; var D int",
+			"d/doc.go": "package d",
+		},
+		buildTags: []string{"custom"},
+		cases: lspTestCases{
+			overrideGodefHover: map[string]string{
+				"a.go:1:41": "var B int",
+				"a.go:1:54": "import \"test/pkg/d\"\nvar D int",
+			},
+			wantHover: map[string]string{
+				"a.go:1:41": "var B int",
+				"a.go:1:54": "import \"test/pkg/d\"\nvar D int",
+			},
+			wantDefinition: map[string]string{
+				"a.go:1:41": "/src/test/pkg/b.go:3:16-3:17",
+				"a.go:1:54": "/src/test/pkg/d/d.go:3:16-3:17",
+			},
+		},
+	},
+	"go nested vendored dep": {
+		rootURI: "file:///src/test/pkg",
+		fs: map[string]string{
+			"a.go":                                `package a; import "github.com/v/vendored"; var _ = vendored.V`,
+			"b/b.go":                              `package b; import "github.com/v/vendored"; var _ = vendored.V`,
+			"vendor/github.com/v/vendored/v.go":   "package vendored; func V() {}",
+			"b/vendor/github.com/v/vendored/v.go": "package vendored\n\nfunc V() {}",
+		},
+		mountFS: map[string]map[string]string{
+			"/src/github.com/v/vendored": {
+				"v.go": "package vendored\n\n\nfunc V() {}",
+			},
+		},
+		cases: lspTestCases{
+			wantDefinition: map[string]string{
+				"a.go:1:61":   "/src/test/pkg/vendor/github.com/v/vendored/v.go:1:24-1:25",
+				"b/b.go:1:61": "/src/test/pkg/b/vendor/github.com/v/vendored/v.go:3:6-3:7",
+				"a.go:1:40":   "/src/test/pkg/vendor/github.com/v/vendored/v.go:1:9-1:17",
+				"b/b.go:1:40": "/src/test/pkg/b/vendor/github.com/v/vendored/v.go:1:9-1:17",
+			},
+			wantXDefinition: map[string]string{
+				"a.go:1:61":   "/src/test/pkg/vendor/github.com/v/vendored/v.go:1:24 id:test/pkg/vendor/github.com/v/vendored/-/V name:V package:test/pkg/vendor/github.com/v/vendored packageName:vendored recv: vendor:true",
+				"b/b.go:1:61": "/src/test/pkg/b/vendor/github.com/v/vendored/v.go:3:6 id:test/pkg/b/vendor/github.com/v/vendored/-/V name:V package:test/pkg/b/vendor/github.com/v/vendored packageName:vendored recv: vendor:true",
+				"b/b.go:1:40": "/src/test/pkg/b/vendor/github.com/v/vendored/v.go:1:9 id:test/pkg/b/vendor/github.com/v/vendored name: package:test/pkg/b/vendor/github.com/v/vendored packageName:vendored recv: vendor:true",
+			},
+		},
+	},
+	"go external dep": {
+		rootURI: "file:///src/test/pkg",
+		fs: map[string]string{
+			"a.go": `package a; import "github.com/d/dep"; var _ = dep.D; var _ = dep.D`,
+		},
+		mountFS: map[string]map[string]string{
+			"/src/github.com/d/dep": {
+				"d.go": "package dep; func D() {}; var _ = D",
+			},
+		},
+		cases: lspTestCases{
+			wantHover: map[string]string{
+				"a.go:1:51": "import \"github.com/d/dep\"\nfunc D()",
+			},
+			wantDefinition: map[string]string{
+				"a.go:1:51": "/src/github.com/d/dep/d.go:1:19-1:20",
+			},
+			wantXDefinition: map[string]string{
+				"a.go:1:51": "/src/github.com/d/dep/d.go:1:19 id:github.com/d/dep/-/D name:D package:github.com/d/dep packageName:dep recv: vendor:false",
+			},
+			wantCompletion: map[string]string{
+				"a.go:1:34": "1:20-1:34 github.com/d/dep module ",
+				"a.go:1:51": "1:51-1:51 D function func()",
+			},
+			wantReferences: map[string][]string{
+				"a.go:1:51": []string{
+					"/src/test/pkg/a.go:1:51",
+					"/src/test/pkg/a.go:1:66",
+					// Do not include "refs" from the dependency
+					// package itself; only return results in the
+					// workspace.
+				},
+			},
+			wantWorkspaceReferences: map[*lspext.WorkspaceReferencesParams][]string{
+				{Query: lspext.SymbolDescriptor{}}: []string{
+					"/src/test/pkg/a.go:1:19-1:37 -> id:github.com/d/dep name: package:github.com/d/dep packageName:dep recv: vendor:false",
+					"/src/test/pkg/a.go:1:51-1:52 -> id:github.com/d/dep/-/D name:D package:github.com/d/dep packageName:dep recv: vendor:false",
+					"/src/test/pkg/a.go:1:66-1:67 -> id:github.com/d/dep/-/D name:D package:github.com/d/dep packageName:dep recv: vendor:false",
+				},
+			},
+		},
+	},
+	"external dep with vendor": {
+		rootURI: "file:///src/test/pkg",
+		fs: map[string]string{
+			"a.go": `package p; import "github.com/d/dep"; var _ = dep.D().F`,
+		},
+		mountFS: map[string]map[string]string{
+			"/src/github.com/d/dep": map[string]string{
+				"d.go":               `package dep; import "vendp"; func D() (v vendp.V) { return }`,
+				"vendor/vendp/vp.go": "package vendp; type V struct { F int }",
+			},
+		},
+		cases: lspTestCases{
+			wantDefinition: map[string]string{
+				"a.go:1:55": "/src/github.com/d/dep/vendor/vendp/vp.go:1:32-1:33",
+			},
+			wantXDefinition: map[string]string{
+				"a.go:1:55": "/src/github.com/d/dep/vendor/vendp/vp.go:1:32 id:github.com/d/dep/vendor/vendp/-/V/F name:F package:github.com/d/dep/vendor/vendp packageName:vendp recv:V vendor:true",
+			},
+			wantCompletion: map[string]string{
+				"a.go:1:55": "1:55-1:55 F variable int",
+			},
+			wantWorkspaceReferences: map[*lspext.WorkspaceReferencesParams][]string{
+				{Query: lspext.SymbolDescriptor{}}: []string{
+					"/src/test/pkg/a.go:1:19-1:37 -> id:github.com/d/dep name: package:github.com/d/dep packageName:dep recv: vendor:false",
+					"/src/test/pkg/a.go:1:55-1:56 -> id:github.com/d/dep/vendor/vendp/-/V/F name:F package:github.com/d/dep/vendor/vendp packageName:vendp recv:V vendor:true",
+					"/src/test/pkg/a.go:1:51-1:52 -> id:github.com/d/dep/-/D name:D package:github.com/d/dep packageName:dep recv: vendor:false",
+				},
+			},
+		},
+	},
+	"go external dep at subtree": {
+		rootURI: "file:///src/test/pkg",
+		fs: map[string]string{
+			"a.go": `package a; import "github.com/d/dep/subp"; var _ = subp.D`,
+		},
+		mountFS: map[string]map[string]string{
+			"/src/github.com/d/dep": {
+				"subp/d.go": "package subp; func D() {}",
+			},
+		},
+		cases: lspTestCases{
+			wantHover: map[string]string{
+				"a.go:1:57": "import \"github.com/d/dep/subp\"\nfunc D()",
+			},
+			wantDefinition: map[string]string{
+				"a.go:1:57": "/src/github.com/d/dep/subp/d.go:1:20-1:21",
+			},
+			wantXDefinition: map[string]string{
+				"a.go:1:57": "/src/github.com/d/dep/subp/d.go:1:20 id:github.com/d/dep/subp/-/D name:D package:github.com/d/dep/subp packageName:subp recv: vendor:false",
+			},
+			wantCompletion: map[string]string{
+				"a.go:1:34": "1:20-1:34 github.com/d/dep/subp module ",
+				"a.go:1:57": "1:57-1:57 D function func()",
+			},
+			wantWorkspaceReferences: map[*lspext.WorkspaceReferencesParams][]string{
+				{Query: lspext.SymbolDescriptor{}}: []string{
+					"/src/test/pkg/a.go:1:19-1:42 -> id:github.com/d/dep/subp name: package:github.com/d/dep/subp packageName:subp recv: vendor:false",
+					"/src/test/pkg/a.go:1:57-1:58 -> id:github.com/d/dep/subp/-/D name:D package:github.com/d/dep/subp packageName:subp recv: vendor:false",
+				},
+			},
+		},
+	},
+	"go nested external dep": { // a depends on dep1, dep1 depends on dep2
+		rootURI: "file:///src/test/pkg",
+		fs: map[string]string{
+			"a.go": `package a; import "github.com/d/dep1"; var _ = dep1.D1().D2`,
+		},
+		mountFS: map[string]map[string]string{
+			"/src/github.com/d/dep1": {
+				"d1.go": `package dep1; import "github.com/d/dep2"; func D1() dep2.D2 { return dep2.D2{} }`,
+			},
+			"/src/github.com/d/dep2": {
+				"d2.go": "package dep2; type D2 struct { D2 int }",
+			},
+		},
+		cases: lspTestCases{
+			overrideGodefHover: map[string]string{
+				"a.go:1:53": "import \"github.com/d/dep1\"\nfunc D1() dep2.D2",
+				"a.go:1:59": "import \"github.com/d/dep2\"\nstruct field D2 int",
+			},
+			wantHover: map[string]string{
+				"a.go:1:53": "import \"github.com/d/dep1\"\nfunc D1() D2",
+				"a.go:1:59": "import \"github.com/d/dep2\"\nstruct field D2 int",
+			},
+			wantDefinition: map[string]string{
+				"a.go:1:53": "/src/github.com/d/dep1/d1.go:1:48-1:50", // func D1
+				"a.go:1:58": "/src/github.com/d/dep2/d2.go:1:32-1:34", // field D2
+			},
+			wantXDefinition: map[string]string{
+				"a.go:1:53": "/src/github.com/d/dep1/d1.go:1:48 id:github.com/d/dep1/-/D1 name:D1 package:github.com/d/dep1 packageName:dep1 recv: vendor:false",
+				"a.go:1:58": "/src/github.com/d/dep2/d2.go:1:32 id:github.com/d/dep2/-/D2/D2 name:D2 package:github.com/d/dep2 packageName:dep2 recv:D2 vendor:false",
+			},
+			wantCompletion: map[string]string{
+				//"a.go:1:53": "1:53-1:53 D1 function func() D2", // gocode does not handle D2 correctly
+				"a.go:1:58": "1:58-1:58 D2 variable int",
+			},
+			wantWorkspaceReferences: map[*lspext.WorkspaceReferencesParams][]string{
+				{Query: lspext.SymbolDescriptor{}}: []string{
+					"/src/test/pkg/a.go:1:19-1:38 -> id:github.com/d/dep1 name: package:github.com/d/dep1 packageName:dep1 recv: vendor:false",
+					"/src/test/pkg/a.go:1:58-1:60 -> id:github.com/d/dep2/-/D2/D2 name:D2 package:github.com/d/dep2 packageName:dep2 recv:D2 vendor:false",
+					"/src/test/pkg/a.go:1:53-1:55 -> id:github.com/d/dep1/-/D1 name:D1 package:github.com/d/dep1 packageName:dep1 recv: vendor:false",
+				},
+			},
+		},
+	},
+	"go symbols": {
+		rootURI: "file:///src/test/pkg",
+		fs: map[string]string{
+			"abc.go": `package a
+
 type XYZ struct {}
 
 func (x XYZ) ABC() {}
@@ -785,196 +1511,813 @@ var (
 	A = 1
 )
 
-const (
-	B = 2
+const (
+	B = 2
+)
+
+type (
+	_ struct{}
+	C struct{}
+)
+
+type UVW interface {}
+
+type T string
+`,
+			"bcd.go": `package a
+
+type YZA struct {}
+
+func (y YZA) BCD() {}
+`,
+			"xyz.go": `package a
+
+func yza() {}
+`,
+		},
+		cases: lspTestCases{
+			wantSymbols: map[string][]string{
+				"abc.go": []string{"/src/test/pkg/abc.go:class:C:17:2", "/src/test/pkg/abc.go:class:T:22:6", "/src/test/pkg/abc.go:interface:UVW:20:6", "/src/test/pkg/abc.go:class:XYZ:3:6", "/src/test/pkg/abc.go:method:XYZ.ABC:5:14", "/src/test/pkg/abc.go:constant:B:12:2", "/src/test/pkg/abc.go:variable:A:8:2"},
+				"bcd.go": []string{"/src/test/pkg/bcd.go:class:YZA:3:6", "/src/test/pkg/bcd.go:method:YZA.BCD:5:14"},
+				"xyz.go": []string{"/src/test/pkg/xyz.go:function:yza:3:6"},
+			},
+			wantWorkspaceSymbols: map[*lspext.WorkspaceSymbolParams][]string{
+				{Query: ""}:            []string{"/src/test/pkg/abc.go:variable:A:8:2", "/src/test/pkg/abc.go:constant:B:12:2", "/src/test/pkg/abc.go:class:C:17:2", "/src/test/pkg/abc.go:class:T:22:6", "/src/test/pkg/abc.go:interface:UVW:20:6", "/src/test/pkg/abc.go:class:XYZ:3:6", "/src/test/pkg/bcd.go:class:YZA:3:6", "/src/test/pkg/xyz.go:function:yza:3:6", "/src/test/pkg/abc.go:method:XYZ.ABC:5:14", "/src/test/pkg/bcd.go:method:YZA.BCD:5:14"},
+				{Query: "xyz"}:         []string{"/src/test/pkg/abc.go:class:XYZ:3:6", "/src/test/pkg/abc.go:method:XYZ.ABC:5:14", "/src/test/pkg/xyz.go:function:yza:3:6"},
+				{Query: "yza"}:         []string{"/src/test/pkg/bcd.go:class:YZA:3:6", "/src/test/pkg/xyz.go:function:yza:3:6", "/src/test/pkg/bcd.go:method:YZA.BCD:5:14"},
+				{Query: "abc"}:         []string{"/src/test/pkg/abc.go:method:XYZ.ABC:5:14", "/src/test/pkg/abc.go:variable:A:8:2", "/src/test/pkg/abc.go:constant:B:12:2", "/src/test/pkg/abc.go:class:C:17:2", "/src/test/pkg/abc.go:class:T:22:6", "/src/test/pkg/abc.go:interface:UVW:20:6", "/src/test/pkg/abc.go:class:XYZ:3:6"},
+				{Query: "bcd"}:         []string{"/src/test/pkg/bcd.go:method:YZA.BCD:5:14", "/src/test/pkg/bcd.go:class:YZA:3:6"},
+				{Query: "is:exported"}: []string{"/src/test/pkg/abc.go:variable:A:8:2", "/src/test/pkg/abc.go:constant:B:12:2", "/src/test/pkg/abc.go:class:C:17:2", "/src/test/pkg/abc.go:class:T:22:6", "/src/test/pkg/abc.go:interface:UVW:20:6", "/src/test/pkg/abc.go:class:XYZ:3:6", "/src/test/pkg/bcd.go:class:YZA:3:6", "/src/test/pkg/abc.go:method:XYZ.ABC:5:14", "/src/test/pkg/bcd.go:method:YZA.BCD:5:14"},
+			},
+		},
+	},
+	"go hover docs": {
+		rootURI: "file:///src/test/pkg",
+		fs: map[string]string{
+			"a.go": `// Copyright 2015 someone.
+// Copyrights often span multiple lines.
+
+// Some additional non-package docs.
+
+// Package p is a package with lots of great things.
+package p
+
+import "github.com/a/pkg2"
+
+// logit is pkg2.X
+var logit = pkg2.X
+
+// T is a struct.
+type T struct {
+	// F is a string field.
+	F string
+
+	// H is a header.
+	H pkg2.Header
+}
+
+// Foo is the best string.
+var Foo string
+
+var (
+	// I1 is an int
+	I1 = 1
+
+	// I2 is an int
+	I2 = 3
+)
+`,
+			"vendor/github.com/a/pkg2/x.go": `// Package pkg2 shows dependencies.
+//
+// How to
+//
+// 	Example Code!
+//
+package pkg2
+
+// A comment that should be ignored
+
+// X does the unknown.
+func X() {
+	panic("zomg")
+}
+
+// Header is like an HTTP header, only better.
+type Header struct {
+	// F is a string, too.
+	F string
+}
+`,
+		},
+		cases: lspTestCases{
+			overrideGodefHover: map[string]string{
+				//"a.go:7:9": "package p; Package p is a package with lots of great things. \n\n", // TODO(slimsag): sub-optimal "no declaration found for p"
+				"a.go:9:9":   "package pkg2 (\"test/pkg/vendor/github.com/a/pkg2\"); Package pkg2 shows dependencies. \n\nHow to \n\n```\nExample Code!\n\n```\n",
+				"a.go:12:5":  "var logit = pkg2.X; logit is pkg2.X \n\n",
+				"a.go:12:13": "package pkg2 (\"test/pkg/vendor/github.com/a/pkg2\"); Package pkg2 shows dependencies. \n\nHow to \n\n```\nExample Code!\n\n```\n",
+				"a.go:12:18": "import \"github.com/a/pkg2\"\nfunc X(); X does the unknown. \n\n",
+				"a.go:15:6":  "type T struct; T is a struct. \n\n; struct {\n\t// F is a string field.\n\tF string\n\n\t// H is a header.\n\tH pkg2.Header\n}",
+				"a.go:17:2":  "struct field F string; F is a string field. \n\n",
+				"a.go:20:2":  "struct field H pkg2.Header; H is a header. \n\n",
+				"a.go:20:4":  "package pkg2 (\"test/pkg/vendor/github.com/a/pkg2\"); Package pkg2 shows dependencies. \n\nHow to \n\n```\nExample Code!\n\n```\n",
+				"a.go:24:5":  "var Foo string; Foo is the best string. \n\n",
+				"a.go:31:2":  "var I2 = 3; I2 is an int \n\n",
+			},
+			wantHover: map[string]string{
+				"a.go:7:9":   "package p; Package p is a package with lots of great things. \n\n",
+				"a.go:9:9":   "package pkg2 (\"test/pkg/vendor/github.com/a/pkg2\"); Package pkg2 shows dependencies. \n\nHow to \n\n```\nExample Code!\n\n```\n",
+				"a.go:12:5":  "var logit func(); logit is pkg2.X \n\n",
+				"a.go:12:13": "package pkg2 (\"test/pkg/vendor/github.com/a/pkg2\"); Package pkg2 shows dependencies. \n\nHow to \n\n```\nExample Code!\n\n```\n",
+				"a.go:12:18": "import \"github.com/a/pkg2\"\nfunc X(); X does the unknown. \n\n",
+				"a.go:15:6":  "type T struct; T is a struct. \n\n; struct {\n    F string\n    H Header\n}",
+				"a.go:17:2":  "struct field F string; F is a string field. \n\n",
+				"a.go:20:2":  "struct field H test/pkg/vendor/github.com/a/pkg2.Header; H is a header. \n\n",
+				"a.go:20:4":  "package pkg2 (\"test/pkg/vendor/github.com/a/pkg2\"); Package pkg2 shows dependencies. \n\nHow to \n\n```\nExample Code!\n\n```\n",
+				"a.go:24:5":  "var Foo string; Foo is the best string. \n\n",
+				"a.go:31:2":  "var I2 int; I2 is an int \n\n",
+			},
+		},
+	},
+	"hover on package names": {
+		rootURI: "file:///src/test/pkg",
+		fs: map[string]string{
+			"a.go":   "package p\n\nimport (\n\tqq \"test/pkg/q\"\n)\n\nvar _ = qq.Q\n",
+			"q/q.go": "// Package q is quiet.\npackage q\n\nvar Q int\n",
+		},
+		cases: lspTestCases{
+			overrideGodefHover: map[string]string{
+				"a.go:4:2":  "package q (\"test/pkg/q\"); Package q is quiet. \n\n",
+				"a.go:4:7":  "package q (\"test/pkg/q\"); Package q is quiet. \n\n",
+				"a.go:7:10": "package q (\"test/pkg/q\"); Package q is quiet. \n\n",
+			},
+			wantHover: map[string]string{
+				"a.go:4:2":  "package qq (\"test/pkg/q\"); Package q is quiet. \n\n",
+				"a.go:4:7":  "package q (\"test/pkg/q\"); Package q is quiet. \n\n",
+				"a.go:7:10": "package qq (\"test/pkg/q\"); Package q is quiet. \n\n",
+			},
+		},
+	},
+	"workspace references multiple files": {
+		rootURI: "file:///src/test/pkg",
+		fs: map[string]string{
+			"a.go": `package p; import "fmt"; var _ = fmt.Println; var x int`,
+			"b.go": `package p; import "fmt"; var _ = fmt.Println; var y int`,
+			"c.go": `package p; import "fmt"; var _ = fmt.Println; var z int`,
+		},
+		mountFS: map[string]map[string]string{
+			"/goroot": {
+				"src/fmt/print.go":       "package fmt; func Println(a ...interface{}) (n int, err error) { return }",
+				"src/builtin/builtin.go": "package builtin; type int int",
+			},
+		},
+		cases: lspTestCases{
+			wantWorkspaceReferences: map[*lspext.WorkspaceReferencesParams][]string{
+				{Query: lspext.SymbolDescriptor{}}: []string{
+					"/src/test/pkg/a.go:1:19-1:24 -> id:fmt name: package:fmt packageName:fmt recv: vendor:false",
+					"/src/test/pkg/a.go:1:38-1:45 -> id:fmt/-/Println name:Println package:fmt packageName:fmt recv: vendor:false",
+					"/src/test/pkg/b.go:1:19-1:24 -> id:fmt name: package:fmt packageName:fmt recv: vendor:false",
+					"/src/test/pkg/b.go:1:38-1:45 -> id:fmt/-/Println name:Println package:fmt packageName:fmt recv: vendor:false",
+					"/src/test/pkg/c.go:1:19-1:24 -> id:fmt name: package:fmt packageName:fmt recv: vendor:false",
+					"/src/test/pkg/c.go:1:38-1:45 -> id:fmt/-/Println name:Println package:fmt packageName:fmt recv: vendor:false",
+				},
+			},
+		},
+	},
+	"interfaces and implementations": {
+		rootURI: "file:///src/test/pkg",
+		fs: map[string]string{
+			"i0.go":    "package p; type I0 interface { M0() }",
+			"i1.go":    "package p; type I1 interface { M1() }",
+			"i2.go":    "package p; type I2 interface { M1(); M2() }",
+			"t0.go":    "package p; type T0 struct{}",
+			"t1.go":    "package p; type T1 struct {}; func (T1) M1() {}; func (T1) M3()",
+			"t1e.go":   "package p; type T1E struct { T1 }; var _ = (T1E{}).M1",
+			"t1p.go":   "package p; type T1P struct {}; func (*T1P) M1() {}",
+			"p2/p2.go": "package p2; type T2 struct{}; func (t2) M1() {}",
+		},
+		cases: lspTestCases{
+			wantImplementation: map[string][]string{
+				"i0.go:1:17": []string{}, // I0
+				"i0.go:1:32": []string{}, // (I0).M0
+				"i1.go:1:17": /* I1 */ []string{
+					"/src/test/pkg/i2.go:1:17:to",
+					"/src/test/pkg/t1.go:1:17:to",
+					"/src/test/pkg/t1e.go:1:17:to",
+					"/src/test/pkg/t1p.go:1:17:to",
+				},
+				"i1.go:1:32": /* I1.(M1)*/ []string{
+					"/src/test/pkg/i2.go:1:32:to:method",
+					"/src/test/pkg/t1.go:1:41:to:method",
+					"/src/test/pkg/t1p.go:1:44:to:method",
+				},
+				"i2.go:1:32":/* I2.(M1)*/ []string{"/src/test/pkg/i1.go:1:32:from:method"},
+				"i2.go:1:38":/* I2.(M2)*/ []string{},
+				"t0.go:1:17":/* T0 */ []string{},
+				"t1.go:1:17":/* T1 */ []string{"/src/test/pkg/i1.go:1:17:from"},
+				"t1.go:1:41":/* (T1).M1 */ []string{"/src/test/pkg/i1.go:1:32:from:method"},
+				"t1.go:1:59":/* (T1).M3 */ []string{},
+				"t1e.go:1:17":/* (T1E) */ []string{"/src/test/pkg/i1.go:1:17:from"},
+				"t1e.go:1:52":/* (T1E).M1 */ []string{"/src/test/pkg/i1.go:1:32:from:method"},
+				"t1p.go:1:17":/* T1P */ []string{"/src/test/pkg/i1.go:1:17:from:ptr"},
+				"t1p.go:1:44":/* (T1P).M1 */ []string{"/src/test/pkg/i1.go:1:32:from:method"},
+			},
+		},
+	},
+	"type definitions with long names": {
+		rootURI: "file:///src/test/pkg",
+		fs: map[string]string{
+			"a.go":   "package p\n\nimport \"test/pkg/q\"\n\ntype Server struct{}\n\nvar s *Server\n\nvar h q.Handler\n",
+			"q/q.go": "package q\n\ntype (\n\tHandler struct{}\n)\n",
+		},
+		cases: lspTestCases{
+			wantTypeDefinition: map[string]string{
+				"a.go:7:5": "/src/test/pkg/a.go:5:6-5:12",
+				"a.go:9:5": "/src/test/pkg/q/q.go:4:2-4:9",
+			},
+		},
+	},
+	"type definitions": {
+		rootURI: "file:///src/test/pkg",
+		fs: map[string]string{
+			"a.go": "package p; type T struct{}; var x T; var y *T; var z int; func F() T { return x }",
+			"b.go": "package p; var w = x",
+		},
+		cases: lspTestCases{
+			wantTypeDefinition: map[string]string{
+				"a.go:1:33": "/src/test/pkg/a.go:1:17-1:18",
+				"a.go:1:42": "/src/test/pkg/a.go:1:17-1:18",
+				"a.go:1:52": "",
+				"a.go:1:64": "",
+				"a.go:1:79": "/src/test/pkg/a.go:1:17-1:18",
+				"b.go:1:16": "/src/test/pkg/a.go:1:17-1:18",
+			},
+		},
+	},
+	"rename": {
+		rootURI: "file:///src/test/pkg",
+		fs: map[string]string{
+			"a.go":    "package p; type T struct{ F int }; func A() { x := 1; y := 2; _ = x + y; _ = T{F: x} }",
+			"b.go":    "package p; func B() { A(); _ = T{}.F; _ = len(\"\") }",
+			"p2/c.go": `package p2; import "test/pkg"; func C() { p.A() }`,
+			"p3/d.go": `package p3; import "test/pkg"; func D() int { return p.T{}.F }`,
+		},
+		cases: lspTestCases{
+			wantRename: map[string][]string{
+				"a.go:1:41 Z": []string{
+					"/src/test/pkg/a.go:1:41-1:42",
+					"/src/test/pkg/b.go:1:23-1:24",
+					"/src/test/pkg/p2/c.go:1:45-1:46",
+				},
+				"a.go:1:47 z": []string{
+					"/src/test/pkg/a.go:1:47-1:48",
+					"/src/test/pkg/a.go:1:67-1:68",
+					"/src/test/pkg/a.go:1:83-1:84",
+				},
+				"a.go:1:27 G": []string{
+					"/src/test/pkg/a.go:1:27-1:28",
+					"/src/test/pkg/a.go:1:80-1:81",
+					"/src/test/pkg/b.go:1:36-1:37",
+					"/src/test/pkg/p3/d.go:1:60-1:61",
+				},
+				"a.go:1:47 y":    []string{"error: renaming x to y conflicts with y at /src/test/pkg/a.go:1:55"},
+				"a.go:1:47 T":    []string{"error: renaming x to T conflicts with T at /src/test/pkg/a.go:1:17"},
+				"a.go:1:41 a":    []string{"error: renaming A to a would make it unexported, but it is used in /src/test/pkg/p2/c.go"},
+				"a.go:1:47 func": []string{`error: "func" is a keyword`},
+				"a.go:1:47 1x":   []string{`error: "1x" is not a valid Go identifier`},
+			},
+			wantPrepareRename: map[string]string{
+				"a.go:1:41":    "1:41-1:42",
+				"a.go:1:9":     "error: renaming packages is not supported",
+				"b.go:1:43":    "error: cannot rename builtin len",
+				"p2/c.go:1:43": "error: renaming imports is not supported",
+			},
+		},
+	},
+	"document highlights": {
+		rootURI: "file:///src/test/pkg",
+		fs: map[string]string{
+			"a.go": "package p; func A() { x := 1; x = 2; _ = x; x++ }",
+			"b.go": "package p; func B() { A(); A() }",
+		},
+		cases: lspTestCases{
+			wantHighlights: map[string][]string{
+				"a.go:1:17": []string{"1:17-1:18:write"},
+				"a.go:1:23": []string{"1:23-1:24:write", "1:31-1:32:write", "1:42-1:43:read", "1:45-1:46:write"},
+				"a.go:1:42": []string{"1:23-1:24:write", "1:31-1:32:write", "1:42-1:43:read", "1:45-1:46:write"},
+				"a.go:1:1":  []string{},
+				"b.go:1:23": []string{"1:23-1:24:read", "1:28-1:29:read"},
+			},
+		},
+	},
+	"hover falls back to godef": {
+		// b.go is ignored by the build, so it isn't typechecked with
+		// the package, but godef only needs to parse it.
+		rootURI:      "file:///src/test/pkg",
+		hoverBackend: hoverBackendTypecheck,
+		fs: map[string]string{
+			"a.go": "package p\n\nfunc A() {}\n",
+			"b.go": "//go:build ignore\n\npackage p\n\nfunc B() int { return 0 }\n\nvar _ = B()\n",
+		},
+		cases: lspTestCases{
+			overrideGodefHover: map[string]string{
+				"b.go:7:9": "func B() int",
+			},
+		},
+	},
+	"goimports formatting": {
+		rootURI:            "file:///src/test/pkg",
+		osFileSystemAccess: true,
+		fs: map[string]string{
+			"a.go": "package p\n\nimport (\n\tl \"test/local\"\n\t\"strings\"\n\ty \"github.com/x/y\"\n)\n\nfunc A() { fmt.Println(l.A, y.B) }\n",
+		},
+		cases: lspTestCases{
+			wantFormatting: map[string]string{
+				"a.go": "package p\n\nimport (\n\ty \"github.com/x/y\"\n\t\"strings\"\n\tl \"test/local\"\n)\n\nfunc A() { fmt.Println(l.A, y.B) }\n",
+			},
+			wantGoimportsFormatting: map[string]string{
+				"a.go": "package p\n\nimport (\n\t\"fmt\"\n\n\ty \"github.com/x/y\"\n\n\tl \"test/local\"\n)\n\nfunc A() { fmt.Println(l.A, y.B) }\n",
+			},
+		},
+	},
+	"goimports formatting without OS file system access": {
+		rootURI: "file:///src/test/pkg",
+		fs: map[string]string{
+			"a.go": "package p\n\nimport (\n\tl \"test/local\"\n\t\"strings\"\n)\n\nfunc A() { fmt.Println(l.A) }\n",
+		},
+		cases: lspTestCases{
+			wantGoimportsFormatting: map[string]string{
+				"a.go": "package p\n\nimport (\n\t\"strings\"\n\tl \"test/local\"\n)\n\nfunc A() { fmt.Println(l.A) }\n",
+			},
+			wantOrganizeImports: map[string]string{
+				"a.go": "",
+			},
+		},
+	},
+	"organize imports": {
+		rootURI:            "file:///src/test/pkg",
+		osFileSystemAccess: true,
+		fs: map[string]string{
+			"a.go": "package p\n\nimport \"os\"\n\nfunc A() { fmt.Println(1) }\n",
+			"b.go": "package p\n\nfunc B() { strings.TrimSpace( \"\" ) }\n",
+			"c.go": "package p\n\nimport (\n\t\"strings\"\n\t\"fmt\"\n)\n\nvar _ = fmt.Sprint(strings.TrimSpace( \"\" ))\n",
+			"d.go": "package p\n\nimport \"os\"\n",
+		},
+		cases: lspTestCases{
+			wantOrganizeImports: map[string]string{
+				"a.go": "1:10-3:12 \n\nimport \"fmt\"",
+				"b.go": "1:10-1:10 \n\nimport \"strings\"",
+				"c.go": "",
+				"d.go": "1:10-3:12 ",
+			},
+		},
+	},
+	"add import quick fixes": {
+		rootURI: "file:///src/test/pkg",
+		fs: map[string]string{
+			"a.go":                             "package p\n\nimport \"os\"\n\nvar _ = os.Args\n\nvar _ = template.New\n\nvar _ = q.X\n\nvar _ = nope.X\n",
+			"b.go":                             "package p\n\nvar _ = template.HTMLEscapeString\n",
+			"q/q.go":                           "package q\n\nvar X int\n",
+			"vendor/github.com/v/q/q.go":       "package q\n\nvar X int\n",
+			"vendor/github.com/v/nope/nope.go": "package other\n\nvar X int\n",
+		},
+		mountFS: map[string]map[string]string{
+			"/goroot": {
+				"src/text/template/t.go": "package template\n\nfunc New() {}\n",
+				"src/html/template/t.go": "package template\n\nfunc New() {}\n\nfunc HTMLEscapeString() {}\n",
+				"src/internal/q/q.go":    "package q\n\nvar X int\n",
+			},
+		},
+		cases: lspTestCases{
+			wantAddImportFixes: map[string][]string{
+				"a.go:7:9 template": []string{
+					"Add import for template: \"html/template\": 1:10-3:12 \n\nimport (\n\t\"html/template\"\n\t\"os\"\n)",
+					"Add import for template: \"text/template\": 1:10-3:12 \n\nimport (\n\t\"os\"\n\t\"text/template\"\n)",
+				},
+				"b.go:3:9 template": []string{
+					"Add import for template: \"html/template\": 1:10-1:10 \n\nimport \"html/template\"",
+				},
+				"a.go:9:9 q": []string{
+					"Add import for q: \"test/pkg/q\": 1:10-3:12 \n\nimport (\n\t\"os\"\n\t\"test/pkg/q\"\n)",
+					"Add import for q: \"github.com/v/q\": 1:10-3:12 \n\nimport (\n\t\"github.com/v/q\"\n\t\"os\"\n)",
+				},
+				"a.go:11:9 nope": []string{},
+			},
+		},
+	},
+	"implement interface code actions": {
+		rootURI: "file:///src/test/pkg",
+		fs: map[string]string{
+			"a.go":   "package p\n\nimport r \"test/pkg/q\"\n\ntype T struct{}\n\nfunc (t *T) Close() error { return nil }\n\nvar _ r.ReadCloser = (*T)(nil)\n\ntype U int\n\nvar _ interface{ M(x, y int) (n int, err error) } = U(0)\n\ntype V struct{}\n\nfunc (v *V) M() {}\n\nvar _ interface{ M(); N(v int) } = V{}\n",
+			"q/q.go": "package q\n\ntype Buf []byte\n\ntype Reader interface {\n\tRead(p Buf) (n int, err error)\n}\n\ntype ReadCloser interface {\n\tReader\n\tClose() error\n}\n",
+		},
+		cases: lspTestCases{
+			wantImplementInterface: map[string][]string{
+				"a.go:5:6": []string{
+					"Implement interface r.ReadCloser: 5:16-5:16 \n\nfunc (t *T) Read(p r.Buf) (n int, err error) {\n\tpanic(\"not implemented\")\n}",
+				},
+				"a.go:9:5": []string{
+					"Implement interface r.ReadCloser: 5:16-5:16 \n\nfunc (t *T) Read(p r.Buf) (n int, err error) {\n\tpanic(\"not implemented\")\n}",
+				},
+				"a.go:11:6": []string{
+					"Implement interface interface{M(x int, y int) (n int, err error)}: 11:11-11:11 \n\nfunc (u U) M(x int, y int) (n int, err error) {\n\tpanic(\"not implemented\")\n}",
+				},
+				"a.go:7:7": []string{},
+				// M is a method of *V, so only N is stubbed, and
+				// its parameter takes the receiver's name.
+				"a.go:15:6": []string{
+					"Implement interface interface{M(); N(v int)}: 15:16-15:16 \n\nfunc (V) N(v int) {\n\tpanic(\"not implemented\")\n}",
+				},
+			},
+		},
+	},
+	"range formatting": {
+		rootURI: "file:///src/test/pkg",
+		fs: map[string]string{
+			"a.go": "package p\n\nfunc A() {\n\tx:=1\n\tif x>0 {\n\t\tx ++\n\t}\n}\n\nfunc B()  {  }",
+		},
+		cases: lspTestCases{
+			wantRangeFormatting: map[string]string{
+				"a.go:4:3-4:4":    "4:1-5:1 \tx := 1\n",
+				"a.go:6:3-6:4":    "6:1-7:1 \t\tx++\n",
+				"a.go:4:2-6:2":    "4:1-8:1 \tx := 1\n\tif x > 0 {\n\t\tx++\n\t}\n",
+				"a.go:10:1-10:15": "10:1-10:15 func B() {}",
+				"a.go:1:1-1:8":    "",
+			},
+		},
+	},
+	"on type formatting": {
+		rootURI: "file:///src/test/pkg",
+		fs: map[string]string{
+			"a.go": "package p\n\nfunc A() {\n\tx:=1\n\n\tswitch x {\n\tcase 1:\n      y()\n\t\t}\n\ts := `\n  raw`\n}\n",
+			"b.go": "package p\n\nfunc B() {\n\tswitch {\n\t\tdefault:\n\t}\n}\n",
+		},
+		cases: lspTestCases{
+			wantOnTypeFormatting: map[string][]string{
+				"a.go:5:1 \n":  []string{"4:3-4:5  := ", "5:1-5:1 \t"},
+				"a.go:8:7 \n":  []string{"8:1-8:7 \t\t"},
+				"a.go:9:4 }":   []string{"9:2-9:3 "},
+				"a.go:11:1 \n": []string{},
+				"a.go:4:5 =":   []string{},
+				"a.go:12:2 }":  []string{},
+				"b.go:5:1 \n":  []string{"5:2-5:3 "},
+			},
+		},
+	},
+	"folding ranges": {
+		rootURI: "file:///src/test/pkg",
+		fs: map[string]string{
+			"a.go": `package p
+
+import (
+	"fmt"
+	"strings"
 )
 
-type (
-	_ struct{}
-	C struct{}
-)
+// A does
+// things.
+func A() {
+	fmt.Println(
+		strings.ToUpper("a"),
+	)
+	_ = []int{
+		1,
+	}
+}
 
-type UVW interface {}
+type T struct {
+	F int
+}
 
-type T string
+type I interface{ M() }
 `,
-			"bcd.go": `package a
+		},
+		cases: lspTestCases{
+			wantFoldingRanges: map[string][]string{
+				"a.go": []string{"2-4:imports", "7-8:comment", "9-15", "10-11", "13-14", "18-19"},
+			},
+		},
+	},
+	"code lenses": {
+		rootURI: "file:///src/test/pkg",
+		fs: map[string]string{
+			"a.go": "package p\n\nfunc f() {}\n",
+			"a_test.go": `package p
 
-type YZA struct {}
+import "testing"
 
-func (y YZA) BCD() {}
+func TestF(t *testing.T) {}
+
+func Testf(t *testing.T) {}
+
+func TestHelper(t *testing.T, n int) {}
+
+func BenchmarkF(b *testing.B) {}
+
+func Test(t *testing.T) {}
+
+func TestMain(m *testing.M) {}
 `,
-			"xyz.go": `package a
+			"x_test.go": "package p_test\n\nimport tt \"testing\"\n\nfunc TestX(t *tt.T) {}\n",
+		},
+		cases: lspTestCases{
+			wantCodeLenses: map[string][]string{
+				"a.go": []string{},
+				"a_test.go": []string{
+					"5:1-5:28 run test go.test.run [test/pkg TestF]",
+					"11:1-11:33 run benchmark go.benchmark.run [test/pkg BenchmarkF]",
+					"13:1-13:27 run test go.test.run [test/pkg Test]",
+				},
+				"x_test.go": []string{
+					"5:1-5:23 run test go.test.run [test/pkg TestX]",
+				},
+			},
+		},
+	},
+	"reference code lenses": {
+		rootURI: "file:///src/test/pkg",
+		fs: map[string]string{
+			"a.go":   "package p\n\nfunc F() {}\n\ntype T struct{}\n\nfunc (T) M() {}\n\nfunc f() {}\n\nvar _ = F\n",
+			"b.go":   "package p\n\nfunc G() { F(); var t T; t.M() }\n",
+			"q/q.go": "package q\n\nimport \"test/pkg\"\n\nvar _ p.T = p.T{}\n",
+		},
+		cases: lspTestCases{
+			wantCodeLenses: map[string][]string{
+				"a.go": []string{
+					"3:6-3:7 unresolved",
+					"5:6-5:7 unresolved",
+					"7:10-7:11 unresolved",
+				},
+			},
+			wantResolvedCodeLenses: map[string][]string{
+				"a.go": []string{
+					"3:6-3:7 2 references go.references.show [file:///src/test/pkg/a.go map[character:5 line:2]]",
+					"5:6-5:7 4 references go.references.show [file:///src/test/pkg/a.go map[character:5 line:4]]",
+					"7:10-7:11 1 reference go.references.show [file:///src/test/pkg/a.go map[character:9 line:6]]",
+				},
+				"b.go": []string{
+					"3:6-3:7 0 references go.references.show [file:///src/test/pkg/b.go map[character:5 line:2]]",
+				},
+			},
+		},
+	},
+	"document links": {
+		rootURI: "file:///src/test/pkg",
+		fs: map[string]string{
+			"a.go": `package p
 
-func yza() {}
+import (
+	"fmt"
+	str "strings"
+
+	"./rel"
+	"test/pkg/q"
+)
+
+var _, _, _ = fmt.Println, str.ToUpper, q.X
 `,
+			"q/q.go": "package q; var X int",
 		},
 		cases: lspTestCases{
-			wantSymbols: map[string][]string{
-				"abc.go": []string{"/src/test/pkg/abc.go:class:C:17:2", "/src/test/pkg/abc.go:class:T:22:6", "/src/test/pkg/abc.go:interface:UVW:20:6", "/src/test/pkg/abc.go:class:XYZ:3:6", "/src/test/pkg/abc.go:method:XYZ.ABC:5:14", "/src/test/pkg/abc.go:constant:B:12:2", "/src/test/pkg/abc.go:variable:A:8:2"},
-				"bcd.go": []string{"/src/test/pkg/bcd.go:class:YZA:3:6", "/src/test/pkg/bcd.go:method:YZA.BCD:5:14"},
-				"xyz.go": []string{"/src/test/pkg/xyz.go:function:yza:3:6"},
+			wantDocumentLinks: map[string][]string{
+				"a.go": []string{
+					"4:3-4:6 https://pkg.go.dev/fmt",
+					"5:7-5:14 https://pkg.go.dev/strings",
+					"8:3-8:13 https://pkg.go.dev/test/pkg/q",
+				},
+				"q/q.go": []string{},
 			},
-			wantWorkspaceSymbols: map[*lspext.WorkspaceSymbolParams][]string{
-				{Query: ""}:            []string{"/src/test/pkg/abc.go:variable:A:8:2", "/src/test/pkg/abc.go:constant:B:12:2", "/src/test/pkg/abc.go:class:C:17:2", "/src/test/pkg/abc.go:class:T:22:6", "/src/test/pkg/abc.go:interface:UVW:20:6", "/src/test/pkg/abc.go:class:XYZ:3:6", "/src/test/pkg/bcd.go:class:YZA:3:6", "/src/test/pkg/xyz.go:function:yza:3:6", "/src/test/pkg/abc.go:method:XYZ.ABC:5:14", "/src/test/pkg/bcd.go:method:YZA.BCD:5:14"},
-				{Query: "xyz"}:         []string{"/src/test/pkg/abc.go:class:XYZ:3:6", "/src/test/pkg/abc.go:method:XYZ.ABC:5:14", "/src/test/pkg/xyz.go:function:yza:3:6"},
-				{Query: "yza"}:         []string{"/src/test/pkg/bcd.go:class:YZA:3:6", "/src/test/pkg/xyz.go:function:yza:3:6", "/src/test/pkg/bcd.go:method:YZA.BCD:5:14"},
-				{Query: "abc"}:         []string{"/src/test/pkg/abc.go:method:XYZ.ABC:5:14", "/src/test/pkg/abc.go:variable:A:8:2", "/src/test/pkg/abc.go:constant:B:12:2", "/src/test/pkg/abc.go:class:C:17:2", "/src/test/pkg/abc.go:class:T:22:6", "/src/test/pkg/abc.go:interface:UVW:20:6", "/src/test/pkg/abc.go:class:XYZ:3:6"},
-				{Query: "bcd"}:         []string{"/src/test/pkg/bcd.go:method:YZA.BCD:5:14", "/src/test/pkg/bcd.go:class:YZA:3:6"},
-				{Query: "is:exported"}: []string{"/src/test/pkg/abc.go:variable:A:8:2", "/src/test/pkg/abc.go:constant:B:12:2", "/src/test/pkg/abc.go:class:C:17:2", "/src/test/pkg/abc.go:class:T:22:6", "/src/test/pkg/abc.go:interface:UVW:20:6", "/src/test/pkg/abc.go:class:XYZ:3:6", "/src/test/pkg/bcd.go:class:YZA:3:6", "/src/test/pkg/abc.go:method:XYZ.ABC:5:14", "/src/test/pkg/bcd.go:method:YZA.BCD:5:14"},
+		},
+	},
+	"ambiguous selectors": {
+		rootURI: "file:///src/test/pkg",
+		fs: map[string]string{
+			"a.go": `package p
+
+type A struct{ X int }
+
+func (A) M() {}
+
+type B struct{ X int }
+
+type I interface{ M() }
+
+type C struct {
+	A
+	*B
+	I
+}
+
+type D struct{ A }
+
+var _ = C{}.X
+var _ = C{}.M
+var _ = D{}.X
+`,
+		},
+		cases: lspTestCases{
+			wantXDefinition: map[string]string{
+				"a.go:19:13": "/src/test/pkg/a.go:3:16 , /src/test/pkg/a.go:7:16 ",
+				"a.go:20:13": "/src/test/pkg/a.go:5:10 , /src/test/pkg/a.go:9:19 ",
+				"a.go:21:13": "/src/test/pkg/a.go:3:16 id:test/pkg/-/A/X name:X package:test/pkg packageName:p recv:A vendor:false",
 			},
 		},
 	},
-	"go hover docs": {
+	"generics definitions": {
 		rootURI: "file:///src/test/pkg",
 		fs: map[string]string{
-			"a.go": `// Copyright 2015 someone.
-// Copyrights often span multiple lines.
+			"a.go": `package p
 
-// Some additional non-package docs.
+type Number interface{ ~int | ~float64 }
 
-// Package p is a package with lots of great things.
-package p
+func Map[T any, U Number](xs []T, f func(T) U) []U { return nil }
 
-import "github.com/a/pkg2"
+type List[T Number] struct{ v T }
 
-// logit is pkg2.X
-var logit = pkg2.X
+func (l List[T]) Get() T { return l.v }
+
+var _ = Map[int, int](nil, nil)
+
+var _ = List[int]{}.Get
+`,
+		},
+		cases: lspTestCases{
+			wantXDefinition: map[string]string{
+				"a.go:11:9":  "/src/test/pkg/a.go:5:6 id:test/pkg/-/Map name:Map package:test/pkg packageName:p recv: vendor:false",
+				"a.go:11:16": "/src/test/pkg/a.go:5:6 id:test/pkg/-/Map name:Map package:test/pkg packageName:p recv: vendor:false",
+				"a.go:13:13": "/src/test/pkg/a.go:7:6 id:test/pkg/-/List name:List package:test/pkg packageName:p recv: vendor:false",
+				"a.go:5:42":  "/src/test/pkg/a.go:5:10 ",
+				"a.go:5:19":  "/src/test/pkg/a.go:3:6 id:test/pkg/-/Number name:Number package:test/pkg packageName:p recv: vendor:false",
+				"a.go:5:45":  "/src/test/pkg/a.go:5:17 , /src/test/pkg/a.go:3:6 id:test/pkg/-/Number name:Number package:test/pkg packageName:p recv: vendor:false",
+				"a.go:7:31":  "/src/test/pkg/a.go:7:11 , /src/test/pkg/a.go:3:6 id:test/pkg/-/Number name:Number package:test/pkg packageName:p recv: vendor:false",
+			},
+		},
+	},
+	"struct tags": {
+		rootURI: "file:///src/test/pkg",
+		fs: map[string]string{
+			"a.go": `package p
 
-// T is a struct.
 type T struct {
-	// F is a string field.
-	F string
+	A, B int   ` + "`json:\"a\"`" + `
+	C    string
+	D    int ` + "`json:\"d,omitempty\"`" + `
+	T2   ` + "`json:\"t2\"`" + `
+}
+
+type T2 struct{}
+`,
+		},
+		cases: lspTestCases{
+			wantDefinition: map[string]string{
+				"a.go:4:16": "/src/test/pkg/a.go:4:2-4:3",
+				"a.go:6:20": "/src/test/pkg/a.go:6:2-6:3",
+				"a.go:7:9":  "",
+			},
+			wantXDefinition: map[string]string{
+				"a.go:6:20": "/src/test/pkg/a.go:6:2 id:test/pkg/-/T/D name:D package:test/pkg packageName:p recv:T vendor:false",
+			},
+		},
+	},
+	"call hierarchy": {
+		rootURI: "file:///src/test/pkg",
+		fs: map[string]string{
+			"a.go": `package p
+
+import "test/pkg/q"
 
-	// H is a header.
-	H pkg2.Header
-}
+type T struct{}
 
-// Foo is the best string.
-var Foo string
+func (*T) M() { F() }
 
-var (
-	// I1 is an int
-	I1 = 1
+func F() {
+	q.G()
+	g := func() { q.G() }
+	g()
+	var i q.I
+	i.N()
+	(q.G)()
+}
 
-	// I2 is an int
-	I2 = 3
-)
+var _ = F
 `,
-			"vendor/github.com/a/pkg2/x.go": `// Package pkg2 shows dependencies.
-//
-// How to
-//
-// 	Example Code!
-//
-package pkg2
-
-// A comment that should be ignored
+			"b.go": `package p
 
-// X does the unknown.
-func X() {
-	panic("zomg")
+func H() {
+	F()
+	new(T).M()
+	F()
 }
+`,
+			"q/q.go": `package q
 
-// Header is like an HTTP header, only better.
-type Header struct {
-	// F is a string, too.
-	F string
+type I interface {
+	N()
 }
+
+func G() {}
 `,
 		},
 		cases: lspTestCases{
-			overrideGodefHover: map[string]string{
-				//"a.go:7:9": "package p; Package p is a package with lots of great things. \n\n", // TODO(slimsag): sub-optimal "no declaration found for p"
-				//"a.go:9:9": "", TODO: handle hovering on import statements (ast.BasicLit)
-				"a.go:12:5":  "var logit = pkg2.X; logit is pkg2.X \n\n",
-				"a.go:12:13": "package pkg2 (\"test/pkg/vendor/github.com/a/pkg2\"); Package pkg2 shows dependencies. \n\nHow to \n\n```\nExample Code!\n\n```\n",
-				"a.go:12:18": "func X(); X does the unknown. \n\n",
-				"a.go:15:6":  "type T struct; T is a struct. \n\n; struct {\n\t// F is a string field.\n\tF string\n\n\t// H is a header.\n\tH pkg2.Header\n}",
-				"a.go:17:2":  "struct field F string; F is a string field. \n\n",
-				"a.go:20:2":  "struct field H pkg2.Header; H is a header. \n\n",
-				"a.go:20:4":  "package pkg2 (\"test/pkg/vendor/github.com/a/pkg2\"); Package pkg2 shows dependencies. \n\nHow to \n\n```\nExample Code!\n\n```\n",
-				"a.go:24:5":  "var Foo string; Foo is the best string. \n\n",
-				"a.go:31:2":  "var I2 = 3; I2 is an int \n\n",
+			wantPrepareCallHierarchy: map[string]string{
+				"a.go:7:11":   "M p.(*T) Method /src/test/pkg/a.go:7:1-7:22 7:11-7:12",
+				"a.go:9:6":    "F p Function /src/test/pkg/a.go:9:1-16:2 9:6-9:7",
+				"b.go:4:2":    "F p Function /src/test/pkg/a.go:9:1-16:2 9:6-9:7",
+				"a.go:14:4":   "N q.I Method /src/test/pkg/q/q.go:4:2-4:5 4:2-4:3",
+				"a.go:12:2":   "",
+				"a.go:5:6":    "",
+				"q/q.go:7:11": "",
 			},
-			wantHover: map[string]string{
-				"a.go:7:9": "package p; Package p is a package with lots of great things. \n\n",
-				//"a.go:9:9": "", TODO: handle hovering on import statements (ast.BasicLit)
-				"a.go:12:5":  "var logit func(); logit is pkg2.X \n\n",
-				"a.go:12:13": "package pkg2 (\"test/pkg/vendor/github.com/a/pkg2\"); Package pkg2 shows dependencies. \n\nHow to \n\n```\nExample Code!\n\n```\n",
-				"a.go:12:18": "func X(); X does the unknown. \n\n",
-				"a.go:15:6":  "type T struct; T is a struct. \n\n; struct {\n    F string\n    H Header\n}",
-				"a.go:17:2":  "struct field F string; F is a string field. \n\n",
-				"a.go:20:2":  "struct field H test/pkg/vendor/github.com/a/pkg2.Header; H is a header. \n\n",
-				"a.go:20:4":  "package pkg2 (\"test/pkg/vendor/github.com/a/pkg2\"); Package pkg2 shows dependencies. \n\nHow to \n\n```\nExample Code!\n\n```\n",
-				"a.go:24:5":  "var Foo string; Foo is the best string. \n\n",
-				"a.go:31:2":  "var I2 int; I2 is an int \n\n",
+			wantIncomingCalls: map[string][]string{
+				"a.go:9:6": []string{
+					"M p.(*T) Method /src/test/pkg/a.go:7:1-7:22 7:11-7:12 from 7:17-7:18",
+					"H p Function /src/test/pkg/b.go:3:1-7:2 3:6-3:7 from 4:2-4:3, 6:2-6:3",
+				},
+				"q/q.go:7:6": []string{
+					"F p Function /src/test/pkg/a.go:9:1-16:2 9:6-9:7 from 10:4-10:5, 11:18-11:19, 15:5-15:6",
+				},
+				"a.go:7:11": []string{
+					"H p Function /src/test/pkg/b.go:3:1-7:2 3:6-3:7 from 5:9-5:10",
+				},
+				"b.go:3:6": []string{},
+			},
+			wantOutgoingCalls: map[string][]string{
+				"a.go:9:6": []string{
+					"G q Function /src/test/pkg/q/q.go:7:1-7:12 7:6-7:7 from 10:4-10:5, 11:18-11:19, 15:5-15:6",
+					"N q.I Method /src/test/pkg/q/q.go:4:2-4:5 4:2-4:3 from 14:4-14:5",
+				},
+				"b.go:3:6": []string{
+					"F p Function /src/test/pkg/a.go:9:1-16:2 9:6-9:7 from 4:2-4:3, 6:2-6:3",
+					"M p.(*T) Method /src/test/pkg/a.go:7:1-7:22 7:11-7:12 from 5:9-5:10",
+				},
+				"q/q.go:7:6": []string{},
 			},
 		},
 	},
-	"workspace references multiple files": {
+	"semantic tokens": {
 		rootURI: "file:///src/test/pkg",
 		fs: map[string]string{
-			"a.go": `package p; import "fmt"; var _ = fmt.Println; var x int`,
-			"b.go": `package p; import "fmt"; var _ = fmt.Println; var y int`,
-			"c.go": `package p; import "fmt"; var _ = fmt.Println; var z int`,
-		},
-		mountFS: map[string]map[string]string{
-			"/goroot": {
-				"src/fmt/print.go":       "package fmt; func Println(a ...interface{}) (n int, err error) { return }",
-				"src/builtin/builtin.go": "package builtin; type int int",
-			},
+			"a.go": `package p
+
+import "test/pkg/q"
+
+const C = 1
+
+var V T
+
+type T struct{ F int }
+
+func (t *T) M(x int) (y int) {
+	v := t.F + x + C
+	q.F(v, nil, len("a"))
+	return v
+}
+`,
+			"q/q.go": "package q; func F(...interface{}) {}",
 		},
 		cases: lspTestCases{
-			wantWorkspaceReferences: map[*lspext.WorkspaceReferencesParams][]string{
-				{Query: lspext.SymbolDescriptor{}}: []string{
-					"/src/test/pkg/a.go:1:19-1:24 -> id:fmt name: package:fmt packageName:fmt recv: vendor:false",
-					"/src/test/pkg/a.go:1:38-1:45 -> id:fmt/-/Println name:Println package:fmt packageName:fmt recv: vendor:false",
-					"/src/test/pkg/b.go:1:19-1:24 -> id:fmt name: package:fmt packageName:fmt recv: vendor:false",
-					"/src/test/pkg/b.go:1:38-1:45 -> id:fmt/-/Println name:Println package:fmt packageName:fmt recv: vendor:false",
-					"/src/test/pkg/c.go:1:19-1:24 -> id:fmt name: package:fmt packageName:fmt recv: vendor:false",
-					"/src/test/pkg/c.go:1:38-1:45 -> id:fmt/-/Println name:Println package:fmt packageName:fmt recv: vendor:false",
+			wantSemanticTokens: map[string][]string{
+				"a.go": []string{
+					"1:1-7 keyword", "1:9-1 namespace",
+					"3:1-6 keyword",
+					"5:1-5 keyword", "5:7-1 variable declaration readonly static",
+					"7:1-3 keyword", "7:5-1 variable declaration static", "7:7-1 type",
+					"9:1-4 keyword", "9:6-1 type declaration", "9:8-6 keyword", "9:16-1 property declaration", "9:18-3 type",
+					"11:1-4 keyword", "11:7-1 parameter declaration", "11:10-1 type", "11:13-1 method declaration", "11:15-1 parameter declaration", "11:17-3 type", "11:23-1 parameter declaration", "11:25-3 type",
+					"12:2-1 variable declaration", "12:7-1 parameter", "12:9-1 property", "12:13-1 parameter", "12:17-1 variable readonly static",
+					"13:2-1 namespace", "13:4-1 function", "13:6-1 variable", "13:9-3 variable readonly", "13:14-3 function",
+					"14:2-6 keyword", "14:9-1 variable",
 				},
 			},
 		},
 	},
-	"interfaces and implementations": {
+	"interfaces and implementations across packages": {
 		rootURI: "file:///src/test/pkg",
 		fs: map[string]string{
-			"i0.go":    "package p; type I0 interface { M0() }",
-			"i1.go":    "package p; type I1 interface { M1() }",
-			"i2.go":    "package p; type I2 interface { M1(); M2() }",
-			"t0.go":    "package p; type T0 struct{}",
-			"t1.go":    "package p; type T1 struct {}; func (T1) M1() {}; func (T1) M3()",
-			"t1e.go":   "package p; type T1E struct { T1 }; var _ = (T1E{}).M1",
-			"t1p.go":   "package p; type T1P struct {}; func (*T1P) M1() {}",
-			"p2/p2.go": "package p2; type T2 struct{}; func (t2) M1() {}",
+			"i.go":    "package p; type I interface { M() }; type IE interface { I }",
+			"p2/t.go": `package p2; import "test/pkg"; type T struct{}; func (T) M() {}; var _ p.I = T{}`,
 		},
 		cases: lspTestCases{
 			wantImplementation: map[string][]string{
-				"i0.go:1:17": []string{}, // I0
-				"i0.go:1:32": []string{}, // (I0).M0
-				"i1.go:1:17": /* I1 */ []string{
-					"/src/test/pkg/i2.go:1:17:to",
-					"/src/test/pkg/t1.go:1:17:to",
-					"/src/test/pkg/t1e.go:1:17:to",
-					"/src/test/pkg/t1p.go:1:17:to",
+				"i.go:1:17": /* I */ []string{
+					"/src/test/pkg/i.go:1:43:from",
+					"/src/test/pkg/i.go:1:43:to",
+					"/src/test/pkg/p2/t.go:1:37:to",
 				},
-				"i1.go:1:32": /* I1.(M1)*/ []string{
-					"/src/test/pkg/i2.go:1:32:to:method",
-					"/src/test/pkg/t1.go:1:41:to:method",
-					"/src/test/pkg/t1p.go:1:44:to:method",
+				"i.go:1:31": /* (I).M */ []string{
+					"/src/test/pkg/p2/t.go:1:58:to:method",
+				},
+				"i.go:1:43": /* IE */ []string{
+					"/src/test/pkg/i.go:1:17:from",
+					"/src/test/pkg/i.go:1:17:to",
+					"/src/test/pkg/p2/t.go:1:37:to",
+				},
+				"p2/t.go:1:37": /* T */ []string{
+					"/src/test/pkg/i.go:1:17:from",
+					"/src/test/pkg/i.go:1:43:from",
+				},
+				"p2/t.go:1:58": /* (T).M */ []string{
+					"/src/test/pkg/i.go:1:31:from:method",
 				},
-				"i2.go:1:32":/* I2.(M1)*/ []string{"/src/test/pkg/i1.go:1:32:from:method"},
-				"i2.go:1:38":/* I2.(M2)*/ []string{},
-				"t0.go:1:17":/* T0 */ []string{},
-				"t1.go:1:17":/* T1 */ []string{"/src/test/pkg/i1.go:1:17:from"},
-				"t1.go:1:41":/* (T1).M1 */ []string{"/src/test/pkg/i1.go:1:32:from:method"},
-				"t1.go:1:59":/* (T1).M3 */ []string{},
-				"t1e.go:1:17":/* (T1E) */ []string{"/src/test/pkg/i1.go:1:17:from"},
-				"t1e.go:1:52":/* (T1E).M1 */ []string{"/src/test/pkg/i1.go:1:32:from:method"},
-				"t1p.go:1:17":/* T1P */ []string{"/src/test/pkg/i1.go:1:17:from:ptr"},
-				"t1p.go:1:44":/* (T1P).M1 */ []string{"/src/test/pkg/i1.go:1:32:from:method"},
 			},
 		},
 	},
@@ -994,8 +2337,12 @@ type Header struct {
 				// Comments for C
 				func C(x int, y int) int {
 					return x+y
-				}`,
+				}
+
+				// Comments for D
+				func D(format string, args ...int) {}`,
 			"b.go": "package p; func main() { B(); A(); A(0,); A(0); C(1,2) }",
+			"c.go": `package p; func _() { D("a,b", (1), C(1, 2), 3, 4) }`,
 		},
 		cases: lspTestCases{
 			wantSignatures: map[string]string{
@@ -1006,6 +2353,11 @@ type Header struct {
 				"b.go:1:51": "func(x int, y int) int Comments for C\n 0",
 				"b.go:1:53": "func(x int, y int) int Comments for C\n 1",
 				"b.go:1:54": "func(x int, y int) int Comments for C\n 1",
+				"c.go:1:28": "func(format string, args ...int) Comments for D\n 0",
+				"c.go:1:34": "func(format string, args ...int) Comments for D\n 1",
+				"c.go:1:41": "func(x int, y int) int Comments for C\n 1",
+				"c.go:1:46": "func(format string, args ...int) Comments for D\n 1",
+				"c.go:1:49": "func(format string, args ...int) Comments for D\n 1",
 			},
 		},
 	},
@@ -1105,6 +2457,13 @@ func TestServer(t *testing.T) {
 			cfg := NewDefaultConfig()
 			cfg.FuncSnippetEnabled = true
 			cfg.GocodeCompletionEnabled = true
+			cfg.BuildTags = test.buildTags
+			cfg.FollowTypeAliases = test.followTypeAliases
+			cfg.MaxReferenceResults = test.maxReferences
+			cfg.HoverBackend = test.hoverBackend
+			if test.symbolScope != "" {
+				cfg.SymbolScope = test.symbolScope
+			}
 
 			h := &LangHandler{
 				Config:        cfg,
@@ -1126,12 +2485,17 @@ func TestServer(t *testing.T) {
 			ctx := context.Background()
 			tdCap := lsp.TextDocumentClientCapabilities{}
 			tdCap.Completion.CompletionItemKind.ValueSet = []lsp.CompletionItemKind{lsp.CIKConstant}
+			var folders []lsp.WorkspaceFolder
+			for _, uri := range test.workspaceFolders {
+				folders = append(folders, lsp.WorkspaceFolder{URI: uri, Name: path.Base(string(uri))})
+			}
 			if err := conn.Call(ctx, "initialize", InitializeParams{
 				InitializeParams: lsp.InitializeParams{
-					RootURI:      test.rootURI,
-					Capabilities: lsp.ClientCapabilities{TextDocument: tdCap},
+					RootURI:          test.rootURI,
+					Capabilities:     lsp.ClientCapabilities{TextDocument: tdCap},
+					WorkspaceFolders: folders,
 				},
-				NoOSFileSystemAccess: true,
+				NoOSFileSystemAccess: !test.osFileSystemAccess,
 				RootImportPath:       strings.TrimPrefix(rootFSPath, "/src/"),
 				BuildContext: &InitializeBuildContextParams{
 					GOOS:     "linux",
@@ -1204,16 +2568,43 @@ func dialServer(t testing.TB, addr string) *jsonrpc2.Conn {
 
 type lspTestCases struct {
 	wantHover, overrideGodefHover           map[string]string
+	wantMarkdownHover                       map[string]string
+	wantHoverRange                          map[string]string
 	wantDefinition, overrideGodefDefinition map[string]string
+	wantTypeDefinition                      map[string]string
 	wantXDefinition                         map[string]string
 	wantCompletion                          map[string]string
+	wantTypecheckCompletion                 map[string]string
 	wantReferences                          map[string][]string
+	wantReferencesWithoutDecl               map[string][]string
 	wantImplementation                      map[string][]string
+	wantHighlights                          map[string][]string
+	wantRename                              map[string][]string
+	wantPrepareRename                       map[string]string
 	wantSymbols                             map[string][]string
+	wantHierarchicalSymbols                 map[string][]string
 	wantWorkspaceSymbols                    map[*lspext.WorkspaceSymbolParams][]string
+	wantDeprecatedCompletion                map[string][]string
+	wantDeprecatedSymbols                   map[string][]string
+	wantDeprecatedWorkspaceSymbols          map[*lspext.WorkspaceSymbolParams][]string
+	wantExportedWorkspaceSymbols            map[*lspext.WorkspaceSymbolParams][]string
 	wantSignatures                          map[string]string
 	wantWorkspaceReferences                 map[*lspext.WorkspaceReferencesParams][]string
 	wantFormatting                          map[string]string
+	wantGoimportsFormatting                 map[string]string
+	wantRangeFormatting                     map[string]string
+	wantOnTypeFormatting                    map[string][]string
+	wantOrganizeImports                     map[string]string
+	wantAddImportFixes                      map[string][]string
+	wantImplementInterface                  map[string][]string
+	wantFoldingRanges                       map[string][]string
+	wantDocumentLinks                       map[string][]string
+	wantCodeLenses                          map[string][]string
+	wantResolvedCodeLenses                  map[string][]string
+	wantPrepareCallHierarchy                map[string]string
+	wantIncomingCalls                       map[string][]string
+	wantOutgoingCalls                       map[string][]string
+	wantSemanticTokens                      map[string][]string
 }
 
 func copyFileToOS(ctx context.Context, fs *AtomicFS, targetFile, srcFile string) error {
@@ -1268,6 +2659,35 @@ func lspTests(t testing.TB, ctx context.Context, h *LangHandler, c *jsonrpc2.Con
 		})
 	}
 
+	if len(cases.wantMarkdownHover) > 0 {
+		hc := h.init.Capabilities.TextDocument.Hover
+		if err := json.Unmarshal([]byte(`{"hover":{"contentFormat":["markdown","plaintext"]}}`), &h.init.Capabilities.TextDocument); err != nil {
+			t.Fatal(err)
+		}
+		for pos, want := range cases.wantMarkdownHover {
+			tbRun(t, fmt.Sprintf("markdownHover-%s", strings.Replace(pos, "/", "-", -1)), func(t testing.TB) {
+				hoverTest(t, ctx, c, rootURI, pos, want)
+			})
+		}
+		h.init.Capabilities.TextDocument.Hover = hc
+	}
+
+	for pos, want := range cases.wantHoverRange {
+		tbRun(t, fmt.Sprintf("hoverRange-%s", strings.Replace(pos, "/", "-", -1)), func(t testing.TB) {
+			hoverRangeTest(t, ctx, c, rootURI, pos, want)
+		})
+	}
+
+	if len(cases.wantTypecheckCompletion) > 0 {
+		h.Config.GocodeCompletionEnabled = false
+		for pos, want := range cases.wantTypecheckCompletion {
+			tbRun(t, fmt.Sprintf("typecheckCompletion-%s", strings.Replace(pos, "/", "-", -1)), func(t testing.TB) {
+				completionTest(t, ctx, c, rootURI, pos, want)
+			})
+		}
+		h.Config.GocodeCompletionEnabled = true
+	}
+
 	// Godef-based definition & hover testing
 	wantGodefDefinition := cases.overrideGodefDefinition
 	if len(wantGodefDefinition) == 0 {
@@ -1278,7 +2698,9 @@ func lspTests(t testing.TB, ctx context.Context, h *LangHandler, c *jsonrpc2.Con
 		wantGodefHover = cases.wantHover
 	}
 
-	if len(wantGodefDefinition) > 0 || (len(wantGodefHover) > 0 && h != nil) || len(cases.wantCompletion) > 0 {
+	// Following type aliases doesn't use godef.
+	followTypeAliases := h != nil && h.Config.FollowTypeAliases
+	if !followTypeAliases && (len(wantGodefDefinition) > 0 || ((len(wantGodefHover) > 0 || len(cases.wantHoverRange) > 0) && h != nil) || len(cases.wantCompletion) > 0 || len(cases.wantTypeDefinition) > 0) {
 		h.Config.UseBinaryPkgCache = true
 
 		// Copy the VFS into a temp directory, which will be our $GOPATH.
@@ -1302,7 +2724,11 @@ func lspTests(t testing.TB, ctx context.Context, h *LangHandler, c *jsonrpc2.Con
 		// Install all Go packages in the $GOPATH.
 		oldGOPATH := os.Getenv("GOPATH")
 		os.Setenv("GOPATH", tmpDir)
-		out, err := exec.Command("go", "install", "-v", "all").CombinedOutput()
+		args := []string{"install", "-v"}
+		if len(h.Config.BuildTags) > 0 {
+			args = append(args, "-tags", strings.Join(h.Config.BuildTags, ","))
+		}
+		out, err := exec.Command("go", append(args, "all")...).CombinedOutput()
 		os.Setenv("GOPATH", oldGOPATH)
 		if err != nil {
 			t.Fatal(err)
@@ -1322,71 +2748,277 @@ func lspTests(t testing.TB, ctx context.Context, h *LangHandler, c *jsonrpc2.Con
 				definitionTest(t, ctx, c, util.PathToURI(tmpRootPath), pos, want, tmpDir)
 			})
 		}
-		for pos, want := range wantGodefHover {
-			tbRun(t, fmt.Sprintf("godef-hover-%s", strings.Replace(pos, "/", "-", -1)), func(t testing.TB) {
-				hoverTest(t, ctx, c, util.PathToURI(tmpRootPath), pos, want)
+		for pos, want := range cases.wantTypeDefinition {
+			tbRun(t, fmt.Sprintf("godef-typeDefinition-%s", strings.Replace(pos, "/", "-", -1)), func(t testing.TB) {
+				typeDefinitionTest(t, ctx, c, util.PathToURI(tmpRootPath), pos, want, tmpDir)
+			})
+		}
+		for pos, want := range wantGodefHover {
+			tbRun(t, fmt.Sprintf("godef-hover-%s", strings.Replace(pos, "/", "-", -1)), func(t testing.TB) {
+				hoverTest(t, ctx, c, util.PathToURI(tmpRootPath), pos, want)
+			})
+		}
+		for pos, want := range cases.wantHoverRange {
+			tbRun(t, fmt.Sprintf("godef-hoverRange-%s", strings.Replace(pos, "/", "-", -1)), func(t testing.TB) {
+				hoverRangeTest(t, ctx, c, util.PathToURI(tmpRootPath), pos, want)
+			})
+		}
+		for pos, want := range cases.wantCompletion {
+			tbRun(t, fmt.Sprintf("completion-%s", strings.Replace(pos, "/", "-", -1)), func(t testing.TB) {
+				completionTest(t, ctx, c, util.PathToURI(tmpRootPath), pos, want)
+			})
+		}
+
+		h.Config.UseBinaryPkgCache = false
+	}
+
+	for pos, want := range cases.wantDefinition {
+		tbRun(t, fmt.Sprintf("definition-%s", strings.Replace(pos, "/", "-", -1)), func(t testing.TB) {
+			definitionTest(t, ctx, c, rootURI, pos, want, "")
+		})
+	}
+
+	for pos, want := range cases.wantTypeDefinition {
+		tbRun(t, fmt.Sprintf("typeDefinition-%s", strings.Replace(pos, "/", "-", -1)), func(t testing.TB) {
+			typeDefinitionTest(t, ctx, c, rootURI, pos, want, "")
+		})
+	}
+
+	for pos, want := range cases.wantXDefinition {
+		tbRun(t, fmt.Sprintf("xdefinition-%s", strings.Replace(pos, "/", "-", -1)), func(t testing.TB) {
+			xdefinitionTest(t, ctx, c, rootURI, pos, want)
+		})
+	}
+
+	for pos, want := range cases.wantReferences {
+		tbRun(t, fmt.Sprintf("references-%s", pos), func(t testing.TB) {
+			referencesTest(t, ctx, c, rootURI, pos, want, true)
+		})
+	}
+
+	for pos, want := range cases.wantReferencesWithoutDecl {
+		tbRun(t, fmt.Sprintf("referencesWithoutDecl-%s", pos), func(t testing.TB) {
+			referencesTest(t, ctx, c, rootURI, pos, want, false)
+		})
+	}
+
+	for pos, want := range cases.wantImplementation {
+		tbRun(t, fmt.Sprintf("implementation-%s", pos), func(t testing.TB) {
+			implementationTest(t, ctx, c, rootURI, pos, want)
+		})
+	}
+
+	for pos, want := range cases.wantHighlights {
+		tbRun(t, fmt.Sprintf("highlights-%s", pos), func(t testing.TB) {
+			highlightsTest(t, ctx, c, rootURI, pos, want)
+		})
+	}
+
+	for posAndName, want := range cases.wantRename {
+		tbRun(t, fmt.Sprintf("rename-%s", strings.Replace(posAndName, "/", "-", -1)), func(t testing.TB) {
+			renameTest(t, ctx, c, rootURI, posAndName, want)
+		})
+	}
+
+	for pos, want := range cases.wantPrepareRename {
+		tbRun(t, fmt.Sprintf("prepareRename-%s", strings.Replace(pos, "/", "-", -1)), func(t testing.TB) {
+			prepareRenameTest(t, ctx, c, rootURI, pos, want)
+		})
+	}
+
+	for file, want := range cases.wantSymbols {
+		tbRun(t, fmt.Sprintf("symbols-%s", file), func(t testing.TB) {
+			symbolsTest(t, ctx, c, rootURI, file, want)
+		})
+	}
+
+	if len(cases.wantHierarchicalSymbols) > 0 {
+		ds := h.init.Capabilities.TextDocument.DocumentSymbol
+		if err := json.Unmarshal([]byte(`{"documentSymbol":{"hierarchicalDocumentSymbolSupport":true}}`), &h.init.Capabilities.TextDocument); err != nil {
+			t.Fatal(err)
+		}
+		for file, want := range cases.wantHierarchicalSymbols {
+			tbRun(t, fmt.Sprintf("hierarchicalSymbols-%s", file), func(t testing.TB) {
+				hierarchicalSymbolsTest(t, ctx, c, rootURI, file, want)
+			})
+		}
+		h.init.Capabilities.TextDocument.DocumentSymbol = ds
+	}
+
+	for params, want := range cases.wantWorkspaceSymbols {
+		tbRun(t, fmt.Sprintf("workspaceSymbols(%v)", *params), func(t testing.TB) {
+			workspaceSymbolsTest(t, ctx, c, rootURI, *params, want)
+		})
+	}
+
+	if len(cases.wantDeprecatedCompletion) > 0 || len(cases.wantDeprecatedSymbols) > 0 || len(cases.wantDeprecatedWorkspaceSymbols) > 0 {
+		h.Config.GocodeCompletionEnabled = false
+		td, ws := h.init.Capabilities.TextDocument, h.init.Capabilities.Workspace
+		// Nothing is tagged until the client says it supports the tag.
+		deprecatedTests := func(supported bool) {
+			for pos, want := range cases.wantDeprecatedCompletion {
+				tbRun(t, fmt.Sprintf("deprecatedCompletion-%s-%v", strings.Replace(pos, "/", "-", -1), supported), func(t testing.TB) {
+					if !supported {
+						want = nil
+					}
+					deprecatedCompletionTest(t, ctx, c, rootURI, pos, want)
+				})
+			}
+			for file, want := range cases.wantDeprecatedSymbols {
+				tbRun(t, fmt.Sprintf("deprecatedSymbols-%s-%v", file, supported), func(t testing.TB) {
+					if !supported {
+						want = nil
+					}
+					deprecatedSymbolsTest(t, ctx, c, rootURI, file, want)
+				})
+			}
+			for params, want := range cases.wantDeprecatedWorkspaceSymbols {
+				tbRun(t, fmt.Sprintf("deprecatedWorkspaceSymbols(%v)-%v", *params, supported), func(t testing.TB) {
+					if !supported {
+						want = nil
+					}
+					deprecatedWorkspaceSymbolsTest(t, ctx, c, *params, want)
+				})
+			}
+		}
+		if err := json.Unmarshal([]byte(`{"documentSymbol":{"hierarchicalDocumentSymbolSupport":true}}`), &h.init.Capabilities.TextDocument); err != nil {
+			t.Fatal(err)
+		}
+		deprecatedTests(false)
+		if err := json.Unmarshal([]byte(`{"completion":{"completionItem":{"tagSupport":{"valueSet":[1]}}},"documentSymbol":{"hierarchicalDocumentSymbolSupport":true,"tagSupport":{"valueSet":[1]}}}`), &h.init.Capabilities.TextDocument); err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal([]byte(`{"symbol":{"tagSupport":{"valueSet":[1]}}}`), &h.init.Capabilities.Workspace); err != nil {
+			t.Fatal(err)
+		}
+		deprecatedTests(true)
+		h.init.Capabilities.TextDocument, h.init.Capabilities.Workspace = td, ws
+		h.Config.GocodeCompletionEnabled = true
+	}
+
+	if len(cases.wantExportedWorkspaceSymbols) > 0 {
+		h.Config.IncludeUnexportedSymbols = false
+		for params, want := range cases.wantExportedWorkspaceSymbols {
+			tbRun(t, fmt.Sprintf("exportedWorkspaceSymbols(%v)", *params), func(t testing.TB) {
+				workspaceSymbolsTest(t, ctx, c, rootURI, *params, want)
+			})
+		}
+		h.Config.IncludeUnexportedSymbols = true
+	}
+
+	for pos, want := range cases.wantSignatures {
+		tbRun(t, fmt.Sprintf("signature-%s", strings.Replace(pos, "/", "-", -1)), func(t testing.TB) {
+			signatureTest(t, ctx, c, rootURI, pos, want)
+		})
+	}
+
+	for params, want := range cases.wantWorkspaceReferences {
+		tbRun(t, fmt.Sprintf("workspaceReferences"), func(t testing.TB) {
+			workspaceReferencesTest(t, ctx, c, rootURI, *params, want)
+		})
+	}
+
+	for file, want := range cases.wantFormatting {
+		tbRun(t, fmt.Sprintf("formatting-%s", file), func(t testing.TB) {
+			formattingTest(t, ctx, c, rootURI, file, want)
+		})
+	}
+
+	if len(cases.wantGoimportsFormatting) > 0 {
+		h.Config.FormatTool = formatToolGoimports
+		h.Config.GoimportsLocalPrefix = "test/"
+		for file, want := range cases.wantGoimportsFormatting {
+			tbRun(t, fmt.Sprintf("goimports-formatting-%s", file), func(t testing.TB) {
+				formattingTest(t, ctx, c, rootURI, file, want)
+			})
+		}
+		h.Config.FormatTool = formatToolGofmt
+		h.Config.GoimportsLocalPrefix = ""
+	}
+
+	for rng, want := range cases.wantRangeFormatting {
+		tbRun(t, fmt.Sprintf("rangeFormatting-%s", rng), func(t testing.TB) {
+			rangeFormattingTest(t, ctx, c, rootURI, rng, want)
+		})
+	}
+
+	for pos, want := range cases.wantOnTypeFormatting {
+		tbRun(t, fmt.Sprintf("onTypeFormatting-%q", pos), func(t testing.TB) {
+			onTypeFormattingTest(t, ctx, c, rootURI, pos, want)
+		})
+	}
+
+	if len(cases.wantOrganizeImports) > 0 || len(cases.wantAddImportFixes) > 0 || len(cases.wantImplementInterface) > 0 {
+		td, ws := h.init.Capabilities.TextDocument, h.init.Capabilities.Workspace
+		if err := json.Unmarshal([]byte(`{"codeAction":{"codeActionLiteralSupport":{"codeActionKind":{"valueSet":["source.organizeImports"]}}}}`), &h.init.Capabilities.TextDocument); err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal([]byte(`{"workspaceEdit":{"documentChanges":true}}`), &h.init.Capabilities.Workspace); err != nil {
+			t.Fatal(err)
+		}
+		for file, want := range cases.wantOrganizeImports {
+			tbRun(t, fmt.Sprintf("organizeImports-%s", file), func(t testing.TB) {
+				organizeImportsTest(t, ctx, h, c, rootURI, file, want)
+			})
+		}
+		for diag, want := range cases.wantAddImportFixes {
+			tbRun(t, fmt.Sprintf("addImportFixes-%s", strings.Replace(diag, " ", "-", -1)), func(t testing.TB) {
+				addImportFixesTest(t, ctx, c, rootURI, diag, want)
 			})
 		}
-		for pos, want := range cases.wantCompletion {
-			tbRun(t, fmt.Sprintf("completion-%s", strings.Replace(pos, "/", "-", -1)), func(t testing.TB) {
-				completionTest(t, ctx, c, util.PathToURI(tmpRootPath), pos, want)
+		for pos, want := range cases.wantImplementInterface {
+			tbRun(t, fmt.Sprintf("implementInterface-%s", strings.Replace(pos, "/", "-", -1)), func(t testing.TB) {
+				implementInterfaceTest(t, ctx, c, rootURI, pos, want)
 			})
 		}
-
-		h.Config.UseBinaryPkgCache = false
-	}
-
-	for pos, want := range cases.wantDefinition {
-		tbRun(t, fmt.Sprintf("definition-%s", strings.Replace(pos, "/", "-", -1)), func(t testing.TB) {
-			definitionTest(t, ctx, c, rootURI, pos, want, "")
-		})
+		h.init.Capabilities.TextDocument, h.init.Capabilities.Workspace = td, ws
 	}
 
-	for pos, want := range cases.wantXDefinition {
-		tbRun(t, fmt.Sprintf("xdefinition-%s", strings.Replace(pos, "/", "-", -1)), func(t testing.TB) {
-			xdefinitionTest(t, ctx, c, rootURI, pos, want)
+	for file, want := range cases.wantFoldingRanges {
+		tbRun(t, fmt.Sprintf("foldingRange-%s", file), func(t testing.TB) {
+			foldingRangesTest(t, ctx, c, rootURI, file, want)
 		})
 	}
 
-	for pos, want := range cases.wantReferences {
-		tbRun(t, fmt.Sprintf("references-%s", pos), func(t testing.TB) {
-			referencesTest(t, ctx, c, rootURI, pos, want)
+	for file, want := range cases.wantDocumentLinks {
+		tbRun(t, fmt.Sprintf("documentLink-%s", file), func(t testing.TB) {
+			documentLinksTest(t, ctx, c, rootURI, file, want)
 		})
 	}
 
-	for pos, want := range cases.wantImplementation {
-		tbRun(t, fmt.Sprintf("implementation-%s", pos), func(t testing.TB) {
-			implementationTest(t, ctx, c, rootURI, pos, want)
+	for file, want := range cases.wantCodeLenses {
+		tbRun(t, fmt.Sprintf("codeLens-%s", file), func(t testing.TB) {
+			codeLensesTest(t, ctx, c, rootURI, file, false, want)
 		})
 	}
 
-	for file, want := range cases.wantSymbols {
-		tbRun(t, fmt.Sprintf("symbols-%s", file), func(t testing.TB) {
-			symbolsTest(t, ctx, c, rootURI, file, want)
+	for file, want := range cases.wantResolvedCodeLenses {
+		tbRun(t, fmt.Sprintf("resolvedCodeLens-%s", file), func(t testing.TB) {
+			codeLensesTest(t, ctx, c, rootURI, file, true, want)
 		})
 	}
 
-	for params, want := range cases.wantWorkspaceSymbols {
-		tbRun(t, fmt.Sprintf("workspaceSymbols(%v)", *params), func(t testing.TB) {
-			workspaceSymbolsTest(t, ctx, c, rootURI, *params, want)
+	for file, want := range cases.wantSemanticTokens {
+		tbRun(t, fmt.Sprintf("semanticTokens-%s", file), func(t testing.TB) {
+			semanticTokensTest(t, ctx, c, rootURI, file, want)
 		})
 	}
 
-	for pos, want := range cases.wantSignatures {
-		tbRun(t, fmt.Sprintf("signature-%s", strings.Replace(pos, "/", "-", -1)), func(t testing.TB) {
-			signatureTest(t, ctx, c, rootURI, pos, want)
+	for pos, want := range cases.wantPrepareCallHierarchy {
+		tbRun(t, fmt.Sprintf("prepareCallHierarchy-%s", strings.Replace(pos, "/", "-", -1)), func(t testing.TB) {
+			prepareCallHierarchyTest(t, ctx, c, rootURI, pos, want)
 		})
 	}
 
-	for params, want := range cases.wantWorkspaceReferences {
-		tbRun(t, fmt.Sprintf("workspaceReferences"), func(t testing.TB) {
-			workspaceReferencesTest(t, ctx, c, rootURI, *params, want)
+	for pos, want := range cases.wantIncomingCalls {
+		tbRun(t, fmt.Sprintf("incomingCalls-%s", strings.Replace(pos, "/", "-", -1)), func(t testing.TB) {
+			callHierarchyCallsTest(t, ctx, c, rootURI, "callHierarchy/incomingCalls", pos, want)
 		})
 	}
 
-	for file, want := range cases.wantFormatting {
-		tbRun(t, fmt.Sprintf("formatting-%s", file), func(t testing.TB) {
-			formattingTest(t, ctx, c, rootURI, file, want)
+	for pos, want := range cases.wantOutgoingCalls {
+		tbRun(t, fmt.Sprintf("outgoingCalls-%s", strings.Replace(pos, "/", "-", -1)), func(t testing.TB) {
+			callHierarchyCallsTest(t, ctx, c, rootURI, "callHierarchy/outgoingCalls", pos, want)
 		})
 	}
 }
@@ -1421,6 +3053,31 @@ func hoverTest(t testing.TB, ctx context.Context, c *jsonrpc2.Conn, rootURI lsp.
 	}
 }
 
+func hoverRangeTest(t testing.TB, ctx context.Context, c *jsonrpc2.Conn, rootURI lsp.DocumentURI, pos, want string) {
+	file, line, char, err := parsePos(pos)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var res struct {
+		Contents markedStrings `json:"contents"`
+		lsp.Hover
+	}
+	err = c.Call(ctx, "textDocument/hover", lsp.TextDocumentPositionParams{
+		TextDocument: lsp.TextDocumentIdentifier{URI: uriJoin(rootURI, file)},
+		Position:     lsp.Position{Line: line, Character: char},
+	}, &res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got string
+	if r := res.Range; r != nil {
+		got = fmt.Sprintf("%d:%d-%d:%d", r.Start.Line+1, r.Start.Character+1, r.End.Line+1, r.End.Character+1)
+	}
+	if got != want {
+		t.Fatalf("got range %q, want %q", got, want)
+	}
+}
+
 func definitionTest(t testing.TB, ctx context.Context, c *jsonrpc2.Conn, rootURI lsp.DocumentURI, pos, want, trimPrefix string) {
 	file, line, char, err := parsePos(pos)
 	if err != nil {
@@ -1449,6 +3106,26 @@ func definitionTest(t testing.TB, ctx context.Context, c *jsonrpc2.Conn, rootURI
 	}
 }
 
+func typeDefinitionTest(t testing.TB, ctx context.Context, c *jsonrpc2.Conn, rootURI lsp.DocumentURI, pos, want, trimPrefix string) {
+	file, line, char, err := parsePos(pos)
+	if err != nil {
+		t.Fatal(err)
+	}
+	definition, err := callLocations(ctx, c, "textDocument/typeDefinition", uriJoin(rootURI, file), line, char)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if definition != "" {
+		definition = util.UriToPath(lsp.DocumentURI(definition))
+		if trimPrefix != "" {
+			definition = strings.TrimPrefix(definition, util.UriToPath(util.PathToURI(trimPrefix)))
+		}
+	}
+	if definition != want {
+		t.Errorf("got %q, want %q", definition, want)
+	}
+}
+
 func xdefinitionTest(t testing.TB, ctx context.Context, c *jsonrpc2.Conn, rootURI lsp.DocumentURI, pos, want string) {
 	file, line, char, err := parsePos(pos)
 	if err != nil {
@@ -1458,7 +3135,11 @@ func xdefinitionTest(t testing.TB, ctx context.Context, c *jsonrpc2.Conn, rootUR
 	if err != nil {
 		t.Fatal(err)
 	}
-	xdefinition = util.UriToPath(lsp.DocumentURI(xdefinition))
+	locs := strings.Split(xdefinition, ", ")
+	for i := range locs {
+		locs[i] = util.UriToPath(lsp.DocumentURI(locs[i]))
+	}
+	xdefinition = strings.Join(locs, ", ")
 	if xdefinition != want {
 		t.Errorf("\ngot  %q\nwant %q", xdefinition, want)
 	}
@@ -1478,12 +3159,12 @@ func completionTest(t testing.TB, ctx context.Context, c *jsonrpc2.Conn, rootURI
 	}
 }
 
-func referencesTest(t testing.TB, ctx context.Context, c *jsonrpc2.Conn, rootURI lsp.DocumentURI, pos string, want []string) {
+func referencesTest(t testing.TB, ctx context.Context, c *jsonrpc2.Conn, rootURI lsp.DocumentURI, pos string, want []string, includeDecl bool) {
 	file, line, char, err := parsePos(pos)
 	if err != nil {
 		t.Fatal(err)
 	}
-	references, err := callReferences(ctx, c, uriJoin(rootURI, file), line, char)
+	references, err := callReferences(ctx, c, uriJoin(rootURI, file), line, char, includeDecl)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -1506,63 +3187,337 @@ func implementationTest(t testing.TB, ctx context.Context, c *jsonrpc2.Conn, roo
 	if err != nil {
 		t.Fatal(err)
 	}
-	for i := range impls {
-		impls[i] = util.UriToPath(lsp.DocumentURI(impls[i]))
-	}
-	sort.Strings(impls)
-	sort.Strings(want)
-	if !reflect.DeepEqual(impls, want) {
-		t.Errorf("\ngot\n\t%q\nwant\n\t%q", impls, want)
+	for i := range impls {
+		impls[i] = util.UriToPath(lsp.DocumentURI(impls[i]))
+	}
+	sort.Strings(impls)
+	sort.Strings(want)
+	if !reflect.DeepEqual(impls, want) {
+		t.Errorf("\ngot\n\t%q\nwant\n\t%q", impls, want)
+	}
+}
+
+func highlightsTest(t testing.TB, ctx context.Context, c *jsonrpc2.Conn, rootURI lsp.DocumentURI, pos string, want []string) {
+	file, line, char, err := parsePos(pos)
+	if err != nil {
+		t.Fatal(err)
+	}
+	highlights, err := callHighlights(ctx, c, uriJoin(rootURI, file), line, char)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(highlights, want) {
+		t.Errorf("\ngot\n\t%q\nwant\n\t%q", highlights, want)
+	}
+}
+
+func renameTest(t testing.TB, ctx context.Context, c *jsonrpc2.Conn, rootURI lsp.DocumentURI, posAndName string, want []string) {
+	// posAndName is of the form file:line:col newName.
+	parts := strings.Fields(posAndName)
+	if len(parts) != 2 {
+		t.Fatalf("invalid rename %q", posAndName)
+	}
+	file, line, char, err := parsePos(parts[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	edits, err := callRename(ctx, c, uriJoin(rootURI, file), line, char, parts[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(edits)
+	sort.Strings(want)
+	if !reflect.DeepEqual(edits, want) {
+		t.Errorf("\ngot\n\t%q\nwant\n\t%q", edits, want)
+	}
+}
+
+func prepareRenameTest(t testing.TB, ctx context.Context, c *jsonrpc2.Conn, rootURI lsp.DocumentURI, pos string, want string) {
+	file, line, char, err := parsePos(pos)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := callPrepareRename(ctx, c, uriJoin(rootURI, file), line, char)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func symbolsTest(t testing.TB, ctx context.Context, c *jsonrpc2.Conn, rootURI lsp.DocumentURI, file string, want []string) {
+	symbols, err := callSymbols(ctx, c, uriJoin(rootURI, file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range symbols {
+		symbols[i] = util.UriToPath(lsp.DocumentURI(symbols[i]))
+	}
+	if !reflect.DeepEqual(symbols, want) {
+		t.Errorf("got %q, want %q", symbols, want)
+	}
+}
+
+func hierarchicalSymbolsTest(t testing.TB, ctx context.Context, c *jsonrpc2.Conn, rootURI lsp.DocumentURI, file string, want []string) {
+	symbols, err := callHierarchicalSymbols(ctx, c, uriJoin(rootURI, file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(symbols, want) {
+		t.Errorf("\ngot  %q\nwant %q", symbols, want)
+	}
+}
+
+func deprecatedCompletionTest(t testing.TB, ctx context.Context, c *jsonrpc2.Conn, rootURI lsp.DocumentURI, pos string, want []string) {
+	file, line, char, err := parsePos(pos)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var res lsp.CompletionList
+	err = c.Call(ctx, "textDocument/completion", lsp.CompletionParams{TextDocumentPositionParams: lsp.TextDocumentPositionParams{
+		TextDocument: lsp.TextDocumentIdentifier{URI: uriJoin(rootURI, file)},
+		Position:     lsp.Position{Line: line, Character: char},
+	}}, &res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var deprecated []string
+	for _, it := range res.Items {
+		if len(it.Tags) == 1 && it.Tags[0] == lsp.CITDeprecated {
+			deprecated = append(deprecated, it.Label)
+		}
+	}
+	if !reflect.DeepEqual(deprecated, want) {
+		t.Errorf("got %q, want %q", deprecated, want)
+	}
+}
+
+// deprecatedSymbolsTest checks the names, qualified by those of their
+// parents, of the hierarchical document symbols tagged deprecated.
+func deprecatedSymbolsTest(t testing.TB, ctx context.Context, c *jsonrpc2.Conn, rootURI lsp.DocumentURI, file string, want []string) {
+	var symbols []lsp.DocumentSymbol
+	err := c.Call(ctx, "textDocument/documentSymbol", lsp.DocumentSymbolParams{
+		TextDocument: lsp.TextDocumentIdentifier{URI: uriJoin(rootURI, file)},
+	}, &symbols)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var deprecated []string
+	var walk func(prefix string, symbols []lsp.DocumentSymbol)
+	walk = func(prefix string, symbols []lsp.DocumentSymbol) {
+		for _, s := range symbols {
+			if len(s.Tags) == 1 && s.Tags[0] == lsp.STDeprecated {
+				deprecated = append(deprecated, prefix+s.Name)
+			}
+			walk(prefix+s.Name+".", s.Children)
+		}
+	}
+	walk("", symbols)
+	if !reflect.DeepEqual(deprecated, want) {
+		t.Errorf("got %q, want %q", deprecated, want)
+	}
+}
+
+// deprecatedWorkspaceSymbolsTest checks the sorted qualified names of the
+// workspace symbols tagged deprecated.
+func deprecatedWorkspaceSymbolsTest(t testing.TB, ctx context.Context, c *jsonrpc2.Conn, params lspext.WorkspaceSymbolParams, want []string) {
+	var symbols []lsp.SymbolInformation
+	if err := c.Call(ctx, "workspace/symbol", params, &symbols); err != nil {
+		t.Fatal(err)
+	}
+	var deprecated []string
+	for _, s := range symbols {
+		if len(s.Tags) == 1 && s.Tags[0] == lsp.STDeprecated {
+			deprecated = append(deprecated, qualifiedName(s))
+		}
+	}
+	sort.Strings(deprecated)
+	if !reflect.DeepEqual(deprecated, want) {
+		t.Errorf("got %q, want %q", deprecated, want)
+	}
+}
+
+func workspaceSymbolsTest(t testing.TB, ctx context.Context, c *jsonrpc2.Conn, rootURI lsp.DocumentURI, params lspext.WorkspaceSymbolParams, want []string) {
+	symbols, err := callWorkspaceSymbols(ctx, c, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range symbols {
+		symbols[i] = util.UriToPath(lsp.DocumentURI(symbols[i]))
+	}
+	if !reflect.DeepEqual(symbols, want) {
+		t.Errorf("got %#v, want %q", symbols, want)
+	}
+}
+
+func signatureTest(t testing.TB, ctx context.Context, c *jsonrpc2.Conn, rootURI lsp.DocumentURI, pos, want string) {
+	file, line, char, err := parsePos(pos)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature, err := callSignature(ctx, c, uriJoin(rootURI, file), line, char)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if signature != want {
+		t.Fatalf("got %q, want %q", signature, want)
+	}
+}
+
+func workspaceReferencesTest(t testing.TB, ctx context.Context, c *jsonrpc2.Conn, rootURI lsp.DocumentURI, params lspext.WorkspaceReferencesParams, want []string) {
+	references, err := callWorkspaceReferences(ctx, c, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(references, want) {
+		t.Errorf("\ngot  %q\nwant %q", references, want)
+	}
+}
+
+func rangeFormattingTest(t testing.TB, ctx context.Context, c *jsonrpc2.Conn, rootURI lsp.DocumentURI, rng string, want string) {
+	// rng is of the form file:line:col-line:col.
+	i := strings.Index(rng, "-")
+	if i < 0 {
+		t.Fatalf("invalid range %q", rng)
+	}
+	file, startLine, startChar, err := parsePos(rng[:i])
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, endLine, endChar, err := parsePos(file + ":" + rng[i+1:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	edits, err := callRangeFormatting(ctx, c, uriJoin(rootURI, file), lsp.Range{
+		Start: lsp.Position{Line: startLine, Character: startChar},
+		End:   lsp.Position{Line: endLine, Character: endChar},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got string
+	switch len(edits) {
+	case 0:
+		// already gofmt clean
+	case 1:
+		r := edits[0].Range
+		got = fmt.Sprintf("%d:%d-%d:%d %s", r.Start.Line+1, r.Start.Character+1, r.End.Line+1, r.End.Character+1, edits[0].NewText)
+	default:
+		t.Errorf("got %d edits, want 0 or 1", len(edits))
+	}
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func onTypeFormattingTest(t testing.TB, ctx context.Context, c *jsonrpc2.Conn, rootURI lsp.DocumentURI, pos string, want []string) {
+	// pos is of the form "file:line:col ch".
+	i := strings.Index(pos, " ")
+	if i < 0 {
+		t.Fatalf("invalid position %q", pos)
+	}
+	file, line, char, err := parsePos(pos[:i])
+	if err != nil {
+		t.Fatal(err)
+	}
+	edits, err := callOnTypeFormatting(ctx, c, uriJoin(rootURI, file), line, char, pos[i+1:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for _, e := range edits {
+		r := e.Range
+		got = append(got, fmt.Sprintf("%d:%d-%d:%d %s", r.Start.Line+1, r.Start.Character+1, r.End.Line+1, r.End.Character+1, e.NewText))
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func foldingRangesTest(t testing.TB, ctx context.Context, c *jsonrpc2.Conn, rootURI lsp.DocumentURI, file string, want []string) {
+	ranges, err := callFoldingRanges(ctx, c, uriJoin(rootURI, file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(ranges, want) {
+		t.Errorf("\ngot\n\t%q\nwant\n\t%q", ranges, want)
+	}
+}
+
+func documentLinksTest(t testing.TB, ctx context.Context, c *jsonrpc2.Conn, rootURI lsp.DocumentURI, file string, want []string) {
+	links, err := callDocumentLinks(ctx, c, uriJoin(rootURI, file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(links, want) {
+		t.Errorf("\ngot\n\t%q\nwant\n\t%q", links, want)
+	}
+}
+
+func codeLensesTest(t testing.TB, ctx context.Context, c *jsonrpc2.Conn, rootURI lsp.DocumentURI, file string, resolve bool, want []string) {
+	lenses, err := callCodeLenses(ctx, c, uriJoin(rootURI, file), resolve)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(lenses, want) {
+		t.Errorf("\ngot\n\t%q\nwant\n\t%q", lenses, want)
 	}
 }
 
-func symbolsTest(t testing.TB, ctx context.Context, c *jsonrpc2.Conn, rootURI lsp.DocumentURI, file string, want []string) {
-	symbols, err := callSymbols(ctx, c, uriJoin(rootURI, file))
+func semanticTokensTest(t testing.TB, ctx context.Context, c *jsonrpc2.Conn, rootURI lsp.DocumentURI, file string, want []string) {
+	toks, err := callSemanticTokens(ctx, c, uriJoin(rootURI, file))
 	if err != nil {
 		t.Fatal(err)
 	}
-	for i := range symbols {
-		symbols[i] = util.UriToPath(lsp.DocumentURI(symbols[i]))
-	}
-	if !reflect.DeepEqual(symbols, want) {
-		t.Errorf("got %q, want %q", symbols, want)
+	if !reflect.DeepEqual(toks, want) {
+		t.Errorf("\ngot\n\t%q\nwant\n\t%q", toks, want)
 	}
 }
 
-func workspaceSymbolsTest(t testing.TB, ctx context.Context, c *jsonrpc2.Conn, rootURI lsp.DocumentURI, params lspext.WorkspaceSymbolParams, want []string) {
-	symbols, err := callWorkspaceSymbols(ctx, c, params)
+func prepareCallHierarchyTest(t testing.TB, ctx context.Context, c *jsonrpc2.Conn, rootURI lsp.DocumentURI, pos, want string) {
+	file, line, char, err := parsePos(pos)
 	if err != nil {
 		t.Fatal(err)
 	}
-	for i := range symbols {
-		symbols[i] = util.UriToPath(lsp.DocumentURI(symbols[i]))
+	items, err := callPrepareCallHierarchy(ctx, c, uriJoin(rootURI, file), line, char)
+	if err != nil {
+		t.Fatal(err)
 	}
-	if !reflect.DeepEqual(symbols, want) {
-		t.Errorf("got %#v, want %q", symbols, want)
+	var got string
+	switch len(items) {
+	case 0:
+	case 1:
+		got = callHierarchyItemString(items[0])
+	default:
+		t.Fatalf("got %d items, want at most 1", len(items))
+	}
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
 	}
 }
 
-func signatureTest(t testing.TB, ctx context.Context, c *jsonrpc2.Conn, rootURI lsp.DocumentURI, pos, want string) {
+// callHierarchyCallsTest prepares the call hierarchy at pos and checks the
+// result of asking method, callHierarchy/incomingCalls or outgoingCalls,
+// for its item.
+func callHierarchyCallsTest(t testing.TB, ctx context.Context, c *jsonrpc2.Conn, rootURI lsp.DocumentURI, method, pos string, want []string) {
 	file, line, char, err := parsePos(pos)
 	if err != nil {
 		t.Fatal(err)
 	}
-	signature, err := callSignature(ctx, c, uriJoin(rootURI, file), line, char)
+	items, err := callPrepareCallHierarchy(ctx, c, uriJoin(rootURI, file), line, char)
 	if err != nil {
 		t.Fatal(err)
 	}
-	if signature != want {
-		t.Fatalf("got %q, want %q", signature, want)
+	if len(items) != 1 {
+		t.Fatalf("got %d items, want 1", len(items))
 	}
-}
-
-func workspaceReferencesTest(t testing.TB, ctx context.Context, c *jsonrpc2.Conn, rootURI lsp.DocumentURI, params lspext.WorkspaceReferencesParams, want []string) {
-	references, err := callWorkspaceReferences(ctx, c, params)
+	calls, err := callCallHierarchyCalls(ctx, c, method, items[0])
 	if err != nil {
 		t.Fatal(err)
 	}
-	if !reflect.DeepEqual(references, want) {
-		t.Errorf("\ngot  %q\nwant %q", references, want)
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("\ngot\n\t%q\nwant\n\t%q", calls, want)
 	}
 }
 
@@ -1589,6 +3544,81 @@ func formattingTest(t testing.TB, ctx context.Context, c *jsonrpc2.Conn, rootURI
 	}
 }
 
+// addImportFixesTest checks the quick fixes for the diagnostic
+// "undefined: name" at pos, where diag is "pos name".
+func addImportFixesTest(t testing.TB, ctx context.Context, c *jsonrpc2.Conn, rootURI lsp.DocumentURI, diag string, want []string) {
+	i := strings.Index(diag, " ")
+	if i < 0 {
+		t.Fatalf("invalid diagnostic %q", diag)
+	}
+	file, line, char, err := parsePos(diag[:i])
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := callAddImportFixes(ctx, c, uriJoin(rootURI, file), line, char, diag[i+1:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func implementInterfaceTest(t testing.TB, ctx context.Context, c *jsonrpc2.Conn, rootURI lsp.DocumentURI, pos string, want []string) {
+	file, line, char, err := parsePos(pos)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := callImplementInterface(ctx, c, uriJoin(rootURI, file), line, char)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+// organizeImportsTest checks the organize imports action for file, first
+// as it is on disk and then opened by the client, when the edit must be
+// for the open version.
+func organizeImportsTest(t testing.TB, ctx context.Context, h *LangHandler, c *jsonrpc2.Conn, rootURI lsp.DocumentURI, file string, want string) {
+	uri := uriJoin(rootURI, file)
+	got, err := callOrganizeImports(ctx, c, uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	contents, err := h.readFile(ctx, uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Call(ctx, "textDocument/didOpen", lsp.DidOpenTextDocumentParams{
+		TextDocument: lsp.TextDocumentItem{URI: uri, Version: 3, Text: string(contents)},
+	}, nil); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := c.Call(ctx, "textDocument/didClose", lsp.DidCloseTextDocumentParams{
+			TextDocument: lsp.TextDocumentIdentifier{URI: uri},
+		}, nil); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	got, err = callOrganizeImports(ctx, c, uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want != "" {
+		want = "v3 " + want
+	}
+	if got != want {
+		t.Errorf("with the file open, got %q, want %q", got, want)
+	}
+}
+
 func parsePos(s string) (file string, line, char int, err error) {
 	parts := strings.Split(s, ":")
 	if len(parts) != 3 {
@@ -1632,13 +3662,19 @@ func callHover(ctx context.Context, c *jsonrpc2.Conn, uri lsp.DocumentURI, line,
 }
 
 func callDefinition(ctx context.Context, c *jsonrpc2.Conn, uri lsp.DocumentURI, line, char int) (string, error) {
+	return callLocations(ctx, c, "textDocument/definition", uri, line, char)
+}
+
+// callLocations calls a method returning locations for a position, such as
+// textDocument/definition.
+func callLocations(ctx context.Context, c *jsonrpc2.Conn, method string, uri lsp.DocumentURI, line, char int) (string, error) {
 	var res locations
-	err := c.Call(ctx, "textDocument/definition", lsp.TextDocumentPositionParams{
+	err := c.Call(ctx, method, lsp.TextDocumentPositionParams{
 		TextDocument: lsp.TextDocumentIdentifier{URI: uri},
 		Position:     lsp.Position{Line: line, Character: char},
 	}, &res)
 	if err != nil {
-		return "", err
+		return definitionNotFound(err)
 	}
 	var str string
 	for i, loc := range res {
@@ -1653,6 +3689,20 @@ func callDefinition(ctx context.Context, c *jsonrpc2.Conn, uri lsp.DocumentURI,
 	return str, nil
 }
 
+// definitionNotFound returns "not found: identifier" if err is a
+// CodeDefinitionNotFound error, and err otherwise.
+func definitionNotFound(err error) (string, error) {
+	e, ok := err.(*jsonrpc2.Error)
+	if !ok || e.Code != CodeDefinitionNotFound || e.Data == nil {
+		return "", err
+	}
+	var data DefinitionNotFoundData
+	if err := json.Unmarshal(*e.Data, &data); err != nil {
+		return "", err
+	}
+	return "not found: " + data.Identifier, nil
+}
+
 func callXDefinition(ctx context.Context, c *jsonrpc2.Conn, uri lsp.DocumentURI, line, char int) (string, error) {
 	var res []lspext.SymbolLocationInformation
 	err := c.Call(ctx, "textDocument/xdefinition", lsp.TextDocumentPositionParams{
@@ -1660,7 +3710,7 @@ func callXDefinition(ctx context.Context, c *jsonrpc2.Conn, uri lsp.DocumentURI,
 		Position:     lsp.Position{Line: line, Character: char},
 	}, &res)
 	if err != nil {
-		return "", err
+		return definitionNotFound(err)
 	}
 	var str string
 	for i, loc := range res {
@@ -1697,10 +3747,10 @@ func callCompletion(ctx context.Context, c *jsonrpc2.Conn, uri lsp.DocumentURI,
 	return str, nil
 }
 
-func callReferences(ctx context.Context, c *jsonrpc2.Conn, uri lsp.DocumentURI, line, char int) ([]string, error) {
+func callReferences(ctx context.Context, c *jsonrpc2.Conn, uri lsp.DocumentURI, line, char int, includeDecl bool) ([]string, error) {
 	var res locations
 	err := c.Call(ctx, "textDocument/references", lsp.ReferenceParams{
-		Context: lsp.ReferenceContext{IncludeDeclaration: true},
+		Context: lsp.ReferenceContext{IncludeDeclaration: includeDecl},
 		TextDocumentPositionParams: lsp.TextDocumentPositionParams{
 			TextDocument: lsp.TextDocumentIdentifier{URI: uri},
 			Position:     lsp.Position{Line: line, Character: char},
@@ -1709,6 +3759,9 @@ func callReferences(ctx context.Context, c *jsonrpc2.Conn, uri lsp.DocumentURI,
 	if err != nil {
 		return nil, err
 	}
+	if !sort.SliceIsSorted(res, func(i, j int) bool { return locationLess(res[i], res[j]) }) {
+		return nil, fmt.Errorf("references are not sorted: %v", res)
+	}
 	str := make([]string, len(res))
 	for i, loc := range res {
 		str[i] = fmt.Sprintf("%s:%d:%d", loc.URI, loc.Range.Start.Line+1, loc.Range.Start.Character+1)
@@ -1739,6 +3792,71 @@ func callImplementation(ctx context.Context, c *jsonrpc2.Conn, uri lsp.DocumentU
 	return str, nil
 }
 
+func callHighlights(ctx context.Context, c *jsonrpc2.Conn, uri lsp.DocumentURI, line, char int) ([]string, error) {
+	var res []lsp.DocumentHighlight
+	err := c.Call(ctx, "textDocument/documentHighlight", lsp.TextDocumentPositionParams{
+		TextDocument: lsp.TextDocumentIdentifier{URI: uri},
+		Position:     lsp.Position{Line: line, Character: char},
+	}, &res)
+	if err != nil {
+		return nil, err
+	}
+	str := make([]string, len(res))
+	for i, h := range res {
+		kind := "text"
+		switch h.Kind {
+		case lsp.Read:
+			kind = "read"
+		case lsp.Write:
+			kind = "write"
+		}
+		str[i] = fmt.Sprintf("%d:%d-%d:%d:%s", h.Range.Start.Line+1, h.Range.Start.Character+1, h.Range.End.Line+1, h.Range.End.Character+1, kind)
+	}
+	return str, nil
+}
+
+// callRename returns the edits as "file:line:col-line:col", or a single
+// "error: message" if the rename is rejected.
+func callRename(ctx context.Context, c *jsonrpc2.Conn, uri lsp.DocumentURI, line, char int, newName string) ([]string, error) {
+	var res lsp.WorkspaceEdit
+	err := c.Call(ctx, "textDocument/rename", lsp.RenameParams{
+		TextDocument: lsp.TextDocumentIdentifier{URI: uri},
+		Position:     lsp.Position{Line: line, Character: char},
+		NewName:      newName,
+	}, &res)
+	if e, ok := err.(*jsonrpc2.Error); ok {
+		return []string{"error: " + e.Message}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var str []string
+	for uri, edits := range res.Changes {
+		for _, e := range edits {
+			if e.NewText != newName {
+				return nil, fmt.Errorf("got edit to %q, want %q", e.NewText, newName)
+			}
+			str = append(str, fmt.Sprintf("%s:%d:%d-%d:%d", util.UriToPath(lsp.DocumentURI(uri)), e.Range.Start.Line+1, e.Range.Start.Character+1, e.Range.End.Line+1, e.Range.End.Character+1))
+		}
+	}
+	return str, nil
+}
+
+// callPrepareRename returns the range as "line:col-line:col", or
+// "error: message" if the target can't be renamed.
+func callPrepareRename(ctx context.Context, c *jsonrpc2.Conn, uri lsp.DocumentURI, line, char int) (string, error) {
+	var res lsp.Range
+	err := c.Call(ctx, "textDocument/prepareRename", lsp.TextDocumentPositionParams{
+		TextDocument: lsp.TextDocumentIdentifier{URI: uri},
+		Position:     lsp.Position{Line: line, Character: char},
+	}, &res)
+	if e, ok := err.(*jsonrpc2.Error); ok {
+		return "error: " + e.Message, nil
+	} else if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%d:%d-%d:%d", res.Start.Line+1, res.Start.Character+1, res.End.Line+1, res.End.Character+1), nil
+}
+
 func callSymbols(ctx context.Context, c *jsonrpc2.Conn, uri lsp.DocumentURI) ([]string, error) {
 	var symbols []lsp.SymbolInformation
 	err := c.Call(ctx, "textDocument/documentSymbol", lsp.DocumentSymbolParams{
@@ -1754,6 +3872,31 @@ func callSymbols(ctx context.Context, c *jsonrpc2.Conn, uri lsp.DocumentURI) ([]
 	return syms, nil
 }
 
+// callHierarchicalSymbols returns the symbols in depth first order as
+// "kind:parent.name range selectionRange".
+func callHierarchicalSymbols(ctx context.Context, c *jsonrpc2.Conn, uri lsp.DocumentURI) ([]string, error) {
+	var symbols []lsp.DocumentSymbol
+	err := c.Call(ctx, "textDocument/documentSymbol", lsp.DocumentSymbolParams{
+		TextDocument: lsp.TextDocumentIdentifier{URI: uri},
+	}, &symbols)
+	if err != nil {
+		return nil, err
+	}
+	rng := func(r lsp.Range) string {
+		return fmt.Sprintf("%d:%d-%d:%d", r.Start.Line+1, r.Start.Character+1, r.End.Line+1, r.End.Character+1)
+	}
+	var syms []string
+	var walk func(prefix string, symbols []lsp.DocumentSymbol)
+	walk = func(prefix string, symbols []lsp.DocumentSymbol) {
+		for _, s := range symbols {
+			syms = append(syms, fmt.Sprintf("%s:%s%s %s %s", strings.ToLower(s.Kind.String()), prefix, s.Name, rng(s.Range), rng(s.SelectionRange)))
+			walk(prefix+s.Name+".", s.Children)
+		}
+	}
+	walk("", symbols)
+	return syms, nil
+}
+
 func callWorkspaceSymbols(ctx context.Context, c *jsonrpc2.Conn, params lspext.WorkspaceSymbolParams) ([]string, error) {
 	var symbols []lsp.SymbolInformation
 	err := c.Call(ctx, "workspace/symbol", params, &symbols)
@@ -1821,6 +3964,265 @@ func callFormatting(ctx context.Context, c *jsonrpc2.Conn, uri lsp.DocumentURI)
 	return edits, err
 }
 
+func callRangeFormatting(ctx context.Context, c *jsonrpc2.Conn, uri lsp.DocumentURI, rng lsp.Range) ([]lsp.TextEdit, error) {
+	var edits []lsp.TextEdit
+	err := c.Call(ctx, "textDocument/rangeFormatting", lsp.DocumentRangeFormattingParams{
+		TextDocument: lsp.TextDocumentIdentifier{URI: uri},
+		Range:        rng,
+	}, &edits)
+	return edits, err
+}
+
+func callOnTypeFormatting(ctx context.Context, c *jsonrpc2.Conn, uri lsp.DocumentURI, line, char int, ch string) ([]lsp.TextEdit, error) {
+	var edits []lsp.TextEdit
+	err := c.Call(ctx, "textDocument/onTypeFormatting", lsp.DocumentOnTypeFormattingParams{
+		TextDocument: lsp.TextDocumentIdentifier{URI: uri},
+		Position:     lsp.Position{Line: line, Character: char},
+		Ch:           ch,
+	}, &edits)
+	return edits, err
+}
+
+// callOrganizeImports returns the edit of the organize imports action for
+// uri as "start-end newText", prefixed by "v<version> " if it is for a
+// versioned document, or "" if there is no action.
+func callOrganizeImports(ctx context.Context, c *jsonrpc2.Conn, uri lsp.DocumentURI) (string, error) {
+	var actions []lsp.CodeAction
+	err := c.Call(ctx, "textDocument/codeAction", lsp.CodeActionParams{
+		TextDocument: lsp.TextDocumentIdentifier{URI: uri},
+		Context:      lsp.CodeActionContext{Only: []lsp.CodeActionKind{lsp.CAKSourceOrganizeImports}},
+	}, &actions)
+	if err != nil {
+		return "", err
+	}
+	if len(actions) == 0 {
+		return "", nil
+	}
+	if len(actions) != 1 || actions[0].Kind != lsp.CAKSourceOrganizeImports {
+		return "", fmt.Errorf("got actions %+v, want one organize imports action", actions)
+	}
+	return codeActionEdit(actions[0], uri)
+}
+
+// callAddImportFixes returns the quick fixes for the diagnostic "undefined:
+// name" at uri:line:char, as "title: edit" like callOrganizeImports.
+func callAddImportFixes(ctx context.Context, c *jsonrpc2.Conn, uri lsp.DocumentURI, line, char int, name string) ([]string, error) {
+	var actions []lsp.CodeAction
+	err := c.Call(ctx, "textDocument/codeAction", lsp.CodeActionParams{
+		TextDocument: lsp.TextDocumentIdentifier{URI: uri},
+		Context: lsp.CodeActionContext{
+			Diagnostics: []lsp.Diagnostic{{
+				Range: lsp.Range{
+					Start: lsp.Position{Line: line, Character: char},
+					End:   lsp.Position{Line: line, Character: char + len(name)},
+				},
+				Message: "undefined: " + name,
+			}},
+			Only: []lsp.CodeActionKind{lsp.CAKQuickFix},
+		},
+	}, &actions)
+	if err != nil {
+		return nil, err
+	}
+	fixes := []string{}
+	for _, a := range actions {
+		if a.Kind != lsp.CAKQuickFix || len(a.Diagnostics) != 1 {
+			return nil, fmt.Errorf("got action %+v, want a quick fix for the diagnostic", a)
+		}
+		edit, err := codeActionEdit(a, uri)
+		if err != nil {
+			return nil, err
+		}
+		fixes = append(fixes, a.Title+": "+edit)
+	}
+	return fixes, nil
+}
+
+func callImplementInterface(ctx context.Context, c *jsonrpc2.Conn, uri lsp.DocumentURI, line, char int) ([]string, error) {
+	var actions []lsp.CodeAction
+	pos := lsp.Position{Line: line, Character: char}
+	err := c.Call(ctx, "textDocument/codeAction", lsp.CodeActionParams{
+		TextDocument: lsp.TextDocumentIdentifier{URI: uri},
+		Range:        lsp.Range{Start: pos, End: pos},
+		Context:      lsp.CodeActionContext{Only: []lsp.CodeActionKind{lsp.CAKQuickFix}},
+	}, &actions)
+	if err != nil {
+		return nil, err
+	}
+	stubs := []string{}
+	for _, a := range actions {
+		edit, err := codeActionEdit(a, uri)
+		if err != nil {
+			return nil, err
+		}
+		stubs = append(stubs, a.Title+": "+edit)
+	}
+	return stubs, nil
+}
+
+// codeActionEdit returns the single edit of action to uri as "start-end
+// newText", prefixed by "v<version> " if it is for a versioned document.
+func codeActionEdit(action lsp.CodeAction, uri lsp.DocumentURI) (string, error) {
+	if action.Edit == nil {
+		return "", fmt.Errorf("got action %+v without an edit", action)
+	}
+	var prefix string
+	edits := action.Edit.Changes[string(uri)]
+	if dc := action.Edit.DocumentChanges; len(dc) == 1 && dc[0].TextDocument.URI == uri {
+		prefix = fmt.Sprintf("v%d ", dc[0].TextDocument.Version)
+		edits = dc[0].Edits
+	}
+	if len(edits) != 1 {
+		return "", fmt.Errorf("got edit %+v, want one edit to %s", action.Edit, uri)
+	}
+	r := edits[0].Range
+	return fmt.Sprintf("%s%d:%d-%d:%d %s", prefix, r.Start.Line+1, r.Start.Character+1, r.End.Line+1, r.End.Character+1, edits[0].NewText), nil
+}
+
+func callFoldingRanges(ctx context.Context, c *jsonrpc2.Conn, uri lsp.DocumentURI) ([]string, error) {
+	var res []lsp.FoldingRange
+	err := c.Call(ctx, "textDocument/foldingRange", lsp.FoldingRangeParams{
+		TextDocument: lsp.TextDocumentIdentifier{URI: uri},
+	}, &res)
+	if err != nil {
+		return nil, err
+	}
+	str := make([]string, len(res))
+	for i, r := range res {
+		// Lines are left zero-based, as sent on the wire.
+		str[i] = fmt.Sprintf("%d-%d", r.StartLine, r.EndLine)
+		if r.Kind != "" {
+			str[i] += ":" + string(r.Kind)
+		}
+	}
+	return str, nil
+}
+
+func callDocumentLinks(ctx context.Context, c *jsonrpc2.Conn, uri lsp.DocumentURI) ([]string, error) {
+	var res []lsp.DocumentLink
+	err := c.Call(ctx, "textDocument/documentLink", lsp.DocumentLinkParams{
+		TextDocument: lsp.TextDocumentIdentifier{URI: uri},
+	}, &res)
+	if err != nil {
+		return nil, err
+	}
+	str := make([]string, len(res))
+	for i, l := range res {
+		r := l.Range
+		str[i] = fmt.Sprintf("%d:%d-%d:%d %s", r.Start.Line+1, r.Start.Character+1, r.End.Line+1, r.End.Character+1, l.Target)
+	}
+	return str, nil
+}
+
+// callCodeLenses returns the code lenses of uri as "range title command
+// arguments", or "range unresolved" for a lens without a command. If
+// resolve is set each lens is resolved first.
+func callCodeLenses(ctx context.Context, c *jsonrpc2.Conn, uri lsp.DocumentURI, resolve bool) ([]string, error) {
+	var res []lsp.CodeLens
+	err := c.Call(ctx, "textDocument/codeLens", lsp.CodeLensParams{
+		TextDocument: lsp.TextDocumentIdentifier{URI: uri},
+	}, &res)
+	if err != nil {
+		return nil, err
+	}
+	str := make([]string, len(res))
+	for i, l := range res {
+		if resolve {
+			if err := c.Call(ctx, "codeLens/resolve", l, &l); err != nil {
+				return nil, err
+			}
+		}
+		r := l.Range
+		str[i] = fmt.Sprintf("%d:%d-%d:%d", r.Start.Line+1, r.Start.Character+1, r.End.Line+1, r.End.Character+1)
+		if l.Command == nil {
+			str[i] += " unresolved"
+			continue
+		}
+		str[i] += fmt.Sprintf(" %s %s %v", l.Command.Title, l.Command.Command, l.Command.Arguments)
+	}
+	return str, nil
+}
+
+// callSemanticTokens returns the semantic tokens of uri, decoded as
+// "line:char-length type modifiers", one-based.
+func callSemanticTokens(ctx context.Context, c *jsonrpc2.Conn, uri lsp.DocumentURI) ([]string, error) {
+	var res lsp.SemanticTokens
+	err := c.Call(ctx, "textDocument/semanticTokens/full", lsp.SemanticTokensParams{
+		TextDocument: lsp.TextDocumentIdentifier{URI: uri},
+	}, &res)
+	if err != nil {
+		return nil, err
+	}
+	if len(res.Data)%5 != 0 {
+		return nil, fmt.Errorf("got %d integers, want a multiple of 5", len(res.Data))
+	}
+	str := make([]string, 0, len(res.Data)/5)
+	var line, char uint32
+	for i := 0; i < len(res.Data); i += 5 {
+		d := res.Data[i : i+5]
+		if d[0] != 0 {
+			char = 0
+		}
+		line += d[0]
+		char += d[1]
+		tok := fmt.Sprintf("%d:%d-%d %s", line+1, char+1, d[2], semanticTokenTypes[d[3]])
+		for j, m := range semanticTokenModifiers {
+			if d[4]&(1<<uint(j)) != 0 {
+				tok += " " + string(m)
+			}
+		}
+		str = append(str, tok)
+	}
+	return str, nil
+}
+
+func callPrepareCallHierarchy(ctx context.Context, c *jsonrpc2.Conn, uri lsp.DocumentURI, line, char int) ([]lsp.CallHierarchyItem, error) {
+	var res []lsp.CallHierarchyItem
+	err := c.Call(ctx, "textDocument/prepareCallHierarchy", lsp.CallHierarchyPrepareParams{
+		TextDocumentPositionParams: lsp.TextDocumentPositionParams{
+			TextDocument: lsp.TextDocumentIdentifier{URI: uri},
+			Position:     lsp.Position{Line: line, Character: char},
+		},
+	}, &res)
+	return res, err
+}
+
+// callCallHierarchyCalls returns the calls which method, incomingCalls or
+// outgoingCalls, reports for item. Each is the item of the other function
+// followed by the ranges of its calls.
+func callCallHierarchyCalls(ctx context.Context, c *jsonrpc2.Conn, method string, item lsp.CallHierarchyItem) ([]string, error) {
+	var res []struct {
+		From       *lsp.CallHierarchyItem
+		To         *lsp.CallHierarchyItem
+		FromRanges []lsp.Range
+	}
+	if err := c.Call(ctx, method, lsp.CallHierarchyIncomingCallsParams{Item: item}, &res); err != nil {
+		return nil, err
+	}
+	str := make([]string, len(res))
+	for i, call := range res {
+		other := call.From
+		if other == nil {
+			other = call.To
+		}
+		ranges := make([]string, len(call.FromRanges))
+		for j, r := range call.FromRanges {
+			ranges[j] = rangeString(r)
+		}
+		str[i] = fmt.Sprintf("%s from %s", callHierarchyItemString(*other), strings.Join(ranges, ", "))
+	}
+	return str, nil
+}
+
+func callHierarchyItemString(item lsp.CallHierarchyItem) string {
+	return fmt.Sprintf("%s %s %s %s:%s %s", item.Name, item.Detail, item.Kind, util.UriToPath(item.URI), rangeString(item.Range), rangeString(item.SelectionRange))
+}
+
+// rangeString formats r with one-based lines and characters.
+func rangeString(r lsp.Range) string {
+	return fmt.Sprintf("%d:%d-%d:%d", r.Start.Line+1, r.Start.Character+1, r.End.Line+1, r.End.Character+1)
+}
+
 type markedStrings []lsp.MarkedString
 
 func (v *markedStrings) UnmarshalJSON(data []byte) error {
@@ -2,15 +2,17 @@ package langserver
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"go/ast"
 	"go/build"
 	"go/parser"
 	"go/token"
 	"go/types"
-	"log"
 	"path"
 	"reflect"
+	"runtime"
 	"strings"
 
 	opentracing "github.com/opentracing/opentracing-go"
@@ -43,43 +45,43 @@ func (h *LangHandler) typecheck(ctx context.Context, conn jsonrpc2.JSONRPC2, fil
 	if err != nil {
 		return nil, nil, nil, nil, nil, nil, err
 	}
-	offset, valid, why := offsetForPosition(contents, position)
+	offset, valid, why := offsetForPosition(contents, position, h.positionEncoding())
 	if !valid {
 		return nil, nil, nil, nil, nil, nil, fmt.Errorf("invalid position: %s:%d:%d (%s)", filename, position.Line, position.Character, why)
 	}
 
 	bctx := h.BuildContext(ctx)
+	if alt, ok := excludedFileContext(bctx, filename); ok {
+		// The file isn't part of its package under the current build
+		// context, so the package is typechecked as it is built with
+		// the file.
+		debugf("typechecking %s with GOOS=%s, GOARCH=%s and tags %v, which include it", filename, alt.GOOS, alt.GOARCH, alt.BuildTags)
+		bctx = alt
+	}
 
-	bpkg, err := ContainingPackage(bctx, filename)
+	bpkg, err := containingPackage(bctx, filename, h.mainModule(bctx, filename))
 	if mpErr, ok := err.(*build.MultiplePackageError); ok {
 		bpkg, err = buildPackageForNamedFileInMultiPackageDir(bpkg, mpErr, path.Base(filename))
 		if err != nil {
 			return nil, nil, nil, nil, nil, nil, err
 		}
-	} else if err != nil {
+	} else if err != nil && !isPartialPackageError(bpkg, err) {
 		return nil, nil, nil, nil, nil, nil, err
 	}
 
 	// TODO(sqs): do all pkgs in workspace together?
-	fset, prog, diags, err := h.cachedTypecheck(ctx, bctx, bpkg)
+	fset, prog, _, err := h.cachedTypecheck(ctx, bctx, bpkg)
 	if err != nil {
 		return nil, nil, nil, nil, nil, nil, err
 	}
 
-	if len(diags) > 0 {
-		go func() {
-			if err := h.publishDiagnostics(ctx, conn, diags); err != nil {
-				log.Printf("warning: failed to send diagnostics: %s.", err)
-			}
-		}()
-	}
-
 	start := posForFileOffset(fset, filename, offset)
 	if start == token.NoPos {
 		return nil, nil, nil, nil, nil, nil, fmt.Errorf("invalid location: %s:#%d", filename, offset)
 	}
 
 	pkg, nodes, _ := prog.PathEnclosingInterval(start, start)
+	nodes = typeParamsPath(nodes, start)
 	if len(nodes) == 0 {
 		return nil, nil, nil, nil, nil, nil, fmt.Errorf("no node found at %s offset %d", fset.Position(start), offset)
 	}
@@ -97,6 +99,33 @@ func (h *LangHandler) typecheck(ctx context.Context, conn jsonrpc2.JSONRPC2, fil
 	return fset, node, nodes, prog, pkg, &start, nil
 }
 
+// typeParamsPath corrects the path PathEnclosingInterval returns for pos
+// if pos is in the type parameters of a function declaration. The
+// vendored astutil doesn't descend into them, so the path it returns ends
+// at the declaration.
+func typeParamsPath(path []ast.Node, pos token.Pos) []ast.Node {
+	for i, n := range path {
+		fd, ok := n.(*ast.FuncDecl)
+		if !ok {
+			continue
+		}
+		tparams := fd.Type.TypeParams
+		if tparams == nil || pos < tparams.Pos() || pos >= tparams.End() {
+			return path
+		}
+		var inner []ast.Node
+		ast.Inspect(tparams, func(n ast.Node) bool {
+			if n == nil || pos < n.Pos() || pos >= n.End() {
+				return false
+			}
+			inner = append([]ast.Node{n}, inner...)
+			return true
+		})
+		return append(inner, path[i:]...)
+	}
+	return path
+}
+
 type invalidNodeError struct {
 	Node ast.Node
 	msg  string
@@ -180,17 +209,31 @@ func buildPackageForNamedFileInMultiPackageDir(bpkg *build.Package, m *build.Mul
 type typecheckKey struct {
 	importPath, srcDir, name string
 
+	// hash is of the names and contents of the package's files, so that
+	// a result is never used after one of them changes.
+	hash string
+
+	// buildTags, goos and goarch affect which files imported packages
+	// are made of.
+	buildTags, goos, goarch string
+
 	// TODO(sqs): needs to include a list of files in the key...there
 	// can be multiple packages (e.g., build-tag-disabled main.go
 	// files) with the same names
 
-	// TODO(sqs): include build context in key
+	// TODO(sqs): include the rest of the build context in key
 }
 
 type typecheckResult struct {
-	fset *token.FileSet
-	prog *loader.Program
-	err  error
+	fset  *token.FileSet
+	prog  *loader.Program
+	diags diagnostics
+	err   error
+
+	// cancelled is true if the request typechecking the package was
+	// cancelled before it finished, in which case err is the context's
+	// error.
+	cancelled bool
 }
 
 func (h *LangHandler) cachedTypecheck(ctx context.Context, bctx *build.Context, bpkg *build.Package) (*token.FileSet, *loader.Program, diagnostics, error) {
@@ -202,25 +245,76 @@ func (h *LangHandler) cachedTypecheck(ctx context.Context, bctx *build.Context,
 	ctx = opentracing.ContextWithSpan(ctx, span)
 	defer span.Finish()
 
-	var diags diagnostics
-	r := h.typecheckCache.Get(typecheckKey{bpkg.ImportPath, bpkg.Dir, bpkg.Name}, func() interface{} {
-		res := &typecheckResult{
-			fset: token.NewFileSet(),
+	hash, err := hashFiles(bctx, packageFiles(bctx, bpkg))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	key := typecheckKey{bpkg.ImportPath, bpkg.Dir, bpkg.Name, hash, strings.Join(bctx.BuildTags, ","), bctx.GOOS, bctx.GOARCH}
+	for {
+		r := h.typecheckCache.Get(key, func() interface{} {
+			res := &typecheckResult{
+				fset: token.NewFileSet(),
+			}
+			release, err := h.acquireLoad(ctx)
+			if err == nil {
+				res.prog, res.diags, res.err = typecheck(ctx, h.positionConverter(ctx), res.fset, bctx, bpkg, h.getFindPackageFunc())
+				release()
+			}
+			if err := ctx.Err(); err != nil {
+				// The program is incomplete, so it must not be
+				// kept for later requests.
+				res.prog, res.diags, res.err, res.cancelled = nil, nil, err, true
+				h.typecheckCache.Remove(key)
+			}
+			return res
+		})
+		if r == nil {
+			// This can happen if we panic
+			return nil, nil, nil, nil
 		}
-		res.prog, diags, res.err = typecheck(ctx, res.fset, bctx, bpkg, h.getFindPackageFunc())
-		return res
-	})
-	if r == nil {
-		// This can happen if we panic
-		return nil, nil, diags, nil
+		res := r.(*typecheckResult)
+		if res.cancelled && ctx.Err() == nil {
+			// Another request was typechecking the package and
+			// was cancelled, but this one still wants it.
+			continue
+		}
+		return res.fset, res.prog, res.diags, res.err
+	}
+}
+
+// acquireLoad blocks until fewer than maxParallelism packages are being
+// loaded, by this request or any other, and returns the func to call once
+// the load has finished. It returns ctx.Err() if ctx is done first.
+func (h *LangHandler) acquireLoad(ctx context.Context) (release func(), err error) {
+	h.mu.Lock()
+	if h.loads == nil {
+		h.loads = make(chan bool, h.maxParallelism())
+	}
+	loads := h.loads
+	h.mu.Unlock()
+	select {
+	case loads <- true:
+		return func() { <-loads }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
 	}
-	res := r.(*typecheckResult)
-	return res.fset, res.prog, diags, res.err
+}
+
+// maxParallelism returns Config.MaxParallelism, or GOMAXPROCS if it is 0.
+func (h *LangHandler) maxParallelism() int {
+	if n := h.config().MaxParallelism; n > 0 {
+		return n
+	}
+	return runtime.GOMAXPROCS(0)
 }
 
 // TODO(sqs): allow typechecking just a specific file not in a package, too
-func typecheck(ctx context.Context, fset *token.FileSet, bctx *build.Context, bpkg *build.Package, findPackage FindPackageFunc) (*loader.Program, diagnostics, error) {
+func typecheck(ctx context.Context, conv *positionConverter, fset *token.FileSet, bctx *build.Context, bpkg *build.Package, findPackage FindPackageFunc) (*loader.Program, diagnostics, error) {
 	var typeErrs []error
+	// An external test package sees the declarations of the in-package
+	// test files of the package it tests, as it does for go test.
+	xtest := strings.HasSuffix(bpkg.Name, "_test")
 	conf := loader.Config{
 		Fset: fset,
 		TypeChecker: types.Config{
@@ -238,15 +332,24 @@ func typecheck(ctx context.Context, fset *token.FileSet, bctx *build.Context, bp
 		},
 		ParserMode: parser.AllErrors | parser.ParseComments, // prevent parser from bailing out
 		FindPackage: func(bctx *build.Context, importPath, fromDir string, mode build.ImportMode) (*build.Package, error) {
+			// Once the request is cancelled no more packages are
+			// loaded, so that Load returns promptly.
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
 			// When importing a package, ignore any
 			// MultipleGoErrors. This occurs, e.g., when you have a
 			// main.go with "// +build ignore" that imports the
-			// non-main package in the same dir.
-			bpkg, err := findPackage(ctx, bctx, importPath, fromDir, mode)
-			if err != nil && !isMultiplePackageError(err) {
-				return bpkg, err
+			// non-main package in the same dir. Errors in some of
+			// its files are reported when they are typechecked.
+			imported, err := findPackage(ctx, bctx, importPath, fromDir, mode)
+			if err != nil && !isMultiplePackageError(err) && !isPartialPackageError(imported, err) {
+				return imported, err
 			}
-			return bpkg, nil
+			if imported != nil && xtest && imported.ImportPath == bpkg.ImportPath {
+				imported = withTestFiles(imported)
+			}
+			return withCgoFilesAsGo(imported), nil
 		},
 	}
 
@@ -264,8 +367,49 @@ func typecheck(ctx context.Context, fset *token.FileSet, bctx *build.Context, bp
 	// 	}
 	//
 
+	conf.CreateFromFilenames(bpkg.ImportPath, packageFiles(bctx, bpkg)...)
+	prog, err := conf.Load()
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+	if err != nil && prog == nil {
+		return nil, nil, err
+	}
+	return prog, errsToDiagnostics(conv, typeErrs, prog), nil
+}
+
+// withTestFiles returns a copy of bpkg whose files include its in-package
+// test files.
+func withTestFiles(bpkg *build.Package) *build.Package {
+	if len(bpkg.TestGoFiles) == 0 {
+		return bpkg
+	}
+	cpy := *bpkg
+	cpy.GoFiles = append(append([]string{}, bpkg.GoFiles...), bpkg.TestGoFiles...)
+	cpy.Imports = append(append([]string{}, bpkg.Imports...), bpkg.TestImports...)
+	return &cpy
+}
+
+// withCgoFilesAsGo returns a copy of bpkg whose cgo files are among its
+// Go files, so that the loader parses them as they are instead of running
+// cgo on them, which needs a C toolchain and the files on disk. The type
+// checker fakes the "C" package they import, whose members have no type.
+func withCgoFilesAsGo(bpkg *build.Package) *build.Package {
+	if bpkg == nil || len(bpkg.CgoFiles) == 0 {
+		return bpkg
+	}
+	cpy := *bpkg
+	cpy.GoFiles = append(append([]string{}, bpkg.GoFiles...), bpkg.CgoFiles...)
+	cpy.CgoFiles = nil
+	return &cpy
+}
+
+// packageFiles returns the paths of the files typechecked for bpkg. Its
+// cgo files are typechecked like its other Go files.
+func packageFiles(bctx *build.Context, bpkg *build.Package) []string {
 	var goFiles []string
 	goFiles = append(goFiles, bpkg.GoFiles...)
+	goFiles = append(goFiles, bpkg.CgoFiles...)
 	goFiles = append(goFiles, bpkg.TestGoFiles...)
 	if strings.HasSuffix(bpkg.Name, "_test") {
 		goFiles = append(goFiles, bpkg.XTestGoFiles...)
@@ -273,16 +417,21 @@ func typecheck(ctx context.Context, fset *token.FileSet, bctx *build.Context, bp
 	for i, filename := range goFiles {
 		goFiles[i] = buildutil.JoinPath(bctx, bpkg.Dir, filename)
 	}
-	conf.CreateFromFilenames(bpkg.ImportPath, goFiles...)
-	prog, err := conf.Load()
-	if err != nil && prog == nil {
-		return nil, nil, err
-	}
-	diags, err := errsToDiagnostics(typeErrs, prog)
-	if err != nil {
-		return nil, nil, err
+	return goFiles
+}
+
+// hashFiles returns a hash of the names and contents of files.
+func hashFiles(bctx *build.Context, files []string) (string, error) {
+	h := sha256.New()
+	for _, filename := range files {
+		contents, err := readFile(bctx, filename)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "%s\x00%d\x00", filename, len(contents))
+		h.Write(contents)
 	}
-	return prog, diags, nil
+	return hex.EncodeToString(h.Sum(nil)), nil
 }
 
 func clearInfoFields(info *loader.PackageInfo) {
@@ -309,3 +458,14 @@ func isMultiplePackageError(err error) bool {
 	_, ok := err.(*build.MultiplePackageError)
 	return ok
 }
+
+// isPartialPackageError reports whether err, returned by go/build along
+// with bpkg, is about only some of the package's files, such as one whose
+// imports don't parse. The rest of the package can still be typechecked,
+// which gives the best type information there is.
+func isPartialPackageError(bpkg *build.Package, err error) bool {
+	if _, ok := err.(*build.NoGoError); ok || bpkg == nil {
+		return false
+	}
+	return len(bpkg.GoFiles)+len(bpkg.CgoFiles)+len(bpkg.TestGoFiles)+len(bpkg.XTestGoFiles) > 0
+}
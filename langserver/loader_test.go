@@ -9,6 +9,7 @@ import (
 	"path"
 	"reflect"
 	"testing"
+	"time"
 
 	opentracing "github.com/opentracing/opentracing-go"
 
@@ -45,7 +46,7 @@ func TestLoader(t *testing.T) {
 	for label, tc := range loaderCases {
 		t.Run(label, func(t *testing.T) {
 			fset, bctx, bpkg := setUpLoaderTest(tc.fs)
-			p, _, err := typecheck(ctx, fset, bctx, bpkg, defaultFindPackageFunc)
+			p, _, err := typecheck(ctx, nil, fset, bctx, bpkg, defaultFindPackageFunc)
 			if err != nil {
 				t.Error(err)
 			} else if len(p.Created) == 0 {
@@ -57,6 +58,25 @@ func TestLoader(t *testing.T) {
 	}
 }
 
+func TestLoaderCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	fset, bctx, bpkg := setUpLoaderTest(loaderCases["imports net/http"].fs)
+	var finds int
+	findPackage := func(ctx context.Context, bctx *build.Context, importPath, fromDir string, mode build.ImportMode) (*build.Package, error) {
+		// Cancel while importing net/http, before any of its imports
+		// are found.
+		finds++
+		cancel()
+		return defaultFindPackageFunc(ctx, bctx, importPath, fromDir, mode)
+	}
+	if _, _, err := typecheck(ctx, nil, fset, bctx, bpkg, findPackage); err != context.Canceled {
+		t.Errorf("got error %v, want %v", err, context.Canceled)
+	}
+	if finds != 1 {
+		t.Errorf("got %d packages found, want 1", finds)
+	}
+}
+
 // BenchmarkLoader measures the performance of loading and
 // typechecking.
 //
@@ -70,7 +90,7 @@ func BenchmarkLoader(b *testing.B) {
 			fset, bctx, bpkg := setUpLoaderTest(tc.fs)
 			b.ResetTimer()
 			for i := 0; i < b.N; i++ {
-				if _, _, err := typecheck(ctx, fset, bctx, bpkg, defaultFindPackageFunc); err != nil {
+				if _, _, err := typecheck(ctx, nil, fset, bctx, bpkg, defaultFindPackageFunc); err != nil {
 					b.Error(err)
 				}
 			}
@@ -118,7 +138,7 @@ func TestLoaderDiagnostics(t *testing.T) {
 	for _, tc := range cases {
 		t.Run(tc.Name, func(t *testing.T) {
 			fset, bctx, bpkg := setUpLoaderTest(tc.FS)
-			_, diag, err := typecheck(ctx, fset, bctx, bpkg, defaultFindPackageFunc)
+			_, diag, err := typecheck(ctx, nil, fset, bctx, bpkg, defaultFindPackageFunc)
 			if err != nil {
 				t.Error(err)
 			}
@@ -142,6 +162,30 @@ func TestLoaderDiagnostics(t *testing.T) {
 	}
 }
 
+func TestLoaderCgo(t *testing.T) {
+	fset, bctx, bpkg := setUpLoaderTest(map[string]string{
+		"/src/p/f.go": `package p; import "C"; import "q"; var _ = C.int(q.X + q.Y)`,
+		"/src/q/q.go": `package q; var X int`,
+		"/src/q/c.go": "package q\n\n// int y;\nimport \"C\"\n\nvar Y = int(C.y)\n",
+	})
+	bctx.CgoEnabled = true
+	bpkg.GoFiles, bpkg.CgoFiles = nil, []string{"f.go"}
+	// Running cgo on q's cgo file would fail, as it isn't on disk.
+	findPackage := func(ctx context.Context, bctx *build.Context, importPath, fromDir string, mode build.ImportMode) (*build.Package, error) {
+		return &build.Package{ImportPath: "q", Name: "q", Dir: "/src/q", GoFiles: []string{"q.go"}, CgoFiles: []string{"c.go"}}, nil
+	}
+	prog, diags, err := typecheck(context.Background(), nil, fset, bctx, bpkg, findPackage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diags) > 0 {
+		t.Errorf("got diagnostics %+v, want none", diags)
+	}
+	if len(prog.Created) == 0 || len(prog.Created[0].Files) != 1 {
+		t.Error("the cgo file of the package wasn't typechecked")
+	}
+}
+
 func setUpLoaderTest(fs map[string]string) (*token.FileSet, *build.Context, *build.Package) {
 	h := LangHandler{HandlerShared: new(HandlerShared)}
 	if err := h.reset(&InitializeParams{
@@ -254,3 +298,40 @@ func TestBuildPackageForNamedFileInMultiPackageDir(t *testing.T) {
 		})
 	}
 }
+
+func TestAcquireLoad(t *testing.T) {
+	ctx := context.Background()
+	h := &LangHandler{Config: Config{MaxParallelism: 2}}
+	acquire := func() func() {
+		release, err := h.acquireLoad(ctx)
+		if err != nil {
+			t.Error(err)
+		}
+		return release
+	}
+	release1 := acquire()
+	release2 := acquire()
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := h.acquireLoad(cancelled); err != context.Canceled {
+		t.Errorf("got error %v acquiring a load for a cancelled request, want %v", err, context.Canceled)
+	}
+
+	acquired := make(chan func())
+	go func() { acquired <- acquire() }()
+	select {
+	case <-acquired:
+		t.Fatal("acquired a third load with MaxParallelism 2")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	release1()
+	select {
+	case release3 := <-acquired:
+		release3()
+	case <-time.After(5 * time.Second):
+		t.Fatal("load not acquired after another was released")
+	}
+	release2()
+}
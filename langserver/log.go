@@ -0,0 +1,98 @@
+package langserver
+
+import (
+	"fmt"
+	"log"
+	"sync"
+)
+
+// LogLevel is the severity of a message logged by the server. Messages
+// below Config.LogLevel are dropped.
+type LogLevel int
+
+const (
+	LogDebug LogLevel = iota
+	LogInfo
+	LogWarn
+	LogError
+)
+
+var logLevelNames = map[LogLevel]string{
+	LogDebug: "debug",
+	LogInfo:  "info",
+	LogWarn:  "warn",
+	LogError: "error",
+}
+
+func (l LogLevel) String() string {
+	if name, ok := logLevelNames[l]; ok {
+		return name
+	}
+	return fmt.Sprintf("LogLevel(%d)", int(l))
+}
+
+// parseLogLevel returns the level named s, as in Config.LogLevel. Unknown
+// names are LogInfo.
+func parseLogLevel(s string) LogLevel {
+	for l, name := range logLevelNames {
+		if name == s {
+			return l
+		}
+	}
+	return LogInfo
+}
+
+// Logger writes the messages logged by the server which aren't dropped
+// because of their level.
+type Logger interface {
+	Log(level LogLevel, msg string)
+}
+
+// stdLogger is the default Logger, which writes messages with the
+// standard log package.
+type stdLogger struct{}
+
+func (stdLogger) Log(level LogLevel, msg string) {
+	log.Println(msg)
+}
+
+var logState = struct {
+	sync.Mutex
+	logger Logger
+	level  LogLevel
+}{logger: stdLogger{}, level: LogInfo}
+
+// SetLogger makes l receive the messages the server logs from now on, and
+// returns the Logger which did before.
+func SetLogger(l Logger) Logger {
+	logState.Lock()
+	defer logState.Unlock()
+	old := logState.logger
+	logState.logger = l
+	return old
+}
+
+// setLogLevel makes the server drop messages below the level named
+// name.
+func setLogLevel(name string) {
+	logState.Lock()
+	logState.level = parseLogLevel(name)
+	logState.Unlock()
+}
+
+// logf logs the message formatted from format and args at level, unless
+// it is below the configured level.
+func logf(level LogLevel, format string, args ...interface{}) {
+	logState.Lock()
+	logger, threshold := logState.logger, logState.level
+	logState.Unlock()
+	if level < threshold {
+		return
+	}
+	logger.Log(level, fmt.Sprintf(format, args...))
+}
+
+func debugf(format string, args ...interface{}) { logf(LogDebug, format, args...) }
+func infof(format string, args ...interface{})  { logf(LogInfo, format, args...) }
+func warnf(format string, args ...interface{})  { logf(LogWarn, format, args...) }
+func errorf(format string, args ...interface{}) { logf(LogError, format, args...) }
@@ -0,0 +1,44 @@
+package langserver
+
+import (
+	"reflect"
+	"testing"
+)
+
+type recordingLogger struct {
+	msgs []string
+}
+
+func (l *recordingLogger) Log(level LogLevel, msg string) {
+	l.msgs = append(l.msgs, level.String()+": "+msg)
+}
+
+func TestLogLevel(t *testing.T) {
+	var rec recordingLogger
+	old := SetLogger(&rec)
+	defer SetLogger(old)
+	defer setLogLevel(NewDefaultConfig().LogLevel)
+
+	for _, level := range []string{"debug", "warn", "bogus"} {
+		setLogLevel(level)
+		debugf("refs.DefInfo: %s", level)
+		infof("info %s", level)
+		warnf("warning %s", level)
+		errorf("error %s", level)
+	}
+	want := []string{
+		"debug: refs.DefInfo: debug",
+		"info: info debug",
+		"warn: warning debug",
+		"error: error debug",
+		"warn: warning warn",
+		"error: error warn",
+		// Unknown levels are info.
+		"info: info bogus",
+		"warn: warning bogus",
+		"error: error bogus",
+	}
+	if !reflect.DeepEqual(rec.msgs, want) {
+		t.Errorf("got messages %q, want %q", rec.msgs, want)
+	}
+}
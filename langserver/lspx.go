@@ -1,6 +1,10 @@
 package langserver
 
-import "github.com/sourcegraph/go-langserver/pkg/lsp"
+import (
+	"encoding/json"
+
+	"github.com/sourcegraph/go-langserver/pkg/lsp"
+)
 
 // This file contains Go-specific extensions to LSP types.
 //
@@ -11,6 +15,11 @@ import "github.com/sourcegraph/go-langserver/pkg/lsp"
 type InitializeParams struct {
 	lsp.InitializeParams
 
+	// InitializationOptions are the initializationOptions of the
+	// initialize request, which are decoded as the Go language server's
+	// options by initializationOptions. Clients may send other values.
+	InitializationOptions json.RawMessage `json:"initializationOptions,omitempty"`
+
 	// NoOSFileSystemAccess makes the server never access the OS file
 	// system. It exclusively uses the file overlay (from
 	// textDocument/didOpen) and the LSP proxy's VFS.
@@ -27,6 +36,131 @@ type InitializeParams struct {
 	RootImportPath string
 }
 
+// InitializationOptions are the options a client may pass as the
+// initializationOptions of the initialize request.
+type InitializationOptions struct {
+	// Overlay holds the contents of documents, keyed by URI, which the
+	// server reads instead of the file system. It lets a client with
+	// several unsaved buffers send them all at once rather than a
+	// textDocument/didOpen for each. The documents may be changed by
+	// textDocument/didChange as if they had been opened.
+	Overlay map[lsp.DocumentURI]string `json:"overlay,omitempty"`
+}
+
+// initializationOptions returns the options of p. It returns nil if there
+// are none, or if they aren't the Go language server's, as for clients
+// which send their own options to every server.
+func (p *InitializeParams) initializationOptions() *InitializationOptions {
+	if len(p.InitializationOptions) == 0 {
+		return nil
+	}
+	var opts InitializationOptions
+	if err := json.Unmarshal(p.InitializationOptions, &opts); err != nil {
+		warnf("ignoring initializationOptions: %s", err)
+		return nil
+	}
+	return &opts
+}
+
+// DidChangeConfigurationParams are the params of
+// workspace/didChangeConfiguration, whose settings are specific to the Go
+// language server.
+type DidChangeConfigurationParams struct {
+	Settings ConfigurationSettings `json:"settings"`
+}
+
+// ConfigurationSettings are the settings which can be changed by
+// workspace/didChangeConfiguration. Each is the Config field of the same
+// name. Settings which are absent are left unchanged.
+type ConfigurationSettings struct {
+	FuncSnippetEnabled             *bool     `json:"funcSnippetEnabled,omitempty"`
+	HoverBackend                   *string   `json:"hoverBackend,omitempty"`
+	FormatTool                     *string   `json:"formatTool,omitempty"`
+	FormatGoVersion                *string   `json:"formatGoVersion,omitempty"`
+	GoimportsLocalPrefix           *string   `json:"goimportsLocalPrefix,omitempty"`
+	DocLinkBaseURL                 *string   `json:"docLinkBaseURL,omitempty"`
+	MaxWorkspaceSymbols            *int      `json:"maxWorkspaceSymbols,omitempty"`
+	SymbolScope                    *string   `json:"symbolScope,omitempty"`
+	DefinitionTarget               *string   `json:"definitionTarget,omitempty"`
+	IncludeUnexportedSymbols       *bool     `json:"includeUnexportedSymbols,omitempty"`
+	DiagnosticsEnabled             *bool     `json:"diagnosticsEnabled,omitempty"`
+	UnusedImportDiagnosticsEnabled *bool     `json:"unusedImportDiagnosticsEnabled,omitempty"`
+	DiagnosticsDebounceMs          *int      `json:"diagnosticsDebounceMs,omitempty"`
+	BuildTags                      *[]string `json:"buildTags,omitempty"`
+	FollowTypeAliases              *bool     `json:"followTypeAliases,omitempty"`
+	ReferenceCodeLensesEnabled     *bool     `json:"referenceCodeLensesEnabled,omitempty"`
+	MaxReferenceResults            *int      `json:"maxReferenceResults,omitempty"`
+	ExcludeDirs                    *[]string `json:"excludeDirs,omitempty"`
+	LogLevel                       *string   `json:"logLevel,omitempty"`
+}
+
+// ServerStatus is the result of the langserver.status command of
+// workspace/executeCommand, which reports how much the server holds in
+// memory.
+type ServerStatus struct {
+	// TypecheckedPackages is the number of typechecked packages in the
+	// cache, including those being typechecked.
+	TypecheckedPackages int `json:"typecheckedPackages"`
+
+	// SymbolPackages is the number of packages whose symbols are in the
+	// cache.
+	SymbolPackages int `json:"symbolPackages"`
+
+	// LoadsInProgress is the number of packages being loaded.
+	LoadsInProgress int `json:"loadsInProgress"`
+
+	// HeapAllocBytes is the size of the live heap objects, and SysBytes
+	// the memory obtained from the OS, as in runtime.MemStats.
+	HeapAllocBytes uint64 `json:"heapAllocBytes"`
+	SysBytes       uint64 `json:"sysBytes"`
+
+	// UptimeSeconds is how long the server process has been running.
+	UptimeSeconds float64 `json:"uptimeSeconds"`
+}
+
+// FreeGCResult is the result of the langserver.freeGC command of
+// workspace/executeCommand, which reports the memory use before and after
+// collecting garbage and returning memory to the OS.
+type FreeGCResult struct {
+	Before MemoryStats `json:"before"`
+	After  MemoryStats `json:"after"`
+}
+
+// MemoryStats are the sizes of runtime.MemStats of the same names.
+type MemoryStats struct {
+	HeapAllocBytes    uint64 `json:"heapAllocBytes"`
+	HeapReleasedBytes uint64 `json:"heapReleasedBytes"`
+	SysBytes          uint64 `json:"sysBytes"`
+}
+
+// BuildContextInfo is the result of the langserver.buildContext command
+// of workspace/executeCommand. Its fields are those of the go/build.Context
+// the server resolves packages with.
+type BuildContextInfo struct {
+	GOROOT     string   `json:"GOROOT"`
+	GOPATH     string   `json:"GOPATH"`
+	GOOS       string   `json:"GOOS"`
+	GOARCH     string   `json:"GOARCH"`
+	BuildTags  []string `json:"BuildTags"`
+	CgoEnabled bool     `json:"CgoEnabled"`
+}
+
+// CodeDefinitionNotFound is the code of the error returned by
+// textDocument/definition, textDocument/typeDefinition and
+// textDocument/xdefinition when there is an identifier at the position but
+// it has no definition, such as an undeclared name. Its data is a
+// DefinitionNotFoundData. Positions which aren't on an identifier have no
+// definitions instead, without an error.
+const CodeDefinitionNotFound = -32001
+
+// DefinitionNotFoundData is the data of a CodeDefinitionNotFound error.
+type DefinitionNotFoundData struct {
+	lsp.TextDocumentPositionParams
+
+	// Identifier is the name at the position.
+	Identifier string `json:"identifier"`
+}
+
 type InitializeBuildContextParams struct {
 	// These fields correspond to the fields of the same name from
 	// go/build.Context.
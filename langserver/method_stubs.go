@@ -0,0 +1,218 @@
+package langserver
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/tools/go/loader"
+
+	"github.com/sourcegraph/go-langserver/pkg/lsp"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+// interfaceAssertion is a package-level declaration that a type of the
+// package satisfies an interface, such as "var _ I = (*T)(nil)".
+type interfaceAssertion struct {
+	spec  *ast.ValueSpec
+	iface types.Type
+	recv  types.Type // the named type or a pointer to it
+	named *types.Named
+}
+
+// implementInterfaceActions returns an "Implement interface" action for
+// each interface which the type at rng is declared to satisfy but
+// doesn't, because it is missing methods. The action is also returned
+// when rng is on the assertion, where the type checker reports the
+// error, and it is attributed to the diagnostics of diags there. It adds
+// stubs of the missing methods after the declaration of the type.
+func (h *LangHandler) implementInterfaceActions(ctx context.Context, conn jsonrpc2.JSONRPC2, uri lsp.DocumentURI, rng lsp.Range, diags []lsp.Diagnostic) ([]lsp.CodeAction, error) {
+	fset, _, nodes, _, pkg, start, err := h.typecheck(ctx, conn, uri, rng.Start)
+	if err != nil {
+		if _, ok := err.(*invalidNodeError); !ok {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			return nil, nil
+		}
+	}
+	var selected types.Object
+	if id, ok := nodes[0].(*ast.Ident); ok {
+		selected = pkg.ObjectOf(id)
+	}
+
+	var actions []lsp.CodeAction
+	for _, a := range interfaceAssertions(pkg) {
+		if a.named.Obj() != selected && (*start < a.spec.Pos() || *start > a.spec.End()) {
+			continue
+		}
+		missing := missingMethods(a.recv, a.iface.Underlying().(*types.Interface))
+		if len(missing) == 0 {
+			continue
+		}
+		f, decl := typeDecl(pkg, a.named.Obj())
+		if decl == nil {
+			continue
+		}
+		qf := fileQualifier(pkg, f)
+		loc := goRangeToLSPLocation(h.positionConverter(ctx), fset, decl.End(), decl.End())
+		edit := lsp.TextEdit{
+			Range:   loc.Range,
+			NewText: methodStubs(receiverName(a.named), a.recv, missing, qf),
+		}
+		startLine, endLine := fset.Position(a.spec.Pos()).Line-1, fset.Position(a.spec.End()).Line-1
+		var fixed []lsp.Diagnostic
+		for _, d := range diags {
+			if d.Range.Start.Line >= startLine && d.Range.Start.Line <= endLine {
+				fixed = append(fixed, d)
+			}
+		}
+		actions = append(actions, lsp.CodeAction{
+			Title:       fmt.Sprintf("Implement interface %s", types.TypeString(a.iface, qf)),
+			Kind:        lsp.CAKQuickFix,
+			Diagnostics: fixed,
+			Edit:        h.documentEdit(loc.URI, edit),
+		})
+	}
+	return actions, nil
+}
+
+// interfaceAssertions returns the declarations in pkg that its
+// package-level types satisfy interfaces, which are variable declarations
+// of an interface type whose values have the type.
+func interfaceAssertions(pkg *loader.PackageInfo) []interfaceAssertion {
+	var assertions []interfaceAssertion
+	for _, f := range pkg.Files {
+		for _, decl := range f.Decls {
+			gd, ok := decl.(*ast.GenDecl)
+			if !ok || gd.Tok != token.VAR {
+				continue
+			}
+			for _, spec := range gd.Specs {
+				vs := spec.(*ast.ValueSpec)
+				if vs.Type == nil {
+					continue
+				}
+				iface := pkg.TypeOf(vs.Type)
+				if iface == nil || !types.IsInterface(iface) {
+					continue
+				}
+				for _, v := range vs.Values {
+					recv := pkg.TypeOf(v)
+					t := recv
+					if ptr, ok := t.(*types.Pointer); ok {
+						t = ptr.Elem()
+					}
+					named, ok := t.(*types.Named)
+					if !ok || named.Obj().Pkg() != pkg.Pkg || named.Obj().Parent() != pkg.Pkg.Scope() {
+						continue
+					}
+					assertions = append(assertions, interfaceAssertion{spec: vs, iface: iface, recv: recv, named: named})
+				}
+			}
+		}
+	}
+	return assertions
+}
+
+// missingMethods returns the methods of iface which recv has no field or
+// method by the name of. Methods of the same name but a different
+// signature aren't stubbed, since the existing one must be fixed instead.
+// Neither are the methods of the pointer to recv: it doesn't satisfy
+// iface without them, but declaring them again wouldn't compile.
+func missingMethods(recv types.Type, iface *types.Interface) []*types.Func {
+	if _, ok := recv.(*types.Pointer); !ok {
+		recv = types.NewPointer(recv)
+	}
+	var missing []*types.Func
+	for i := 0; i < iface.NumMethods(); i++ {
+		m := iface.Method(i)
+		if obj, _, _ := types.LookupFieldOrMethod(recv, false, m.Pkg(), m.Name()); obj == nil {
+			missing = append(missing, m)
+		}
+	}
+	return missing
+}
+
+// typeDecl returns the declaration of the package-level type obj in pkg,
+// and the file it is in.
+func typeDecl(pkg *loader.PackageInfo, obj *types.TypeName) (*ast.File, *ast.GenDecl) {
+	for _, f := range pkg.Files {
+		if obj.Pos() < f.Pos() || obj.Pos() > f.End() {
+			continue
+		}
+		for _, decl := range f.Decls {
+			if gd, ok := decl.(*ast.GenDecl); ok && gd.Tok == token.TYPE && gd.Pos() <= obj.Pos() && obj.Pos() < gd.End() {
+				return f, gd
+			}
+		}
+	}
+	return nil, nil
+}
+
+// fileQualifier returns the qualifier of the packages used in f, the
+// names it imports them by. Packages f doesn't import are qualified by
+// their names.
+func fileQualifier(pkg *loader.PackageInfo, f *ast.File) types.Qualifier {
+	return func(p *types.Package) string {
+		if p == pkg.Pkg {
+			return ""
+		}
+		for _, spec := range f.Imports {
+			if pkgName := importPkgName(pkg, spec); pkgName != nil && pkgName.Imported() == p {
+				if pkgName.Name() == "." {
+					return ""
+				}
+				return pkgName.Name()
+			}
+		}
+		return p.Name()
+	}
+}
+
+// receiverName returns the receiver name for new methods of named, which
+// is that of its existing methods, or else its first letter in lower
+// case.
+func receiverName(named *types.Named) string {
+	for i := 0; i < named.NumMethods(); i++ {
+		if name := named.Method(i).Type().(*types.Signature).Recv().Name(); name != "" && name != "_" {
+			return name
+		}
+	}
+	r, _ := utf8.DecodeRuneInString(named.Obj().Name())
+	return string(unicode.ToLower(r))
+}
+
+// methodStubs returns the declarations of methods with the receiver recv
+// named recvName and the names and signatures of methods, each of which
+// panics. Each is preceded by a blank line. The receiver is unnamed in
+// the methods which have a parameter or result named recvName.
+func methodStubs(recvName string, recv types.Type, methods []*types.Func, qf types.Qualifier) string {
+	var buf bytes.Buffer
+	for _, m := range methods {
+		sig := m.Type().(*types.Signature)
+		if hasVarNamed(sig.Params(), recvName) || hasVarNamed(sig.Results(), recvName) {
+			fmt.Fprintf(&buf, "\n\nfunc (%s) %s", types.TypeString(recv, qf), m.Name())
+		} else {
+			fmt.Fprintf(&buf, "\n\nfunc (%s %s) %s", recvName, types.TypeString(recv, qf), m.Name())
+		}
+		types.WriteSignature(&buf, sig, qf)
+		buf.WriteString(" {\n\tpanic(\"not implemented\")\n}")
+	}
+	return buf.String()
+}
+
+// hasVarNamed reports whether one of vars is named name.
+func hasVarNamed(vars *types.Tuple, name string) bool {
+	for i := 0; i < vars.Len(); i++ {
+		if vars.At(i).Name() == name {
+			return true
+		}
+	}
+	return false
+}
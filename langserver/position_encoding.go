@@ -0,0 +1,130 @@
+package langserver
+
+import (
+	"bytes"
+	"context"
+	"go/token"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/sourcegraph/go-langserver/langserver/util"
+	"github.com/sourcegraph/go-langserver/pkg/lsp"
+)
+
+// negotiatePositionEncoding returns the encoding positions are counted in
+// for a client with caps. UTF-8 is preferred if the client supports it,
+// as the server counts the columns of positions in bytes.
+// Otherwise it is the first encoding the client prefers which the server
+// knows, or else UTF-16, which every client supports.
+func negotiatePositionEncoding(caps lsp.ClientCapabilities) lsp.PositionEncodingKind {
+	for _, enc := range caps.General.PositionEncodings {
+		if enc == lsp.PositionEncodingUTF8 {
+			return enc
+		}
+	}
+	for _, enc := range caps.General.PositionEncodings {
+		if enc == lsp.PositionEncodingUTF16 || enc == lsp.PositionEncodingUTF32 {
+			return enc
+		}
+	}
+	return lsp.PositionEncodingUTF16
+}
+
+// positionEncoding returns the encoding negotiated with the client at
+// initialize.
+func (h *LangHandler) positionEncoding() lsp.PositionEncodingKind {
+	if h.init == nil {
+		return lsp.PositionEncodingUTF16
+	}
+	return negotiatePositionEncoding(h.init.Capabilities)
+}
+
+// characterWidth returns how many units of enc the rune r, encoded in
+// size bytes, counts for. Invalid bytes, which decode as utf8.RuneError
+// one at a time, count as one unit. An empty enc is UTF-16.
+func characterWidth(r rune, size int, enc lsp.PositionEncodingKind) int {
+	switch enc {
+	case lsp.PositionEncodingUTF8:
+		return size
+	case lsp.PositionEncodingUTF32:
+		return 1
+	default:
+		if r >= 0x10000 {
+			// A surrogate pair.
+			return 2
+		}
+		return 1
+	}
+}
+
+// lspPosition returns the LSP position of p, whose column counts bytes,
+// with its character counted in the units of enc. contents are those of
+// the file of p. They are only needed if enc isn't UTF-8, and if they are
+// nil or aren't those p was found in, the bytes are counted.
+func lspPosition(p token.Position, contents []byte, enc lsp.PositionEncodingKind) lsp.Position {
+	pos := lsp.Position{Line: p.Line - 1, Character: p.Column - 1}
+	lineStart := p.Offset - (p.Column - 1)
+	if enc == lsp.PositionEncodingUTF8 || p.Column <= 1 || lineStart < 0 || p.Offset > len(contents) {
+		return pos
+	}
+	line := contents[lineStart:p.Offset]
+	if bytes.IndexByte(line, '\n') >= 0 {
+		return pos
+	}
+	pos.Character = 0
+	for len(line) > 0 {
+		r, size := utf8.DecodeRune(line)
+		pos.Character += characterWidth(r, size, enc)
+		line = line[size:]
+	}
+	return pos
+}
+
+// positionConverter converts the positions of the files of token.FileSets
+// to LSP positions in the encoding negotiated with the client, reading
+// each file whose lines it counts once. A nil *positionConverter counts
+// bytes. It is safe for concurrent use.
+type positionConverter struct {
+	enc      lsp.PositionEncodingKind
+	readFile func(filename string) ([]byte, error)
+
+	mu    sync.Mutex
+	files map[string][]byte
+}
+
+// positionConverter returns a positionConverter reading the files of the
+// workspace, or nil if the client counts bytes.
+func (h *LangHandler) positionConverter(ctx context.Context) *positionConverter {
+	enc := h.positionEncoding()
+	if enc == lsp.PositionEncodingUTF8 {
+		return nil
+	}
+	return &positionConverter{
+		enc: enc,
+		readFile: func(filename string) ([]byte, error) {
+			return h.readFile(ctx, util.PathToURI(filename))
+		},
+		files: make(map[string][]byte),
+	}
+}
+
+// position returns the LSP position of p.
+func (c *positionConverter) position(p token.Position) lsp.Position {
+	if c == nil {
+		return lsp.Position{Line: p.Line - 1, Character: p.Column - 1}
+	}
+	return lspPosition(p, c.contents(p.Filename), c.enc)
+}
+
+// contents returns the contents of the file filename, or nil if it can't
+// be read.
+func (c *positionConverter) contents(filename string) []byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	contents, ok := c.files[filename]
+	if !ok {
+		contents, _ = c.readFile(filename)
+		c.files[filename] = contents
+	}
+	return contents
+}
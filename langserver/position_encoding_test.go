@@ -0,0 +1,84 @@
+package langserver
+
+import (
+	"go/token"
+	"testing"
+
+	"github.com/sourcegraph/go-langserver/pkg/lsp"
+)
+
+func TestOffsetForPosition(t *testing.T) {
+	// "é" is 2 bytes and 1 UTF-16 code unit, "世" 3 bytes and 1 code
+	// unit, and "😀" 4 bytes and a surrogate pair of 2 code units.
+	contents := []byte("package p\n\nvar s = \"é世😀\"; var x = 1\n")
+	tests := []struct {
+		enc       lsp.PositionEncodingKind
+		character int
+		want      int // byte offset on line 2, or -1 if invalid
+	}{
+		{lsp.PositionEncodingUTF16, 9, 9},   // é
+		{lsp.PositionEncodingUTF16, 10, 11}, // 世
+		{lsp.PositionEncodingUTF16, 11, 14}, // 😀
+		{lsp.PositionEncodingUTF16, 12, -1}, // in the middle of 😀
+		{lsp.PositionEncodingUTF16, 20, 25}, // x
+		{"", 20, 25},                        // UTF-16 is the default
+		{lsp.PositionEncodingUTF8, 25, 25},
+		{lsp.PositionEncodingUTF8, 10, -1}, // in the middle of é
+		{lsp.PositionEncodingUTF32, 19, 25},
+		{lsp.PositionEncodingUTF32, 40, -1}, // beyond the line
+	}
+	const lineStart = 11
+	for _, test := range tests {
+		offset, valid, why := offsetForPosition(contents, lsp.Position{Line: 2, Character: test.character}, test.enc)
+		switch {
+		case test.want < 0 && valid:
+			t.Errorf("%s character %d: got offset %d, want invalid", test.enc, test.character, offset-lineStart)
+		case test.want >= 0 && !valid:
+			t.Errorf("%s character %d: got invalid (%s), want offset %d", test.enc, test.character, why, test.want)
+		case test.want >= 0 && offset-lineStart != test.want:
+			t.Errorf("%s character %d: got offset %d, want %d", test.enc, test.character, offset-lineStart, test.want)
+		}
+	}
+}
+
+func TestLSPPosition(t *testing.T) {
+	contents := []byte("package p\n\nvar s = \"é世😀\"; var x = 1\n")
+	tests := []struct {
+		enc    lsp.PositionEncodingKind
+		column int // of x, in bytes
+		want   int
+	}{
+		{lsp.PositionEncodingUTF16, 26, 20},
+		{"", 26, 20}, // UTF-16 is the default
+		{lsp.PositionEncodingUTF8, 26, 25},
+		{lsp.PositionEncodingUTF32, 26, 19},
+		{lsp.PositionEncodingUTF16, 1, 0},
+	}
+	const lineStart = 11
+	for _, test := range tests {
+		p := token.Position{Line: 3, Column: test.column, Offset: lineStart + test.column - 1}
+		got := lspPosition(p, contents, test.enc)
+		if want := (lsp.Position{Line: 2, Character: test.want}); got != want {
+			t.Errorf("%s column %d: got %v, want %v", test.enc, test.column, got, want)
+		}
+	}
+}
+
+func TestNegotiatePositionEncoding(t *testing.T) {
+	tests := []struct {
+		supported []lsp.PositionEncodingKind
+		want      lsp.PositionEncodingKind
+	}{
+		{nil, lsp.PositionEncodingUTF16},
+		{[]lsp.PositionEncodingKind{lsp.PositionEncodingUTF16, lsp.PositionEncodingUTF8}, lsp.PositionEncodingUTF8},
+		{[]lsp.PositionEncodingKind{lsp.PositionEncodingUTF32, lsp.PositionEncodingUTF16}, lsp.PositionEncodingUTF32},
+		{[]lsp.PositionEncodingKind{"utf-7"}, lsp.PositionEncodingUTF16},
+	}
+	for _, test := range tests {
+		var caps lsp.ClientCapabilities
+		caps.General.PositionEncodings = test.supported
+		if got := negotiatePositionEncoding(caps); got != test.want {
+			t.Errorf("%v: got %s, want %s", test.supported, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package langserver
+
+import (
+	"context"
+	"fmt"
+	"go/build"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+
+	"github.com/neelance/parallel"
+	opentracing "github.com/opentracing/opentracing-go"
+
+	"github.com/sourcegraph/go-langserver/langserver/util"
+	"github.com/sourcegraph/go-langserver/pkg/tools"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+// startPrewarm typechecks the packages of Config.PrewarmPackages in the
+// background, so that their results are cached by the time they are
+// navigated. It is started once the client is initialized, since the
+// progress it reports can't be created before. It is stopped by
+// stopBackground.
+func (h *LangHandler) startPrewarm(conn jsonrpc2.JSONRPC2) {
+	patterns := h.config().PrewarmPackages
+	if len(patterns) == 0 {
+		return
+	}
+	span := opentracing.StartSpan("langserver-go: prewarm", opentracing.Tags{"patterns": strings.Join(patterns, ",")})
+	ctx, cancel := context.WithCancel(opentracing.ContextWithSpan(context.Background(), span))
+	h.mu.Lock()
+	h.backgroundCancels = append(h.backgroundCancels, cancel)
+	h.mu.Unlock()
+	go func() {
+		defer span.Finish()
+		defer cancel()
+		h.prewarm(ctx, conn, patterns)
+	}()
+}
+
+// stopBackground cancels the background work of the server, such as
+// prewarming packages and sweeping the idle ones from the caches. It is
+// called on shutdown.
+func (h *LangHandler) stopBackground() {
+	h.mu.Lock()
+	cancels := h.backgroundCancels
+	h.backgroundCancels = nil
+	h.mu.Unlock()
+	for _, cancel := range cancels {
+		cancel()
+	}
+}
+
+// prewarm typechecks the packages of the workspace folders matching
+// patterns, at most MaxParallelism at once.
+func (h *LangHandler) prewarm(ctx context.Context, conn jsonrpc2.JSONRPC2, patterns []string) {
+	bctx := h.BuildContext(ctx)
+	findPackage := h.getFindPackageFunc()
+
+	type prewarmPackage struct {
+		importPath string
+		rootPath   string
+	}
+	var pkgs []prewarmPackage
+	seen := make(map[string]bool)
+	for _, rootPath := range h.workspaceFolders() {
+		for _, pkg := range tools.ListPkgsUnderDir(bctx, rootPath, h.skipExcludedDir(rootPath)) {
+			if seen[pkg] {
+				// Workspace folders may be nested.
+				continue
+			}
+			seen[pkg] = true
+			bpkg, err := findPackage(ctx, bctx, pkg, rootPath, build.FindOnly)
+			if err != nil && !isMultiplePackageError(err) {
+				debugf("skipping possible package %s: %s", pkg, err)
+				continue
+			}
+			rel, err := filepath.Rel(rootPath, bpkg.Dir)
+			if err != nil || !matchPrewarmPatterns(patterns, pkg, filepath.ToSlash(rel)) {
+				continue
+			}
+			pkgs = append(pkgs, prewarmPackage{importPath: pkg, rootPath: rootPath})
+		}
+	}
+	if len(pkgs) == 0 {
+		return
+	}
+
+	progress := h.beginProgress(ctx, conn, "Loading Go packages")
+	var done int64
+	par := parallel.NewRun(h.maxParallelism())
+	for _, p := range pkgs {
+		par.Acquire()
+		if ctx.Err() != nil {
+			par.Release()
+			break
+		}
+		go func(p prewarmPackage) {
+			defer func() {
+				// Packages which can't be found or loaded are done too.
+				progress.report(ctx, int(atomic.AddInt64(&done, 1)), len(pkgs))
+				par.Release()
+				_ = util.Panicf(recover(), "prewarming pkg %v", p.importPath)
+			}()
+			bpkg, err := findPackage(ctx, bctx, p.importPath, p.rootPath, 0)
+			if err != nil && !isMultiplePackageError(err) {
+				return
+			}
+			if _, _, _, err := h.cachedTypecheck(ctx, bctx, bpkg); err != nil && ctx.Err() == nil {
+				debugf("prewarming package %s: %s", p.importPath, err)
+			}
+		}(p)
+	}
+	_ = par.Wait()
+	if ctx.Err() != nil {
+		progress.end(ctx, "cancelled")
+		return
+	}
+	progress.end(ctx, fmt.Sprintf("loaded %d packages", len(pkgs)))
+}
+
+// matchPrewarmPatterns reports whether the package with the import path
+// importPath, in the directory rel relative to its workspace folder,
+// matches one of patterns. A pattern is an import path or a path
+// relative to the folder, optionally starting with "./", which may
+// contain the wildcards of path.Match. A pattern ending in "/..." also
+// matches the packages below it, and "..." matches every package.
+func matchPrewarmPatterns(patterns []string, importPath, rel string) bool {
+	for _, pattern := range patterns {
+		pattern = strings.TrimPrefix(pattern, "./")
+		for _, name := range []string{importPath, rel} {
+			if matchPrewarmPattern(pattern, name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func matchPrewarmPattern(pattern, name string) bool {
+	if pattern == "..." {
+		return true
+	}
+	if prefix := strings.TrimSuffix(pattern, "/..."); prefix != pattern {
+		if prefix == "." && !strings.HasPrefix(name, "../") {
+			return true
+		}
+		// The prefix may itself contain wildcards, so each
+		// ancestor of name is tried against it.
+		for dir := name; dir != "." && dir != "/" && dir != ""; dir = path.Dir(dir) {
+			if ok, _ := path.Match(prefix, dir); ok {
+				return true
+			}
+		}
+		return false
+	}
+	ok, _ := path.Match(pattern, name)
+	return ok
+}
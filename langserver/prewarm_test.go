@@ -0,0 +1,33 @@
+package langserver
+
+import "testing"
+
+func TestMatchPrewarmPatterns(t *testing.T) {
+	tests := []struct {
+		pattern    string
+		importPath string
+		rel        string
+		want       bool
+	}{
+		{"...", "example.com/p/a", "a", true},
+		{"./...", "example.com/p", ".", true},
+		{"./...", "example.com/p/a/b", "a/b", true},
+		{".", "example.com/p", ".", true},
+		{".", "example.com/p/a", "a", false},
+		{"a", "example.com/p/a", "a", true},
+		{"./a", "example.com/p/a/b", "a/b", false},
+		{"./a/...", "example.com/p/a/b", "a/b", true},
+		{"./a/...", "example.com/p/ab", "ab", false},
+		{"cmd/*", "example.com/p/cmd/x", "cmd/x", true},
+		{"cmd/*", "example.com/p/cmd/x/y", "cmd/x/y", false},
+		{"*/internal/...", "example.com/p/x/internal/y", "x/internal/y", true},
+		{"example.com/p/a", "example.com/p/a", "a", true},
+		{"example.com/p/...", "example.com/p/a/b", "a/b", true},
+		{"example.com/q/...", "example.com/p/a", "a", false},
+	}
+	for _, test := range tests {
+		if got := matchPrewarmPatterns([]string{test.pattern}, test.importPath, test.rel); got != test.want {
+			t.Errorf("pattern %q matching %q (%q): got %v, want %v", test.pattern, test.importPath, test.rel, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package langserver
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/sourcegraph/go-langserver/pkg/lsp"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+// progressTokens numbers the progress tokens created by the server.
+var progressTokens int64
+
+// workDoneProgress reports the progress of a long running operation to
+// the client with $/progress notifications. A nil *workDoneProgress
+// reports nothing, so it needn't be checked by operations.
+type workDoneProgress struct {
+	conn  jsonrpc2.JSONRPC2
+	token lsp.ProgressToken
+
+	mu          sync.Mutex
+	lastPercent int // of the last report, to not send a report for each step
+}
+
+// beginProgress creates a progress titled title and reports its start at
+// 0%, if the client supports progress created by the server. Otherwise,
+// or if the client fails to create it, it returns nil. It waits for the
+// client to create the progress, so it mustn't be called by the requests
+// lspHandler handles synchronously, as the response couldn't be read.
+func (h *LangHandler) beginProgress(ctx context.Context, conn jsonrpc2.JSONRPC2, title string) *workDoneProgress {
+	if h.init == nil || !h.init.Capabilities.Window.WorkDoneProgress {
+		return nil
+	}
+	token := lsp.ProgressToken(fmt.Sprintf("go-langserver-%d", atomic.AddInt64(&progressTokens, 1)))
+	if err := conn.Call(ctx, "window/workDoneProgress/create", lsp.WorkDoneProgressCreateParams{Token: token}, nil); err != nil {
+		warnf("creating progress %q: %s", title, err)
+		return nil
+	}
+	p := &workDoneProgress{conn: conn, token: token}
+	p.notify(ctx, lsp.WorkDoneProgressBegin{Kind: "begin", Title: title, Percentage: new(int)})
+	return p
+}
+
+// report reports that done of total steps of the operation, such as
+// packages, have been done. Only the steps which advance the percentage
+// are reported, so operations can report every step however many there
+// are.
+func (p *workDoneProgress) report(ctx context.Context, done, total int) {
+	if p == nil || total <= 0 {
+		return
+	}
+	percentage := done * 100 / total
+	p.mu.Lock()
+	if percentage <= p.lastPercent {
+		p.mu.Unlock()
+		return
+	}
+	p.lastPercent = percentage
+	p.mu.Unlock()
+	p.notify(ctx, lsp.WorkDoneProgressReport{
+		Kind:       "report",
+		Message:    fmt.Sprintf("%d/%d", done, total),
+		Percentage: &percentage,
+	})
+}
+
+// end reports that the operation has finished, with message.
+func (p *workDoneProgress) end(ctx context.Context, message string) {
+	if p == nil {
+		return
+	}
+	p.notify(ctx, lsp.WorkDoneProgressEnd{Kind: "end", Message: message})
+}
+
+func (p *workDoneProgress) notify(ctx context.Context, value interface{}) {
+	_ = p.conn.Notify(ctx, "$/progress", lsp.ProgressParams{Token: p.token, Value: value})
+}
@@ -0,0 +1,99 @@
+package langserver
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"reflect"
+	"runtime"
+	"sync"
+	"testing"
+
+	"github.com/sourcegraph/go-langserver/pkg/lsp"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+func TestWorkDoneProgress(t *testing.T) {
+	h := &LangHandler{Config: NewDefaultConfig(), HandlerShared: &HandlerShared{}}
+	// The server waits for the client to create the progress, so it
+	// handles requests concurrently as it does when run by NewHandler.
+	addr, done := startServer(t, lspHandler{jsonrpc2.HandlerWithError(h.handle)})
+	defer done()
+
+	var (
+		mu      sync.Mutex
+		created []lsp.ProgressToken
+		kinds   []string
+	)
+	nc, err := (&net.Dialer{}).Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn := jsonrpc2.NewConn(context.Background(), jsonrpc2.NewBufferedStream(nc, jsonrpc2.VSCodeObjectCodec{}), jsonrpc2.HandlerWithError(func(_ context.Context, _ *jsonrpc2.Conn, req *jsonrpc2.Request) (interface{}, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch req.Method {
+		case "window/workDoneProgress/create":
+			var params lsp.WorkDoneProgressCreateParams
+			if err := json.Unmarshal(*req.Params, &params); err != nil {
+				t.Error(err)
+			}
+			created = append(created, params.Token)
+		case "$/progress":
+			var params struct {
+				Token lsp.ProgressToken
+				Value struct{ Kind string }
+			}
+			if err := json.Unmarshal(*req.Params, &params); err != nil {
+				t.Error(err)
+			}
+			if len(created) == 0 || params.Token != created[len(created)-1] {
+				t.Errorf("got progress with token %q, which wasn't created", params.Token)
+			}
+			kinds = append(kinds, params.Value.Kind)
+		}
+		return nil, nil
+	}))
+	defer conn.Close()
+
+	ctx := context.Background()
+	var caps lsp.ClientCapabilities
+	caps.Window.WorkDoneProgress = true
+	if err := conn.Call(ctx, "initialize", InitializeParams{
+		InitializeParams:     lsp.InitializeParams{RootURI: "file:///src/test/pkg", Capabilities: caps},
+		NoOSFileSystemAccess: true,
+		BuildContext: &InitializeBuildContextParams{
+			GOOS:     "linux",
+			GOARCH:   "amd64",
+			GOPATH:   "/",
+			GOROOT:   "/goroot",
+			Compiler: runtime.Compiler,
+		},
+	}, nil); err != nil {
+		t.Fatal("initialize:", err)
+	}
+	for uri, text := range map[lsp.DocumentURI]string{
+		"file:///src/test/pkg/a.go":   "package p\n\nfunc A() {}\n",
+		"file:///src/test/pkg/q/q.go": "package q\n\nfunc Q() {}\n",
+	} {
+		if err := conn.Call(ctx, "textDocument/didOpen", lsp.DidOpenTextDocumentParams{
+			TextDocument: lsp.TextDocumentItem{URI: uri, Version: 1, Text: text},
+		}, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := conn.Call(ctx, "workspace/symbol", lsp.WorkspaceSymbolParams{Query: "Q"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	// The notifications are sent before the response, so they have all
+	// been handled.
+	if want := []string{"begin", "report", "report", "end"}; !reflect.DeepEqual(kinds, want) {
+		t.Errorf("got progress %q, want %q", kinds, want)
+	}
+	if len(created) != 1 {
+		t.Errorf("got %d progresses created, want 1", len(created))
+	}
+}
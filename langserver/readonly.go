@@ -0,0 +1,39 @@
+package langserver
+
+import (
+	"fmt"
+
+	"github.com/sourcegraph/go-langserver/pkg/lsp"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+// editingMethods are the requests whose results edit documents, which
+// Config.ReadOnly disables.
+var editingMethods = map[string]bool{
+	"textDocument/rename":           true,
+	"textDocument/prepareRename":    true,
+	"textDocument/formatting":       true,
+	"textDocument/rangeFormatting":  true,
+	"textDocument/onTypeFormatting": true,
+	"textDocument/codeAction":       true,
+}
+
+// readOnlyError is the error of a request for method, one of
+// editingMethods, when Config.ReadOnly is set.
+func readOnlyError(method string) error {
+	return &jsonrpc2.Error{
+		Code:    jsonrpc2.CodeInvalidRequest,
+		Message: fmt.Sprintf("server is read-only: %s is disabled", method),
+	}
+}
+
+// withoutEditingCapabilities removes the capabilities of editingMethods
+// from caps.
+func withoutEditingCapabilities(caps lsp.ServerCapabilities) lsp.ServerCapabilities {
+	caps.RenameProvider = nil
+	caps.DocumentFormattingProvider = false
+	caps.DocumentRangeFormattingProvider = false
+	caps.DocumentOnTypeFormattingProvider = nil
+	caps.CodeActionProvider = false
+	return caps
+}
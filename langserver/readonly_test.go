@@ -0,0 +1,65 @@
+package langserver
+
+import (
+	"context"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/sourcegraph/go-langserver/pkg/lsp"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+func TestReadOnly(t *testing.T) {
+	h := &LangHandler{Config: NewDefaultConfig(), HandlerShared: &HandlerShared{}}
+	h.Config.ReadOnly = true
+	addr, done := startServer(t, jsonrpc2.HandlerWithError(h.handle))
+	defer done()
+	conn := dialServer(t, addr)
+	defer conn.Close()
+
+	ctx := context.Background()
+	var res lsp.InitializeResult
+	if err := conn.Call(ctx, "initialize", InitializeParams{
+		InitializeParams:     lsp.InitializeParams{RootURI: "file:///src/test/pkg"},
+		NoOSFileSystemAccess: true,
+		BuildContext: &InitializeBuildContextParams{
+			GOOS:     "linux",
+			GOARCH:   "amd64",
+			GOPATH:   "/",
+			GOROOT:   "/goroot",
+			Compiler: runtime.Compiler,
+		},
+	}, &res); err != nil {
+		t.Fatal("initialize:", err)
+	}
+	caps := res.Capabilities
+	if caps.RenameProvider != nil || caps.DocumentFormattingProvider || caps.DocumentRangeFormattingProvider || caps.DocumentOnTypeFormattingProvider != nil || caps.CodeActionProvider {
+		t.Errorf("got editing capabilities %+v", caps)
+	}
+	if !caps.HoverProvider || !caps.DefinitionProvider {
+		t.Errorf("got capabilities %+v, want hover and definition", caps)
+	}
+
+	uri := lsp.DocumentURI("file:///src/test/pkg/a.go")
+	if err := conn.Call(ctx, "textDocument/didOpen", lsp.DidOpenTextDocumentParams{
+		TextDocument: lsp.TextDocumentItem{URI: uri, Version: 1, Text: "package p\n\nfunc Foo()   { Foo() }\n"},
+	}, nil); err != nil {
+		t.Fatal(err)
+	}
+	doc := lsp.TextDocumentIdentifier{URI: uri}
+	calls := map[string]interface{}{
+		"textDocument/rename":     lsp.RenameParams{TextDocument: doc, Position: lsp.Position{Line: 2, Character: 5}, NewName: "Bar"},
+		"textDocument/formatting": lsp.DocumentFormattingParams{TextDocument: doc},
+		"textDocument/codeAction": lsp.CodeActionParams{TextDocument: doc},
+	}
+	for method, params := range calls {
+		err := conn.Call(ctx, method, params, nil)
+		if err == nil || !strings.Contains(err.Error(), "server is read-only") {
+			t.Errorf("%s: got error %v, want the server to be read-only", method, err)
+		}
+	}
+	if err := conn.Call(ctx, "textDocument/hover", lsp.TextDocumentPositionParams{TextDocument: doc, Position: lsp.Position{Line: 2, Character: 5}}, nil); err != nil {
+		t.Errorf("hover: %s", err)
+	}
+}
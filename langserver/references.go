@@ -13,6 +13,7 @@ import (
 	"go/types"
 	"io"
 	"math"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -52,6 +53,9 @@ func (h *LangHandler) handleTextDocumentReferences(ctx context.Context, conn jso
 		return nil, err
 	}
 
+	span, ctx := startChildSpan(ctx, "langserver-go: build result")
+	defer span.Finish()
+
 	// NOTICE: Code adapted from golang.org/x/tools/cmd/guru
 	// referrers.go.
 
@@ -75,17 +79,6 @@ func (h *LangHandler) handleTextDocumentReferences(ctx context.Context, conn jso
 		}
 		return nil, fmt.Errorf("no package found for object %s", obj)
 	}
-	defpkg := strings.TrimSuffix(obj.Pkg().Path(), "_test")
-	_, pkgLevel := classify(obj)
-
-	bctx := h.BuildContext(ctx)
-	pkgInWorkspace := func(path string) bool {
-		if h.init.RootImportPath == "" {
-			return true
-		}
-		return util.PathHasPrefix(path, h.init.RootImportPath)
-	}
-
 	// findRefCtx is used in the findReferences function. It has its own
 	// context so we can stop finding references once we have reached our
 	// limit.
@@ -100,7 +93,7 @@ func (h *LangHandler) handleTextDocumentReferences(ctx context.Context, conn jso
 		// refs is a stream of raw references found by findReferences or findReferencesPkgLevel.
 		refs = make(chan *ast.Ident)
 
-		// findRefErr is non-nil if findReferences fails.
+		// findRefErr is non-nil if findWorkspaceReferences fails.
 		findRefErr error
 	)
 
@@ -109,12 +102,71 @@ func (h *LangHandler) handleTextDocumentReferences(ctx context.Context, conn jso
 	// references back to the client, as well as build up the final slice
 	// which we return as the response.
 	go func() {
-		locsC <- refStreamAndCollect(ctx, conn, req, fset, refs, params.Context.XLimit, stop)
+		locsC <- refStreamAndCollect(ctx, conn, req, h.positionConverter(ctx), fset, refs, params.Context.XLimit, h.config().MaxReferenceResults, stop)
 		close(locsC)
 	}()
 
+	findRefErr = h.findWorkspaceReferences(findRefCtx, fset, obj, reverseImportGraphC, params.Context.IncludeDeclaration, refs)
+
+	// Tell refStreamAndCollect that we are done finding references. It
+	// will then send the all the collected references to locsC.
+	close(refs)
+	locs := <-locsC
+
+	// If we find references then we can ignore findRefErr. It should only
+	// be non-nil due to timeouts or our last findReferences doesn't find
+	// the def.
+	if len(locs) == 0 && findRefErr != nil {
+		return nil, findRefErr
+	}
+
+	if locs == nil {
+		locs = []lsp.Location{}
+	}
+
+	// References are found concurrently, so sort them to give the same
+	// result for each request.
+	sort.Slice(locs, func(i, j int) bool { return locationLess(locs[i], locs[j]) })
+	if max := h.config().MaxReferenceResults; max > 0 && len(locs) > max {
+		_ = conn.Notify(ctx, "window/logMessage", &lsp.LogMessageParams{
+			Type:    lsp.Info,
+			Message: fmt.Sprintf("references to %s truncated: returning %d of %d (see maxReferenceResults)", obj.Name(), max, len(locs)),
+		})
+		locs = locs[:max]
+	}
+	return locs, nil
+}
+
+// locationLess orders locations by URI, then by start position.
+func locationLess(a, b lsp.Location) bool {
+	if a.URI != b.URI {
+		return a.URI < b.URI
+	}
+	if a.Range.Start.Line != b.Range.Start.Line {
+		return a.Range.Start.Line < b.Range.Start.Line
+	}
+	return a.Range.Start.Character < b.Range.Start.Character
+}
+
+// findWorkspaceReferences sends every reference to obj found in the
+// workspace to refs, as well as the declaration of obj if includeDecl is
+// set and it is in the workspace. It does not close refs.
+func (h *LangHandler) findWorkspaceReferences(ctx context.Context, fset *token.FileSet, obj types.Object, reverseImportGraphC <-chan importgraph.Graph, includeDecl bool, refs chan<- *ast.Ident) error {
+	defpkg := strings.TrimSuffix(obj.Pkg().Path(), "_test")
+	_, pkgLevel := classify(obj)
+
+	bctx := h.BuildContext(ctx)
+	pkgInWorkspace := func(path string) bool {
+		if h.init.RootImportPath == "" {
+			return true
+		}
+		return util.PathHasPrefix(path, h.init.RootImportPath)
+	}
+
+	var findRefErr error
+
 	// Don't include decl if it is outside of workspace.
-	if params.Context.IncludeDeclaration && util.PathHasPrefix(defpkg, h.init.RootImportPath) {
+	if includeDecl && util.PathHasPrefix(defpkg, h.init.RootImportPath) {
 		refs <- &ast.Ident{NamePos: obj.Pos(), Name: obj.Name()}
 	}
 
@@ -162,11 +214,17 @@ func (h *LangHandler) handleTextDocumentReferences(ctx context.Context, conn jso
 		if pkgLevel {
 			// pkgLevel queries can be done syntactically instead of semantically,
 			// which is much faster. See https://golang.org/cl/97800/.
-			findRefErr = h.findReferencesPkgLevel(findRefCtx, bctx, fset, unseen, pkgInWorkspace, obj, refs)
+			findRefErr = h.findReferencesPkgLevel(ctx, bctx, fset, unseen, pkgInWorkspace, obj, refs)
 		} else {
 			lconf := loader.Config{
 				Fset:  fset,
 				Build: bctx,
+				// References can only be in the workspace, so
+				// only the signatures of the other packages are
+				// needed.
+				TypeCheckFuncBodies: func(path string) bool {
+					return pkgInWorkspace(strings.TrimSuffix(path, "_test"))
+				},
 			}
 
 			// The importgraph doesn't treat external test packages
@@ -175,31 +233,15 @@ func (h *LangHandler) handleTextDocumentReferences(ctx context.Context, conn jso
 				lconf.ImportWithTests(path)
 			}
 
-			findRefErr = findReferences(findRefCtx, lconf, pkgInWorkspace, obj, refs)
+			findRefErr = h.findReferences(ctx, lconf, pkgInWorkspace, obj, refs)
 		}
-		if findRefCtx.Err() != nil {
+		if ctx.Err() != nil {
 			// If we are canceled, cancel loop early
 			break
 		}
 	}
 
-	// Tell refStreamAndCollect that we are done finding references. It
-	// will then send the all the collected references to locsC.
-	close(refs)
-	locs := <-locsC
-
-	// If we find references then we can ignore findRefErr. It should only
-	// be non-nil due to timeouts or our last findReferences doesn't find
-	// the def.
-	if len(locs) == 0 && findRefErr != nil {
-		return nil, findRefErr
-	}
-
-	if locs == nil {
-		locs = []lsp.Location{}
-	}
-
-	return locs, nil
+	return findRefErr
 }
 
 // reverseImportGraph returns the reversed import graph for the workspace
@@ -217,7 +259,12 @@ func (h *LangHandler) reverseImportGraph(ctx context.Context, conn jsonrpc2.JSON
 		// import graph across commits. We want this behaviour since
 		// we assume that they don't change drastically across
 		// commits.
-		cacheKey := "importgraph:" + string(h.init.Root())
+		folders := h.workspaceFolders()
+		uris := make([]string, len(folders))
+		for i, folder := range folders {
+			uris[i] = string(util.PathToURI(folder))
+		}
+		cacheKey := "importgraph:" + strings.Join(uris, " ")
 
 		h.mu.Lock()
 		tryCache := h.importGraph == nil
@@ -245,7 +292,18 @@ func (h *LangHandler) reverseImportGraph(ctx context.Context, conn jsonrpc2.JSON
 			findPackage := func(bctx *build.Context, importPath, fromDir string, mode build.ImportMode) (*build.Package, error) {
 				return findPackageWithCtx(ctx, bctx, importPath, fromDir, mode)
 			}
-			g := tools.BuildReverseImportGraph(bctx, findPackage, h.FilePath(h.init.Root()))
+			g := make(importgraph.Graph)
+			for _, folder := range folders {
+				for to, from := range tools.BuildReverseImportGraph(bctx, findPackage, folder, h.skipExcludedDir(folder)) {
+					if g[to] == nil {
+						g[to] = from
+						continue
+					}
+					for p := range from {
+						g[to][p] = true
+					}
+				}
+			}
 			h.mu.Lock()
 			h.importGraph = g
 			h.mu.Unlock()
@@ -266,9 +324,10 @@ func (h *LangHandler) reverseImportGraph(ctx context.Context, conn jsonrpc2.JSON
 }
 
 // refStreamAndCollect returns all refs read in from chan until it is
-// closed. While it is reading, it will also occasionaly stream out updates of
-// the refs received so far.
-func refStreamAndCollect(ctx context.Context, conn jsonrpc2.JSONRPC2, req *jsonrpc2.Request, fset *token.FileSet, refs <-chan *ast.Ident, limit int, stop func()) []lsp.Location {
+// closed, without duplicates. While it is reading, it will also occasionaly
+// stream out updates of the refs received so far, up to streamLimit of them
+// if it is > 0.
+func refStreamAndCollect(ctx context.Context, conn jsonrpc2.JSONRPC2, req *jsonrpc2.Request, conv *positionConverter, fset *token.FileSet, refs <-chan *ast.Ident, limit, streamLimit int, stop func()) []lsp.Location {
 	if limit == 0 {
 		// If we don't have a limit, just set it to a value we should never exceed
 		limit = math.MaxInt32
@@ -288,20 +347,25 @@ func refStreamAndCollect(ctx context.Context, conn jsonrpc2.JSONRPC2, req *jsonr
 	var (
 		locs []lsp.Location
 		pos  int
+		seen = make(map[lsp.Location]bool)
 	)
 	send := func() {
-		if pos >= len(locs) {
+		end := len(locs)
+		if streamLimit > 0 && end > streamLimit {
+			end = streamLimit
+		}
+		if pos >= end {
 			return
 		}
-		patch := make([]referenceAddOp, 0, len(locs)-pos)
-		for _, l := range locs[pos:] {
+		patch := make([]referenceAddOp, 0, end-pos)
+		for _, l := range locs[pos:end] {
 			patch = append(patch, referenceAddOp{
 				OP:    "add",
 				Path:  "/-",
 				Value: l,
 			})
 		}
-		pos = len(locs)
+		pos = end
 		_ = conn.Notify(ctx, "$/partialResult", &lspext.PartialResultParams{
 			ID: id,
 			// We use referencePatch so the build server can rewrite URIs
@@ -320,11 +384,18 @@ func refStreamAndCollect(ctx context.Context, conn jsonrpc2.JSONRPC2, req *jsonr
 				send()
 				return locs
 			}
+			loc := goRangeToLSPLocation(conv, fset, n.Pos(), n.End())
+			if seen[loc] {
+				// The loader may check a package twice, once
+				// augmented with its tests.
+				continue
+			}
 			if len(locs) >= limit {
 				stop()
 				continue
 			}
-			locs = append(locs, goRangeToLSPLocation(fset, n.Pos(), n.End()))
+			seen[loc] = true
+			locs = append(locs, loc)
 		case <-tick.C:
 			send()
 		}
@@ -333,7 +404,7 @@ func refStreamAndCollect(ctx context.Context, conn jsonrpc2.JSONRPC2, req *jsonr
 
 // findReferences will find all references to obj. It will only return
 // references from packages in lconf.ImportPkgs.
-func findReferences(ctx context.Context, lconf loader.Config, pkgInWorkspace func(string) bool, obj types.Object, refs chan<- *ast.Ident) error {
+func (h *LangHandler) findReferences(ctx context.Context, lconf loader.Config, pkgInWorkspace func(string) bool, obj types.Object, refs chan<- *ast.Ident) error {
 	// Bail out early if the context is canceled
 	if ctx.Err() != nil {
 		return ctx.Err()
@@ -437,6 +508,11 @@ func findReferences(ctx context.Context, lconf loader.Config, pkgInWorkspace fun
 			_ = util.Panicf(recover(), "findReferences")
 		}()
 
+		release, err := h.acquireLoad(ctx)
+		if err != nil {
+			return
+		}
+		defer release()
 		lconf.Load() // ignore error
 	}()
 
@@ -0,0 +1,35 @@
+package langserver
+
+import (
+	"context"
+	"go/ast"
+	"go/token"
+	"testing"
+
+	"github.com/sourcegraph/go-langserver/pkg/lspext"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+func TestRefStreamAndCollectStreamLimit(t *testing.T) {
+	fset := token.NewFileSet()
+	f := fset.AddFile("/src/p/a.go", -1, 100)
+	f.SetLinesForContent(make([]byte, 100))
+	refs := make(chan *ast.Ident, 5)
+	for i := 0; i < 5; i++ {
+		refs <- &ast.Ident{NamePos: f.Pos(i * 10), Name: "x"}
+	}
+	close(refs)
+
+	var r notifyRecorder
+	locs := refStreamAndCollect(context.Background(), &r, &jsonrpc2.Request{}, nil, fset, refs, 0, 2, func() {})
+	if len(locs) != 5 {
+		t.Errorf("got %d locations, want all 5", len(locs))
+	}
+	streamed := 0
+	for _, p := range r.params[1:] {
+		streamed += len(p.(*lspext.PartialResultParams).Patch.(referencePatch))
+	}
+	if streamed != 2 {
+		t.Errorf("streamed %d locations, want 2", streamed)
+	}
+}
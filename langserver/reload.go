@@ -0,0 +1,20 @@
+package langserver
+
+// commandReload is the workspace/executeCommand command which makes the
+// server forget what it has read from the file system, for when it
+// changed behind the client's back, as with a git checkout.
+const commandReload = "langserver.reload"
+
+// reload drops the typechecked packages, symbols, godef files, modules
+// and import graph, and the overlay files which the client doesn't have
+// open, such as those sent at initialization, so that the next requests
+// read them again. Requests in flight finish with what they have, but
+// their results aren't cached. The documents the client has open are
+// kept, as they are the client's rather than the disk's.
+func (h *LangHandler) reload() {
+	h.HandlerShared.Mu.Lock()
+	overlay := h.overlay
+	h.HandlerShared.Mu.Unlock()
+	overlay.dropUnopened()
+	h.resetCaches(true)
+}
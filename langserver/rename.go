@@ -0,0 +1,277 @@
+package langserver
+
+import (
+	"context"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"path"
+	"sort"
+	"unicode"
+
+	"golang.org/x/tools/go/loader"
+
+	"github.com/sourcegraph/go-langserver/langserver/util"
+	"github.com/sourcegraph/go-langserver/pkg/lsp"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+func (h *LangHandler) handleTextDocumentRename(ctx context.Context, conn jsonrpc2.JSONRPC2, req *jsonrpc2.Request, params lsp.RenameParams) (*lsp.WorkspaceEdit, error) {
+	if !util.IsURI(params.TextDocument.URI) {
+		return nil, &jsonrpc2.Error{
+			Code:    jsonrpc2.CodeInvalidParams,
+			Message: fmt.Sprintf("%s not yet supported for out-of-workspace URI (%q)", req.Method, params.TextDocument.URI),
+		}
+	}
+	if err := validIdentifier(params.NewName); err != nil {
+		return nil, &jsonrpc2.Error{Code: jsonrpc2.CodeInvalidParams, Message: err.Error()}
+	}
+
+	// Begin computing the reverse import graph immediately, as this
+	// occurs in the background and is IO-bound.
+	reverseImportGraphC := h.reverseImportGraph(ctx, conn)
+
+	fset, _, pkg, obj, err := h.renameTarget(ctx, conn, params.TextDocument.URI, params.Position)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkRename(fset, pkg, obj, params.NewName); err != nil {
+		return nil, &jsonrpc2.Error{Code: jsonrpc2.CodeInvalidParams, Message: err.Error()}
+	}
+
+	refs := make(chan *ast.Ident)
+	errC := make(chan error, 1)
+	go func() {
+		errC <- h.findWorkspaceReferences(ctx, fset, obj, reverseImportGraphC, true, refs)
+		close(refs)
+	}()
+
+	declDir := path.Dir(fset.Position(obj.Pos()).Filename)
+	conv := h.positionConverter(ctx)
+	seen := make(map[lsp.Location]bool)
+	changes := make(map[string][]lsp.TextEdit)
+	var external string
+	for id := range refs {
+		loc := goRangeToLSPLocation(conv, fset, id.Pos(), id.End())
+		if seen[loc] {
+			continue
+		}
+		seen[loc] = true
+		if filename := fset.Position(id.Pos()).Filename; path.Dir(filename) != declDir {
+			external = filename
+		}
+		changes[string(loc.URI)] = append(changes[string(loc.URI)], lsp.TextEdit{
+			Range:   loc.Range,
+			NewText: params.NewName,
+		})
+	}
+	if err := <-errC; err != nil {
+		return nil, err
+	}
+	if external != "" && !ast.IsExported(params.NewName) {
+		return nil, &jsonrpc2.Error{
+			Code:    jsonrpc2.CodeInvalidParams,
+			Message: fmt.Sprintf("renaming %s to %s would make it unexported, but it is used in %s", obj.Name(), params.NewName, external),
+		}
+	}
+
+	for _, edits := range changes {
+		sort.Slice(edits, func(i, j int) bool {
+			a, b := edits[i].Range.Start, edits[j].Range.Start
+			return a.Line < b.Line || (a.Line == b.Line && a.Character < b.Character)
+		})
+	}
+	return &lsp.WorkspaceEdit{Changes: changes}, nil
+}
+
+func (h *LangHandler) handleTextDocumentPrepareRename(ctx context.Context, conn jsonrpc2.JSONRPC2, req *jsonrpc2.Request, params lsp.TextDocumentPositionParams) (*lsp.Range, error) {
+	if !util.IsURI(params.TextDocument.URI) {
+		return nil, &jsonrpc2.Error{
+			Code:    jsonrpc2.CodeInvalidParams,
+			Message: fmt.Sprintf("%s not yet supported for out-of-workspace URI (%q)", req.Method, params.TextDocument.URI),
+		}
+	}
+
+	fset, node, _, _, err := h.renameTarget(ctx, conn, params.TextDocument.URI, params.Position)
+	if err != nil {
+		return nil, err
+	}
+	r := rangeForNode(h.positionConverter(ctx), fset, node)
+	return &r, nil
+}
+
+// renameTarget returns the identifier at position and the object it
+// denotes, or a jsonrpc2 error if it can't be renamed.
+func (h *LangHandler) renameTarget(ctx context.Context, conn jsonrpc2.JSONRPC2, uri lsp.DocumentURI, position lsp.Position) (*token.FileSet, *ast.Ident, *loader.PackageInfo, types.Object, error) {
+	fset, node, _, _, pkg, _, err := h.typecheck(ctx, conn, uri, position)
+	if err != nil {
+		if _, ok := err.(*invalidNodeError); ok {
+			return nil, nil, nil, nil, &jsonrpc2.Error{Code: jsonrpc2.CodeInvalidParams, Message: "no identifier to rename at this position"}
+		}
+		return nil, nil, nil, nil, err
+	}
+
+	reject := func(format string, v ...interface{}) (*token.FileSet, *ast.Ident, *loader.PackageInfo, types.Object, error) {
+		return nil, nil, nil, nil, &jsonrpc2.Error{Code: jsonrpc2.CodeInvalidParams, Message: fmt.Sprintf(format, v...)}
+	}
+	obj := pkg.ObjectOf(node)
+	if obj == nil {
+		for _, f := range pkg.Files {
+			if f.Name == node {
+				return reject("renaming packages is not supported")
+			}
+		}
+		return reject("no object found to rename")
+	}
+	if obj.Pkg() == nil {
+		return reject("cannot rename builtin %s", obj.Name())
+	}
+	switch obj := obj.(type) {
+	case *types.PkgName:
+		return reject("renaming imports is not supported")
+	case *types.Var:
+		if obj.Anonymous() {
+			return reject("cannot rename embedded field %s, rename its type instead", obj.Name())
+		}
+	}
+	defpkg := util.VendorlessImportPath(obj.Pkg().Path())
+	if h.init.RootImportPath != "" && !util.PathHasPrefix(defpkg, h.init.RootImportPath) {
+		return reject("cannot rename %s: it is declared outside of the workspace in package %s", obj.Name(), defpkg)
+	}
+	return fset, node, pkg, obj, nil
+}
+
+// validIdentifier returns an error if name can't be used to name a Go
+// object.
+func validIdentifier(name string) error {
+	if name == "" {
+		return fmt.Errorf("new name is empty")
+	}
+	if name == "_" {
+		return fmt.Errorf("cannot rename to the blank identifier")
+	}
+	if token.Lookup(name).IsKeyword() {
+		return fmt.Errorf("%q is a keyword", name)
+	}
+	for i, r := range name {
+		if !unicode.IsLetter(r) && r != '_' && (i == 0 || !unicode.IsDigit(r)) {
+			return fmt.Errorf("%q is not a valid Go identifier", name)
+		}
+	}
+	return nil
+}
+
+// checkRename reports whether renaming obj to newName would conflict with,
+// shadow or capture another identifier. Only uses found in info are
+// checked, but those are all the unqualified uses unless obj is declared
+// in a different package.
+func checkRename(fset *token.FileSet, info *loader.PackageInfo, obj types.Object, newName string) error {
+	conflict := func(other types.Object) error {
+		return fmt.Errorf("renaming %s to %s conflicts with %s at %s", obj.Name(), newName, other.Name(), fset.Position(other.Pos()))
+	}
+
+	switch obj := obj.(type) {
+	case *types.Var:
+		if obj.IsField() {
+			if owner := fieldOwner(info, obj); owner != nil {
+				if other, _, _ := types.LookupFieldOrMethod(owner, true, obj.Pkg(), newName); other != nil {
+					return conflict(other)
+				}
+			}
+			return nil
+		}
+	case *types.Func:
+		if recv := obj.Type().(*types.Signature).Recv(); recv != nil {
+			if other, _, _ := types.LookupFieldOrMethod(recv.Type(), true, obj.Pkg(), newName); other != nil {
+				return conflict(other)
+			}
+			return nil
+		}
+	}
+
+	scope := obj.Parent()
+	if scope == nil {
+		return nil
+	}
+	if scope == obj.Pkg().Scope() && (obj.Name() == "init" || newName == "init") {
+		return fmt.Errorf("cannot rename %s to %s: init is special", obj.Name(), newName)
+	}
+	if other := scope.Lookup(newName); other != nil {
+		return conflict(other)
+	}
+	if info.Pkg != obj.Pkg() {
+		return nil
+	}
+	if scope == obj.Pkg().Scope() {
+		// Imports are in the file scopes, beneath the package scope.
+		for _, f := range info.Files {
+			if other := info.Scopes[f].Lookup(newName); other != nil {
+				return conflict(other)
+			}
+		}
+	}
+
+	// encloses reports whether s is scope or nested inside it.
+	encloses := func(s *types.Scope) bool {
+		for ; s != nil; s = s.Parent() {
+			if s == scope {
+				return true
+			}
+		}
+		return false
+	}
+	for id, used := range info.Uses {
+		s := info.Pkg.Scope().Innermost(id.Pos())
+		if s == nil {
+			continue
+		}
+		if _, resolved := s.LookupParent(id.Name, id.Pos()); resolved != used {
+			// Not resolved lexically, eg a selector.
+			continue
+		}
+		switch {
+		case used == obj:
+			// A use of obj which newName would resolve to
+			// something declared closer to it.
+			if inner, other := s.LookupParent(newName, id.Pos()); other != nil && inner != scope && encloses(inner) {
+				return conflict(other)
+			}
+		case id.Name == newName:
+			// A use of something else which would now resolve to
+			// obj instead.
+			if encloses(s) && !encloses(used.Parent()) && (scope == obj.Pkg().Scope() || obj.Pos() < id.Pos()) {
+				return conflict(used)
+			}
+		}
+	}
+	return nil
+}
+
+// fieldOwner returns the type which declares the field v, preferring a
+// named type so that methods are also considered. It returns nil if it
+// can't be found in info.
+func fieldOwner(info *loader.PackageInfo, v *types.Var) types.Type {
+	hasField := func(t types.Type) bool {
+		if s, ok := t.Underlying().(*types.Struct); ok {
+			for i := 0; i < s.NumFields(); i++ {
+				if s.Field(i) == v {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	scope := v.Pkg().Scope()
+	for _, name := range scope.Names() {
+		if tn, ok := scope.Lookup(name).(*types.TypeName); ok && hasField(tn.Type()) {
+			return tn.Type()
+		}
+	}
+	for _, tv := range info.Types {
+		if tv.Type != nil && hasField(tv.Type) {
+			return tv.Type
+		}
+	}
+	return nil
+}
@@ -0,0 +1,250 @@
+package langserver
+
+import (
+	"context"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/scanner"
+	"go/token"
+	"go/types"
+	"path"
+	"sort"
+
+	"github.com/sourcegraph/go-langserver/langserver/util"
+	"github.com/sourcegraph/go-langserver/pkg/lsp"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+// semanticTokenTypes and semanticTokenModifiers are the legend of the
+// semantic tokens. A token's type is sent as its index in
+// semanticTokenTypes, and its modifiers as the bit set of their indexes in
+// semanticTokenModifiers.
+var (
+	semanticTokenTypes = []lsp.SemanticTokenType{
+		lsp.STTNamespace,
+		lsp.STTType,
+		lsp.STTFunction,
+		lsp.STTMethod,
+		lsp.STTVariable,
+		lsp.STTParameter,
+		lsp.STTProperty,
+		lsp.STTKeyword,
+	}
+	semanticTokenModifiers = []lsp.SemanticTokenModifier{
+		lsp.STMDeclaration,
+		lsp.STMReadonly,
+		lsp.STMStatic,
+	}
+)
+
+func (h *LangHandler) handleTextDocumentSemanticTokensFull(ctx context.Context, conn jsonrpc2.JSONRPC2, req *jsonrpc2.Request, params lsp.SemanticTokensParams) (*lsp.SemanticTokens, error) {
+	if !util.IsURI(params.TextDocument.URI) {
+		return nil, &jsonrpc2.Error{
+			Code:    jsonrpc2.CodeInvalidParams,
+			Message: fmt.Sprintf("%s not yet supported for out-of-workspace URI (%q)", req.Method, params.TextDocument.URI),
+		}
+	}
+
+	contents, err := h.readFile(ctx, params.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+	filename := h.FilePath(params.TextDocument.URI)
+	bctx := h.BuildContext(ctx)
+	bpkg, err := containingPackage(bctx, filename, h.mainModule(bctx, filename))
+	if mpErr, ok := err.(*build.MultiplePackageError); ok {
+		bpkg, err = buildPackageForNamedFileInMultiPackageDir(bpkg, mpErr, path.Base(filename))
+	}
+	if err != nil {
+		return nil, err
+	}
+	fset, prog, _, err := h.cachedTypecheck(ctx, bctx, bpkg)
+	if err != nil {
+		return nil, err
+	}
+	if prog == nil || len(prog.Created) == 0 {
+		return nil, fmt.Errorf("typechecking %s failed", bpkg.ImportPath)
+	}
+	pkg := prog.Created[0]
+	for _, f := range pkg.Files {
+		if util.PathEqual(fset.File(f.Pos()).Name(), filename) {
+			toks := semanticTokens(fset, f, &pkg.Info, contents, h.positionEncoding())
+			return &lsp.SemanticTokens{Data: encodeSemanticTokens(toks)}, nil
+		}
+	}
+	return nil, fmt.Errorf("%s is not in package %s", filename, bpkg.ImportPath)
+}
+
+type semanticToken struct {
+	line, char, length int // zero-based, in the units of the position encoding
+	typ                lsp.SemanticTokenType
+	mods               []lsp.SemanticTokenModifier
+}
+
+// semanticTokens returns the tokens of f, whose source is src, in the
+// order they appear, counting characters in the units of enc. Keywords
+// are found by scanning src. Identifiers are
+// classified by the objects info records for them:
+//
+// * constants are readonly variables
+// * package-level variables and constants are static
+// * the identifiers declaring an object have the declaration modifier
+//
+// Identifiers without an object, such as "_", have no token.
+func semanticTokens(fset *token.FileSet, f *ast.File, info *types.Info, src []byte, enc lsp.PositionEncodingKind) []semanticToken {
+	var toks []semanticToken
+	// newToken returns the token of the length bytes at p, counted in
+	// the units of enc.
+	newToken := func(p token.Position, length int, typ lsp.SemanticTokenType, mods []lsp.SemanticTokenModifier) semanticToken {
+		start := lspPosition(p, src, enc)
+		p.Offset, p.Column = p.Offset+length, p.Column+length
+		end := lspPosition(p, src, enc)
+		return semanticToken{line: start.Line, char: start.Character, length: end.Character - start.Character, typ: typ, mods: mods}
+	}
+	add := func(pos token.Pos, length int, typ lsp.SemanticTokenType, mods ...lsp.SemanticTokenModifier) {
+		toks = append(toks, newToken(fset.Position(pos), length, typ, mods))
+	}
+
+	// The keywords aren't in the AST, so find them in the source.
+	var s scanner.Scanner
+	sfset := token.NewFileSet()
+	s.Init(sfset.AddFile("", -1, len(src)), src, nil, 0)
+	for {
+		pos, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		if tok.IsKeyword() {
+			toks = append(toks, newToken(sfset.Position(pos), len(lit), lsp.STTKeyword, nil))
+		}
+	}
+
+	// Parameters and results are variables like any other to the type
+	// checker, so tell them apart by where they are declared.
+	params := make(map[types.Object]bool)
+	ast.Inspect(f, func(n ast.Node) bool {
+		var recv *ast.FieldList
+		var ftype *ast.FuncType
+		switch n := n.(type) {
+		case *ast.FuncDecl:
+			recv, ftype = n.Recv, n.Type
+		case *ast.FuncLit:
+			ftype = n.Type
+		default:
+			return true
+		}
+		for _, fields := range []*ast.FieldList{recv, ftype.Params, ftype.Results} {
+			if fields == nil {
+				continue
+			}
+			for _, field := range fields.List {
+				for _, name := range field.Names {
+					if obj := info.Defs[name]; obj != nil {
+						params[obj] = true
+					}
+				}
+			}
+		}
+		return true
+	})
+
+	add(f.Name.Pos(), len(f.Name.Name), lsp.STTNamespace)
+	ast.Inspect(f, func(n ast.Node) bool {
+		id, ok := n.(*ast.Ident)
+		if !ok {
+			return true
+		}
+		// The identifier of an embedded field both uses its type and
+		// declares the field; it is shown as the type.
+		var mods []lsp.SemanticTokenModifier
+		obj := info.Uses[id]
+		if obj == nil {
+			obj = info.Defs[id]
+			if obj == nil {
+				return true
+			}
+			mods = append(mods, lsp.STMDeclaration)
+		}
+		packageLevel := obj.Pkg() != nil && obj.Parent() == obj.Pkg().Scope()
+		switch obj := obj.(type) {
+		case *types.PkgName:
+			add(id.Pos(), len(id.Name), lsp.STTNamespace, mods...)
+		case *types.TypeName:
+			add(id.Pos(), len(id.Name), lsp.STTType, mods...)
+		case *types.Builtin:
+			add(id.Pos(), len(id.Name), lsp.STTFunction, mods...)
+		case *types.Func:
+			if obj.Type().(*types.Signature).Recv() != nil {
+				add(id.Pos(), len(id.Name), lsp.STTMethod, mods...)
+			} else {
+				add(id.Pos(), len(id.Name), lsp.STTFunction, mods...)
+			}
+		case *types.Const:
+			mods = append(mods, lsp.STMReadonly)
+			if packageLevel {
+				mods = append(mods, lsp.STMStatic)
+			}
+			add(id.Pos(), len(id.Name), lsp.STTVariable, mods...)
+		case *types.Nil:
+			add(id.Pos(), len(id.Name), lsp.STTVariable, lsp.STMReadonly)
+		case *types.Var:
+			switch {
+			case obj.IsField():
+				add(id.Pos(), len(id.Name), lsp.STTProperty, mods...)
+			case params[obj]:
+				add(id.Pos(), len(id.Name), lsp.STTParameter, mods...)
+			case packageLevel:
+				add(id.Pos(), len(id.Name), lsp.STTVariable, append(mods, lsp.STMStatic)...)
+			default:
+				add(id.Pos(), len(id.Name), lsp.STTVariable, mods...)
+			}
+		}
+		return true
+	})
+
+	sort.Slice(toks, func(i, j int) bool {
+		if toks[i].line != toks[j].line {
+			return toks[i].line < toks[j].line
+		}
+		return toks[i].char < toks[j].char
+	})
+	return toks
+}
+
+// encodeSemanticTokens returns toks, which must be in order, packed as
+// the integers of lsp.SemanticTokens.Data.
+func encodeSemanticTokens(toks []semanticToken) []uint32 {
+	data := make([]uint32, 0, 5*len(toks))
+	var line, char int
+	for _, t := range toks {
+		if t.line != line {
+			char = 0
+		}
+		var mods uint32
+		for _, m := range t.mods {
+			mods |= 1 << uint(semanticTokenModifierIndex(m))
+		}
+		data = append(data, uint32(t.line-line), uint32(t.char-char), uint32(t.length), uint32(semanticTokenTypeIndex(t.typ)), mods)
+		line, char = t.line, t.char
+	}
+	return data
+}
+
+func semanticTokenTypeIndex(typ lsp.SemanticTokenType) int {
+	for i, t := range semanticTokenTypes {
+		if t == typ {
+			return i
+		}
+	}
+	panic("unknown semantic token type " + typ)
+}
+
+func semanticTokenModifierIndex(mod lsp.SemanticTokenModifier) int {
+	for i, m := range semanticTokenModifiers {
+		if m == mod {
+			return i
+		}
+	}
+	panic("unknown semantic token modifier " + mod)
+}
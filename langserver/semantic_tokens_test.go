@@ -0,0 +1,24 @@
+package langserver
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/sourcegraph/go-langserver/pkg/lsp"
+)
+
+func TestEncodeSemanticTokens(t *testing.T) {
+	toks := []semanticToken{
+		{line: 2, char: 5, length: 3, typ: lsp.STTVariable, mods: []lsp.SemanticTokenModifier{lsp.STMDeclaration, lsp.STMStatic}},
+		{line: 2, char: 10, length: 4, typ: lsp.STTType},
+		{line: 4, char: 1, length: 5, typ: lsp.STTKeyword},
+	}
+	want := []uint32{
+		2, 5, 3, 4, 5,
+		0, 5, 4, 1, 0,
+		2, 1, 5, 7, 0,
+	}
+	if got := encodeSemanticTokens(toks); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
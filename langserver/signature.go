@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"go/ast"
+	"go/scanner"
 	"go/token"
 	"go/types"
 
@@ -40,14 +41,22 @@ func (h *LangHandler) handleTextDocumentSignatureHelp(ctx context.Context, conn
 	sParams := signature.Params()
 	info.Parameters = make([]lsp.ParameterInformation, sParams.Len())
 	for i := 0; i < sParams.Len(); i++ {
-		info.Parameters[i] = lsp.ParameterInformation{Label: shortParam(sParams.At(i))}
-	}
-	activeParameter := len(call.Args)
-	for index, arg := range call.Args {
-		if arg.End() >= *start {
-			activeParameter = index
-			break
+		label := shortParam(sParams.At(i))
+		if signature.Variadic() && i == sParams.Len()-1 {
+			label = variadicParam(sParams.At(i))
 		}
+		info.Parameters[i] = lsp.ParameterInformation{Label: label}
+	}
+
+	contents, err := h.readFile(ctx, params.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+	activeParameter := countArgs(contents, fset.Position(call.Lparen).Offset, fset.Position(*start).Offset)
+	if signature.Variadic() && activeParameter >= sParams.Len()-1 {
+		// Every argument from the last parameter on is part of the
+		// variadic parameter.
+		activeParameter = sParams.Len() - 1
 	}
 
 	funcIdent, funcOk := call.Fun.(*ast.Ident)
@@ -60,6 +69,9 @@ func (h *LangHandler) handleTextDocumentSignatureHelp(ctx context.Context, conn
 	}
 	if funcIdent != nil && funcOk {
 		funcObj := pkg.ObjectOf(funcIdent)
+		if funcObj == nil {
+			return &lsp.SignatureHelp{Signatures: []lsp.SignatureInformation{info}, ActiveSignature: 0, ActiveParameter: activeParameter}, nil
+		}
 		_, path, _ := prog.PathEnclosingInterval(funcObj.Pos(), funcObj.Pos())
 		for i := 0; i < len(path); i++ {
 			a, b := path[i].(*ast.FuncDecl)
@@ -84,6 +96,34 @@ func callExpr(fset *token.FileSet, nodes []ast.Node) *ast.CallExpr {
 	return nil
 }
 
+// countArgs returns the index of the argument at offset cursor in a call
+// whose opening paren is at offset lparen in src, by counting the commas
+// between them which aren't nested in another expression.
+func countArgs(src []byte, lparen, cursor int) int {
+	if cursor <= lparen || cursor > len(src) {
+		return 0
+	}
+	src = src[lparen+1 : cursor]
+	var s scanner.Scanner
+	s.Init(token.NewFileSet().AddFile("", -1, len(src)), src, nil, 0)
+	index, depth := 0, 0
+	for {
+		_, tok, _ := s.Scan()
+		switch tok {
+		case token.EOF:
+			return index
+		case token.LPAREN, token.LBRACK, token.LBRACE:
+			depth++
+		case token.RPAREN, token.RBRACK, token.RBRACE:
+			depth--
+		case token.COMMA:
+			if depth == 0 {
+				index++
+			}
+		}
+	}
+}
+
 // shortTyoe returns shorthand type notation without specifying type's import path
 func shortType(t types.Type) string {
 	return types.TypeString(t, func(*types.Package) string {
@@ -99,3 +139,16 @@ func shortParam(param *types.Var) string {
 	}
 	return ret + shortType(param.Type())
 }
+
+// variadicParam is like shortParam, but for the final parameter of a
+// variadic function, which is shown as "name ...elem".
+func variadicParam(param *types.Var) string {
+	ret := param.Name()
+	if ret != "" {
+		ret += " "
+	}
+	if s, ok := param.Type().(*types.Slice); ok {
+		return ret + "..." + shortType(s.Elem())
+	}
+	return ret + shortType(param.Type())
+}
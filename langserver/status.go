@@ -0,0 +1,64 @@
+package langserver
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"time"
+
+	"github.com/sourcegraph/go-langserver/pkg/lsp"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+// commandStatus is the workspace/executeCommand command whose result is
+// the ServerStatus, for monitoring long running servers.
+const commandStatus = "langserver.status"
+
+// startTime is when the process started, for the uptime in ServerStatus.
+var startTime = time.Now()
+
+func (h *LangHandler) handleWorkspaceExecuteCommand(ctx context.Context, conn jsonrpc2.JSONRPC2, req *jsonrpc2.Request, params lsp.ExecuteCommandParams) (interface{}, error) {
+	switch params.Command {
+	case commandStatus:
+		return h.status(), nil
+	case commandReload:
+		h.reload()
+		return nil, nil
+	case commandBuildContext:
+		return h.buildContextInfo(ctx), nil
+	case commandFreeGC:
+		if h.config().FreeGCCommandEnabled {
+			return freeGC(), nil
+		}
+	}
+	return nil, &jsonrpc2.Error{
+		Code:    jsonrpc2.CodeInvalidParams,
+		Message: fmt.Sprintf("unknown command %q", params.Command),
+	}
+}
+
+// status returns the current status of the server.
+func (h *LangHandler) status() ServerStatus {
+	h.mu.Lock()
+	typecheckCache, symbolCache, loads := h.typecheckCache, h.symbolCache, h.loads
+	h.mu.Unlock()
+
+	// The symbol cache also holds the list of all packages.
+	symbolPackages := 0
+	for _, k := range symbolCache.Keys() {
+		if _, ok := k.(pkgSymbolsKey); ok {
+			symbolPackages++
+		}
+	}
+
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	return ServerStatus{
+		TypecheckedPackages: typecheckCache.Len(),
+		SymbolPackages:      symbolPackages,
+		LoadsInProgress:     len(loads),
+		HeapAllocBytes:      mem.HeapAlloc,
+		SysBytes:            mem.Sys,
+		UptimeSeconds:       time.Since(startTime).Seconds(),
+	}
+}
@@ -0,0 +1,119 @@
+package langserver
+
+import (
+	"context"
+	"go/build"
+	"reflect"
+	"testing"
+
+	"github.com/sourcegraph/go-langserver/pkg/lsp"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+func TestStatusCommand(t *testing.T) {
+	h := &LangHandler{Config: NewDefaultConfig(), HandlerShared: &HandlerShared{}}
+	h.resetCaches(false)
+	fill := func() interface{} { return nil }
+	h.typecheckCache.Get("a", fill)
+	h.typecheckCache.Get("b", fill)
+	h.symbolCache.Get(pkgSymbolsKey{pkg: "a"}, fill)
+	h.allPackages(&build.Context{})
+
+	execute := func(command string) (interface{}, error) {
+		return h.handleWorkspaceExecuteCommand(context.Background(), nil, &jsonrpc2.Request{Method: "workspace/executeCommand"}, lsp.ExecuteCommandParams{Command: command})
+	}
+	res, err := execute(commandStatus)
+	if err != nil {
+		t.Fatal(err)
+	}
+	status := res.(ServerStatus)
+	if status.TypecheckedPackages != 2 || status.SymbolPackages != 1 || status.LoadsInProgress != 0 {
+		t.Errorf("got status %+v, want 2 typechecked packages, 1 symbol package and no loads", status)
+	}
+	if status.HeapAllocBytes == 0 || status.SysBytes == 0 || status.UptimeSeconds <= 0 {
+		t.Errorf("got status %+v, want memory use and uptime", status)
+	}
+
+	if _, err := execute("langserver.unknown"); err == nil {
+		t.Error("got no error for an unknown command")
+	}
+}
+
+func TestReloadCommand(t *testing.T) {
+	h := &LangHandler{Config: NewDefaultConfig(), HandlerShared: &HandlerShared{}}
+	if err := h.HandlerShared.Reset(false); err != nil {
+		t.Fatal(err)
+	}
+	h.resetCaches(false)
+	fill := func() interface{} { return nil }
+	h.typecheckCache.Get("a", fill)
+	h.symbolCache.Get("a", fill)
+	h.godefCache.Get("a", fill)
+
+	const open, initial = "file:///src/p/open.go", "file:///src/p/initial.go"
+	h.overlay.didOpen(&lsp.DidOpenTextDocumentParams{TextDocument: lsp.TextDocumentItem{URI: open, Version: 1, Text: "package p"}})
+	h.overlay.set(initial, []byte("package p"))
+
+	if _, err := h.handleWorkspaceExecuteCommand(context.Background(), nil, &jsonrpc2.Request{Method: "workspace/executeCommand"}, lsp.ExecuteCommandParams{Command: commandReload}); err != nil {
+		t.Fatal(err)
+	}
+	if n := h.typecheckCache.Len() + h.symbolCache.Len() + h.godefCache.Len(); n != 0 {
+		t.Errorf("got %d cached values after reloading, want none", n)
+	}
+	if _, found := h.overlay.get(open); !found {
+		t.Error("the open document was dropped")
+	}
+	if _, found := h.overlay.get(initial); found {
+		t.Error("the document which isn't open was kept")
+	}
+}
+
+func TestBuildContextCommand(t *testing.T) {
+	h := &LangHandler{Config: NewDefaultConfig(), HandlerShared: &HandlerShared{}}
+	h.Config.BuildTags = []string{"integration"}
+	h.Config.GOPATH = "/configured/gopath"
+	h.init = &InitializeParams{BuildContext: &InitializeBuildContextParams{
+		GOOS:       "windows",
+		GOARCH:     "arm64",
+		GOPATH:     "/client/gopath",
+		GOROOT:     "/client/goroot",
+		CgoEnabled: true,
+		BuildTags:  []string{"client"},
+	}}
+	if err := h.HandlerShared.Reset(false); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := h.handleWorkspaceExecuteCommand(context.Background(), nil, &jsonrpc2.Request{Method: "workspace/executeCommand"}, lsp.ExecuteCommandParams{Command: commandBuildContext})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := BuildContextInfo{
+		GOROOT:     "/client/goroot",
+		GOPATH:     "/configured/gopath",
+		GOOS:       "windows",
+		GOARCH:     "arm64",
+		BuildTags:  []string{"client", "integration"},
+		CgoEnabled: true,
+	}
+	if got := res.(BuildContextInfo); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestFreeGCCommand(t *testing.T) {
+	h := &LangHandler{Config: NewDefaultConfig(), HandlerShared: &HandlerShared{}}
+	params := lsp.ExecuteCommandParams{Command: commandFreeGC}
+	if _, err := h.handleWorkspaceExecuteCommand(context.Background(), nil, &jsonrpc2.Request{Method: "workspace/executeCommand"}, params); err == nil {
+		t.Error("got no error with the command disabled by default")
+	}
+
+	h.Config.FreeGCCommandEnabled = true
+	res, err := h.handleWorkspaceExecuteCommand(context.Background(), nil, &jsonrpc2.Request{Method: "workspace/executeCommand"}, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := res.(FreeGCResult); got.After.SysBytes == 0 || got.After.HeapAllocBytes > got.After.SysBytes {
+		t.Errorf("got implausible memory stats %+v", got)
+	}
+}
@@ -8,13 +8,15 @@ import (
 	"go/doc"
 	"go/parser"
 	"go/token"
-	"log"
+	"go/types"
 	"os"
 	"path"
 	"path/filepath"
 	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"unicode"
 
 	"golang.org/x/tools/go/buildutil"
 
@@ -197,7 +199,7 @@ func score(q Query, s symbolPair) (scor int) {
 	}
 	name, container := strings.ToLower(s.Name), strings.ToLower(s.ContainerName)
 	if !util.IsURI(s.Location.URI) {
-		log.Printf("unexpectedly saw symbol defined at a non-file URI: %q", s.Location.URI)
+		warnf("unexpectedly saw symbol defined at a non-file URI: %q", s.Location.URI)
 		return 0
 	}
 	filename := util.UriToPath(s.Location.URI)
@@ -217,6 +219,7 @@ func score(q Query, s symbolPair) (scor int) {
 			return 2
 		}
 	}
+	var fuzzy int
 	for i, tok := range q.Tokens {
 		tok := strings.ToLower(tok)
 		if strings.HasPrefix(container, tok) {
@@ -224,6 +227,8 @@ func score(q Query, s symbolPair) (scor int) {
 		}
 		if strings.HasPrefix(name, tok) {
 			scor += 3
+		} else {
+			fuzzy += fuzzyScore(tok, s.Name)
 		}
 		if strings.Contains(filename, tok) && len(tok) >= 3 {
 			scor++
@@ -242,20 +247,117 @@ func score(q Query, s symbolPair) (scor int) {
 			scor += 3
 		}
 	}
-	if scor > 0 && !(strings.HasPrefix(filename, "vendor/") || strings.Contains(filename, "/vendor/")) {
+	matched := scor > 0 || fuzzy > 0
+	if matched && !(strings.HasPrefix(filename, "vendor/") || strings.Contains(filename, "/vendor/")) {
 		// boost for non-vendor symbols
 		scor += 5
 	}
-	if scor > 0 && ast.IsExported(s.Name) {
+	if matched && ast.IsExported(s.Name) {
 		// boost for exported symbols
 		scor++
 	}
-	return scor
+	// Fuzzy matches only rank symbols which otherwise score the same, so
+	// that exact and prefix matches always rank above them.
+	if fuzzy >= fuzzyTier {
+		fuzzy = fuzzyTier - 1
+	}
+	return scor*fuzzyTier + fuzzy
+}
+
+// fuzzyTier is the factor scores are multiplied by to leave room for fuzzy
+// match scores beneath them.
+const fuzzyTier = 4
+
+// fuzzyScore returns a score for tok matching name as a subsequence, for
+// example "nhc" matching "NewHTTPClient". It returns 0 if it doesn't match,
+// 2 if every character of tok starts a word in name, such as an acronym of
+// a camelCase name, and 1 otherwise. tok must be lower case.
+func fuzzyScore(tok, name string) int {
+	if len(tok) < 2 {
+		return 0
+	}
+	lower := []rune(strings.ToLower(name))
+	boundaries := wordBoundaries(name)
+
+	// match finds the positions in name that tok matches at. If
+	// preferBoundaries is set each character of tok is matched at the
+	// next word boundary when there is one. The first character must
+	// always start a word, otherwise nearly everything matches.
+	match := func(preferBoundaries bool) (matched, atBoundary int) {
+		i := 0
+		for _, c := range tok {
+			next := -1
+			for j := i; j < len(lower); j++ {
+				if lower[j] != c {
+					continue
+				}
+				if boundaries[j] {
+					next = j
+					break
+				}
+				if next < 0 && matched > 0 {
+					next = j
+					if !preferBoundaries {
+						break
+					}
+				}
+			}
+			if next < 0 {
+				return matched, atBoundary
+			}
+			matched++
+			if boundaries[next] {
+				atBoundary++
+			}
+			i = next + 1
+		}
+		return matched, atBoundary
+	}
+
+	n := len([]rune(tok))
+	matched, atBoundary := match(true)
+	if matched != n {
+		matched, atBoundary = match(false)
+	}
+	switch {
+	case matched != n:
+		return 0
+	case atBoundary == n:
+		return 2
+	default:
+		return 1
+	}
+}
+
+// wordBoundaries reports which runes of the identifier name start a word,
+// either after an underscore or at a change of case. The last upper case
+// letter of an acronym followed by lower case starts a new word, so the
+// words of "HTTPClient" are "HTTP" and "Client".
+func wordBoundaries(name string) []bool {
+	r := []rune(name)
+	b := make([]bool, len(r))
+	for i := range r {
+		switch {
+		case i == 0:
+			b[i] = true
+		case r[i] == '_':
+			// Underscores separate words, but don't start one.
+		case r[i-1] == '_':
+			b[i] = true
+		case unicode.IsUpper(r[i]) && !unicode.IsUpper(r[i-1]):
+			b[i] = true
+		case unicode.IsUpper(r[i]) && i+1 < len(r) && unicode.IsLower(r[i+1]):
+			b[i] = true
+		case unicode.IsDigit(r[i]) && !unicode.IsDigit(r[i-1]):
+			b[i] = true
+		}
+	}
+	return b
 }
 
 // toSym returns a SymbolInformation value derived from values we get
 // from the Go parser and doc packages.
-func toSym(name string, bpkg *build.Package, recv string, kind lsp.SymbolKind, fs *token.FileSet, pos token.Pos) symbolPair {
+func toSym(name string, bpkg *build.Package, recv string, kind lsp.SymbolKind, conv *positionConverter, fs *token.FileSet, pos token.Pos, deprecated bool) symbolPair {
 	var id string
 	if recv == "" {
 		id = fmt.Sprintf("%s/-/%s", path.Clean(bpkg.ImportPath), name)
@@ -263,12 +365,17 @@ func toSym(name string, bpkg *build.Package, recv string, kind lsp.SymbolKind, f
 		id = fmt.Sprintf("%s/-/%s/%s", path.Clean(bpkg.ImportPath), recv, name)
 	}
 
+	var tags []lsp.SymbolTag
+	if deprecated {
+		tags = []lsp.SymbolTag{lsp.STDeprecated}
+	}
 	return symbolPair{
 		SymbolInformation: lsp.SymbolInformation{
 			Name:          name,
 			Kind:          kind,
-			Location:      goRangeToLSPLocation(fs, pos, pos+token.Pos(len(name))),
+			Location:      goRangeToLSPLocation(conv, fs, pos, pos+token.Pos(len(name))),
 			ContainerName: recv,
+			Tags:          tags,
 		},
 		// NOTE: fields must be kept in sync with workspace_refs.go:defSymbolDescriptor
 		desc: symbolDescriptor{
@@ -295,7 +402,7 @@ func (h *LangHandler) handleTextDocumentSymbol(ctx context.Context, conn jsonrpc
 
 	fset := token.NewFileSet()
 	bctx := h.BuildContext(ctx)
-	src, err := buildutil.ParseFile(fset, bctx, nil, filepath.Dir(path), filepath.Base(path), 0)
+	src, err := buildutil.ParseFile(fset, bctx, nil, filepath.Dir(path), filepath.Base(path), parser.ParseComments)
 	if err != nil {
 		return nil, err
 	}
@@ -305,14 +412,214 @@ func (h *LangHandler) handleTextDocumentSymbol(ctx context.Context, conn jsonrpc
 	}
 	pkg.Files[filepath.Base(path)] = src
 
-	symbols := astPkgToSymbols(fset, pkg, &build.Package{})
+	symbols := astPkgToSymbols(h.positionConverter(ctx), fset, pkg, &build.Package{})
+	tags := h.documentSymbolTagSupported(lsp.STDeprecated)
 	res := make([]lsp.SymbolInformation, len(symbols))
 	for i, s := range symbols {
 		res[i] = s.SymbolInformation
+		if !tags {
+			res[i].Tags = nil
+		}
 	}
 	return res, nil
 }
 
+// handleTextDocumentHierarchicalSymbol handles `textDocument/documentSymbol`
+// requests from clients which support hierarchical symbols. Fields, methods
+// and values of a type declared in the document are nested in the type.
+func (h *LangHandler) handleTextDocumentHierarchicalSymbol(ctx context.Context, conn jsonrpc2.JSONRPC2, req *jsonrpc2.Request, params lsp.DocumentSymbolParams) ([]lsp.DocumentSymbol, error) {
+	if !util.IsURI(params.TextDocument.URI) {
+		return nil, &jsonrpc2.Error{
+			Code:    jsonrpc2.CodeInvalidParams,
+			Message: fmt.Sprintf("textDocument/documentSymbol not yet supported for out-of-workspace URI (%q)", params.TextDocument.URI),
+		}
+	}
+	path := util.UriToPath(params.TextDocument.URI)
+
+	fset := token.NewFileSet()
+	bctx := h.BuildContext(ctx)
+	src, err := buildutil.ParseFile(fset, bctx, nil, filepath.Dir(path), filepath.Base(path), parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	syms := documentSymbols(h.positionConverter(ctx), fset, src)
+	if !h.documentSymbolTagSupported(lsp.STDeprecated) {
+		clearSymbolTags(syms)
+	}
+	return syms, nil
+}
+
+// documentSymbols returns the symbols declared in f, sorted by position.
+// Like the godoc grouping used by astPkgToSymbols, a type's children are
+// its fields and methods, and the consts and vars declared to be of that
+// type.
+func documentSymbols(conv *positionConverter, fset *token.FileSet, f *ast.File) []lsp.DocumentSymbol {
+	syms := []lsp.DocumentSymbol{}
+	typeIndex := make(map[string]int) // index in syms of each type
+	sym := func(name *ast.Ident, kind lsp.SymbolKind, n ast.Node, docs ...*ast.CommentGroup) lsp.DocumentSymbol {
+		return lsp.DocumentSymbol{
+			Name:           name.Name,
+			Kind:           kind,
+			Tags:           deprecatedTags(docs...),
+			Range:          rangeForNode(conv, fset, n),
+			SelectionRange: rangeForNode(conv, fset, name),
+		}
+	}
+
+	// Methods and typed values are collected with the name of their type,
+	// and nested once all the types in f are known.
+	type member struct {
+		typeName string
+		sym      lsp.DocumentSymbol
+	}
+	var members []member
+	for _, decl := range f.Decls {
+		switch decl := decl.(type) {
+		case *ast.FuncDecl:
+			if decl.Recv == nil || len(decl.Recv.List) == 0 {
+				syms = append(syms, sym(decl.Name, lsp.SKFunction, decl, decl.Doc))
+				continue
+			}
+			recv := decl.Recv.List[0].Type
+			s := sym(decl.Name, lsp.SKMethod, decl, decl.Doc)
+			s.Detail = types.ExprString(recv)
+			if star, ok := recv.(*ast.StarExpr); ok {
+				recv = star.X
+			}
+			name, _ := recv.(*ast.Ident)
+			if name == nil {
+				syms = append(syms, s)
+				continue
+			}
+			members = append(members, member{name.Name, s})
+
+		case *ast.GenDecl:
+			// The type of a const spec without one is inherited from
+			// the previous spec, as with iota.
+			var typeName string
+			for _, spec := range decl.Specs {
+				// The range of an ungrouped declaration includes its
+				// keyword.
+				var n ast.Node = spec
+				if !decl.Lparen.IsValid() {
+					n = decl
+				}
+				switch spec := spec.(type) {
+				case *ast.TypeSpec:
+					kind := lsp.SKClass
+					if _, ok := spec.Type.(*ast.InterfaceType); ok {
+						kind = lsp.SKInterface
+					}
+					s := sym(spec.Name, kind, n, spec.Doc, decl.Doc)
+					s.Children = typeMembers(conv, fset, spec.Type)
+					typeIndex[spec.Name.Name] = len(syms)
+					syms = append(syms, s)
+
+				case *ast.ValueSpec:
+					kind := lsp.SKVariable
+					if decl.Tok == token.CONST {
+						kind = lsp.SKConstant
+					}
+					if id, ok := spec.Type.(*ast.Ident); ok {
+						typeName = id.Name
+					} else if spec.Type != nil || decl.Tok != token.CONST || len(spec.Values) > 0 {
+						typeName = ""
+					}
+					for _, name := range spec.Names {
+						if name.Name == "_" {
+							continue
+						}
+						members = append(members, member{typeName, sym(name, kind, n, spec.Doc, decl.Doc)})
+					}
+				}
+			}
+		}
+	}
+
+	for _, m := range members {
+		if i, ok := typeIndex[m.typeName]; ok {
+			syms[i].Children = append(syms[i].Children, m.sym)
+		} else {
+			syms = append(syms, m.sym)
+		}
+	}
+	sortDocumentSymbols(syms)
+	for i := range syms {
+		sortDocumentSymbols(syms[i].Children)
+	}
+	return syms
+}
+
+// typeMembers returns the fields of a struct type or the methods of an
+// interface type.
+func typeMembers(conv *positionConverter, fset *token.FileSet, t ast.Expr) []lsp.DocumentSymbol {
+	var (
+		fields *ast.FieldList
+		kind   lsp.SymbolKind
+	)
+	switch t := t.(type) {
+	case *ast.StructType:
+		fields, kind = t.Fields, lsp.SKField
+	case *ast.InterfaceType:
+		fields, kind = t.Methods, lsp.SKMethod
+	default:
+		return nil
+	}
+
+	var syms []lsp.DocumentSymbol
+	add := func(name *ast.Ident, kind lsp.SymbolKind, field *ast.Field) {
+		syms = append(syms, lsp.DocumentSymbol{
+			Name:           name.Name,
+			Kind:           kind,
+			Tags:           deprecatedTags(field.Doc),
+			Range:          rangeForNode(conv, fset, field),
+			SelectionRange: rangeForNode(conv, fset, name),
+		})
+	}
+	for _, field := range fields.List {
+		for _, name := range field.Names {
+			add(name, kind, field)
+		}
+		if len(field.Names) > 0 {
+			continue
+		}
+		// An embedded field is named after its type, and an
+		// embedded interface contributes its methods.
+		typ := field.Type
+		if star, ok := typ.(*ast.StarExpr); ok {
+			typ = star.X
+		}
+		if sel, ok := typ.(*ast.SelectorExpr); ok {
+			typ = sel.Sel
+		}
+		if name, ok := typ.(*ast.Ident); ok {
+			if kind == lsp.SKMethod {
+				add(name, lsp.SKInterface, field)
+			} else {
+				add(name, kind, field)
+			}
+		}
+	}
+	return syms
+}
+
+// clearSymbolTags removes the tags of syms and their children, for
+// clients which don't support them.
+func clearSymbolTags(syms []lsp.DocumentSymbol) {
+	for i := range syms {
+		syms[i].Tags = nil
+		clearSymbolTags(syms[i].Children)
+	}
+}
+
+// sortDocumentSymbols sorts syms by the start of their range.
+func sortDocumentSymbols(syms []lsp.DocumentSymbol) {
+	sort.SliceStable(syms, func(i, j int) bool {
+		a, b := syms[i].Range.Start, syms[j].Range.Start
+		return a.Line < b.Line || (a.Line == b.Line && a.Character < b.Character)
+	})
+}
+
 // handleSymbol handles `workspace/symbol` requests for the Go
 // language server.
 func (h *LangHandler) handleWorkspaceSymbol(ctx context.Context, conn jsonrpc2.JSONRPC2, req *jsonrpc2.Request, params lspext.WorkspaceSymbolParams) ([]lsp.SymbolInformation, error) {
@@ -331,7 +638,7 @@ func (h *LangHandler) handleWorkspaceSymbol(ctx context.Context, conn jsonrpc2.J
 		// If no limit is specified, default to a reasonable number
 		// for a user to look at. If they want more, they should
 		// refine the query.
-		params.Limit = 50
+		params.Limit = h.config().MaxWorkspaceSymbols
 	}
 	return h.handleSymbol(ctx, conn, req, q, params.Limit)
 }
@@ -339,11 +646,11 @@ func (h *LangHandler) handleWorkspaceSymbol(ctx context.Context, conn jsonrpc2.J
 func (h *LangHandler) handleSymbol(ctx context.Context, conn jsonrpc2.JSONRPC2, req *jsonrpc2.Request, query Query, limit int) ([]lsp.SymbolInformation, error) {
 	results := resultSorter{Query: query, results: make([]scoredSymbol, 0)}
 	{
-		rootPath := h.FilePath(h.init.Root())
 		bctx := h.BuildContext(ctx)
 
-		par := parallel.NewRun(h.Config.MaxParallelism)
-		for _, pkg := range tools.ListPkgsUnderDir(bctx, rootPath) {
+		var pkgs []symbolPackage
+		for _, sp := range h.symbolPackages(bctx) {
+			pkg := sp.importPath
 			// If we're restricting results to a single file or dir, ensure the
 			// package dir matches to avoid doing unnecessary work.
 			if results.Query.File != "" {
@@ -361,7 +668,18 @@ func (h *LangHandler) handleSymbol(ctx context.Context, conn jsonrpc2.JSONRPC2,
 			if results.Query.Filter == FilterDir && !util.PathEqual(pkg, results.Query.Dir) {
 				continue
 			}
+			pkgs = append(pkgs, sp)
+		}
 
+		// Only searches of several packages take long enough to be
+		// worth reporting.
+		var progress *workDoneProgress
+		if len(pkgs) > 1 {
+			progress = h.beginProgress(ctx, conn, "Searching Go symbols")
+		}
+		var done int64
+		par := parallel.NewRun(h.maxParallelism())
+		for _, sp := range pkgs {
 			par.Acquire()
 
 			// If the context is cancelled, breaking the loop here
@@ -372,7 +690,7 @@ func (h *LangHandler) handleSymbol(ctx context.Context, conn jsonrpc2.JSONRPC2,
 				break
 			}
 
-			go func(pkg string) {
+			go func(pkg, rootPath string) {
 				// Prevent any uncaught panics from taking the
 				// entire server down. For an example see
 				// https://github.com/golang/go/issues/17788
@@ -381,9 +699,11 @@ func (h *LangHandler) handleSymbol(ctx context.Context, conn jsonrpc2.JSONRPC2,
 					_ = util.Panicf(recover(), "%v for pkg %v", req.Method, pkg)
 				}()
 				h.collectFromPkg(ctx, bctx, pkg, rootPath, &results)
-			}(pkg)
+				progress.report(ctx, int(atomic.AddInt64(&done, 1)), len(pkgs))
+			}(sp.importPath, sp.rootPath)
 		}
 		_ = par.Wait()
+		progress.end(ctx, fmt.Sprintf("searched %d packages", len(pkgs)))
 	}
 	sort.Sort(&results)
 	if len(results.results) > limit && limit > 0 {
@@ -393,16 +713,64 @@ func (h *LangHandler) handleSymbol(ctx context.Context, conn jsonrpc2.JSONRPC2,
 	return results.Results(), nil
 }
 
+// symbolPackage is a package searched by workspace/symbol, and the
+// workspace folder it is found from.
+type symbolPackage struct {
+	importPath string
+	rootPath   string
+}
+
+// symbolPackages returns the packages workspace/symbol searches, as
+// decided by Config.SymbolScope. By default they are the packages of all
+// the workspace folders.
+func (h *LangHandler) symbolPackages(bctx *build.Context) []symbolPackage {
+	folders := h.workspaceFolders()
+	var pkgs []symbolPackage
+	seen := make(map[string]bool)
+	if h.config().SymbolScope != symbolScopeGOPATH {
+		for _, rootPath := range folders {
+			for _, pkg := range tools.ListPkgsUnderDir(bctx, rootPath, h.skipExcludedDir(rootPath)) {
+				// Workspace folders may be nested.
+				if !seen[pkg] {
+					seen[pkg] = true
+					pkgs = append(pkgs, symbolPackage{importPath: pkg, rootPath: rootPath})
+				}
+			}
+		}
+		return pkgs
+	}
+	// The packages are found from the first folder, as those outside of
+	// the workspace are.
+	rootPath := h.folderOf("")
+	for _, gopath := range buildutil.SplitPathList(bctx, bctx.GOPATH) {
+		for _, pkg := range tools.ListPkgsUnderDir(bctx, gopath, nil) {
+			// A package may be in several GOPATH entries, in which
+			// case the first is used, as by the go tool.
+			if !seen[pkg] {
+				seen[pkg] = true
+				pkgs = append(pkgs, symbolPackage{importPath: pkg, rootPath: rootPath})
+			}
+		}
+	}
+	sort.Slice(pkgs, func(i, j int) bool { return pkgs[i].importPath < pkgs[j].importPath })
+	return pkgs
+}
+
 type pkgSymResult struct {
 	ready   chan struct{} // closed to broadcast readiness
 	symbols []lsp.SymbolInformation
 }
 
+// pkgSymbolsKey is the key of the symbols of a package in the symbol
+// cache. The build tags decide which files are in the package.
+type pkgSymbolsKey struct{ pkg, buildTags string }
+
 // collectFromPkg collects all the symbols from the specified package
 // into the results. It uses LangHandler's package symbol cache to
 // speed up repeated calls.
 func (h *LangHandler) collectFromPkg(ctx context.Context, bctx *build.Context, pkg string, rootPath string, results *resultSorter) {
-	symbols := h.symbolCache.Get(pkg, func() interface{} {
+	key := pkgSymbolsKey{pkg, strings.Join(bctx.BuildTags, ",")}
+	symbols := h.symbolCache.Get(key, func() interface{} {
 		findPackage := h.getFindPackageFunc()
 		buildPkg, err := findPackage(ctx, bctx, pkg, rootPath, 0)
 		if err != nil {
@@ -411,9 +779,9 @@ func (h *LangHandler) collectFromPkg(ctx context.Context, bctx *build.Context, p
 		}
 
 		fs := token.NewFileSet()
-		astPkgs, err := parseDir(fs, bctx, buildPkg.Dir, nil, 0)
+		astPkgs, err := parseDir(fs, bctx, buildPkg.Dir, nil, parser.ParseComments)
 		if err != nil {
-			log.Printf("failed to parse directory %s: %s", buildPkg.Dir, err)
+			warnf("failed to parse directory %s: %s", buildPkg.Dir, err)
 			return nil
 		}
 		astPkg := astPkgs[buildPkg.Name]
@@ -421,59 +789,67 @@ func (h *LangHandler) collectFromPkg(ctx context.Context, bctx *build.Context, p
 			return nil
 		}
 
-		return astPkgToSymbols(fs, astPkg, buildPkg)
+		return astPkgToSymbols(h.positionConverter(ctx), fs, astPkg, buildPkg)
 	})
 
 	if symbols == nil {
 		return
 	}
 
+	// Filter here rather than when scoring, so that every query sees the
+	// same set of symbols. The cache holds all symbols since the config
+	// may change.
+	exportedOnly := results.Query.Filter == FilterExported || !h.config().IncludeUnexportedSymbols
+	tags := h.workspaceSymbolTagSupported(lsp.STDeprecated)
 	for _, sym := range symbols.([]symbolPair) {
-		if results.Query.Filter == FilterExported && !isExported(&sym) {
+		if exportedOnly && !isExported(&sym) {
 			continue
 		}
+		if !tags {
+			sym.Tags = nil
+		}
 		results.Collect(sym)
 	}
 }
 
 // astToSymbols returns a slice of LSP symbols from an AST.
-func astPkgToSymbols(fs *token.FileSet, astPkg *ast.Package, buildPkg *build.Package) []symbolPair {
+func astPkgToSymbols(conv *positionConverter, fs *token.FileSet, astPkg *ast.Package, buildPkg *build.Package) []symbolPair {
 	// TODO(keegancsmith) Remove vendored doc/go once https://github.com/golang/go/issues/17788 is shipped
 	docPkg := doc.New(astPkg, buildPkg.ImportPath, doc.AllDecls)
 
 	// Emit decls
 	var pkgSyms []symbolPair
 	for _, t := range docPkg.Types {
-		pkgSyms = append(pkgSyms, toSym(t.Name, buildPkg, "", typeSpecSym(t), fs, declNamePos(t.Decl, t.Name)))
+		pkgSyms = append(pkgSyms, toSym(t.Name, buildPkg, "", typeSpecSym(t), conv, fs, declNamePos(t.Decl, t.Name), isDeprecated(t.Doc)))
 		for _, v := range t.Funcs {
-			pkgSyms = append(pkgSyms, toSym(v.Name, buildPkg, "", lsp.SKFunction, fs, v.Decl.Name.NamePos))
+			pkgSyms = append(pkgSyms, toSym(v.Name, buildPkg, "", lsp.SKFunction, conv, fs, v.Decl.Name.NamePos, isDeprecated(v.Doc)))
 		}
 		for _, v := range t.Methods {
-			pkgSyms = append(pkgSyms, toSym(v.Name, buildPkg, t.Name, lsp.SKMethod, fs, v.Decl.Name.NamePos))
+			pkgSyms = append(pkgSyms, toSym(v.Name, buildPkg, t.Name, lsp.SKMethod, conv, fs, v.Decl.Name.NamePos, isDeprecated(v.Doc)))
 		}
 		for _, v := range t.Consts {
 			for _, name := range v.Names {
-				pkgSyms = append(pkgSyms, toSym(name, buildPkg, "", lsp.SKConstant, fs, declNamePos(v.Decl, name)))
+				pkgSyms = append(pkgSyms, toSym(name, buildPkg, "", lsp.SKConstant, conv, fs, declNamePos(v.Decl, name), valueDeprecated(v, name)))
 			}
 		}
 		for _, v := range t.Vars {
 			for _, name := range v.Names {
-				pkgSyms = append(pkgSyms, toSym(name, buildPkg, "", lsp.SKField, fs, declNamePos(v.Decl, name)))
+				pkgSyms = append(pkgSyms, toSym(name, buildPkg, "", lsp.SKField, conv, fs, declNamePos(v.Decl, name), valueDeprecated(v, name)))
 			}
 		}
 	}
 	for _, v := range docPkg.Consts {
 		for _, name := range v.Names {
-			pkgSyms = append(pkgSyms, toSym(name, buildPkg, "", lsp.SKConstant, fs, declNamePos(v.Decl, name)))
+			pkgSyms = append(pkgSyms, toSym(name, buildPkg, "", lsp.SKConstant, conv, fs, declNamePos(v.Decl, name), valueDeprecated(v, name)))
 		}
 	}
 	for _, v := range docPkg.Vars {
 		for _, name := range v.Names {
-			pkgSyms = append(pkgSyms, toSym(name, buildPkg, "", lsp.SKVariable, fs, declNamePos(v.Decl, name)))
+			pkgSyms = append(pkgSyms, toSym(name, buildPkg, "", lsp.SKVariable, conv, fs, declNamePos(v.Decl, name), valueDeprecated(v, name)))
 		}
 	}
 	for _, v := range docPkg.Funcs {
-		pkgSyms = append(pkgSyms, toSym(v.Name, buildPkg, "", lsp.SKFunction, fs, v.Decl.Name.NamePos))
+		pkgSyms = append(pkgSyms, toSym(v.Name, buildPkg, "", lsp.SKFunction, conv, fs, v.Decl.Name.NamePos, isDeprecated(v.Doc)))
 	}
 
 	return pkgSyms
@@ -496,6 +872,71 @@ func typeSpecSym(t *doc.Type) lsp.SymbolKind {
 	return lsp.SKClass
 }
 
+// valueDeprecated reports whether the const or var name declared by v is
+// deprecated, either by the doc comment of its declaration or by that of
+// its own spec.
+func valueDeprecated(v *doc.Value, name string) bool {
+	if isDeprecated(v.Doc) {
+		return true
+	}
+	for _, spec := range v.Decl.Specs {
+		if spec, ok := spec.(*ast.ValueSpec); ok {
+			for _, specName := range spec.Names {
+				if specName.Name == name {
+					return isDeprecated(spec.Doc.Text())
+				}
+			}
+		}
+	}
+	return false
+}
+
+// isDeprecated reports whether doc, the text of a doc comment, marks its
+// declaration as deprecated, which by convention is done with a line
+// starting with "Deprecated:".
+func isDeprecated(doc string) bool {
+	for _, line := range strings.Split(doc, "\n") {
+		if strings.HasPrefix(line, "Deprecated:") {
+			return true
+		}
+	}
+	return false
+}
+
+// deprecatedTags returns the tags of a symbol with the doc comments docs,
+// which mark it deprecated if any of them does. The docs are only there if
+// the declarations were parsed with parser.ParseComments.
+func deprecatedTags(docs ...*ast.CommentGroup) []lsp.SymbolTag {
+	for _, doc := range docs {
+		if isDeprecated(doc.Text()) {
+			return []lsp.SymbolTag{lsp.STDeprecated}
+		}
+	}
+	return nil
+}
+
+// documentSymbolTagSupported and workspaceSymbolTagSupported report
+// whether the client shows document and workspace symbols tagged with
+// tag.
+func (h *LangHandler) documentSymbolTagSupported(tag lsp.SymbolTag) bool {
+	ds := h.init.Capabilities.TextDocument.DocumentSymbol
+	return ds != nil && ds.TagSupport != nil && hasSymbolTag(ds.TagSupport.ValueSet, tag)
+}
+
+func (h *LangHandler) workspaceSymbolTagSupported(tag lsp.SymbolTag) bool {
+	ws := h.init.Capabilities.Workspace.Symbol
+	return ws != nil && ws.TagSupport != nil && hasSymbolTag(ws.TagSupport.ValueSet, tag)
+}
+
+func hasSymbolTag(tags []lsp.SymbolTag, tag lsp.SymbolTag) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
 func declNamePos(decl *ast.GenDecl, name string) token.Pos {
 	for _, spec := range decl.Specs {
 		switch spec := spec.(type) {
@@ -549,6 +990,8 @@ func parseDir(fset *token.FileSet, bctx *build.Context, path string, filter func
 	return
 }
 
+// isExported reports whether sym is part of its package's exported API. A
+// method is only exported if its receiver type is too.
 func isExported(sym *symbolPair) bool {
 	if sym.ContainerName == "" {
 		return ast.IsExported(sym.Name)
@@ -559,6 +1002,6 @@ func isExported(sym *symbolPair) bool {
 func maybeLogImportError(pkg string, err error) {
 	_, isNoGoError := err.(*build.NoGoError)
 	if !(isNoGoError || !isMultiplePackageError(err) || strings.HasPrefix(pkg, "github.com/golang/go/test/")) {
-		log.Printf("skipping possible package %s: %s", pkg, err)
+		debugf("skipping possible package %s: %s", pkg, err)
 	}
 }
@@ -86,6 +86,54 @@ func Test_resultSorter(t *testing.T) {
 			Location: lsp.Location{URI: "file:///foo.go"},
 			Kind:     lsp.SKFunction,
 		}},
+	}, {
+		rawQuery: "nhc",
+		allSymbols: []lsp.SymbolInformation{{
+			ContainerName: "p", Name: "NoHealthCheck",
+			Location: lsp.Location{URI: "file:///file.go"},
+			Kind:     lsp.SKFunction,
+		}, {
+			ContainerName: "p", Name: "nhcFoo",
+			Location: lsp.Location{URI: "file:///file.go"},
+			Kind:     lsp.SKFunction,
+		}, {
+			ContainerName: "p", Name: "NewHTTPClient",
+			Location: lsp.Location{URI: "file:///file.go"},
+			Kind:     lsp.SKFunction,
+		}, {
+			ContainerName: "p", Name: "nhc",
+			Location: lsp.Location{URI: "file:///file.go"},
+			Kind:     lsp.SKFunction,
+		}, {
+			ContainerName: "p", Name: "newHttpclient",
+			Location: lsp.Location{URI: "file:///file.go"},
+			Kind:     lsp.SKFunction,
+		}, {
+			ContainerName: "p", Name: "other",
+			Location: lsp.Location{URI: "file:///file.go"},
+			Kind:     lsp.SKFunction,
+		}},
+		expResults: []lsp.SymbolInformation{{
+			ContainerName: "p", Name: "nhc",
+			Location: lsp.Location{URI: "file:///file.go"},
+			Kind:     lsp.SKFunction,
+		}, {
+			ContainerName: "p", Name: "nhcFoo",
+			Location: lsp.Location{URI: "file:///file.go"},
+			Kind:     lsp.SKFunction,
+		}, {
+			ContainerName: "p", Name: "NewHTTPClient",
+			Location: lsp.Location{URI: "file:///file.go"},
+			Kind:     lsp.SKFunction,
+		}, {
+			ContainerName: "p", Name: "NoHealthCheck",
+			Location: lsp.Location{URI: "file:///file.go"},
+			Kind:     lsp.SKFunction,
+		}, {
+			ContainerName: "p", Name: "newHttpclient",
+			Location: lsp.Location{URI: "file:///file.go"},
+			Kind:     lsp.SKFunction,
+		}},
 	}, {
 		// Just tests that 'is:exported' does not affect resultSorter
 		// results, as filtering is done elsewhere in (*LangHandler).collectFromPkg
@@ -155,3 +203,26 @@ func TestQueryString(t *testing.T) {
 		})
 	}
 }
+
+func TestFuzzyScore(t *testing.T) {
+	tests := []struct {
+		tok, name string
+		want      int
+	}{
+		{"nhc", "NewHTTPClient", 2},
+		{"newhc", "NewHTTPClient", 1},
+		{"nhcl", "NewHTTPClient", 1},
+		{"hc", "NewHTTPClient", 2},
+		{"ewc", "NewHTTPClient", 0},
+		{"ttp", "NewHTTPClient", 0},
+		{"fb", "foo_bar", 2},
+		{"cl", "acClient", 1},
+		{"xyz", "NewHTTPClient", 0},
+		{"n", "NewHTTPClient", 0},
+	}
+	for _, test := range tests {
+		if got := fuzzyScore(test.tok, test.name); got != test.want {
+			t.Errorf("fuzzyScore(%q, %q) got %d, want %d", test.tok, test.name, got, test.want)
+		}
+	}
+}
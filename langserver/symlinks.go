@@ -0,0 +1,91 @@
+package langserver
+
+import (
+	"path"
+	"path/filepath"
+
+	"github.com/sourcegraph/go-langserver/langserver/util"
+	"github.com/sourcegraph/go-langserver/pkg/lsp"
+)
+
+// clientURIs returns a function giving the URI the client knows the file
+// of uri by. A workspace folder may be a symlink, or be under one, such
+// as a symlinked GOPATH, while the packages imported through GOPATH have
+// the paths GOPATH spells. The files of the folder are then found under
+// another path than the one the client opened them by, so they are moved
+// back under the folder. Other URIs are returned unchanged.
+func (h *LangHandler) clientURIs() func(lsp.DocumentURI) lsp.DocumentURI {
+	if h.init == nil || h.init.NoOSFileSystemAccess {
+		// Symlinks can only be resolved on the OS file system.
+		return func(uri lsp.DocumentURI) lsp.DocumentURI { return uri }
+	}
+	folders := resolveFolders(h.workspaceFolders(), filepath.EvalSymlinks)
+	return func(uri lsp.DocumentURI) lsp.DocumentURI {
+		if !util.IsURI(uri) {
+			return uri
+		}
+		filename := util.UriToPath(uri)
+		if p := clientPath(folders, filename, filepath.EvalSymlinks); p != filename {
+			return util.PathToURI(p)
+		}
+		return uri
+	}
+}
+
+// clientLocations changes the URIs of locs to those the client knows
+// their files by, as clientURIs does, and returns locs.
+func (h *LangHandler) clientLocations(locs []lsp.Location) []lsp.Location {
+	clientURI := h.clientURIs()
+	for i := range locs {
+		locs[i].URI = clientURI(locs[i].URI)
+	}
+	return locs
+}
+
+// resolvedFolder is a workspace folder as the client opened it and with
+// its symlinks resolved.
+type resolvedFolder struct {
+	path, resolved string
+}
+
+// resolveFolders resolves the symlinks of folders with evalSymlinks. The
+// folders which can't be resolved are left out.
+func resolveFolders(folders []string, evalSymlinks func(string) (string, error)) []resolvedFolder {
+	var resolved []resolvedFolder
+	for _, f := range folders {
+		r, err := evalSymlinks(f)
+		if err != nil {
+			continue
+		}
+		resolved = append(resolved, resolvedFolder{path: f, resolved: filepath.ToSlash(r)})
+	}
+	return resolved
+}
+
+// clientPath returns the path of the file filename under the folder
+// whose resolved path it is in once its own symlinks are resolved with
+// evalSymlinks. Files which are in a folder as the client opened it, or
+// in no folder, are returned unchanged.
+func clientPath(folders []resolvedFolder, filename string, evalSymlinks func(string) (string, error)) string {
+	for _, f := range folders {
+		if util.PathHasPrefix(filename, f.path) {
+			return filename
+		}
+	}
+	dir, err := evalSymlinks(path.Dir(filename))
+	if err != nil {
+		return filename
+	}
+	resolved := path.Join(filepath.ToSlash(dir), path.Base(filename))
+	var folder *resolvedFolder
+	for i, f := range folders {
+		// The innermost folder wins, as for folderOf.
+		if util.PathHasPrefix(resolved, f.resolved) && (folder == nil || len(f.resolved) > len(folder.resolved)) {
+			folder = &folders[i]
+		}
+	}
+	if folder == nil {
+		return filename
+	}
+	return path.Join(folder.path, util.PathTrimPrefix(resolved, folder.resolved))
+}
@@ -0,0 +1,55 @@
+package langserver
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestClientPath(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks need privileges on windows")
+	}
+	tmpDir, err := ioutil.TempDir("", "langserver-symlinks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	// real/src/p is the package, and link a symlink to real, as a
+	// symlinked GOPATH is.
+	if err := os.MkdirAll(filepath.Join(tmpDir, "real", "src", "p", "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(tmpDir, "other"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(tmpDir, "real"), filepath.Join(tmpDir, "link")); err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.ToSlash(tmpDir)
+
+	tests := []struct {
+		folder, filename, want string
+	}{
+		// The client opened the symlinked folder, and GOPATH is the
+		// real one.
+		{"/link/src/p", "/real/src/p/a.go", "/link/src/p/a.go"},
+		{"/link/src/p", "/real/src/p/sub/b.go", "/link/src/p/sub/b.go"},
+		{"/link/src/p", "/link/src/p/a.go", "/link/src/p/a.go"},
+		// The client opened the real folder, and GOPATH is the
+		// symlink.
+		{"/real/src/p", "/link/src/p/a.go", "/real/src/p/a.go"},
+		// Files outside the folder are left alone.
+		{"/link/src/p", "/real/src/other.go", "/real/src/other.go"},
+		{"/link/src/p", "/other/c.go", "/other/c.go"},
+		{"/link/src/p", "/missing/d.go", "/missing/d.go"},
+	}
+	for _, test := range tests {
+		folders := resolveFolders([]string{dir + test.folder}, filepath.EvalSymlinks)
+		if got := clientPath(folders, dir+test.filename, filepath.EvalSymlinks); got != dir+test.want {
+			t.Errorf("folder %s: got %s for %s, want %s", test.folder, got, test.filename, dir+test.want)
+		}
+	}
+}
@@ -3,7 +3,6 @@ package langserver
 import (
 	"context"
 	"encoding/json"
-	"log"
 	"sync"
 
 	basictracer "github.com/opentracing/basictracer-go"
@@ -80,6 +79,14 @@ func (h *HandlerCommon) SpanForRequest(ctx context.Context, buildOrLang string,
 
 	if !isFileSystemRequest(req.Method) && req.Params != nil {
 		span.SetTag("params", string(*req.Params))
+		var params struct {
+			TextDocument struct {
+				URI string `json:"uri"`
+			} `json:"textDocument"`
+		}
+		if err := json.Unmarshal(*req.Params, &params); err == nil && params.TextDocument.URI != "" {
+			span.SetTag("uri", params.TextDocument.URI)
+		}
 	}
 
 	return span, opentracing.ContextWithSpan(ctx, span), nil
@@ -100,7 +107,7 @@ func (t *tracer) RecordSpan(span basictracer.RawSpan) {
 
 	ctx := context.Background()
 	if err := t.conn.Notify(ctx, "telemetry/event", span); err != nil {
-		log.Println("Error sending LSP telemetry/event notification:", err)
+		errorf("sending LSP telemetry/event notification: %s", err)
 	}
 }
 
@@ -113,3 +120,15 @@ func startSpanFollowsFromContext(ctx context.Context, operationName string, opts
 	}
 	return opentracing.GlobalTracer().StartSpan(operationName, opts...)
 }
+
+// startChildSpan starts a span for a phase of the request whose span is in
+// ctx, such as building its result once the package is typechecked. The
+// span uses the request's tracer, which may not be the global one.
+func startChildSpan(ctx context.Context, operationName string) (opentracing.Span, context.Context) {
+	parentSpan := opentracing.SpanFromContext(ctx)
+	if parentSpan == nil {
+		return opentracing.StartSpanFromContext(ctx, operationName)
+	}
+	span := parentSpan.Tracer().StartSpan(operationName, opentracing.ChildOf(parentSpan.Context()))
+	return span, opentracing.ContextWithSpan(ctx, span)
+}
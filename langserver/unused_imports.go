@@ -0,0 +1,155 @@
+package langserver
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/tools/go/ast/astutil"
+
+	"github.com/sourcegraph/go-langserver/pkg/lsp"
+)
+
+// unusedImportRegexp matches the message of the diagnostics of unused
+// imports, which is that of the type checker. The first group is the
+// quoted import path, the second the name it is imported as, if any.
+var unusedImportRegexp = regexp.MustCompile(`^("[^"]*") imported (?:as (\w+) )?(?:and|but) not used$`)
+
+// unusedImports returns a warning for each import of f which f doesn't
+// use. It only looks at the syntax of f: a package is used if a name in
+// f which f doesn't declare is the name it is imported as. Unnamed
+// imports are imported as the name of the package, which is assumed from
+// the import path, so that no other file is read. Blank, dot and cgo
+// imports are never reported. The characters of the ranges are counted in
+// the units of enc, in contents, the source of f.
+func unusedImports(fset *token.FileSet, f *ast.File, contents []byte, enc lsp.PositionEncodingKind) []*lsp.Diagnostic {
+	used := make(map[string]bool)
+	for _, id := range f.Unresolved {
+		used[id.Name] = true
+	}
+	var diags []*lsp.Diagnostic
+	for _, imp := range f.Imports {
+		ipath, err := strconv.Unquote(imp.Path.Value)
+		if err != nil || ipath == "C" {
+			continue
+		}
+		var msg string
+		if imp.Name != nil {
+			if imp.Name.Name == "_" || imp.Name.Name == "." || used[imp.Name.Name] {
+				continue
+			}
+			msg = fmt.Sprintf("%s imported as %s and not used", imp.Path.Value, imp.Name.Name)
+		} else {
+			if used[importPathToAssumedName(ipath)] {
+				continue
+			}
+			msg = fmt.Sprintf("%s imported and not used", imp.Path.Value)
+		}
+		diags = append(diags, &lsp.Diagnostic{
+			Range: lsp.Range{
+				Start: lspPosition(fset.Position(imp.Pos()), contents, enc),
+				End:   lspPosition(fset.Position(imp.End()), contents, enc),
+			},
+			Severity: lsp.Warning,
+			Source:   "go",
+			Message:  msg,
+		})
+	}
+	return diags
+}
+
+// importPathToAssumedName returns the name a package is most likely
+// declared with given its import path, as goimports assumes: the last
+// element of the path without a major version suffix, a "go-" prefix or
+// the characters which can't be in identifiers.
+func importPathToAssumedName(ipath string) string {
+	base := path.Base(ipath)
+	if strings.HasPrefix(base, "v") {
+		if _, err := strconv.Atoi(base[1:]); err == nil {
+			if dir := path.Dir(ipath); dir != "." {
+				base = path.Base(dir)
+			}
+		}
+	}
+	base = strings.TrimPrefix(base, "go-")
+	if i := strings.IndexFunc(base, func(r rune) bool {
+		return !('a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9' || r == '_' || r >= 0x80)
+	}); i >= 0 {
+		base = base[:i]
+	}
+	return base
+}
+
+// removeImportFixes returns a quick fix for each import of the file uri
+// which one of diags reports as unused. The fix removes the import.
+func (h *LangHandler) removeImportFixes(ctx context.Context, uri lsp.DocumentURI, diags []lsp.Diagnostic) ([]lsp.CodeAction, error) {
+	var (
+		fixes    []lsp.CodeAction
+		contents []byte
+		seen     = make(map[string]bool)
+	)
+	for _, d := range diags {
+		m := unusedImportRegexp.FindStringSubmatch(d.Message)
+		if m == nil || seen[m[1]+" "+m[2]] {
+			continue
+		}
+		seen[m[1]+" "+m[2]] = true
+		ipath, err := strconv.Unquote(m[1])
+		if err != nil {
+			continue
+		}
+		if contents == nil {
+			contents, err = h.readFile(ctx, uri)
+			if err != nil {
+				return nil, err
+			}
+		}
+		edit, ok := removeImportEdit(h.FilePath(uri), contents, m[2], ipath, h.positionEncoding())
+		if !ok {
+			continue
+		}
+		fixes = append(fixes, lsp.CodeAction{
+			Title:       fmt.Sprintf("Remove unused import %s", m[1]),
+			Kind:        lsp.CAKQuickFix,
+			Diagnostics: []lsp.Diagnostic{d},
+			Edit:        h.documentEdit(uri, edit),
+		})
+	}
+	return fixes, nil
+}
+
+// removeImportEdit returns the edit which removes the import of ipath as
+// name, which is empty for unnamed imports, from the file filename, whose
+// source is contents, with its range in the units of enc. ok is false if
+// the file doesn't parse or has no such import.
+func removeImportEdit(filename string, contents []byte, name, ipath string, enc lsp.PositionEncodingKind) (edit lsp.TextEdit, ok bool) {
+	fset := token.NewFileSet()
+	orig, err := parser.ParseFile(fset, filename, contents, parser.ImportsOnly|parser.ParseComments)
+	if err != nil {
+		return lsp.TextEdit{}, false
+	}
+	f, err := parser.ParseFile(fset, filename, contents, parser.ParseComments)
+	if err != nil {
+		return lsp.TextEdit{}, false
+	}
+	if !astutil.DeleteNamedImport(fset, f, name, ipath) {
+		return lsp.TextEdit{}, false
+	}
+	var buf bytes.Buffer
+	if err := format.Node(&buf, fset, f); err != nil {
+		return lsp.TextEdit{}, false
+	}
+	fixed, err := parser.ParseFile(fset, filename, buf.Bytes(), parser.ImportsOnly|parser.ParseComments)
+	if err != nil {
+		return lsp.TextEdit{}, false
+	}
+	return importsEdit(fset, orig, fixed, contents, buf.Bytes(), enc), true
+}
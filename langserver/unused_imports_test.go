@@ -0,0 +1,82 @@
+package langserver
+
+import (
+	"fmt"
+	"go/parser"
+	"go/token"
+	"reflect"
+	"testing"
+
+	"github.com/sourcegraph/go-langserver/pkg/lsp"
+)
+
+func TestUnusedImports(t *testing.T) {
+	const src = `package p
+
+import (
+	"fmt"
+	"os"
+	str "strings"
+	s2 "strings"
+	_ "net/http/pprof"
+	. "math"
+	"C"
+	"gopkg.in/yaml.v2"
+	"example.com/go-thing"
+	"example.com/mod/v2"
+	"example.com/renamed"
+)
+
+var _ = fmt.Sprint(str.ToUpper("x"), Pi, thing.X, mod.Y)
+
+func f() {
+	os := 1
+	_ = os
+}
+`
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "a.go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, d := range unusedImports(fset, f, []byte(src), lsp.PositionEncodingUTF16) {
+		got = append(got, fmt.Sprintf("%d:%d-%d:%d %s", d.Range.Start.Line, d.Range.Start.Character, d.Range.End.Line, d.Range.End.Character, d.Message))
+	}
+	want := []string{
+		`4:1-4:5 "os" imported and not used`,
+		`6:1-6:13 "strings" imported as s2 and not used`,
+		`10:1-10:19 "gopkg.in/yaml.v2" imported and not used`,
+		`13:1-13:22 "example.com/renamed" imported and not used`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestRemoveImportEdit(t *testing.T) {
+	const src = "package p\n\nimport (\n\t\"fmt\"\n\tstr \"strings\"\n)\n\nvar _ = fmt.Sprint\n"
+	tests := []struct {
+		name, ipath string
+		want        string
+		ok          bool
+	}{
+		{"str", "strings", "0:9-5:1 \n\nimport (\n\t\"fmt\"\n)", true},
+		{"", "fmt", "0:9-5:1 \n\nimport (\n\tstr \"strings\"\n)", true},
+		{"", "strings", "", false},
+	}
+	for _, test := range tests {
+		edit, ok := removeImportEdit("a.go", []byte(src), test.name, test.ipath, lsp.PositionEncodingUTF16)
+		if ok != test.ok {
+			t.Errorf("removing %s %q: got ok %v, want %v", test.name, test.ipath, ok, test.ok)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		got := fmt.Sprintf("%d:%d-%d:%d %s", edit.Range.Start.Line, edit.Range.Start.Character, edit.Range.End.Line, edit.Range.End.Character, edit.NewText)
+		if got != test.want {
+			t.Errorf("removing %s %q: got edit %q, want %q", test.name, test.ipath, got, test.want)
+		}
+	}
+}
@@ -70,15 +70,18 @@ func IsURI(s lsp.DocumentURI) bool {
 	return strings.HasPrefix(string(s), "file:///")
 }
 
-// PathToURI converts given absolute path to file URI
+// PathToURI converts given absolute path to file URI. Characters which
+// aren't allowed in a URI path, such as spaces, are escaped, so that
+// UriToPath gives back the path.
 func PathToURI(path string) lsp.DocumentURI {
-	if path != "" {
-		path = virtualPath(path)
-		if !strings.HasPrefix(path, "/") {
-			path = "/" + path
-		}
+	if path == "" {
+		return "file://"
 	}
-	return lsp.DocumentURI("file://" + path)
+	path = virtualPath(path)
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return lsp.DocumentURI((&url.URL{Scheme: "file", Path: path}).String())
 }
 
 // UriToPath converts given file URI to path
@@ -0,0 +1,86 @@
+package langserver
+
+import (
+	"github.com/sourcegraph/go-langserver/langserver/util"
+	"github.com/sourcegraph/go-langserver/pkg/lsp"
+)
+
+// initialFolders returns the paths of the workspace folders of init. A
+// client which doesn't send workspaceFolders has a single folder, its
+// root.
+func initialFolders(init *InitializeParams) []string {
+	if len(init.WorkspaceFolders) == 0 {
+		return []string{util.UriToPath(init.Root())}
+	}
+	var folders []string
+	for _, f := range init.WorkspaceFolders {
+		folders = addFolder(folders, util.UriToPath(f.URI))
+	}
+	return folders
+}
+
+// addFolder returns folders with folder appended, unless it is already
+// one of them.
+func addFolder(folders []string, folder string) []string {
+	for _, f := range folders {
+		if util.PathEqual(f, folder) {
+			return folders
+		}
+	}
+	return append(folders, folder)
+}
+
+// workspaceFolders returns the paths of the workspace folders, in the
+// order they were added.
+func (h *LangHandler) workspaceFolders() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]string(nil), h.folders...)
+}
+
+// folderOf returns the innermost workspace folder containing filename.
+// Files outside of every folder, such as those of dependencies, are
+// resolved against the first folder, or the root if all the folders were
+// removed.
+func (h *LangHandler) folderOf(filename string) string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var folder string
+	for _, f := range h.folders {
+		if util.PathHasPrefix(filename, f) && len(f) > len(folder) {
+			folder = f
+		}
+	}
+	switch {
+	case folder != "":
+		return folder
+	case len(h.folders) > 0:
+		return h.folders[0]
+	}
+	return h.RootFSPath
+}
+
+// handleWorkspaceDidChangeWorkspaceFolders adds and removes the workspace
+// folders of params. The import graph and the workspace's symbols span
+// all the folders, so the caches are reset.
+func (h *LangHandler) handleWorkspaceDidChangeWorkspaceFolders(params lsp.DidChangeWorkspaceFoldersParams) {
+	h.mu.Lock()
+	for _, removed := range params.Event.Removed {
+		folder := util.UriToPath(removed.URI)
+		kept := h.folders[:0]
+		for _, f := range h.folders {
+			if !util.PathEqual(f, folder) {
+				kept = append(kept, f)
+			}
+		}
+		if len(kept) == len(h.folders) {
+			warnf("Ignoring removal of %s, which is not a workspace folder.", removed.URI)
+		}
+		h.folders = kept
+	}
+	for _, added := range params.Event.Added {
+		h.folders = addFolder(h.folders, util.UriToPath(added.URI))
+	}
+	h.resetCaches(false)
+	h.mu.Unlock()
+}
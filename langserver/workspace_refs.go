@@ -9,7 +9,6 @@ import (
 	"go/parser"
 	"go/token"
 	"go/types"
-	"log"
 	"math"
 	"strings"
 	"sync"
@@ -38,41 +37,47 @@ func (h *LangHandler) handleWorkspaceReferences(ctx context.Context, conn jsonrp
 	// See: https://github.com/Microsoft/language-server-protocol/blob/master/protocol.md#cancelRequest
 	ctx, cancel := context.WithTimeout(ctx, workspaceReferencesTimeout)
 	defer cancel()
-	rootPath := h.FilePath(h.init.Root())
 	bctx := h.BuildContext(ctx)
 
-	// Perform typechecking.
+	// Perform typechecking. unvendoredPackages maps the packages of the
+	// workspace to the folder they are in.
 	var (
 		findPackage        = h.getFindPackageFunc()
 		fset               = token.NewFileSet()
 		pkgs               []string
-		unvendoredPackages = map[string]struct{}{}
+		unvendoredPackages = map[string]string{}
 	)
-	for _, pkg := range tools.ListPkgsUnderDir(bctx, rootPath) {
-		bpkg, err := findPackage(ctx, bctx, pkg, rootPath, build.FindOnly)
-		if err != nil && !isMultiplePackageError(err) {
-			log.Printf("skipping possible package %s: %s", pkg, err)
-			continue
-		}
-
-		// If a dirs hint is present, only look for references created in those
-		// directories.
-		dirs, ok := params.Hints["dirs"]
-		if ok {
-			found := false
-			for _, dir := range dirs.([]interface{}) {
-				if util.PathEqual(bpkg.Dir, dir.(string)) {
-					found = true
-					break
-				}
+	for _, rootPath := range h.workspaceFolders() {
+		for _, pkg := range tools.ListPkgsUnderDir(bctx, rootPath, h.skipExcludedDir(rootPath)) {
+			bpkg, err := findPackage(ctx, bctx, pkg, rootPath, build.FindOnly)
+			if err != nil && !isMultiplePackageError(err) {
+				debugf("skipping possible package %s: %s", pkg, err)
+				continue
 			}
-			if !found {
+			if _, seen := unvendoredPackages[bpkg.ImportPath]; seen {
+				// The package is in nested workspace folders.
 				continue
 			}
+
+			// If a dirs hint is present, only look for references created in those
+			// directories.
+			dirs, ok := params.Hints["dirs"]
+			if ok {
+				found := false
+				for _, dir := range dirs.([]interface{}) {
+					if util.PathEqual(bpkg.Dir, dir.(string)) {
+						found = true
+						break
+					}
+				}
+				if !found {
+					continue
+				}
+			}
+			unvendoredPackages[bpkg.ImportPath] = rootPath
+			unvendoredPackages[bpkg.ImportPath+"_test"] = rootPath
+			pkgs = append(pkgs, pkg)
 		}
-		unvendoredPackages[bpkg.ImportPath] = struct{}{}
-		unvendoredPackages[bpkg.ImportPath+"_test"] = struct{}{}
-		pkgs = append(pkgs, pkg)
 	}
 	if len(pkgs) == 0 {
 		// occurs when the directory hint is present and matches no directories
@@ -85,7 +90,7 @@ func (h *LangHandler) handleWorkspaceReferences(ctx context.Context, conn jsonrp
 	// waiting for all packages to be typechecked (which is IO bound).
 	var results = refResult{results: make([]referenceInformation, 0)}
 	afterTypeCheck := func(pkg *loader.PackageInfo, files []*ast.File) {
-		_, interested := unvendoredPackages[pkg.Pkg.Path()]
+		rootPath, interested := unvendoredPackages[pkg.Pkg.Path()]
 		if !interested {
 			clearInfoFields(pkg) // save memory
 			return
@@ -99,7 +104,7 @@ func (h *LangHandler) handleWorkspaceReferences(ctx context.Context, conn jsonrp
 
 		err := h.workspaceRefsFromPkg(ctx, bctx, conn, params, fset, pkg, files, rootPath, &results)
 		if err != nil {
-			log.Printf("workspaceRefsFromPkg: %v: %v", pkg, err)
+			warnf("workspaceRefsFromPkg: %v: %v", pkg, err)
 		}
 	}
 
@@ -113,7 +118,7 @@ func (h *LangHandler) handleWorkspaceReferences(ctx context.Context, conn jsonrp
 			_ = util.Panicf(recover(), "%v for pkg %v", req.Method, pkgs)
 		}()
 
-		_, err = h.workspaceRefsTypecheck(ctx, bctx, conn, fset, pkgs, afterTypeCheck)
+		_, err = h.workspaceRefsTypecheck(ctx, bctx, fset, pkgs, afterTypeCheck)
 		close(done)
 	}()
 
@@ -203,7 +208,7 @@ loop:
 	return r, nil
 }
 
-func (h *LangHandler) workspaceRefsTypecheck(ctx context.Context, bctx *build.Context, conn jsonrpc2.JSONRPC2, fset *token.FileSet, pkgs []string, afterTypeCheck func(info *loader.PackageInfo, files []*ast.File)) (prog *loader.Program, err error) {
+func (h *LangHandler) workspaceRefsTypecheck(ctx context.Context, bctx *build.Context, fset *token.FileSet, pkgs []string, afterTypeCheck func(info *loader.PackageInfo, files []*ast.File)) (prog *loader.Program, err error) {
 	span, ctx := opentracing.StartSpanFromContext(ctx, "workspaceRefsTypecheck")
 	defer func() {
 		if err != nil {
@@ -215,20 +220,22 @@ func (h *LangHandler) workspaceRefsTypecheck(ctx context.Context, bctx *build.Co
 
 	// Configure the loader.
 	findPackage := h.getFindPackageFunc()
-	var typeErrs []error
 	conf := loader.Config{
 		Fset: fset,
 		TypeChecker: types.Config{
 			DisableUnusedImportCheck: true,
 			FakeImportC:              true,
-			Error: func(err error) {
-				typeErrs = append(typeErrs, err)
-			},
+			// The type errors are the documents' diagnostics, which
+			// are published as they change.
+			Error: func(err error) {},
 		},
 		Build:       bctx,
 		AllowErrors: true,
 		ParserMode:  parser.AllErrors | parser.ParseComments, // prevent parser from bailing out
 		FindPackage: func(bctx *build.Context, importPath, fromDir string, mode build.ImportMode) (*build.Package, error) {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
 			// When importing a package, ignore any
 			// MultipleGoErrors. This occurs, e.g., when you have a
 			// main.go with "// +build ignore" that imports the
@@ -253,7 +260,12 @@ func (h *LangHandler) workspaceRefsTypecheck(ctx context.Context, bctx *build.Co
 	}
 
 	// Load and typecheck the packages.
+	release, err := h.acquireLoad(ctx)
+	if err != nil {
+		return nil, err
+	}
 	prog, err = conf.Load()
+	release()
 	if err != nil && prog == nil {
 		return nil, err
 	}
@@ -262,18 +274,6 @@ func (h *LangHandler) workspaceRefsTypecheck(ctx context.Context, bctx *build.Co
 		return nil, err
 	}
 
-	// Publish typechecking error diagnostics.
-	diags, err := errsToDiagnostics(typeErrs, prog)
-	if err != nil {
-		return nil, err
-	}
-	if len(diags) > 0 {
-		go func() {
-			if err := h.publishDiagnostics(ctx, conn, diags); err != nil {
-				log.Printf("warning: failed to send diagnostics: %s.", err)
-			}
-		}()
-	}
 	return prog, nil
 }
 
@@ -295,6 +295,7 @@ func (h *LangHandler) workspaceRefsFromPkg(ctx context.Context, bctx *build.Cont
 
 	// Compute workspace references.
 	findPackage := h.getFindPackageFunc()
+	conv := h.positionConverter(ctx)
 	cfg := &refs.Config{
 		FileSet:  fs,
 		Pkg:      pkg.Pkg,
@@ -309,7 +310,7 @@ func (h *LangHandler) workspaceRefsFromPkg(ctx context.Context, bctx *build.Cont
 			// the data).
 			ext.Error.Set(span, true)
 			err := fmt.Errorf("workspaceRefsFromPkg: failed to import %v: %v", r.Def.ImportPath, err)
-			log.Println(err)
+			debugf("%s", err)
 			span.SetTag("error", err.Error())
 			return
 		}
@@ -319,7 +320,7 @@ func (h *LangHandler) workspaceRefsFromPkg(ctx context.Context, bctx *build.Cont
 
 		results.resultsMu.Lock()
 		results.results = append(results.results, referenceInformation{
-			Reference: goRangeToLSPLocation(fs, r.Start, r.End),
+			Reference: goRangeToLSPLocation(conv, fs, r.Start, r.End),
 			Symbol:    symDesc,
 		})
 		results.resultsMu.Unlock()
@@ -2,6 +2,7 @@ package main // import "github.com/sourcegraph/go-langserver"
 
 import (
 	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"io"
@@ -11,8 +12,13 @@ import (
 	"os"
 	"runtime"
 	"runtime/debug"
+	"strings"
+	"sync"
 	"time"
+	"unicode"
 
+	basictracer "github.com/opentracing/basictracer-go"
+	opentracing "github.com/opentracing/opentracing-go"
 	"github.com/sourcegraph/go-langserver/langserver"
 	"github.com/sourcegraph/jsonrpc2"
 
@@ -20,17 +26,43 @@ import (
 )
 
 var (
-	mode               = flag.String("mode", "stdio", "communication mode (stdio|tcp)")
-	addr               = flag.String("addr", ":4389", "server listen address (tcp)")
-	trace              = flag.Bool("trace", false, "print all requests and responses")
-	logfile            = flag.String("logfile", "", "also log to this file (in addition to stderr)")
-	printVersion       = flag.Bool("version", false, "print version and exit")
-	pprof              = flag.String("pprof", "", "start a pprof http server (https://golang.org/pkg/net/http/pprof/)")
-	freeosmemory       = flag.Bool("freeosmemory", true, "aggressively free memory back to the OS")
-	usebinarypkgcache  = flag.Bool("usebinarypkgcache", true, "use $GOPATH/pkg binary .a files (improves performance)")
-	maxparallelism     = flag.Int("maxparallelism", -1, "use at max N parallel goroutines to fulfill requests")
-	gocodecompletion   = flag.Bool("gocodecompletion", false, "enable completion (extra memory burden)")
-	funcSnippetEnabled = flag.Bool("func-snippet-enabled", true, "enable argument snippets on func completion")
+	mode                 = flag.String("mode", "stdio", "communication mode (stdio|tcp)")
+	addr                 = flag.String("addr", ":4389", "server listen address (tcp)")
+	trace                = flag.Bool("trace", false, "print all requests and responses")
+	logfile              = flag.String("logfile", "", "also log to this file (in addition to stderr)")
+	spanfile             = flag.String("spanfile", "", "record the tracing spans of all requests to this file, one JSON object per line")
+	printVersion         = flag.Bool("version", false, "print version and exit")
+	pprof                = flag.String("pprof", "", "start a pprof http server (https://golang.org/pkg/net/http/pprof/)")
+	freeosmemory         = flag.Bool("freeosmemory", true, "aggressively free memory back to the OS")
+	usebinarypkgcache    = flag.Bool("usebinarypkgcache", true, "use $GOPATH/pkg binary .a files (improves performance)")
+	maxparallelism       = flag.Int("maxparallelism", -1, "use at max N parallel goroutines to fulfill requests and load at most N packages at once")
+	gocodecompletion     = flag.Bool("gocodecompletion", false, "enable gocode completion (extra memory burden); otherwise the typechecker completes selectors, type names and struct literal fields")
+	funcSnippetEnabled   = flag.Bool("func-snippet-enabled", true, "enable argument snippets on func completion")
+	hoverBackend         = flag.String("hover-backend", "", "how hovers are answered (typecheck|godef), by default like definitions")
+	formatTool           = flag.String("format-tool", "gofmt", "which tool is used to format documents (gofmt|goimports)")
+	goimportsLocalPrefix = flag.String("goimports-local-prefix", "", "goimports only: put imports beginning with this string after 3rd-party packages; a comma-separated list gives each prefix its own group")
+	formatGoVersion      = flag.String("format-go-version", "", "format like gofmt of this Go version, such as 1.18, which doesn't reformat doc comments (empty for the current one)")
+	docLinkBaseURL       = flag.String("doc-link-base-url", "https://pkg.go.dev", "link import paths to the documentation on this server (empty to disable)")
+	maxWorkspaceSymbols  = flag.Int("max-workspace-symbols", 50, "return at most N workspace/symbol results if the client doesn't set a limit (0 for no limit)")
+	symbolScope          = flag.String("symbol-scope", "workspace", "which packages workspace/symbol searches (workspace|gopath)")
+	definitionTarget     = flag.String("definition-target", "source", "where definitions outside of the workspace lead (source|doc); doc needs -doc-link-base-url")
+	unexportedSymbols    = flag.Bool("include-unexported-symbols", true, "include unexported symbols in workspace/symbol results")
+	typecheckCacheSize   = flag.Int("typecheck-cache-size", 0, "keep at most N typechecked packages in memory (0 to use $SRC_TYPECHECK_CACHE_SIZE, default 10)")
+	packageCacheTTL      = flag.Duration("package-cache-ttl", 0, "evict typechecked packages unused for this long, such as 30m (0 to keep them until the cache is full)")
+	diagnostics          = flag.Bool("diagnostics", true, "publish type errors of open documents as diagnostics")
+	unusedImports        = flag.Bool("unused-import-diagnostics", true, "publish warnings for the unused imports of open documents, even if -diagnostics is false")
+	diagnosticsDebounce  = flag.Int("diagnostics-debounce-ms", 250, "recompute diagnostics N milliseconds after the last change to a package")
+	buildTags            = flag.String("tags", "", "a comma or space separated list of build tags to consider satisfied")
+	followTypeAliases    = flag.Bool("follow-type-aliases", false, "make definitions of type aliases lead to the types they denote")
+	maxReferenceResults  = flag.Int("max-reference-results", 0, "return at most N locations for references, the first ones in order (0 for no limit)")
+	referenceCodeLenses  = flag.Bool("reference-code-lenses", true, "show code lenses counting the references to exported declarations (costly in large workspaces)")
+	goroot               = flag.String("goroot", "", "use this GOROOT instead of the client's or the environment's")
+	gopath               = flag.String("gopath", "", "use this GOPATH instead of the client's or the environment's")
+	logLevel             = flag.String("log-level", "info", "log messages of this severity and above (debug|info|warn|error)")
+	prewarmPackages      = flag.String("prewarm-packages", "", "a comma separated list of packages to typecheck in the background after initialize (import paths or patterns like ./cmd/...)")
+	readOnly             = flag.Bool("read-only", false, "disable rename, formatting and code actions, which edit documents")
+	freeGCCommand        = flag.Bool("free-gc-command", false, "enable the langserver.freeGC command, which returns unused memory to the OS")
+	excludeDirs          = flag.String("exclude-dirs", "", "a comma separated list of directory patterns, relative to the workspace folders, left out of workspace scans and diagnostics (like node_modules or third_party/*)")
 )
 
 // version is the version field we report back. If you are releasing a new version:
@@ -68,6 +100,35 @@ func main() {
 	cfg.GocodeCompletionEnabled = *gocodecompletion
 	cfg.MaxParallelism = *maxparallelism
 	cfg.UseBinaryPkgCache = *usebinarypkgcache
+	cfg.HoverBackend = *hoverBackend
+	cfg.FormatTool = *formatTool
+	cfg.GoimportsLocalPrefix = *goimportsLocalPrefix
+	cfg.FormatGoVersion = *formatGoVersion
+	cfg.DocLinkBaseURL = *docLinkBaseURL
+	cfg.MaxWorkspaceSymbols = *maxWorkspaceSymbols
+	cfg.SymbolScope = *symbolScope
+	cfg.DefinitionTarget = *definitionTarget
+	cfg.IncludeUnexportedSymbols = *unexportedSymbols
+	cfg.TypecheckCacheSize = *typecheckCacheSize
+	cfg.PackageCacheTTL = *packageCacheTTL
+	cfg.DiagnosticsEnabled = *diagnostics
+	cfg.UnusedImportDiagnosticsEnabled = *unusedImports
+	cfg.DiagnosticsDebounceMs = *diagnosticsDebounce
+	cfg.BuildTags = strings.FieldsFunc(*buildTags, func(r rune) bool { return r == ',' || unicode.IsSpace(r) })
+	cfg.FollowTypeAliases = *followTypeAliases
+	cfg.ReferenceCodeLensesEnabled = *referenceCodeLenses
+	cfg.MaxReferenceResults = *maxReferenceResults
+	cfg.GOROOT = *goroot
+	cfg.GOPATH = *gopath
+	cfg.LogLevel = *logLevel
+	cfg.ReadOnly = *readOnly
+	cfg.FreeGCCommandEnabled = *freeGCCommand
+	if *prewarmPackages != "" {
+		cfg.PrewarmPackages = strings.Split(*prewarmPackages, ",")
+	}
+	if *excludeDirs != "" {
+		cfg.ExcludeDirs = strings.Split(*excludeDirs, ",")
+	}
 
 	if err := run(cfg); err != nil {
 		fmt.Fprintln(os.Stderr, err)
@@ -94,6 +155,18 @@ func run(cfg langserver.Config) error {
 	}
 	log.SetOutput(logW)
 
+	if *spanfile != "" {
+		f, err := os.Create(*spanfile)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		opt := basictracer.DefaultOptions()
+		opt.ShouldSample = func(uint64) bool { return true }
+		opt.Recorder = &spanRecorder{enc: json.NewEncoder(f)}
+		opentracing.SetGlobalTracer(basictracer.NewWithOptions(opt))
+	}
+
 	var connOpt []jsonrpc2.ConnOpt
 	if *trace {
 		connOpt = append(connOpt, jsonrpc2.LogMessages(log.New(logW, "", 0)))
@@ -146,6 +219,21 @@ func (stdrwc) Close() error {
 	return os.Stdout.Close()
 }
 
+// spanRecorder writes finished spans to a file so that the latency of
+// requests and their phases can be analyzed without a tracing backend.
+type spanRecorder struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func (r *spanRecorder) RecordSpan(span basictracer.RawSpan) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.enc.Encode(span); err != nil {
+		log.Println("Error recording span:", err)
+	}
+}
+
 // freeOSMemory should be called in a goroutine, it invokes
 // runtime/debug.FreeOSMemory() more aggressively than the runtime default of
 // 5 minutes after GC.
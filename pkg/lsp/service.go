@@ -17,6 +17,10 @@ type InitializeParams struct {
 	RootURI               DocumentURI        `json:"rootUri,omitempty"`
 	InitializationOptions interface{}        `json:"initializationOptions,omitempty"`
 	Capabilities          ClientCapabilities `json:"capabilities"`
+
+	// WorkspaceFolders are the folders open in the client, if it
+	// supports several. The root is then usually the first of them.
+	WorkspaceFolders []WorkspaceFolder `json:"workspaceFolders,omitempty"`
 }
 
 // Root returns the RootURI if set, or otherwise the RootPath with 'file://' prepended.
@@ -35,6 +39,8 @@ type DocumentURI string
 type ClientCapabilities struct {
 	Workspace    WorkspaceClientCapabilities    `json:"workspace,omitempty"`
 	TextDocument TextDocumentClientCapabilities `json:"textDocument,omitempty"`
+	Window       WindowClientCapabilities       `json:"window,omitempty"`
+	General      GeneralClientCapabilities      `json:"general,omitempty"`
 	Experimental interface{}                    `json:"experimental,omitempty"`
 
 	// Below are Sourcegraph extensions. They do not live in lspext since
@@ -53,7 +59,46 @@ type ClientCapabilities struct {
 	XCacheProvider bool `json:"xcacheProvider,omitempty"`
 }
 
-type WorkspaceClientCapabilities struct{}
+type WorkspaceClientCapabilities struct {
+	WorkspaceFolders bool `json:"workspaceFolders,omitempty"`
+
+	WorkspaceEdit *struct {
+		DocumentChanges bool `json:"documentChanges,omitempty"`
+	} `json:"workspaceEdit,omitempty"`
+
+	Symbol *struct {
+		TagSupport *struct {
+			ValueSet []SymbolTag `json:"valueSet"`
+		} `json:"tagSupport,omitempty"`
+	} `json:"symbol,omitempty"`
+}
+
+type WindowClientCapabilities struct {
+	// WorkDoneProgress indicates the client supports progress created
+	// by the server with window/workDoneProgress/create.
+	WorkDoneProgress bool `json:"workDoneProgress,omitempty"`
+}
+
+type GeneralClientCapabilities struct {
+	// PositionEncodings are the encodings the client can count the
+	// characters of positions in, in its order of preference. It is
+	// UTF-16 alone if it is empty.
+	PositionEncodings []PositionEncodingKind `json:"positionEncodings,omitempty"`
+}
+
+// PositionEncodingKind is the unit the characters of positions are
+// counted in.
+type PositionEncodingKind string
+
+const (
+	// PositionEncodingUTF8 counts bytes.
+	PositionEncodingUTF8 PositionEncodingKind = "utf-8"
+	// PositionEncodingUTF16 counts UTF-16 code units, as LSP does by
+	// default.
+	PositionEncodingUTF16 PositionEncodingKind = "utf-16"
+	// PositionEncodingUTF32 counts Unicode code points.
+	PositionEncodingUTF32 PositionEncodingKind = "utf-32"
+)
 
 type TextDocumentClientCapabilities struct {
 	Completion struct {
@@ -62,12 +107,42 @@ type TextDocumentClientCapabilities struct {
 		} `json:"completionItemKind,omitempty"`
 		CompletionItem struct {
 			SnippetSupport bool `json:"snippetSupport,omitempty"`
+			TagSupport     *struct {
+				ValueSet []CompletionItemTag `json:"valueSet"`
+			} `json:"tagSupport,omitempty"`
 		} `json:"completionItem,omitempty"`
 	} `json:"completion,omitempty"`
 
+	Definition *struct {
+		LinkSupport bool `json:"linkSupport,omitempty"`
+	} `json:"definition,omitempty"`
+
 	Implementation *struct {
 		DynamicRegistration bool `json:"dynamicRegistration,omitempty"`
 	} `json:"implementation,omitempty"`
+
+	Rename *struct {
+		PrepareSupport bool `json:"prepareSupport,omitempty"`
+	} `json:"rename,omitempty"`
+
+	DocumentSymbol *struct {
+		HierarchicalDocumentSymbolSupport bool `json:"hierarchicalDocumentSymbolSupport,omitempty"`
+		TagSupport                        *struct {
+			ValueSet []SymbolTag `json:"valueSet"`
+		} `json:"tagSupport,omitempty"`
+	} `json:"documentSymbol,omitempty"`
+
+	Hover *struct {
+		ContentFormat []MarkupKind `json:"contentFormat,omitempty"`
+	} `json:"hover,omitempty"`
+
+	CodeAction *struct {
+		CodeActionLiteralSupport *struct {
+			CodeActionKind struct {
+				ValueSet []CodeActionKind `json:"valueSet,omitempty"`
+			} `json:"codeActionKind"`
+		} `json:"codeActionLiteralSupport,omitempty"`
+	} `json:"codeAction,omitempty"`
 }
 
 type InitializeResult struct {
@@ -149,11 +224,13 @@ type SaveOptions struct {
 }
 
 type ServerCapabilities struct {
+	PositionEncoding                 PositionEncodingKind             `json:"positionEncoding,omitempty"`
 	TextDocumentSync                 *TextDocumentSyncOptionsOrKind   `json:"textDocumentSync,omitempty"`
 	HoverProvider                    bool                             `json:"hoverProvider,omitempty"`
 	CompletionProvider               *CompletionOptions               `json:"completionProvider,omitempty"`
 	SignatureHelpProvider            *SignatureHelpOptions            `json:"signatureHelpProvider,omitempty"`
 	DefinitionProvider               bool                             `json:"definitionProvider,omitempty"`
+	TypeDefinitionProvider           bool                             `json:"typeDefinitionProvider,omitempty"`
 	ReferencesProvider               bool                             `json:"referencesProvider,omitempty"`
 	DocumentHighlightProvider        bool                             `json:"documentHighlightProvider,omitempty"`
 	DocumentSymbolProvider           bool                             `json:"documentSymbolProvider,omitempty"`
@@ -161,10 +238,16 @@ type ServerCapabilities struct {
 	ImplementationProvider           bool                             `json:"implementationProvider,omitempty"`
 	CodeActionProvider               bool                             `json:"codeActionProvider,omitempty"`
 	CodeLensProvider                 *CodeLensOptions                 `json:"codeLensProvider,omitempty"`
+	DocumentLinkProvider             *DocumentLinkOptions             `json:"documentLinkProvider,omitempty"`
 	DocumentFormattingProvider       bool                             `json:"documentFormattingProvider,omitempty"`
 	DocumentRangeFormattingProvider  bool                             `json:"documentRangeFormattingProvider,omitempty"`
 	DocumentOnTypeFormattingProvider *DocumentOnTypeFormattingOptions `json:"documentOnTypeFormattingProvider,omitempty"`
-	RenameProvider                   bool                             `json:"renameProvider,omitempty"`
+	RenameProvider                   *RenameOptionsOrBool             `json:"renameProvider,omitempty"`
+	FoldingRangeProvider             bool                             `json:"foldingRangeProvider,omitempty"`
+	CallHierarchyProvider            bool                             `json:"callHierarchyProvider,omitempty"`
+	SemanticTokensProvider           *SemanticTokensOptions           `json:"semanticTokensProvider,omitempty"`
+	ExecuteCommandProvider           *ExecuteCommandOptions           `json:"executeCommandProvider,omitempty"`
+	Workspace                        *WorkspaceOptions                `json:"workspace,omitempty"`
 
 	// XWorkspaceReferencesProvider indicates the server provides support for
 	// xworkspace/references. This is a Sourcegraph extension.
@@ -194,6 +277,77 @@ type CodeLensOptions struct {
 	ResolveProvider bool `json:"resolveProvider,omitempty"`
 }
 
+type DocumentLinkOptions struct {
+	ResolveProvider bool `json:"resolveProvider,omitempty"`
+}
+
+type ExecuteCommandOptions struct {
+	Commands []string `json:"commands"`
+}
+
+type WorkspaceOptions struct {
+	WorkspaceFolders *WorkspaceFoldersServerCapabilities `json:"workspaceFolders,omitempty"`
+}
+
+type WorkspaceFoldersServerCapabilities struct {
+	Supported           bool `json:"supported,omitempty"`
+	ChangeNotifications bool `json:"changeNotifications,omitempty"`
+}
+
+type SemanticTokensOptions struct {
+	Legend SemanticTokensLegend `json:"legend"`
+	Range  bool                 `json:"range,omitempty"`
+	Full   bool                 `json:"full,omitempty"`
+}
+
+type SemanticTokensLegend struct {
+	TokenTypes     []SemanticTokenType     `json:"tokenTypes"`
+	TokenModifiers []SemanticTokenModifier `json:"tokenModifiers"`
+}
+
+type RenameOptions struct {
+	PrepareProvider bool `json:"prepareProvider,omitempty"`
+}
+
+// RenameOptionsOrBool holds either a bool or RenameOptions. The LSP API
+// allows either to be specified in the (ServerCapabilities).RenameProvider
+// field, but RenameOptions may only be sent to clients which state they
+// support textDocument/prepareRename.
+type RenameOptionsOrBool struct {
+	Bool    bool
+	Options *RenameOptions
+}
+
+// MarshalJSON implements json.Marshaler.
+func (v *RenameOptionsOrBool) MarshalJSON() ([]byte, error) {
+	if v == nil {
+		return []byte("null"), nil
+	}
+	if v.Options != nil {
+		return json.Marshal(v.Options)
+	}
+	return json.Marshal(v.Bool)
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (v *RenameOptionsOrBool) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte("null")) {
+		*v = RenameOptionsOrBool{}
+		return nil
+	}
+	var b bool
+	if err := json.Unmarshal(data, &b); err == nil {
+		*v = RenameOptionsOrBool{Bool: b}
+		return nil
+	}
+	var tmp RenameOptions
+	if err := json.Unmarshal(data, &tmp); err != nil {
+		return err
+	}
+	*v = RenameOptionsOrBool{Options: &tmp}
+	return nil
+}
+
 type SignatureHelpOptions struct {
 	TriggerCharacters []string `json:"triggerCharacters,omitempty"`
 }
@@ -262,17 +416,28 @@ var completionItemKindName = map[CompletionItemKind]string{
 }
 
 type CompletionItem struct {
-	Label            string             `json:"label"`
-	Kind             CompletionItemKind `json:"kind,omitempty"`
-	Detail           string             `json:"detail,omitempty"`
-	Documentation    string             `json:"documentation,omitempty"`
-	SortText         string             `json:"sortText,omitempty"`
-	FilterText       string             `json:"filterText,omitempty"`
-	InsertText       string             `json:"insertText,omitempty"`
-	InsertTextFormat InsertTextFormat   `json:"insertTextFormat,omitempty"`
-	TextEdit         *TextEdit          `json:"textEdit,omitempty"`
-	Data             interface{}        `json:"data,omitempty"`
-}
+	Label            string              `json:"label"`
+	Kind             CompletionItemKind  `json:"kind,omitempty"`
+	Detail           string              `json:"detail,omitempty"`
+	Documentation    string              `json:"documentation,omitempty"`
+	SortText         string              `json:"sortText,omitempty"`
+	FilterText       string              `json:"filterText,omitempty"`
+	InsertText       string              `json:"insertText,omitempty"`
+	InsertTextFormat InsertTextFormat    `json:"insertTextFormat,omitempty"`
+	TextEdit         *TextEdit           `json:"textEdit,omitempty"`
+	Tags             []CompletionItemTag `json:"tags,omitempty"`
+	Data             interface{}         `json:"data,omitempty"`
+}
+
+// CompletionItemTag is extra information about a completion item which
+// changes how it is shown.
+type CompletionItemTag int
+
+const (
+	// CITDeprecated marks an item which shouldn't be used any more.
+	// Clients usually show it struck through.
+	CITDeprecated CompletionItemTag = 1
+)
 
 type CompletionList struct {
 	IsIncomplete bool             `json:"isIncomplete"`
@@ -306,6 +471,34 @@ type CompletionParams struct {
 type Hover struct {
 	Contents []MarkedString `json:"contents"`
 	Range    *Range         `json:"range,omitempty"`
+
+	// Markup, if set, is sent as the contents instead of Contents. It is
+	// only understood by clients which list its kind in their hover
+	// contentFormat capability.
+	Markup *MarkupContent `json:"-"`
+}
+
+func (h Hover) MarshalJSON() ([]byte, error) {
+	type hover Hover
+	if h.Markup == nil {
+		return json.Marshal(hover(h))
+	}
+	return json.Marshal(struct {
+		Contents *MarkupContent `json:"contents"`
+		Range    *Range         `json:"range,omitempty"`
+	}{h.Markup, h.Range})
+}
+
+type MarkupKind string
+
+const (
+	MKPlainText MarkupKind = "plaintext"
+	MKMarkdown  MarkupKind = "markdown"
+)
+
+type MarkupContent struct {
+	Kind  MarkupKind `json:"kind"`
+	Value string     `json:"value"`
 }
 
 type MarkedString markedString
@@ -458,10 +651,37 @@ var symbolKindName = map[SymbolKind]string{
 }
 
 type SymbolInformation struct {
-	Name          string     `json:"name"`
-	Kind          SymbolKind `json:"kind"`
-	Location      Location   `json:"location"`
-	ContainerName string     `json:"containerName,omitempty"`
+	Name          string      `json:"name"`
+	Kind          SymbolKind  `json:"kind"`
+	Location      Location    `json:"location"`
+	ContainerName string      `json:"containerName,omitempty"`
+	Tags          []SymbolTag `json:"tags,omitempty"`
+}
+
+// SymbolTag is extra information about a symbol which changes how it is
+// shown.
+type SymbolTag int
+
+const (
+	// STDeprecated marks a symbol which shouldn't be used any more.
+	// Clients usually show it struck through.
+	STDeprecated SymbolTag = 1
+)
+
+// DocumentSymbol represents programming constructs like variables, classes,
+// interfaces etc. that appear in a document. Document symbols can be
+// hierarchical and they have two ranges: one that encloses its definition
+// and one that points to its most interesting range, e.g. the range of an
+// identifier.
+type DocumentSymbol struct {
+	Name           string           `json:"name"`
+	Detail         string           `json:"detail,omitempty"`
+	Kind           SymbolKind       `json:"kind"`
+	Deprecated     bool             `json:"deprecated,omitempty"`
+	Tags           []SymbolTag      `json:"tags,omitempty"`
+	Range          Range            `json:"range"`
+	SelectionRange Range            `json:"selectionRange"`
+	Children       []DocumentSymbol `json:"children,omitempty"`
 }
 
 type WorkspaceSymbolParams struct {
@@ -471,6 +691,30 @@ type WorkspaceSymbolParams struct {
 
 type CodeActionContext struct {
 	Diagnostics []Diagnostic `json:"diagnostics"`
+
+	// Only, if set, restricts the code actions to these kinds and their
+	// sub-kinds.
+	Only []CodeActionKind `json:"only,omitempty"`
+}
+
+// CodeActionKind is a hierarchical, "."-separated kind of code action.
+type CodeActionKind string
+
+const (
+	CAKQuickFix              CodeActionKind = "quickfix"
+	CAKRefactor              CodeActionKind = "refactor"
+	CAKSource                CodeActionKind = "source"
+	CAKSourceOrganizeImports CodeActionKind = "source.organizeImports"
+)
+
+// CodeAction is a change which can be made in the editor, returned by
+// textDocument/codeAction to clients which support code action literals.
+type CodeAction struct {
+	Title       string         `json:"title"`
+	Kind        CodeActionKind `json:"kind,omitempty"`
+	Diagnostics []Diagnostic   `json:"diagnostics,omitempty"`
+	Edit        *WorkspaceEdit `json:"edit,omitempty"`
+	Command     *Command       `json:"command,omitempty"`
 }
 
 type CodeActionParams struct {
@@ -479,13 +723,18 @@ type CodeActionParams struct {
 	Context      CodeActionContext      `json:"context"`
 }
 
+type ExecuteCommandParams struct {
+	Command   string        `json:"command"`
+	Arguments []interface{} `json:"arguments,omitempty"`
+}
+
 type CodeLensParams struct {
 	TextDocument TextDocumentIdentifier `json:"textDocument"`
 }
 
 type CodeLens struct {
 	Range   Range       `json:"range"`
-	Command Command     `json:"command,omitempty"`
+	Command *Command    `json:"command,omitempty"`
 	Data    interface{} `json:"data,omitempty"`
 }
 
@@ -506,6 +755,98 @@ type RenameParams struct {
 	NewName      string                 `json:"newName"`
 }
 
+type FoldingRangeParams struct {
+	TextDocument TextDocumentIdentifier `json:"textDocument"`
+}
+
+type FoldingRangeKind string
+
+const (
+	FRKComment FoldingRangeKind = "comment"
+	FRKImports FoldingRangeKind = "imports"
+	FRKRegion  FoldingRangeKind = "region"
+)
+
+type FoldingRange struct {
+	StartLine int              `json:"startLine"`
+	EndLine   int              `json:"endLine"`
+	Kind      FoldingRangeKind `json:"kind,omitempty"`
+}
+
+type DocumentLinkParams struct {
+	TextDocument TextDocumentIdentifier `json:"textDocument"`
+}
+
+type DocumentLink struct {
+	Range  Range  `json:"range"`
+	Target string `json:"target,omitempty"`
+}
+
+type CallHierarchyPrepareParams struct {
+	TextDocumentPositionParams
+}
+
+type CallHierarchyItem struct {
+	Name           string      `json:"name"`
+	Kind           SymbolKind  `json:"kind"`
+	Detail         string      `json:"detail,omitempty"`
+	URI            DocumentURI `json:"uri"`
+	Range          Range       `json:"range"`
+	SelectionRange Range       `json:"selectionRange"`
+}
+
+type CallHierarchyIncomingCallsParams struct {
+	Item CallHierarchyItem `json:"item"`
+}
+
+type CallHierarchyIncomingCall struct {
+	From       CallHierarchyItem `json:"from"`
+	FromRanges []Range           `json:"fromRanges"`
+}
+
+type CallHierarchyOutgoingCallsParams struct {
+	Item CallHierarchyItem `json:"item"`
+}
+
+type CallHierarchyOutgoingCall struct {
+	To         CallHierarchyItem `json:"to"`
+	FromRanges []Range           `json:"fromRanges"`
+}
+
+type SemanticTokenType string
+
+const (
+	STTNamespace SemanticTokenType = "namespace"
+	STTType      SemanticTokenType = "type"
+	STTFunction  SemanticTokenType = "function"
+	STTMethod    SemanticTokenType = "method"
+	STTVariable  SemanticTokenType = "variable"
+	STTParameter SemanticTokenType = "parameter"
+	STTProperty  SemanticTokenType = "property"
+	STTKeyword   SemanticTokenType = "keyword"
+)
+
+type SemanticTokenModifier string
+
+const (
+	STMDeclaration SemanticTokenModifier = "declaration"
+	STMReadonly    SemanticTokenModifier = "readonly"
+	STMStatic      SemanticTokenModifier = "static"
+)
+
+type SemanticTokensParams struct {
+	TextDocument TextDocumentIdentifier `json:"textDocument"`
+}
+
+// SemanticTokens are the tokens of a document. Data holds five integers
+// for each token: its line and start character relative to the previous
+// token, its length, the index of its type in the legend and the bit set
+// of the indexes of its modifiers.
+type SemanticTokens struct {
+	ResultID string   `json:"resultId,omitempty"`
+	Data     []uint32 `json:"data"`
+}
+
 type DidOpenTextDocumentParams struct {
 	TextDocument TextDocumentItem `json:"textDocument"`
 }
@@ -516,8 +857,8 @@ type DidChangeTextDocumentParams struct {
 }
 
 type TextDocumentContentChangeEvent struct {
-	Range       *Range `json:"range,omitEmpty"`
-	RangeLength uint   `json:"rangeLength,omitEmpty"`
+	Range       *Range `json:"range,omitempty"`
+	RangeLength uint   `json:"rangeLength,omitempty"`
 	Text        string `json:"text"`
 }
 
@@ -562,6 +903,20 @@ type DidChangeConfigurationParams struct {
 	Settings interface{} `json:"settings"`
 }
 
+type WorkspaceFolder struct {
+	URI  DocumentURI `json:"uri"`
+	Name string      `json:"name"`
+}
+
+type DidChangeWorkspaceFoldersParams struct {
+	Event WorkspaceFoldersChangeEvent `json:"event"`
+}
+
+type WorkspaceFoldersChangeEvent struct {
+	Added   []WorkspaceFolder `json:"added"`
+	Removed []WorkspaceFolder `json:"removed"`
+}
+
 type FileChangeType int
 
 const (
@@ -600,3 +955,40 @@ type DocumentOnTypeFormattingParams struct {
 type CancelParams struct {
 	ID ID `json:"id"`
 }
+
+// ProgressToken identifies the progress reported by $/progress
+// notifications.
+type ProgressToken string
+
+type WorkDoneProgressCreateParams struct {
+	Token ProgressToken `json:"token"`
+}
+
+type ProgressParams struct {
+	Token ProgressToken `json:"token"`
+	Value interface{}   `json:"value"`
+}
+
+// WorkDoneProgressBegin, WorkDoneProgressReport and WorkDoneProgressEnd
+// are the values of the $/progress notifications starting, updating and
+// ending the progress of an operation. Kind is "begin", "report" and
+// "end" respectively.
+type WorkDoneProgressBegin struct {
+	Kind        string `json:"kind"`
+	Title       string `json:"title"`
+	Cancellable bool   `json:"cancellable,omitempty"`
+	Message     string `json:"message,omitempty"`
+	Percentage  *int   `json:"percentage,omitempty"`
+}
+
+type WorkDoneProgressReport struct {
+	Kind        string `json:"kind"`
+	Cancellable bool   `json:"cancellable,omitempty"`
+	Message     string `json:"message,omitempty"`
+	Percentage  *int   `json:"percentage,omitempty"`
+}
+
+type WorkDoneProgressEnd struct {
+	Kind    string `json:"kind"`
+	Message string `json:"message,omitempty"`
+}
@@ -58,6 +58,41 @@ func TestTextDocumentSyncOptionsOrKind_MarshalUnmarshalJSON(t *testing.T) {
 	}
 }
 
+func TestRenameOptionsOrBool_MarshalUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		data []byte
+		want *RenameOptionsOrBool
+	}{
+		{
+			data: []byte(`true`),
+			want: &RenameOptionsOrBool{Bool: true},
+		},
+		{
+			data: []byte(`{"prepareProvider":true}`),
+			want: &RenameOptionsOrBool{Options: &RenameOptions{PrepareProvider: true}},
+		},
+	}
+	for _, test := range tests {
+		var got RenameOptionsOrBool
+		if err := json.Unmarshal(test.data, &got); err != nil {
+			t.Error(err)
+			continue
+		}
+		if !reflect.DeepEqual(&got, test.want) {
+			t.Errorf("got %+v, want %+v", got, test.want)
+			continue
+		}
+		data, err := json.Marshal(&got)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if !bytes.Equal(data, test.data) {
+			t.Errorf("got JSON %q, want %q", data, test.data)
+		}
+	}
+}
+
 func TestMarkedString_MarshalUnmarshalJSON(t *testing.T) {
 	tests := []struct {
 		data []byte
@@ -94,3 +129,32 @@ func TestMarkedString_MarshalUnmarshalJSON(t *testing.T) {
 		}
 	}
 }
+
+func TestHover_MarshalJSON(t *testing.T) {
+	tests := []struct {
+		hover Hover
+		want  string
+	}{
+		{
+			hover: Hover{Contents: []MarkedString{{Language: "go", Value: "foo"}, RawMarkedString("bar")}},
+			want:  `{"contents":[{"language":"go","value":"foo"},"bar"]}`,
+		},
+		{
+			hover: Hover{
+				Contents: []MarkedString{{Language: "go", Value: "foo"}},
+				Markup:   &MarkupContent{Kind: MKMarkdown, Value: "```go\nfoo\n```"},
+			},
+			want: `{"contents":{"kind":"markdown","value":"` + "```go\\nfoo\\n```" + `"}}`,
+		},
+	}
+	for _, test := range tests {
+		data, err := json.Marshal(test.hover)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if string(data) != test.want {
+			t.Errorf("got JSON %s, want %s", data, test.want)
+		}
+	}
+}
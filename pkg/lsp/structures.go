@@ -29,6 +29,22 @@ type Location struct {
 	Range Range       `json:"range"`
 }
 
+// LocationLink is a link from the range of a document, such as an
+// identifier, to the location it refers to.
+type LocationLink struct {
+	// OriginSelectionRange is the range the link is from, if it isn't the
+	// word at the position requested.
+	OriginSelectionRange *Range `json:"originSelectionRange,omitempty"`
+
+	TargetURI DocumentURI `json:"targetUri"`
+
+	// TargetRange is the range of the target, such as a declaration,
+	// and TargetSelectionRange the part of it which is selected, such as
+	// the declared name.
+	TargetRange          Range `json:"targetRange"`
+	TargetSelectionRange Range `json:"targetSelectionRange"`
+}
+
 type Diagnostic struct {
 	/**
 	 * The range at which the message applies.
@@ -101,7 +117,25 @@ type WorkspaceEdit struct {
 	/**
 	 * Holds changes to existing resources.
 	 */
-	Changes map[string][]TextEdit `json:"changes"`
+	Changes map[string][]TextEdit `json:"changes,omitempty"`
+
+	/**
+	 * Holds changes to versioned documents, for clients which support
+	 * them. Used instead of Changes.
+	 */
+	DocumentChanges []TextDocumentEdit `json:"documentChanges,omitempty"`
+}
+
+type TextDocumentEdit struct {
+	/**
+	 * The text document to change, and the version it was computed for.
+	 */
+	TextDocument VersionedTextDocumentIdentifier `json:"textDocument"`
+
+	/**
+	 * The edits to be applied.
+	 */
+	Edits []TextEdit `json:"edits"`
 }
 
 type TextDocumentIdentifier struct {
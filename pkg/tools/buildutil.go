@@ -17,7 +17,9 @@ import (
 // looks at all directories under GOPATH if there is a `...` pattern. This
 // instead only explores the directories under dir. In future
 // buildutil.ExpandPattern may be more performant (there are TODOs for it).
-func ListPkgsUnderDir(ctxt *build.Context, dir string) []string {
+// The directories for which skip returns true aren't explored, unless skip
+// is nil.
+func ListPkgsUnderDir(ctxt *build.Context, dir string, skip func(dir string) bool) []string {
 	ch := make(chan string)
 
 	var wg sync.WaitGroup
@@ -25,7 +27,7 @@ func ListPkgsUnderDir(ctxt *build.Context, dir string) []string {
 		root := root
 		wg.Add(1)
 		go func() {
-			allPackages(ctxt, root, dir, ch)
+			allPackages(ctxt, root, dir, skip, ch)
 			wg.Done()
 		}()
 	}
@@ -49,7 +51,7 @@ var ioLimit = make(chan bool, 20)
 // allPackages is from tools/go/buildutil. We don't use the exported method
 // since it doesn't allow searching from a directory. We need from a specific
 // directory for performance on large GOPATHs.
-func allPackages(ctxt *build.Context, root, start string, ch chan<- string) {
+func allPackages(ctxt *build.Context, root, start string, skip func(dir string) bool, ch chan<- string) {
 	root = path.Clean(root)
 	start = path.Clean(start)
 
@@ -73,6 +75,9 @@ func allPackages(ctxt *build.Context, root, start string, ch chan<- string) {
 		if base == "" || base[0] == '.' || base[0] == '_' || base == "testdata" {
 			return
 		}
+		if skip != nil && skip(dir) {
+			return
+		}
 
 		pkg := util.PathTrimPrefix(dir, root)
 
@@ -20,11 +20,12 @@ type FindPackageFunc func(ctxt *build.Context, fromDir, importPath string, mode
 // * it only returns the reverse graph
 // * it does not return errors
 // * it uses a custom FindPackageFunc
-// * it only searches pkgs under dir (but graph can contain pkgs outside of dir)
+// * it only searches pkgs under dir (but graph can contain pkgs outside of dir),
+//   skipping the directories skip returns true for, as ListPkgsUnderDir does
 // * it searches xtest pkgs as well
 //
 // The code is adapted from the original function.
-func BuildReverseImportGraph(ctxt *build.Context, findPackage FindPackageFunc, dir string) importgraph.Graph {
+func BuildReverseImportGraph(ctxt *build.Context, findPackage FindPackageFunc, dir string, skip func(dir string) bool) importgraph.Graph {
 	type importEdge struct {
 		from, to string
 	}
@@ -34,7 +35,7 @@ func BuildReverseImportGraph(ctxt *build.Context, findPackage FindPackageFunc, d
 	go func() {
 		sema := make(chan int, 20) // I/O concurrency limiting semaphore
 		var wg sync.WaitGroup
-		for _, path := range ListPkgsUnderDir(ctxt, dir) {
+		for _, path := range ListPkgsUnderDir(ctxt, dir, skip) {
 			wg.Add(1)
 			go func(path string) {
 				defer wg.Done()